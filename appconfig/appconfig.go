@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/google/go-github/v53/github"
+	ttlcache "github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
@@ -35,6 +36,10 @@ import (
 // non-nil error if b encodes an invalid RemoteRef.
 type RemoteRefParser func(path string, b []byte) (*RemoteRef, error)
 
+// MergeFunc combines base and overlay configuration into a single
+// configuration. Values in overlay take precedence over values in base.
+type MergeFunc func(base, overlay []byte) ([]byte, error)
+
 // RemoteRef identifies a configuration file in a different repository.
 type RemoteRef struct {
 	// The repository in "owner/name" format. Required.
@@ -66,6 +71,17 @@ type Config struct {
 	Source   string
 	Path     string
 	IsRemote bool
+
+	// IsOwnerDefault is true if the repository did not define configuration
+	// and the Config was loaded from the owner's default repository instead.
+	// If the default is a remote reference, both IsOwnerDefault and IsRemote
+	// are true and Source is the target of the reference.
+	IsOwnerDefault bool
+
+	// Base is the owner default configuration that was merged with the
+	// repository configuration to produce Content. It is nil unless the
+	// Loader has a MergeFunc and both configurations exist.
+	Base *Config
 }
 
 // IsUndefined returns true if the Config's content is empty and there is no
@@ -81,6 +97,9 @@ type Loader struct {
 	parser       RemoteRefParser
 	defaultRepo  string
 	defaultPaths []string
+	merge        MergeFunc
+
+	cache *ttlcache.Cache
 }
 
 // NewLoader creates a Loader that loads configuration from paths.
@@ -108,11 +127,76 @@ func NewLoader(paths []string, opts ...Option) *Loader {
 // the Loader's paths in order, following remote references if they exist. If
 // no configuration exists at any path in the repository, it tries to load
 // default configuration defined by owner for all repositories. If no default
-// configuration exists, it returns an undefined Config and a nil error.
+// configuration exists, it returns an undefined Config and a nil error. If the
+// Loader has a MergeFunc and both the repository and owner define
+// configuration, the content is the result of merging the two and the Base
+// field of the Config describes the owner default.
 //
 // If error is non-nil, the Source and Path fields of the returned Config tell
-// which file LoadConfig was processing when it encountered the error.
+// which file LoadConfig was processing when it encountered the error. Missing
+// files never produce errors, so a non-nil error means the configuration could
+// not be read, for example because of a network failure.
+//
+// If caching is enabled and ref is a commit SHA, successful results are cached.
 func (ld *Loader) LoadConfig(ctx context.Context, client *github.Client, owner, repo, ref string) (Config, error) {
+	if ld.cache == nil || !isCommitSHA(ref) {
+		return ld.loadConfig(ctx, client, owner, repo, ref)
+	}
+
+	key := strings.ToLower(fmt.Sprintf("%s%s/%s@%s", client.BaseURL, owner, repo, ref))
+	if c, ok := ld.cache.Get(key); ok {
+		zerolog.Ctx(ctx).Debug().Msgf("Using cached configuration for %s/%s@%s", owner, repo, ref)
+		return c.(Config), nil
+	}
+
+	c, err := ld.loadConfig(ctx, client, owner, repo, ref)
+	if err == nil {
+		ld.cache.Set(key, c, ttlcache.DefaultExpiration)
+	}
+	return c, err
+}
+
+func (ld *Loader) loadConfig(ctx context.Context, client *github.Client, owner, repo, ref string) (Config, error) {
+	c, err := ld.loadRepoConfig(ctx, client, owner, repo, ref)
+	if err != nil {
+		return c, err
+	}
+
+	// owner defaults are disabled, so use the repository configuration as is
+	if ld.defaultRepo == "" || len(ld.defaultPaths) == 0 {
+		return c, nil
+	}
+
+	// if the repository defined no configuration, try falling back to the
+	// defaults
+	if c.IsUndefined() {
+		return ld.loadDefaultConfig(ctx, client, owner)
+	}
+
+	// the default repository's own configuration has nothing to merge with
+	if ld.merge == nil || strings.EqualFold(repo, ld.defaultRepo) {
+		return c, nil
+	}
+
+	base, err := ld.loadDefaultConfig(ctx, client, owner)
+	if err != nil {
+		return base, err
+	}
+	if base.IsUndefined() {
+		return c, nil
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Merging configuration from %s with default configuration from %s", c.Source, base.Source)
+	content, err := ld.merge(base.Content, c.Content)
+	if err != nil {
+		return c, errors.Wrap(err, "failed to merge configuration")
+	}
+	c.Content = content
+	c.Base = &base
+	return c, nil
+}
+
+func (ld *Loader) loadRepoConfig(ctx context.Context, client *github.Client, owner, repo, ref string) (Config, error) {
 	logger := zerolog.Ctx(ctx)
 
 	c := Config{
@@ -149,13 +233,8 @@ func (ld *Loader) LoadConfig(ctx context.Context, client *github.Client, owner,
 		return c, nil
 	}
 
-	// if the repository defined no configuration and org defaults are enabled,
-	// try falling back to the defaults
-	if ld.defaultRepo != "" && len(ld.defaultPaths) > 0 {
-		return ld.loadDefaultConfig(ctx, client, owner)
-	}
-
-	// couldn't find configuration anyhere, so return an empty/undefined one
+	// couldn't find configuration in the repository, so return an
+	// empty/undefined one
 	return Config{}, nil
 }
 
@@ -221,13 +300,14 @@ func (ld *Loader) loadDefaultConfig(ctx context.Context, client *github.Client,
 			// if the owner has no default repo, return empty/undefined config
 			return Config{}, nil
 		}
-		c := Config{Source: fmt.Sprintf("%s/%s", owner, ld.defaultRepo)}
+		c := Config{Source: fmt.Sprintf("%s/%s", owner, ld.defaultRepo), IsOwnerDefault: true}
 		return c, errors.Wrap(err, "failed to get default repository")
 	}
 
 	ref := r.GetDefaultBranch()
 	c := Config{
-		Source: fmt.Sprintf("%s/%s@%s", owner, r.GetName(), ref),
+		Source:         fmt.Sprintf("%s/%s@%s", owner, r.GetName(), ref),
+		IsOwnerDefault: true,
 	}
 
 	for _, p := range ld.defaultPaths {
@@ -267,31 +347,39 @@ func (ld *Loader) loadDefaultConfig(ctx context.Context, client *github.Client,
 // getFileContents returns the content of the file at path on ref in owner/repo
 // if it exists. Returns an empty slice and false if the file does not exist.
 func getFileContents(ctx context.Context, client *github.Client, owner, repo, ref, path string) ([]byte, bool, error) {
+	content, _, exists, err := getFile(ctx, client, owner, repo, ref, path)
+	return content, exists, err
+}
+
+// getFile is like getFileContents, but also returns the SHA of the file's
+// content. The SHA is empty if the file is too large to read with the
+// contents API.
+func getFile(ctx context.Context, client *github.Client, owner, repo, ref, path string) ([]byte, string, bool, error) {
 	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{
 		Ref: ref,
 	})
 	if err != nil {
 		switch {
 		case isNotFound(err):
-			return nil, false, nil
+			return nil, "", false, nil
 		case isTooLargeError(err):
 			b, err := getLargeFileContents(ctx, client, owner, repo, ref, path)
-			return b, true, err
+			return b, "", true, err
 		}
-		return nil, false, errors.Wrap(err, "failed to read file")
+		return nil, "", false, errors.Wrap(err, "failed to read file")
 	}
 
 	// file will be nil if the path exists but is a directory
 	if file == nil {
-		return nil, false, nil
+		return nil, "", false, nil
 	}
 
 	content, err := file.GetContent()
 	if err != nil {
-		return nil, true, errors.Wrap(err, "failed to decode file content")
+		return nil, "", true, errors.Wrap(err, "failed to decode file content")
 	}
 
-	return []byte(content), true, nil
+	return []byte(content), file.GetSHA(), true, nil
 }
 
 // getLargeFileContents is similar to getFileContents, but works for files up
@@ -319,6 +407,18 @@ func getLargeFileContents(ctx context.Context, client *github.Client, owner, rep
 	return b, nil
 }
 
+func isCommitSHA(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
 func isNotFound(err error) bool {
 	if rerr, ok := err.(*github.ErrorResponse); ok {
 		return rerr.Response.StatusCode == http.StatusNotFound
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v53/github"
 )
@@ -91,6 +92,8 @@ func TestLoadConfig(t *testing.T) {
 				Content: []byte("message: hello\n"),
 				Source:  "test/.github@develop",
 				Path:    "test-app.yml",
+
+				IsOwnerDefault: true,
 			},
 		},
 		"defaultConfigRemoteReference": {
@@ -104,8 +107,73 @@ func TestLoadConfig(t *testing.T) {
 				Source:   "remote/config@develop",
 				Path:     "config/test-app.yml",
 				IsRemote: true,
+
+				IsOwnerDefault: true,
+			},
+		},
+		"orgFallback": {
+			Paths: []string{".github/test-app.yml"},
+			Options: []Option{
+				WithOrgFallback(".github"),
+			},
+			Repo: "default-config",
+			Expected: Config{
+				Content: []byte("message: hello\n"),
+				Source:  "test/.github@develop",
+				Path:    ".github/test-app.yml",
+
+				IsOwnerDefault: true,
+			},
+		},
+		"orgFallbackLocalFile": {
+			Paths: []string{".github/test-app.yml"},
+			Options: []Option{
+				WithOrgFallback(".github"),
+			},
+			Repo: "local-file",
+			Expected: Config{
+				Content: []byte("message: hello\n"),
+				Source:  "test/local-file@develop",
+				Path:    ".github/test-app.yml",
 			},
 		},
+		"mergedConfig": {
+			Paths: []string{".github/test-app.yml"},
+			Options: []Option{
+				WithMerge(YAMLMerge),
+			},
+			Repo: "merged-config",
+			Expected: Config{
+				Content: []byte("message: hello\nextra: true\n"),
+				Source:  "test/merged-config@develop",
+				Path:    ".github/test-app.yml",
+				Base: &Config{
+					Source: "test/.github@develop",
+					Path:   "test-app.yml",
+				},
+			},
+		},
+		"mergedConfigWithoutDefault": {
+			Paths: []string{".github/test-app.yml"},
+			Options: []Option{
+				WithOwnerDefault(".github-missing", []string{"test-app.yml"}),
+				WithMerge(YAMLMerge),
+			},
+			Repo: "local-file",
+			Expected: Config{
+				Content: []byte("message: hello\n"),
+				Source:  "test/local-file@develop",
+				Path:    ".github/test-app.yml",
+			},
+		},
+		"orgFallbackMissing": {
+			Paths: []string{".github/test-app.v2.yml"},
+			Options: []Option{
+				WithOrgFallback(".github"),
+			},
+			Repo:     "local-file",
+			Expected: Config{},
+		},
 	}
 
 	ctx := context.Background()
@@ -135,14 +203,110 @@ func TestLoadConfig(t *testing.T) {
 			if test.Expected.IsRemote != cfg.IsRemote {
 				t.Errorf("incorrect remote flag: expected: %t, actual: %t", test.Expected.IsRemote, cfg.IsRemote)
 			}
+			if test.Expected.IsOwnerDefault != cfg.IsOwnerDefault {
+				t.Errorf("incorrect owner default flag: expected: %t, actual: %t", test.Expected.IsOwnerDefault, cfg.IsOwnerDefault)
+			}
 			if !bytes.Equal(test.Expected.Content, cfg.Content) {
 				t.Errorf("incorrect content\nexpected: %s\n  actual: %s", test.Expected.Content, cfg.Content)
 			}
+			switch {
+			case test.Expected.Base == nil && cfg.Base != nil:
+				t.Errorf("expected nil base, but got: %s", cfg.Base.Source)
+			case test.Expected.Base != nil && cfg.Base == nil:
+				t.Errorf("expected base %s, but got nil", test.Expected.Base.Source)
+			case test.Expected.Base != nil && cfg.Base != nil:
+				if test.Expected.Base.Source != cfg.Base.Source || test.Expected.Base.Path != cfg.Base.Path {
+					t.Errorf("incorrect base: expected: %s:%s, actual: %s:%s", test.Expected.Base.Source, test.Expected.Base.Path, cfg.Base.Source, cfg.Base.Path)
+				}
+			}
 		})
 	}
 }
 
+func TestLoadConfigCache(t *testing.T) {
+	tests := map[string]struct {
+		Ref      string
+		Requests int
+	}{
+		"commitSHA": {
+			Ref:      "4a5d1e3f1f1b6a0e3c2a9c8f8d3b1a7e6c5d4b3a",
+			Requests: 1,
+		},
+		"branch": {
+			Ref:      TestRef,
+			Requests: 2,
+		},
+	}
+
+	ctx := context.Background()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rp := makeTestResponsePlayer()
+			client := github.NewClient(&http.Client{Transport: rp})
+			ld := NewLoader([]string{".github/test-app.yml"}, WithCache(time.Minute))
+
+			for i := 0; i < 2; i++ {
+				cfg, err := ld.LoadConfig(ctx, client, TestOwner, "local-file", test.Ref)
+				if err != nil {
+					t.Fatalf("unexpected error loading config: %v", err)
+				}
+				if !bytes.Equal([]byte("message: hello\n"), cfg.Content) {
+					t.Errorf("incorrect content: %s", cfg.Content)
+				}
+			}
+
+			var requests int
+			for _, rule := range rp.Rules {
+				if rule.Matcher == ExactPathMatcher("/repos/test/local-file/contents/.github/test-app.yml") {
+					requests = rule.Count
+				}
+			}
+			if requests != test.Requests {
+				t.Errorf("incorrect request count: expected %d, actual %d", test.Requests, requests)
+			}
+		})
+	}
+}
+
+func TestLoadTyped(t *testing.T) {
+	type AppConfig struct {
+		Message string `yaml:"message"`
+		Extra   bool   `yaml:"extra"`
+	}
+
+	ctx := context.Background()
+	client := makeTestClient()
+	ld := NewLoader([]string{".github/test-app.yml"}, WithMerge(YAMLMerge))
+
+	v, c, err := LoadTyped[AppConfig](ctx, ld, client, TestOwner, "merged-config", TestRef)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+	if v.Message != "hello" || !v.Extra {
+		t.Errorf("incorrect config: %+v", v)
+	}
+	if c.Source != "test/merged-config@develop" {
+		t.Errorf("incorrect source: %q", c.Source)
+	}
+
+	v, c, err = LoadTyped[AppConfig](ctx, NewLoader([]string{".github/test-app.v2.yml"}, WithOwnerDefault("", nil)), client, TestOwner, "local-file", TestRef)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+	if !c.IsUndefined() {
+		t.Errorf("expected undefined config, but got: %+v", c)
+	}
+	if v != (AppConfig{}) {
+		t.Errorf("expected zero config, but got: %+v", v)
+	}
+}
+
 func makeTestClient() *github.Client {
+	return github.NewClient(&http.Client{Transport: makeTestResponsePlayer()})
+}
+
+func makeTestResponsePlayer() *ResponsePlayer {
 	rp := &ResponsePlayer{}
 	for route, f := range map[string]string{
 		"/repos/test/local-file/contents/.github/test-app.yml":    "local-file-contents.yml",
@@ -161,11 +325,17 @@ func makeTestClient() *github.Client {
 		"/repos/test/.github":                       "dot-github.yml",
 		"/repos/test/.github/contents/test-app.yml": "dot-github-contents.yml",
 
+		"/repos/test/.github/contents/.github/test-app.yml":    "dot-github-contents.yml",
+		"/repos/test/.github/contents/.github/test-app.v2.yml": "404.yml",
+
+		"/repos/test/merged-config/contents/.github/test-app.yml": "merged-config-contents.yml",
+		"/repos/test/.github-missing":                             "404.yml",
+
 		"/repos/test/default-config-remote-ref/contents/.github-remote/test-app.yml": "404.yml",
 		"/repos/test/.github-remote":               "remote-config.yml",
 		"/repos/test/config/contents/test-app.yml": "remote-ref-contents.yml",
 	} {
 		rp.AddRule(ExactPathMatcher(route), filepath.Join("testdata", f))
 	}
-	return github.NewClient(&http.Client{Transport: rp})
+	return rp
 }
@@ -14,6 +14,12 @@
 
 package appconfig
 
+import (
+	"time"
+
+	ttlcache "github.com/patrickmn/go-cache"
+)
+
 type Option func(*Loader)
 
 // WithRemoteRefParser sets the parser for encoded RemoteRefs. The default
@@ -36,6 +42,41 @@ func WithOwnerDefault(name string, paths []string) Option {
 	}
 }
 
+// WithOrgFallback sets the owner repository to check when a repository does
+// not define its own configuration, using the same paths as the repository.
+// For example, if the loader's path is ".github/app.yml", the fallback is
+// ".github/app.yml" in owner/name. This matches how GitHub finds community
+// health files, like ".github/CODEOWNERS", in an organization's ".github"
+// repository. Use WithOwnerDefault to use different paths in the owner
+// repository.
+func WithOrgFallback(name string) Option {
+	return func(ld *Loader) {
+		ld.defaultRepo = name
+		ld.defaultPaths = ld.paths
+	}
+}
+
+// WithMerge enables layered configuration. If both a repository and its
+// owner define configuration, the loader combines them with merge, passing
+// the owner default as the base and the repository configuration as the
+// overlay. Use YAMLMerge for YAML configuration. By default, the repository
+// configuration replaces the owner default.
+func WithMerge(merge MergeFunc) Option {
+	return func(ld *Loader) {
+		ld.merge = merge
+	}
+}
+
+// WithCache enables caching of loaded configuration for expiry. Only loads
+// at a full commit SHA are cached, as the content at a SHA never changes.
+// Loads at branches or tags always read from GitHub. The expiry bounds how
+// long changes to remote references and owner defaults take to be visible.
+func WithCache(expiry time.Duration) Option {
+	return func(ld *Loader) {
+		ld.cache = ttlcache.New(expiry, 2*expiry)
+	}
+}
+
 /*
 
 Not sure this is valuable yet, but leaving this option function as a starting
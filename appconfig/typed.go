@@ -0,0 +1,199 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultTypedCacheSize is the number of decoded values stored by
+	// LoadConfig and LoadConfigAt.
+	DefaultTypedCacheSize = 1000
+
+	// DefaultTypedCacheExpiry is how long LoadConfig and LoadConfigAt return
+	// a cached value for a file at a branch, a tag, or the default branch
+	// without fetching the file again. Values for files at a commit SHA do
+	// not expire, as the content at a SHA never changes.
+	DefaultTypedCacheExpiry = time.Minute
+)
+
+// ErrConfigNotFound is returned by LoadConfig when the configuration file
+// does not exist. Use errors.Is to test for it, as the error may be wrapped.
+var ErrConfigNotFound = errors.New("configuration file not found")
+
+// Decoder decodes configuration content into v, which is a pointer.
+type Decoder func(b []byte, v interface{}) error
+
+// registeredDecoder is a Decoder with an ID that is unique to each call to
+// RegisterDecoder, so that cached values are not reused after a decoder is
+// replaced.
+type registeredDecoder struct {
+	decode Decoder
+	id     uint64
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoderIDs uint64
+	decoders   = map[string]registeredDecoder{
+		".yml":  {decode: yaml.Unmarshal},
+		".yaml": {decode: yaml.Unmarshal},
+		".json": {decode: json.Unmarshal},
+	}
+
+	// typedCache stores decoded values by type, decoder, and content SHA.
+	// New only fails if the size is not positive.
+	typedCache, _ = lru.New(DefaultTypedCacheSize)
+
+	// typedRefCache stores decoded values by client, type, decoder, and file
+	// location so that repeated loads do not fetch the file. Values are keyed
+	// by client so that a value is only returned to callers that use the
+	// same credentials as the load that fetched it.
+	typedRefCache, _ = lru.New(DefaultTypedCacheSize)
+)
+
+// RegisterDecoder sets the Decoder used by LoadConfig for files with the
+// extension ext, like ".toml". It replaces any existing decoder for the
+// extension, including the defaults for ".yml", ".yaml", and ".json".
+// Extensions are not case-sensitive.
+func RegisterDecoder(ext string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoderIDs++
+	decoders[strings.ToLower(ext)] = registeredDecoder{decode: d, id: decoderIDs}
+}
+
+type typedCacheKey struct {
+	typ     reflect.Type
+	decoder uint64
+	sha     string
+}
+
+type typedRefKey struct {
+	client  *github.Client
+	typ     reflect.Type
+	decoder uint64
+	owner   string
+	repo    string
+	ref     string
+	path    string
+}
+
+type typedRefEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func decoderFor(p string) (registeredDecoder, bool) {
+	ext := strings.ToLower(path.Ext(p))
+
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	d, ok := decoders[ext]
+	return d, ok
+}
+
+// LoadConfig reads the file at path on the default branch of owner/repo and
+// decodes it into a value of type T. It is equivalent to calling LoadConfigAt
+// with an empty ref.
+func LoadConfig[T any](ctx context.Context, client *github.Client, owner, repo, path string) (T, error) {
+	return LoadConfigAt[T](ctx, client, owner, repo, "", path)
+}
+
+// LoadConfigAt reads the file at path and ref in owner/repo and decodes it
+// into a value of type T, using the Decoder registered for the file's
+// extension. If ref is empty, the file is read from the default branch. It
+// returns an error wrapping ErrConfigNotFound if the file does not exist.
+//
+// Decoded values are cached, so repeated loads of the same file with the same
+// client do not fetch it again: values for a commit SHA are kept until they are evicted from the
+// cache, and values for other refs are kept for DefaultTypedCacheExpiry. When
+// a value expires, the file is fetched again, but is only decoded again if
+// its content changed. Handlers that know the commit of an event should pass
+// it as ref to avoid both requests and stale values. Loads with a different
+// client always fetch the file, so one app or installation never receives a
+// value it cannot read itself; use a caching ClientCreator to reuse clients
+// and their cached values across events.
+//
+// Cached values are returned to every caller that loads the same file, so a
+// value of type T must be treated as read-only: changing a map, a slice, or
+// a value behind a pointer in it changes the value seen by other callers.
+// Copy the value before modifying it. Unlike a Loader, LoadConfigAt does not
+// follow remote references or fall back to owner defaults.
+func LoadConfigAt[T any](ctx context.Context, client *github.Client, owner, repo, ref, path string) (T, error) {
+	var v T
+
+	decoder, ok := decoderFor(path)
+	if !ok {
+		return v, errors.Errorf("no decoder for configuration file %s", path)
+	}
+
+	typ := reflect.TypeOf(&v).Elem()
+	refKey := typedRefKey{
+		client:  client,
+		typ:     typ,
+		decoder: decoder.id,
+		owner:   strings.ToLower(owner),
+		repo:    strings.ToLower(repo),
+		ref:     ref,
+		path:    path,
+	}
+	if cached, ok := typedRefCache.Get(refKey); ok {
+		entry := cached.(typedRefEntry)
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			return entry.value.(T), nil
+		}
+		typedRefCache.Remove(refKey)
+	}
+
+	content, sha, exists, err := getFile(ctx, client, owner, repo, ref, path)
+	if err != nil {
+		return v, err
+	}
+	if !exists {
+		return v, errors.Wrapf(ErrConfigNotFound, "%s in %s/%s", path, owner, repo)
+	}
+
+	key := typedCacheKey{typ: typ, decoder: decoder.id, sha: sha}
+	if cached, ok := typedCache.Get(key); ok && sha != "" {
+		v = cached.(T)
+	} else {
+		if err := decoder.decode(content, &v); err != nil {
+			return v, errors.Wrapf(err, "failed to parse configuration %s in %s/%s", path, owner, repo)
+		}
+		if sha != "" {
+			typedCache.Add(key, v)
+		}
+	}
+
+	entry := typedRefEntry{value: v}
+	if !isCommitSHA(ref) {
+		entry.expires = time.Now().Add(DefaultTypedCacheExpiry)
+	}
+	typedRefCache.Add(refKey, entry)
+	return v, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestLoadConfigTyped(t *testing.T) {
+	type AppConfig struct {
+		Message string `yaml:"message" json:"message"`
+	}
+
+	tests := map[string]struct {
+		Path     string
+		Expected AppConfig
+		NotFound bool
+		Error    bool
+	}{
+		"yaml": {
+			Path:     "app.yml",
+			Expected: AppConfig{Message: "hello"},
+		},
+		"json": {
+			Path:     "app.json",
+			Expected: AppConfig{Message: "hello"},
+		},
+		"notFound": {
+			Path:     "missing.yml",
+			NotFound: true,
+			Error:    true,
+		},
+		"unknownExtension": {
+			Path:  "app.ini",
+			Error: true,
+		},
+	}
+
+	ctx := context.Background()
+	client := github.NewClient(&http.Client{Transport: makeTypedTestResponsePlayer()})
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := LoadConfig[AppConfig](ctx, client, TestOwner, "typed", test.Path)
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error loading config, but got nil")
+				}
+				if test.NotFound != errors.Is(err, ErrConfigNotFound) {
+					t.Errorf("incorrect not found error: expected %t, actual: %v", test.NotFound, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error loading config: %v", err)
+			}
+			if cfg != test.Expected {
+				t.Errorf("incorrect config: expected %+v, actual %+v", test.Expected, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTypedCache(t *testing.T) {
+	var decodes int
+	RegisterDecoder(".count", func(b []byte, v interface{}) error {
+		decodes++
+		*(v.(*string)) = string(b)
+		return nil
+	})
+
+	ctx := context.Background()
+	rp := makeTypedTestResponsePlayer()
+	client := github.NewClient(&http.Client{Transport: rp})
+
+	tests := []struct {
+		Expire   bool
+		Expected string
+		Fetches  int
+		Decodes  int
+	}{
+		{Expected: "one", Fetches: 1, Decodes: 1},
+		{Expected: "one", Fetches: 1, Decodes: 1},
+		{Expire: true, Expected: "one", Fetches: 2, Decodes: 1},
+		{Expire: true, Expected: "two", Fetches: 3, Decodes: 2},
+	}
+
+	for i, test := range tests {
+		if test.Expire {
+			typedRefCache.Purge()
+		}
+
+		cfg, err := LoadConfig[string](ctx, client, TestOwner, "typed", "app.count")
+		if err != nil {
+			t.Fatalf("unexpected error loading config: %v", err)
+		}
+		if cfg != test.Expected {
+			t.Errorf("incorrect config in load %d: expected %q, actual %q", i, test.Expected, cfg)
+		}
+		if n := typedRequestCount(rp, "app.count"); n != test.Fetches {
+			t.Errorf("incorrect request count after load %d: expected %d, actual %d", i, test.Fetches, n)
+		}
+		if decodes != test.Decodes {
+			t.Errorf("incorrect number of decodes after load %d: expected %d, actual %d", i, test.Decodes, decodes)
+		}
+	}
+
+	// replacing the decoder invalidates cached values
+	RegisterDecoder(".count", func(b []byte, v interface{}) error {
+		*(v.(*string)) = strings.ToUpper(string(b))
+		return nil
+	})
+
+	cfg, err := LoadConfig[string](ctx, client, TestOwner, "typed", "app.count")
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+	if cfg != "ONE" {
+		t.Errorf("incorrect config after replacing decoder: expected %q, actual %q", "ONE", cfg)
+	}
+}
+
+func TestLoadConfigAtCommit(t *testing.T) {
+	type AppConfig struct {
+		Message string `yaml:"message"`
+	}
+
+	typedRefCache.Purge()
+
+	ctx := context.Background()
+	rp := makeTypedTestResponsePlayer()
+	client := github.NewClient(&http.Client{Transport: rp})
+
+	const sha = "8f3a1c5e7b9d2f4a6c8e0b1d3f5a7c9e2b4d6f80"
+	for i := 0; i < 2; i++ {
+		cfg, err := LoadConfigAt[AppConfig](ctx, client, TestOwner, "typed", sha, "app.yml")
+		if err != nil {
+			t.Fatalf("unexpected error loading config: %v", err)
+		}
+		if cfg.Message != "hello" {
+			t.Errorf("incorrect config: %+v", cfg)
+		}
+	}
+
+	if n := typedRequestCount(rp, "app.yml"); n != 1 {
+		t.Errorf("incorrect request count: expected 1, actual %d", n)
+	}
+	if entry, ok := typedRefCache.Get(typedRefKey{
+		client:  client,
+		typ:     reflect.TypeOf(AppConfig{}),
+		decoder: decoders[".yml"].id,
+		owner:   TestOwner,
+		repo:    "typed",
+		ref:     sha,
+		path:    "app.yml",
+	}); !ok || !entry.(typedRefEntry).expires.IsZero() {
+		t.Errorf("value at commit SHA was not cached without expiry: %+v", entry)
+	}
+
+	// cached values are not shared with other clients, which may not have
+	// access to the repository
+	other := github.NewClient(&http.Client{Transport: rp})
+	if _, err := LoadConfigAt[AppConfig](ctx, other, TestOwner, "typed", sha, "app.yml"); err != nil {
+		t.Fatalf("unexpected error loading config with another client: %v", err)
+	}
+	if n := typedRequestCount(rp, "app.yml"); n != 2 {
+		t.Errorf("incorrect request count with another client: expected 2, actual %d", n)
+	}
+}
+
+func typedRequestCount(rp *ResponsePlayer, file string) int {
+	for _, rule := range rp.Rules {
+		if rule.Matcher == ExactPathMatcher("/repos/test/typed/contents/"+file) {
+			return rule.Count
+		}
+	}
+	return 0
+}
+
+func makeTypedTestResponsePlayer() *ResponsePlayer {
+	rp := &ResponsePlayer{}
+	for route, f := range map[string]string{
+		"/repos/test/typed/contents/app.yml":     "typed-yaml-contents.yml",
+		"/repos/test/typed/contents/app.json":    "typed-json-contents.yml",
+		"/repos/test/typed/contents/app.count":   "typed-count-contents.yml",
+		"/repos/test/typed/contents/missing.yml": "404.yml",
+	} {
+		rp.AddRule(ExactPathMatcher(route), filepath.Join("testdata", f))
+	}
+	return rp
+}
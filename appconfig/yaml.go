@@ -15,8 +15,11 @@
 package appconfig
 
 import (
-	"errors"
+	"context"
+	"fmt"
 
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
@@ -47,3 +50,72 @@ func YAMLRemoteRefParser(path string, b []byte) (*RemoteRef, error) {
 	}
 	return &ref, nil
 }
+
+// YAMLMerge is a MergeFunc for YAML configuration. Both base and overlay must
+// contain a YAML mapping or be empty. Mappings merge recursively, with keys
+// from overlay replacing keys from base. All other values, including
+// sequences, in overlay replace the values in base. The result preserves the
+// key order of base, followed by new keys from overlay. Comments are not
+// preserved.
+func YAMLMerge(base, overlay []byte) ([]byte, error) {
+	var b, o yaml.MapSlice
+	if err := yaml.Unmarshal(base, &b); err != nil {
+		return nil, errors.Wrap(err, "failed to parse base configuration")
+	}
+	if err := yaml.Unmarshal(overlay, &o); err != nil {
+		return nil, errors.Wrap(err, "failed to parse overlay configuration")
+	}
+	return yaml.Marshal(mergeMapSlices(b, o))
+}
+
+func mergeMapSlices(base, overlay yaml.MapSlice) yaml.MapSlice {
+	merged := make(yaml.MapSlice, len(base), len(base)+len(overlay))
+	copy(merged, base)
+
+	index := make(map[string]int, len(base))
+	for i, item := range merged {
+		index[mapKey(item.Key)] = i
+	}
+
+	for _, item := range overlay {
+		i, ok := index[mapKey(item.Key)]
+		if !ok {
+			index[mapKey(item.Key)] = len(merged)
+			merged = append(merged, item)
+			continue
+		}
+
+		baseValue, baseIsMap := merged[i].Value.(yaml.MapSlice)
+		overlayValue, overlayIsMap := item.Value.(yaml.MapSlice)
+		if baseIsMap && overlayIsMap {
+			merged[i].Value = mergeMapSlices(baseValue, overlayValue)
+		} else {
+			merged[i].Value = item.Value
+		}
+	}
+	return merged
+}
+
+// mapKey returns a comparable representation of a YAML key, which may be any
+// value, including values that are not comparable in Go.
+func mapKey(k interface{}) string {
+	return fmt.Sprintf("%T:%v", k, k)
+}
+
+// LoadTyped loads configuration for the repository owner/repo using ld and
+// decodes the YAML content into a value of type T. It returns the zero value
+// of T if the configuration is undefined. The returned Config describes where
+// the configuration was found, as with LoadConfig.
+func LoadTyped[T any](ctx context.Context, ld *Loader, client *github.Client, owner, repo, ref string) (T, Config, error) {
+	var v T
+
+	c, err := ld.LoadConfig(ctx, client, owner, repo, ref)
+	if err != nil || c.IsUndefined() {
+		return v, c, err
+	}
+
+	if err := yaml.Unmarshal(c.Content, &v); err != nil {
+		return v, c, errors.Wrapf(err, "failed to parse configuration at %s in %s", c.Path, c.Source)
+	}
+	return v, c, nil
+}
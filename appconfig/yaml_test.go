@@ -98,3 +98,76 @@ func TestYAMLRemoteRefParser(t *testing.T) {
 		})
 	}
 }
+
+func TestYAMLMerge(t *testing.T) {
+	tests := map[string]struct {
+		Base    string
+		Overlay string
+		Output  string
+		Error   bool
+	}{
+		"disjointKeys": {
+			Base:    "a: 1\n",
+			Overlay: "b: 2\n",
+			Output:  "a: 1\nb: 2\n",
+		},
+		"overlayWins": {
+			Base:    "a: 1\nb: 2\n",
+			Overlay: "a: 3\n",
+			Output:  "a: 3\nb: 2\n",
+		},
+		"nestedMaps": {
+			Base:    "policy:\n  approvals: 2\n  teams: [a]\n",
+			Overlay: "policy:\n  approvals: 1\n",
+			Output:  "policy:\n  approvals: 1\n  teams:\n  - a\n",
+		},
+		"sequencesReplace": {
+			Base:    "teams: [a, b]\n",
+			Overlay: "teams: [c]\n",
+			Output:  "teams:\n- c\n",
+		},
+		"scalarReplacesMap": {
+			Base:    "policy:\n  approvals: 2\n",
+			Overlay: "policy: disabled\n",
+			Output:  "policy: disabled\n",
+		},
+		"emptyOverlay": {
+			Base:    "a: 1\n",
+			Overlay: "# no settings\n",
+			Output:  "a: 1\n",
+		},
+		"emptyBase": {
+			Base:    "",
+			Overlay: "a: 1\n",
+			Output:  "a: 1\n",
+		},
+		"invalidBase": {
+			Base:    "[a, b]",
+			Overlay: "a: 1\n",
+			Error:   true,
+		},
+		"invalidOverlay": {
+			Base:    "a: 1\n",
+			Overlay: "a: [",
+			Error:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := YAMLMerge([]byte(test.Base), []byte(test.Overlay))
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error merging config, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error merging config: %v", err)
+			}
+			if string(out) != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, string(out))
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ArgMode sets whether a positional argument must be provided.
+type ArgMode int
+
+const (
+	Required ArgMode = iota
+	Optional
+)
+
+// FlagKind sets the type of value a flag accepts.
+type FlagKind int
+
+const (
+	// Bool flags are true when given as "--name" and also accept an explicit
+	// value, like "--name=false".
+	Bool FlagKind = iota
+
+	// String flags require a value, given as "--name=value".
+	String
+)
+
+// UsageError is returned when a command's arguments do not match its
+// specification.
+type UsageError struct {
+	Command *Command
+	Cause   error
+}
+
+func (e UsageError) Error() string {
+	return fmt.Sprintf("invalid arguments for /%s: %v", e.Command.name, e.Cause)
+}
+
+// Args contains the parsed arguments of a command.
+type Args struct {
+	// Raw contains the arguments as they appeared in the comment, after
+	// splitting and removing quotes.
+	Raw []string
+
+	// Positional contains the positional arguments in order. If a command
+	// does not declare any arguments, it accepts any number of positional
+	// arguments.
+	Positional []string
+
+	values map[string]string
+	flags  map[string]string
+}
+
+// Get returns the value of the named positional argument or string flag. It
+// returns the empty string if the argument or flag was not provided.
+func (a Args) Get(name string) string {
+	if v, ok := a.values[name]; ok {
+		return v
+	}
+	return a.flags[name]
+}
+
+// Has returns true if the named argument or flag was provided.
+func (a Args) Has(name string) bool {
+	_, isValue := a.values[name]
+	_, isFlag := a.flags[name]
+	return isValue || isFlag
+}
+
+// Bool returns the value of the named boolean flag.
+func (a Args) Bool(name string) bool {
+	v, _ := strconv.ParseBool(a.flags[name])
+	return v
+}
+
+type argSpec struct {
+	name string
+	mode ArgMode
+}
+
+// Command is a registered command. Its methods declare the arguments and
+// flags that the command accepts and return the command so that calls can be
+// chained.
+type Command struct {
+	name        string
+	description string
+	fn          CommandFunc
+	revoke      CommandFunc
+
+	args  []argSpec
+	flags map[string]FlagKind
+}
+
+// Arg declares a positional argument. Arguments are assigned in the order
+// they are declared and optional arguments must follow required arguments.
+func (c *Command) Arg(name string, mode ArgMode) *Command {
+	if mode == Required && len(c.args) > 0 && c.args[len(c.args)-1].mode == Optional {
+		panic(fmt.Sprintf("commands: required argument %q of /%s follows an optional argument", name, c.name))
+	}
+	c.args = append(c.args, argSpec{name: name, mode: mode})
+	return c
+}
+
+// Flag declares a flag, given in a comment as "--name" or "--name=value".
+func (c *Command) Flag(name string, kind FlagKind) *Command {
+	if c.flags == nil {
+		c.flags = make(map[string]FlagKind)
+	}
+	c.flags[name] = kind
+	return c
+}
+
+// Describe sets the description of the command used by Router.Help.
+func (c *Command) Describe(description string) *Command {
+	c.description = description
+	return c
+}
+
+// OnRevoke sets a function to run when a comment that invoked the command is
+// deleted or is edited so that it no longer contains the same command, like
+// to cancel a deployment. The function is passed the arguments of the
+// original command. Revocations are handled for all comments, regardless of
+// the actions set with WithActions.
+func (c *Command) OnRevoke(fn CommandFunc) *Command {
+	c.revoke = fn
+	return c
+}
+
+// Usage returns a summary of the command's arguments and flags, like
+// "/deploy <ref> [env] [--dry-run]".
+func (c *Command) Usage() string {
+	parts := []string{"/" + c.name}
+	for _, a := range c.args {
+		if a.mode == Required {
+			parts = append(parts, "<"+a.name+">")
+		} else {
+			parts = append(parts, "["+a.name+"]")
+		}
+	}
+	for _, name := range c.flagNames() {
+		if c.flags[name] == String {
+			parts = append(parts, "[--"+name+"=value]")
+		} else {
+			parts = append(parts, "[--"+name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *Command) flagNames() []string {
+	names := make([]string, 0, len(c.flags))
+	for name := range c.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parse assigns tokens to the command's arguments and flags. Tokens after a
+// "--" token are always positional.
+func (c *Command) parse(tokens []string) (Args, error) {
+	args := Args{
+		Raw:    tokens,
+		values: make(map[string]string),
+		flags:  make(map[string]string),
+	}
+
+	flagsDone := false
+	for _, t := range tokens {
+		if flagsDone || !strings.HasPrefix(t, "--") {
+			args.Positional = append(args.Positional, t)
+			continue
+		}
+		if t == "--" {
+			flagsDone = true
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(t, "--"), "=")
+		kind, ok := c.flags[name]
+		if !ok {
+			return Args{}, errors.Errorf("unknown flag --%s", name)
+		}
+
+		switch kind {
+		case Bool:
+			if !hasValue {
+				value = "true"
+			}
+			if _, err := strconv.ParseBool(value); err != nil {
+				return Args{}, errors.Errorf("flag --%s must be true or false", name)
+			}
+		case String:
+			if !hasValue {
+				return Args{}, errors.Errorf("flag --%s requires a value", name)
+			}
+		}
+		args.flags[name] = value
+	}
+
+	if len(c.args) == 0 {
+		return args, nil
+	}
+
+	for i, spec := range c.args {
+		if i >= len(args.Positional) {
+			if spec.mode == Required {
+				return Args{}, errors.Errorf("missing required argument <%s>", spec.name)
+			}
+			break
+		}
+		args.values[spec.name] = args.Positional[i]
+	}
+	if len(args.Positional) > len(c.args) {
+		return Args{}, errors.Errorf("too many arguments, expected at most %d", len(c.args))
+	}
+
+	return args, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+)
+
+func TestCommandParse(t *testing.T) {
+	cmd := (&Command{name: "deploy"}).
+		Arg("ref", Required).
+		Arg("env", Optional).
+		Flag("dry-run", Bool).
+		Flag("reason", String)
+
+	tests := map[string]struct {
+		Tokens []string
+
+		Values map[string]string
+		DryRun bool
+		Err    string
+	}{
+		"requiredOnly": {
+			Tokens: []string{"main"},
+			Values: map[string]string{"ref": "main"},
+		},
+		"allArgsAndFlags": {
+			Tokens: []string{"main", "--dry-run", "prod", "--reason=hot fix"},
+			Values: map[string]string{"ref": "main", "env": "prod", "reason": "hot fix"},
+			DryRun: true,
+		},
+		"explicitBoolFlag": {
+			Tokens: []string{"--dry-run=false", "main"},
+			Values: map[string]string{"ref": "main"},
+		},
+		"positionalAfterSeparator": {
+			Tokens: []string{"--", "--main"},
+			Values: map[string]string{"ref": "--main"},
+		},
+		"missingRequired": {
+			Tokens: []string{"--dry-run"},
+			Err:    "missing required argument <ref>",
+		},
+		"tooManyArgs": {
+			Tokens: []string{"main", "prod", "extra"},
+			Err:    "too many arguments, expected at most 2",
+		},
+		"unknownFlag": {
+			Tokens: []string{"main", "--force"},
+			Err:    "unknown flag --force",
+		},
+		"missingFlagValue": {
+			Tokens: []string{"main", "--reason"},
+			Err:    "flag --reason requires a value",
+		},
+		"invalidBoolFlag": {
+			Tokens: []string{"main", "--dry-run=maybe"},
+			Err:    "flag --dry-run must be true or false",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			args, err := cmd.parse(test.Tokens)
+			if test.Err != "" {
+				if err == nil || err.Error() != test.Err {
+					t.Fatalf("incorrect error: expected %q, actual %v", test.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for k, v := range test.Values {
+				if args.Get(k) != v {
+					t.Errorf("incorrect value for %q: expected %q, actual %q", k, v, args.Get(k))
+				}
+			}
+			if args.Bool("dry-run") != test.DryRun {
+				t.Errorf("incorrect value for dry-run: expected %t, actual %t", test.DryRun, args.Bool("dry-run"))
+			}
+		})
+	}
+}
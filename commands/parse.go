@@ -0,0 +1,117 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Parse finds a slash command at the start of a comment body. It returns the
+// command name without the leading slash and the arguments that follow it on
+// the same line. If the body does not start with a command, the name is
+// empty. If the arguments cannot be split, Parse returns the command name and
+// an error.
+//
+// Arguments are split like a shell: whitespace separates arguments, single
+// and double quotes group words, and a backslash escapes the next character
+// outside of single quotes.
+func Parse(body string) (name string, args []string, err error) {
+	line := strings.TrimLeftFunc(body, unicode.IsSpace)
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, "/") {
+		return "", nil, nil
+	}
+
+	line = strings.TrimPrefix(line, "/")
+
+	name, rest := line, ""
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+
+	args, err = Split(rest)
+	return name, args, err
+}
+
+// Split tokenizes a string using shell-style quoting rules. It returns an
+// error if a quote is not terminated or if the string ends with an escape.
+func Split(s string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+
+	inToken := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			token.WriteRune(r)
+			escaped = false
+
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				token.WriteRune(r)
+			}
+
+		case r == '\\':
+			inToken = true
+			escaped = true
+
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				token.WriteRune(r)
+			}
+
+		case r == '"' || r == '\'':
+			inToken = true
+			quote = r
+
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+
+		default:
+			inToken = true
+			token.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("unterminated escape at end of input")
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c quote", quote)
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		Body string
+
+		Name string
+		Args []string
+		Err  bool
+	}{
+		"noCommand": {
+			Body: "looks good to me",
+		},
+		"commandWithoutArgs": {
+			Body: "/create-branch",
+			Name: "create-branch",
+		},
+		"leadingWhitespace": {
+			Body: "\n  /create-pr main",
+			Name: "create-pr",
+			Args: []string{"main"},
+		},
+		"onlyFirstLine": {
+			Body: "/label bug\n/label feature",
+			Name: "label",
+			Args: []string{"bug"},
+		},
+		"quotedArgs": {
+			Body: `/create-pr "PR title" 'it''s' a\ b "say \"hi\""`,
+			Name: "create-pr",
+			Args: []string{"PR title", "its", "a b", `say "hi"`},
+		},
+		"emptyQuotedArg": {
+			Body: `/cmd ""`,
+			Name: "cmd",
+			Args: []string{""},
+		},
+		"bareSlash": {
+			Body: "/ not a command",
+		},
+		"unterminatedQuote": {
+			Body: `/cmd "oops`,
+			Name: "cmd",
+			Err:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd, args, err := Parse(test.Body)
+			if test.Name != cmd {
+				t.Errorf("incorrect name: expected %q, actual %q", test.Name, cmd)
+			}
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.Name != "" && !reflect.DeepEqual(test.Args, args) {
+				t.Errorf("incorrect args:\nexpected: %q\n  actual: %q", test.Args, args)
+			}
+		})
+	}
+}
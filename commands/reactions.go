@@ -0,0 +1,88 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Reactions used by AckCommand. GitHub only supports a fixed set of reaction
+// contents, so there are no check mark or cross reactions.
+const (
+	ReactionReceived  = "eyes"
+	ReactionSucceeded = "rocket"
+	ReactionFailed    = "confused"
+)
+
+// AddReaction adds a reaction to an issue or pull request comment and returns
+// the reaction. The content must be one of the reactions supported by GitHub,
+// like "+1", "eyes", or "rocket". If the app already added the same reaction
+// to the comment, GitHub returns the existing reaction.
+//
+// In dry-run mode, AddReaction makes no requests and returns a reaction with
+// githubapp.DryRunNodeID as its node ID.
+func AddReaction(ctx context.Context, client *github.Client, owner, repo string, commentID int64, content string) (*github.Reaction, error) {
+	if githubapp.IsDryRun(ctx) {
+		zerolog.Ctx(ctx).Info().Str("reaction", content).Int64("comment", commentID).Msg("Dry run: skipped adding reaction")
+		return &github.Reaction{NodeID: github.String(githubapp.DryRunNodeID), Content: github.String(content)}, nil
+	}
+
+	reaction, _, err := client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, commentID, content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to add %q reaction to comment %d", content, commentID)
+	}
+	return reaction, nil
+}
+
+// AckCommand acknowledges the comment that invoked a command with reactions
+// instead of replies. It adds the ReactionReceived reaction, runs fn, and
+// then replaces the reaction with ReactionSucceeded or ReactionFailed,
+// depending on the error returned by fn. It returns the error from fn.
+//
+// Reactions are informational, so failures to add or remove them are logged
+// and do not prevent fn from running. In dry-run mode, reactions are logged
+// instead of added, but fn still runs.
+func AckCommand(ctx context.Context, client *github.Client, inv Invocation, fn func(ctx context.Context) error) error {
+	logger := zerolog.Ctx(ctx)
+	commentID := inv.Event.GetComment().GetID()
+
+	received, rerr := AddReaction(ctx, client, inv.Owner, inv.Repo, commentID, ReactionReceived)
+	if rerr != nil {
+		logger.Warn().Err(rerr).Msg("Failed to acknowledge command")
+	}
+
+	err := fn(ctx)
+
+	if received != nil && received.GetNodeID() != githubapp.DryRunNodeID {
+		if _, rerr := client.Reactions.DeleteIssueCommentReaction(ctx, inv.Owner, inv.Repo, commentID, received.GetID()); rerr != nil {
+			logger.Warn().Err(rerr).Msg("Failed to remove command acknowledgement")
+		}
+	}
+
+	content := ReactionSucceeded
+	if err != nil {
+		content = ReactionFailed
+	}
+	if _, rerr := AddReaction(ctx, client, inv.Owner, inv.Repo, commentID, content); rerr != nil {
+		logger.Warn().Err(rerr).Msg("Failed to report command result")
+	}
+
+	return err
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+func TestAddReaction(t *testing.T) {
+	srv := newTestReactionServer(t, nil)
+	srv.Reactions["eyes"] = 10
+
+	reaction, err := AddReaction(context.Background(), srv.Client(), "owner", "repo", 42, "eyes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reaction.GetID() != 10 {
+		t.Errorf("expected existing reaction 10, actual %d", reaction.GetID())
+	}
+	if len(srv.Reactions) != 1 {
+		t.Errorf("incorrect reactions: %v", srv.Reactions)
+	}
+}
+
+func TestAckCommand(t *testing.T) {
+	tests := map[string]struct {
+		Err    error
+		Failed map[string]bool
+		DryRun bool
+
+		Requests  []string
+		Reactions []string
+	}{
+		"success": {
+			Requests:  []string{"POST eyes", "DELETE 1", "POST rocket"},
+			Reactions: []string{"rocket"},
+		},
+		"failure": {
+			Err:       errors.New("deploy failed"),
+			Requests:  []string{"POST eyes", "DELETE 1", "POST confused"},
+			Reactions: []string{"confused"},
+		},
+		"receiptFails": {
+			Failed:    map[string]bool{"eyes": true},
+			Requests:  []string{"POST eyes", "POST rocket"},
+			Reactions: []string{"rocket"},
+		},
+		"dryRun": {
+			DryRun: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestReactionServer(t, test.Failed)
+
+			inv := Invocation{
+				Command: "deploy",
+				Event: &github.IssueCommentEvent{
+					Comment: &github.IssueComment{ID: github.Int64(42)},
+				},
+				Owner: "owner",
+				Repo:  "repo",
+			}
+
+			called := false
+			ctx := githubapp.WithDryRun(context.Background(), test.DryRun)
+			err := AckCommand(ctx, srv.Client(), inv, func(ctx context.Context) error {
+				called = true
+				return test.Err
+			})
+
+			if !called {
+				t.Error("command function was not called")
+			}
+			if err != test.Err {
+				t.Errorf("incorrect error: expected %v, actual %v", test.Err, err)
+			}
+			if !reflect.DeepEqual(test.Requests, srv.Requests) {
+				t.Errorf("incorrect requests:\nexpected: %q\n  actual: %q", test.Requests, srv.Requests)
+			}
+
+			var reactions []string
+			for content := range srv.Reactions {
+				reactions = append(reactions, content)
+			}
+			if !reflect.DeepEqual(test.Reactions, reactions) {
+				t.Errorf("incorrect reactions: expected %q, actual %q", test.Reactions, reactions)
+			}
+		})
+	}
+}
+
+// testReactionServer implements the reaction endpoints for comment 42 in
+// owner/repo. Reactions are assigned sequential IDs. Creating a reaction
+// fails with a server error if its content is in failed.
+type testReactionServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	nextID    int64
+	Reactions map[string]int64
+	Requests  []string
+}
+
+func newTestReactionServer(t *testing.T, failed map[string]bool) *testReactionServer {
+	s := &testReactionServer{
+		nextID:    1,
+		Reactions: make(map[string]int64),
+	}
+
+	const path = "/repos/owner/repo/issues/comments/42/reactions"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.Requests = append(s.Requests, "POST "+req.Content)
+		if failed[req.Content] {
+			http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		// GitHub returns existing reactions with a 200 status
+		status := http.StatusOK
+		id, ok := s.Reactions[req.Content]
+		if !ok {
+			id, status = s.nextID, http.StatusCreated
+			s.nextID++
+			s.Reactions[req.Content] = id
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"id":%d,"content":%q}`, id, req.Content)
+	})
+	mux.HandleFunc(path+"/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, path+"/")
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.Requests = append(s.Requests, r.Method+" "+id)
+		for content, rid := range s.Reactions {
+			if fmt.Sprint(rid) == id {
+				delete(s.Reactions, content)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testReactionServer) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
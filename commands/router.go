@@ -0,0 +1,301 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commands routes slash commands in issue and pull request comments,
+// like "/create-branch name", to functions registered by an application.
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Invocation describes the comment that invoked a command.
+type Invocation struct {
+	// Command is the name of the command, without the leading slash.
+	Command string
+
+	// Event is the comment event that contained the command.
+	Event *github.IssueCommentEvent
+
+	InstallationID int64
+	Owner          string
+	Repo           string
+
+	// Number is the number of the issue or pull request.
+	Number        int
+	IsPullRequest bool
+
+	// Author is the login of the user who wrote the comment.
+	Author string
+
+	// Action is the action of the comment event, like "created", "edited",
+	// or "deleted".
+	Action string
+
+	// PreviousBody is the body of the comment before it was edited. It is
+	// only set for the "edited" action.
+	PreviousBody string
+}
+
+// CommandFunc runs a command. It is passed the arguments that followed the
+// command name in the comment, parsed according to the command's declared
+// arguments and flags.
+type CommandFunc func(ctx context.Context, inv Invocation, args Args) error
+
+// Option configures a Router.
+type Option func(*Router)
+
+// WithActions sets the comment actions that can invoke commands. By default,
+// only commands in newly created comments are run.
+func WithActions(actions ...string) Option {
+	return func(r *Router) {
+		r.actions = make(map[string]bool)
+		for _, a := range actions {
+			r.actions[a] = true
+		}
+	}
+}
+
+// WithBotAuthors allows bots to invoke commands. By default, comments from
+// authors with a "[bot]" suffix are ignored.
+func WithBotAuthors(allow bool) Option {
+	return func(r *Router) {
+		r.allowBots = allow
+	}
+}
+
+// WithUsageReplies enables replies to comments with invalid commands. When a
+// command's arguments are invalid, the router uses the client creator to post
+// a comment with the error and the usage of the command. By default, invalid
+// commands are only logged.
+func WithUsageReplies(cc githubapp.ClientCreator) Option {
+	return func(r *Router) {
+		r.replies = cc
+	}
+}
+
+// Router runs commands found in issue_comment events. It implements
+// githubapp.EventHandler and githubapp.IssueCommentHandler.
+type Router struct {
+	commands  map[string]*Command
+	actions   map[string]bool
+	allowBots bool
+	replies   githubapp.ClientCreator
+}
+
+// NewRouter creates a router with no commands.
+func NewRouter(opts ...Option) *Router {
+	r := &Router{
+		commands: make(map[string]*Command),
+		actions:  map[string]bool{"created": true},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Command registers a function to run for a command and returns the command
+// so that its arguments and flags can be declared. The name may include a
+// leading slash. Registering a name again replaces the existing command.
+func (r *Router) Command(name string, fn CommandFunc) *Command {
+	c := &Command{
+		name: strings.TrimPrefix(name, "/"),
+		fn:   fn,
+	}
+	r.commands[c.name] = c
+	return c
+}
+
+// Help returns a Markdown table that lists the usage and description of all
+// registered commands.
+func (r *Router) Help() string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("| Command | Description |\n")
+	b.WriteString("| ------- | ----------- |\n")
+	for _, name := range names {
+		c := r.commands[name]
+		fmt.Fprintf(&b, "| `%s` | %s |\n", c.Usage(), strings.ReplaceAll(c.description, "|", "\\|"))
+	}
+	return b.String()
+}
+
+func (r *Router) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (r *Router) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.IssueCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse issue comment event payload")
+	}
+	return r.HandleIssueComment(ctx, &event)
+}
+
+// HandleIssueComment runs the command in the comment, if any. Comments that
+// do not start with a registered command are ignored. If a comment is edited
+// or deleted, it also revokes the command the comment contained before the
+// change, if the command has a revoke function.
+func (r *Router) HandleIssueComment(ctx context.Context, event *github.IssueCommentEvent) error {
+	logger := zerolog.Ctx(ctx)
+
+	action := event.GetAction()
+	if !r.actions[action] && action != "edited" && action != "deleted" {
+		return nil
+	}
+
+	author := event.GetComment().GetUser().GetLogin()
+	if !r.allowBots && strings.HasSuffix(author, "[bot]") {
+		logger.Debug().Msg("Ignoring command in comment created by a bot")
+		return nil
+	}
+
+	if err := r.revoke(ctx, event); err != nil {
+		return err
+	}
+	if !r.actions[action] || action == "deleted" {
+		return nil
+	}
+
+	name, tokens, err := Parse(event.GetComment().GetBody())
+	if name == "" {
+		return nil
+	}
+
+	cmd, ok := r.commands[name]
+	if !ok {
+		logger.Debug().Msgf("Ignoring unknown command: /%s", name)
+		return nil
+	}
+
+	var args Args
+	if err == nil {
+		args, err = cmd.parse(tokens)
+	}
+	if err != nil {
+		return r.reportUsage(ctx, event, UsageError{Command: cmd, Cause: err})
+	}
+
+	logger.Debug().Msgf("Running command /%s", name)
+	return errors.Wrapf(cmd.fn(ctx, newInvocation(name, event), args), "command /%s failed", name)
+}
+
+// revoke runs the revoke function of the command that a comment contained
+// before it was edited or deleted. Edits that keep the same command and
+// arguments do not revoke the command.
+func (r *Router) revoke(ctx context.Context, event *github.IssueCommentEvent) error {
+	var previous string
+	switch event.GetAction() {
+	case "deleted":
+		previous = event.GetComment().GetBody()
+	case "edited":
+		body := event.GetChanges().GetBody()
+		if body == nil || body.From == nil {
+			return nil
+		}
+		previous = body.GetFrom()
+	default:
+		return nil
+	}
+
+	name, tokens, err := Parse(previous)
+	if name == "" || err != nil {
+		return nil
+	}
+
+	cmd, ok := r.commands[name]
+	if !ok || cmd.revoke == nil {
+		return nil
+	}
+
+	if event.GetAction() == "edited" {
+		current, currentTokens, _ := Parse(event.GetComment().GetBody())
+		if current == name && reflect.DeepEqual(tokens, currentTokens) {
+			return nil
+		}
+	}
+
+	args, err := cmd.parse(tokens)
+	if err != nil {
+		// the command was never run, so there is nothing to revoke
+		return nil
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Revoking command /%s", name)
+	return errors.Wrapf(cmd.revoke(ctx, newInvocation(name, event), args), "revoking command /%s failed", name)
+}
+
+func newInvocation(name string, event *github.IssueCommentEvent) Invocation {
+	inv := Invocation{
+		Command:        name,
+		Event:          event,
+		InstallationID: githubapp.GetInstallationIDFromEvent(event),
+		Owner:          event.GetRepo().GetOwner().GetLogin(),
+		Repo:           event.GetRepo().GetName(),
+		Number:         event.GetIssue().GetNumber(),
+		IsPullRequest:  event.GetIssue().IsPullRequest(),
+		Author:         event.GetComment().GetUser().GetLogin(),
+		Action:         event.GetAction(),
+	}
+	if event.GetAction() == "edited" {
+		inv.PreviousBody = event.GetChanges().GetBody().GetFrom()
+	}
+	return inv
+}
+
+// reportUsage logs a usage error and replies to the comment if replies are
+// enabled and the context is not in dry-run mode.
+func (r *Router) reportUsage(ctx context.Context, event *github.IssueCommentEvent, uerr UsageError) error {
+	zerolog.Ctx(ctx).Warn().Err(uerr).Msg("Ignoring command with invalid arguments")
+	if r.replies == nil {
+		return nil
+	}
+	if githubapp.IsDryRun(ctx) {
+		zerolog.Ctx(ctx).Info().Int("number", event.GetIssue().GetNumber()).Msg("Dry run: skipped replying with command usage")
+		return nil
+	}
+
+	installationID, ok := githubapp.LookupInstallationID(event)
+	if !ok {
+		return errors.New("cannot reply with command usage: event has no installation")
+	}
+
+	client, cerr := r.replies.NewInstallationClient(installationID)
+	if cerr != nil {
+		return cerr
+	}
+
+	msg := fmt.Sprintf("@%s %v\n\nUsage: `%s`", event.GetComment().GetUser().GetLogin(), uerr.Cause, uerr.Command.Usage())
+	owner, repo := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName()
+	if _, _, cerr := client.Issues.CreateComment(ctx, owner, repo, event.GetIssue().GetNumber(), &github.IssueComment{Body: &msg}); cerr != nil {
+		return errors.Wrap(cerr, "failed to reply with command usage")
+	}
+	return nil
+}
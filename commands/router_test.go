@@ -0,0 +1,301 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+func TestRouterHelp(t *testing.T) {
+	r := NewRouter()
+	r.Command("deploy", nil).Arg("ref", Required).Arg("env", Optional).Flag("dry-run", Bool).Describe("Deploy a ref")
+	r.Command("/create-pr", nil).Flag("title", String)
+
+	expected := "| Command | Description |\n" +
+		"| ------- | ----------- |\n" +
+		"| `/create-pr [--title=value]` |  |\n" +
+		"| `/deploy <ref> [env] [--dry-run]` | Deploy a ref |\n"
+
+	if help := r.Help(); help != expected {
+		t.Errorf("incorrect help:\nexpected: %q\n  actual: %q", expected, help)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	tests := map[string]struct {
+		Options []Option
+		Action  string
+		Author  string
+		Body    string
+
+		Called bool
+		Args   []string
+	}{
+		"runsCommand": {
+			Action: "created",
+			Author: "octocat",
+			Body:   "/greet hello world",
+			Called: true,
+			Args:   []string{"hello", "world"},
+		},
+		"ignoresUnknownCommand": {
+			Action: "created",
+			Author: "octocat",
+			Body:   "/unknown",
+		},
+		"ignoresEditedComment": {
+			Action: "edited",
+			Author: "octocat",
+			Body:   "/greet",
+		},
+		"runsConfiguredAction": {
+			Options: []Option{WithActions("created", "edited")},
+			Action:  "edited",
+			Author:  "octocat",
+			Body:    "/greet",
+			Called:  true,
+		},
+		"ignoresBotAuthor": {
+			Action: "created",
+			Author: "my-app[bot]",
+			Body:   "/greet",
+		},
+		"runsBotAuthorWhenAllowed": {
+			Options: []Option{WithBotAuthors(true)},
+			Action:  "created",
+			Author:  "my-app[bot]",
+			Body:    "/greet",
+			Called:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var called bool
+			var inv Invocation
+			var args Args
+
+			r := NewRouter(test.Options...)
+			r.Command("/greet", func(ctx context.Context, i Invocation, a Args) error {
+				called, inv, args = true, i, a
+				return nil
+			})
+
+			event := &github.IssueCommentEvent{
+				Action: github.String(test.Action),
+				Comment: &github.IssueComment{
+					Body: github.String(test.Body),
+					User: &github.User{Login: github.String(test.Author)},
+				},
+				Issue: &github.Issue{Number: github.Int(42)},
+				Repo: &github.Repository{
+					Name:  github.String("repo"),
+					Owner: &github.User{Login: github.String("owner")},
+				},
+				Installation: &github.Installation{ID: github.Int64(7)},
+			}
+
+			if err := r.HandleIssueComment(context.Background(), event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if test.Called != called {
+				t.Fatalf("incorrect called state: expected %t, actual %t", test.Called, called)
+			}
+			if !called {
+				return
+			}
+
+			if !reflect.DeepEqual(test.Args, args.Positional) {
+				t.Errorf("incorrect args:\nexpected: %q\n  actual: %q", test.Args, args.Positional)
+			}
+
+			expected := Invocation{
+				Command:        "greet",
+				Event:          event,
+				InstallationID: 7,
+				Owner:          "owner",
+				Repo:           "repo",
+				Number:         42,
+				Author:         test.Author,
+				Action:         test.Action,
+			}
+			if !reflect.DeepEqual(expected, inv) {
+				t.Errorf("incorrect invocation:\nexpected: %+v\n  actual: %+v", expected, inv)
+			}
+		})
+	}
+}
+
+func TestRouterRevoke(t *testing.T) {
+	tests := map[string]struct {
+		Options  []Option
+		Action   string
+		Body     string
+		Previous *string
+
+		Revoked []string
+		Ran     bool
+	}{
+		"deletedComment": {
+			Action:  "deleted",
+			Body:    "/deploy main prod",
+			Revoked: []string{"main", "prod"},
+		},
+		"editedToRemoveCommand": {
+			Action:   "edited",
+			Body:     "never mind",
+			Previous: github.String("/deploy main prod"),
+			Revoked:  []string{"main", "prod"},
+		},
+		"editedArguments": {
+			Options:  []Option{WithActions("created", "edited")},
+			Action:   "edited",
+			Body:     "/deploy main staging",
+			Previous: github.String("/deploy main prod"),
+			Revoked:  []string{"main", "prod"},
+			Ran:      true,
+		},
+		"editedTextAfterCommand": {
+			Action:   "edited",
+			Body:     "/deploy main prod\n\nplease",
+			Previous: github.String("/deploy main prod"),
+		},
+		"editedWithoutBodyChange": {
+			Action: "edited",
+			Body:   "never mind",
+		},
+		"editedFromOtherCommand": {
+			Action:   "edited",
+			Body:     "never mind",
+			Previous: github.String("/status"),
+		},
+		"createdComment": {
+			Action: "created",
+			Body:   "/deploy main prod",
+			Ran:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var revoked []string
+			var inv Invocation
+			var ran bool
+
+			r := NewRouter(test.Options...)
+			r.Command("status", func(ctx context.Context, i Invocation, a Args) error {
+				return nil
+			})
+			r.Command("deploy", func(ctx context.Context, i Invocation, a Args) error {
+				ran = true
+				return nil
+			}).Arg("ref", Required).Arg("env", Optional).OnRevoke(func(ctx context.Context, i Invocation, a Args) error {
+				revoked, inv = []string{a.Get("ref"), a.Get("env")}, i
+				return nil
+			})
+
+			event := &github.IssueCommentEvent{
+				Action: github.String(test.Action),
+				Comment: &github.IssueComment{
+					Body: github.String(test.Body),
+					User: &github.User{Login: github.String("octocat")},
+				},
+				Issue: &github.Issue{Number: github.Int(42)},
+				Repo: &github.Repository{
+					Name:  github.String("repo"),
+					Owner: &github.User{Login: github.String("owner")},
+				},
+			}
+			if test.Previous != nil {
+				event.Changes = &github.EditChange{Body: &github.EditBody{From: test.Previous}}
+			}
+
+			if err := r.HandleIssueComment(context.Background(), event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.Revoked, revoked) {
+				t.Errorf("incorrect revoked args:\nexpected: %q\n  actual: %q", test.Revoked, revoked)
+			}
+			if test.Ran != ran {
+				t.Errorf("incorrect ran state: expected %t, actual %t", test.Ran, ran)
+			}
+			if revoked != nil {
+				if inv.Command != "deploy" || inv.Action != test.Action {
+					t.Errorf("incorrect invocation: %+v", inv)
+				}
+				if test.Previous != nil && inv.PreviousBody != *test.Previous {
+					t.Errorf("incorrect previous body: expected %q, actual %q", *test.Previous, inv.PreviousBody)
+				}
+			}
+		})
+	}
+}
+
+func TestRouterUsageReplies(t *testing.T) {
+	tests := map[string]struct {
+		DryRun   bool
+		Requests []string
+	}{
+		"replies": {
+			Requests: []string{"POST /repos/owner/repo/issues/42/comments"},
+		},
+		"dryRun": {
+			DryRun: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cc := &githubapp.MockClientCreator{}
+			cc.Respond("POST", "/repos/owner/repo/issues/42/comments", 201, `{"id":1}`)
+
+			r := NewRouter(WithUsageReplies(cc))
+			r.Command("/deploy", func(ctx context.Context, i Invocation, a Args) error {
+				t.Error("command with invalid arguments was called")
+				return nil
+			}).Arg("ref", Required)
+
+			event := &github.IssueCommentEvent{
+				Action: github.String("created"),
+				Comment: &github.IssueComment{
+					Body: github.String("/deploy"),
+					User: &github.User{Login: github.String("octocat")},
+				},
+				Issue: &github.Issue{Number: github.Int(42)},
+				Repo: &github.Repository{
+					Name:  github.String("repo"),
+					Owner: &github.User{Login: github.String("owner")},
+				},
+				Installation: &github.Installation{ID: github.Int64(7)},
+			}
+
+			ctx := githubapp.WithDryRun(context.Background(), test.DryRun)
+			if err := r.HandleIssueComment(ctx, event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if requests := cc.Requests(); !reflect.DeepEqual(test.Requests, requests) {
+				t.Errorf("incorrect requests:\nexpected: %q\n  actual: %q", test.Requests, requests)
+			}
+		})
+	}
+}
@@ -18,18 +18,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
-	"strings"
 
 	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/commands"
 	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/palantir/go-githubapp/markdown"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 type PRCommentHandler struct {
 	githubapp.ClientCreator
 
 	preamble string
+	commands *commands.Router
+}
+
+func NewPRCommentHandler(cc githubapp.ClientCreator, preamble string) *PRCommentHandler {
+	h := &PRCommentHandler{
+		ClientCreator: cc,
+		preamble:      preamble,
+		commands:      commands.NewRouter(commands.WithUsageReplies(cc)),
+	}
+	h.commands.Command("create-branch", h.createBranch).Describe("Create a branch with example files")
+	h.commands.Command("create-pr", h.createPR).Describe("Open a pull request from the branch")
+	h.commands.Command("help", h.help).Describe("List the available commands")
+	return h
 }
 
 func (h *PRCommentHandler) Handles() []string {
@@ -69,22 +83,24 @@ func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID str
 	author := event.GetComment().GetUser().GetLogin()
 	body := event.GetComment().GetBody()
 
-	if strings.HasSuffix(author, "[bot]") {
-		logger.Debug().Msg("Issue comment was created by a bot")
+	// Ignore comments created by this app, but not comments from other bots
+	ownComment, err := githubapp.IsOwnComment(ctx, h.ClientCreator, author)
+	if err != nil {
+		return err
+	}
+	if ownComment {
+		logger.Debug().Msg("Issue comment was created by this app")
 		return nil
 	}
 
-	// Find command beginning with a slash and followed by a word, may contain dashes (-) and multiple words
-	// Only matches the first slash command
-	pattern := regexp.MustCompile(`^\/\w+(?:-\w+)*`)
-	slash_command := "None"
-	if match := pattern.FindString(body); match != "" {
-		slash_command = match
-		fmt.Println("Slash command found:", match)
+	// Find the slash command at the start of the comment, if any
+	slashCommand := "None"
+	if name, _, err := commands.Parse(body); err == nil && name != "" {
+		slashCommand = "/" + name
 	}
 
 	logger.Debug().Msgf("Echoing comment on %s/%s#%d by %s", repoOwner, repoName, prNum, author)
-	msg := fmt.Sprintf("%s\n%s said\n```\n%s\n```\nFound the slash command: `%s`\n", h.preamble, author, body, slash_command)
+	msg := fmt.Sprintf("%s\n%s said\n%sFound the slash command: %s\n", h.preamble, markdown.Escape(author), markdown.CodeBlock(body), markdown.Code(slashCommand))
 
 	// Answer with an issue comment
 	prComment := github.IssueComment{
@@ -95,130 +111,97 @@ func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID str
 		logger.Error().Err(err).Msg("Failed to comment on pull request")
 	}
 
-	if slash_command == "/create-branch" {
-		// Legend:
-		// varNameRef = Variable names ending with "Ref" are reference that are obtained after an API call to GitHub
-		// varNameObj = Variable names ending with "Obj" are objectes, often times with the same "base variable name" as reference
-		// 				which are sent to the GitHub API
-		// Therefore: Obj's most likely will have a follow-up variable with the same name ending in "Ref",
-		// i.e. newBranchObj (object to create) -> newBranchRef (reference of the created object after the API call)
-
-		// Get the reference to the latest commit of the main branch
-		// TODO: Get the default branch using the API, not just using the main branch
-		baseBranchRef, _, err := client.Git.GetRef(ctx, repoOwner, repoName, "heads/main")
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to get current reference")
-			return nil
-		}
-		logMsg := fmt.Sprintf("Current ref is: %s", baseBranchRef)
-		logger.Debug().Msg(logMsg)
-
-		// Create new branch with the latest commit SHA of the base branch as basis
-		newBranchObj := github.Reference{
-			Ref: github.String("refs/heads/my-bot-PR-branch"),
-			Object: &github.GitObject{
-				SHA: baseBranchRef.Object.SHA,
-			},
-		}
-		newBranchRef, _, err := client.Git.CreateRef(ctx, repoOwner, repoName, &newBranchObj)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to create new branch")
-			return nil
-		}
-		logMsg = fmt.Sprintf("New branch ref is: %s", newBranchRef)
-		logger.Debug().Msg(logMsg)
-
-		// Create a new tree where files can be added to with an array of TreeEntries
-		// TODO: Make adding of file contents better, i.e. by using templates?
-		file1 := &github.TreeEntry{
-			Path:    github.String("file1.txt"),
-			Mode:    github.String("100644"), // Mode for a blob
-			Type:    github.String("blob"),
-			Content: github.String("file content"),
-		}
-		file2 := &github.TreeEntry{
-			Path:    github.String("file2.txt"),
-			Mode:    github.String("100644"),
-			Type:    github.String("blob"),
-			Content: github.String("another file content"),
-		}
-		entries := []*github.TreeEntry{file1, file2}
-		newTreeRef, _, err := client.Git.CreateTree(ctx, repoOwner, repoName, *baseBranchRef.Object.SHA, entries)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to create new tree")
-			return nil
-		}
-		logMsg = fmt.Sprintf("New tree is: %v", newTreeRef)
-		logger.Debug().Msg(logMsg)
-
-		// Create a new commit onto the tree that has just been created
-		// Get latest commit so it can be referenced as parent of the new commit
-		latestCommitRef, _, err := client.Git.GetCommit(ctx, repoOwner, repoName, *github.String(*baseBranchRef.Object.SHA))
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to get latest commit")
-			return nil
-		}
-		logMsg = fmt.Sprintf("Latest commit is: %v", latestCommitRef)
-		logger.Debug().Msg(logMsg)
-
-		// Create a commit by committing the previously create tree
-		newCommitObj := github.Commit{
-			SHA:     github.String(newTreeRef.GetSHA()),
-			Message: github.String("This is a commit by bot"),
-			Tree:    newTreeRef,
-			Parents: []*github.Commit{latestCommitRef},
-		}
-		newCommitRef, _, err := client.Git.CreateCommit(ctx, repoOwner, repoName, &newCommitObj)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to create new commit")
-			return nil
-		}
-		logMsg = fmt.Sprintf("New commit is: %v", newCommitRef)
-		logger.Debug().Msg(logMsg)
-
-		// Update HEAD to point to the currently created commit
-		updateRef, _, err := client.Git.UpdateRef(ctx, repoOwner, repoName, newBranchRef, true, *github.String(*newCommitRef.SHA))
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to update reference")
-			return nil
-		}
-		logMsg = fmt.Sprintf("New reference is: %v", updateRef)
-		logger.Debug().Msg(logMsg)
-	}
-
-	if slash_command == "/create-pr" {
-		title := "PR created by bot"
-		head := "my-bot-PR-branch"
-		base := "main"
-		prBody := "Please, merge the content of this PR :rocket:"
-
-		newPRObj := github.NewPullRequest{
-			Title: &title,
-			Head:  &head,
-			Base:  &base,
-			Body:  &prBody,
-		}
-
-		newPRRef, _, err := client.PullRequests.Create(ctx, repoOwner, repoName, &newPRObj)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to create pull request")
-			return nil
-		}
-		logMsg := fmt.Sprintf("Created pull request with ID %v and title %s", *newPRRef.Number, *newPRRef.Title)
-		logger.Debug().Msg(logMsg)
-
-		// Post the link to the PR in the comments
-		msg := fmt.Sprintf("The PR has been created, [click here to check it](%s) :eyes:", newPRRef.GetHTMLURL())
-		prCommentObj := github.IssueComment{
-			Body: &msg,
-		}
-
-		if _, _, err := client.Issues.CreateComment(ctx, repoOwner, repoName, prNum, &prCommentObj); err != nil {
-			logger.Error().Err(err).Msg("Failed to comment on pull request")
-		}
-		logMsg = fmt.Sprintf("Commit containing PR link has been created. Link to PR: %s", newPRRef.GetHTMLURL())
-		logger.Debug().Msg(logMsg)
+	// Run the slash command, if it is registered
+	return h.commands.HandleIssueComment(ctx, &event)
+}
+
+func (h *PRCommentHandler) help(ctx context.Context, inv commands.Invocation, args commands.Args) error {
+	client, err := h.NewInstallationClient(inv.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	msg := h.commands.Help()
+	_, _, err = client.Issues.CreateComment(ctx, inv.Owner, inv.Repo, inv.Number, &github.IssueComment{Body: &msg})
+	return err
+}
+
+func (h *PRCommentHandler) createBranch(ctx context.Context, inv commands.Invocation, args commands.Args) error {
+	logger := zerolog.Ctx(ctx)
+
+	client, err := h.NewInstallationClient(inv.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	// Commit example files to a new branch based on the default branch. This
+	// creates a tree with the files, creates a commit of that tree with the
+	// head of the default branch as its parent, and then creates the branch
+	// pointing at the new commit. If the branch already exists, the commit is
+	// added to it instead.
+	// TODO: Make adding of file contents better, i.e. by using templates?
+	commit, err := githubapp.CommitFiles(ctx, client, githubapp.CommitRequest{
+		Owner:   inv.Owner,
+		Repo:    inv.Repo,
+		Branch:  "my-bot-PR-branch",
+		Message: "This is a commit by bot",
+		Files: map[string][]byte{
+			"file1.txt": []byte("file content"),
+			"file2.txt": []byte("another file content"),
+		},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to commit files")
+		return nil
+	}
+	logger.Debug().Msgf("New commit is: %s", commit.SHA)
+
+	return nil
+}
+
+func (h *PRCommentHandler) createPR(ctx context.Context, inv commands.Invocation, args commands.Args) error {
+	logger := zerolog.Ctx(ctx)
+
+	client, err := h.NewInstallationClient(inv.InstallationID)
+	if err != nil {
+		return err
+	}
+	repoOwner, repoName, prNum := inv.Owner, inv.Repo, inv.Number
+
+	newPRRef, err := githubapp.CreatePullRequest(ctx, client, githubapp.PRRequest{
+		Owner: repoOwner,
+		Repo:  repoName,
+		Title: "PR created by bot",
+		Body:  "Please, merge the content of this PR :rocket:",
+		Head:  "my-bot-PR-branch",
+	})
+	if errors.Is(err, githubapp.ErrNoCommits) {
+		logger.Info().Msg("Branch has no changes to open a pull request for")
+		return nil
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create pull request")
+		return nil
+	}
+	logMsg := fmt.Sprintf("Created pull request with ID %v and title %s", newPRRef.GetNumber(), newPRRef.GetTitle())
+	logger.Debug().Msg(logMsg)
+
+	// Assign the pull request to the user who asked for it
+	if _, err := githubapp.AssignUsers(ctx, client, repoOwner, repoName, newPRRef.GetNumber(), inv.Author); err != nil {
+		logger.Error().Err(err).Msg("Failed to assign pull request")
+	}
+
+	// Post the link to the PR in the comments
+	msg := fmt.Sprintf("The PR has been created, [click here to check it](%s) :eyes:", newPRRef.GetHTMLURL())
+	prCommentObj := github.IssueComment{
+		Body: &msg,
+	}
+
+	if _, _, err := client.Issues.CreateComment(ctx, repoOwner, repoName, prNum, &prCommentObj); err != nil {
+		logger.Error().Err(err).Msg("Failed to comment on pull request")
 	}
+	logMsg = fmt.Sprintf("Commit containing PR link has been created. Link to PR: %s", newPRRef.GetHTMLURL())
+	logger.Debug().Msg(logMsg)
 
 	return nil
 }
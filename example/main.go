@@ -50,10 +50,7 @@ func main() {
 		panic(err)
 	}
 
-	prCommentHandler := &PRCommentHandler{
-		ClientCreator: cc,
-		preamble:      config.AppConfig.PullRequestPreamble,
-	}
+	prCommentHandler := NewPRCommentHandler(cc, config.AppConfig.PullRequestPreamble)
 
 	webhookHandler := githubapp.NewDefaultEventDispatcher(config.Github, prCommentHandler)
 
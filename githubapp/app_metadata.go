@@ -0,0 +1,70 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func (c *clientCreator) AppMetadata(ctx context.Context) (*github.App, error) {
+	c.appMetadataMu.Lock()
+	defer c.appMetadataMu.Unlock()
+
+	if c.appMetadata != nil {
+		return c.appMetadata, nil
+	}
+
+	client, err := c.NewAppClient()
+	if err != nil {
+		return nil, err
+	}
+
+	app, _, err := client.Apps.Get(ctx, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get app metadata")
+	}
+	c.appMetadata = app
+	return app, nil
+}
+
+// AppLogin returns the login of the bot user that the app uses for comments,
+// reviews, and other content it creates, like "my-app[bot]".
+func AppLogin(app *github.App) string {
+	return app.GetSlug() + "[bot]"
+}
+
+// IsSelfComment returns true if login is the login of the app's bot user.
+// Use it to ignore events for comments created by the app itself without
+// ignoring comments from other bots.
+func IsSelfComment(app *github.App, login string) bool {
+	return app.GetSlug() != "" && strings.EqualFold(login, AppLogin(app))
+}
+
+// IsOwnComment returns true if login is the login of the bot user of the app
+// used by cc. It uses the app metadata cached by the ClientCreator, so only
+// the first call for a ClientCreator makes a request to GitHub. Handlers that
+// respond to comments should use it to avoid responding to their own
+// comments.
+func IsOwnComment(ctx context.Context, cc ClientCreator, login string) (bool, error) {
+	app, err := cc.AppMetadata(ctx)
+	if err != nil {
+		return false, err
+	}
+	return IsSelfComment(app, login), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestAppMetadata(t *testing.T) {
+	var requests, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			writeTestGitHubError(w, http.StatusInternalServerError, "Server Error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"slug":"my-app","name":"My App","permissions":{"issues":"write"}}`))
+	}))
+	defer server.Close()
+
+	atomic.StoreInt32(&failures, 1)
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	if _, err := cc.AppMetadata(context.Background()); err == nil {
+		t.Fatal("expected error when GitHub fails, but got nil")
+	}
+
+	for i := 0; i < 2; i++ {
+		app, err := cc.AppMetadata(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if app.GetSlug() != "my-app" || app.GetName() != "My App" {
+			t.Errorf("incorrect app metadata: slug=%q name=%q", app.GetSlug(), app.GetName())
+		}
+		if app.GetPermissions().GetIssues() != "write" {
+			t.Errorf("incorrect issues permission: %q", app.GetPermissions().GetIssues())
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests (one failure, one success), got %d", n)
+	}
+}
+
+func TestIsSelfComment(t *testing.T) {
+	tests := map[string]struct {
+		Slug     string
+		Login    string
+		Expected bool
+	}{
+		"self":        {Slug: "my-app", Login: "my-app[bot]", Expected: true},
+		"caseFolded":  {Slug: "my-app", Login: "My-App[bot]", Expected: true},
+		"otherBot":    {Slug: "my-app", Login: "dependabot[bot]", Expected: false},
+		"user":        {Slug: "my-app", Login: "my-app", Expected: false},
+		"missingSlug": {Login: "[bot]", Expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := &github.App{}
+			if test.Slug != "" {
+				app.Slug = &test.Slug
+			}
+			if got := IsSelfComment(app, test.Login); got != test.Expected {
+				t.Errorf("expected %t, got %t", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestIsOwnComment(t *testing.T) {
+	cc := &MockClientCreator{}
+	cc.Respond("GET", "/app", 0, &github.App{Slug: github.String("my-app")})
+
+	for login, expected := range map[string]bool{
+		"my-app[bot]":     true,
+		"dependabot[bot]": false,
+		"octocat":         false,
+	} {
+		own, err := IsOwnComment(context.Background(), cc, login)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if own != expected {
+			t.Errorf("expected IsOwnComment(%q) to be %t, got %t", login, expected, own)
+		}
+	}
+
+	if _, err := IsOwnComment(context.Background(), &MockClientCreator{}, "my-app[bot]"); err == nil {
+		t.Error("expected error when app metadata is not available, but got nil")
+	}
+}
@@ -15,7 +15,10 @@
 package githubapp
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/go-github/v53/github"
 	lru "github.com/hashicorp/golang-lru"
@@ -28,37 +31,109 @@ const (
 	DefaultCachingClientCapacity = 64
 )
 
+// CacheOptions configure the client cache of a caching ClientCreator.
+type CacheOptions struct {
+	// MaxSize is the maximum number of clients in the cache. When the cache
+	// is full, the least recently used client is evicted. If zero,
+	// DefaultCachingClientCapacity is used.
+	MaxSize int
+
+	// TTL is how long a client stays in the cache after it is created. If
+	// zero, clients are only evicted when the cache is full.
+	TTL time.Duration
+}
+
+// CacheStats contains counters for the client cache of a caching
+// ClientCreator. Evictions include clients removed because the cache was
+// full and clients removed because they expired.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CachingClientCreator is a ClientCreator that caches installation clients.
+type CachingClientCreator interface {
+	ClientCreator
+
+	// CacheStats returns the current cache counters. It is safe to call
+	// concurrently with client creation.
+	CacheStats() CacheStats
+}
+
 // NewDefaultCachingClientCreator returns a ClientCreator using values from the
-// configuration or other defaults.
+// configuration or other defaults. It returns an error if the API URLs in the
+// configuration are invalid or if the private key cannot be loaded. See
+// Config.APIURLs for how missing API URLs are determined and
+// Config.LoadPrivateKey for how the private key is loaded.
 func NewDefaultCachingClientCreator(c Config, opts ...ClientOption) (ClientCreator, error) {
+	v3APIURL, v4APIURL, err := c.APIURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := c.LoadPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// options from the caller take precedence over the configured slug
+	if c.App.Slug != "" {
+		opts = append([]ClientOption{WithClientAppSlug(c.App.Slug)}, opts...)
+	}
+
 	delegate := NewClientCreator(
-		c.V3APIURL,
-		c.V4APIURL,
+		v3APIURL,
+		v4APIURL,
 		c.App.IntegrationID,
-		[]byte(c.App.PrivateKey),
+		privateKey,
 		opts...,
 	)
-	return NewCachingClientCreator(delegate, DefaultCachingClientCapacity)
+	return NewCachingClientCreator(delegate, CacheOptions{})
 }
 
 // NewCachingClientCreator returns a ClientCreator that creates a GitHub client for installations of the app specified
-// by the provided arguments. It uses an LRU cache of the provided capacity to store clients created for installations
-// and returns cached clients when a cache hit exists.
-func NewCachingClientCreator(delegate ClientCreator, capacity int) (ClientCreator, error) {
-	cache, err := lru.New(capacity)
+// by the provided arguments. It uses an LRU cache configured by opts to store clients created for installations
+// and returns cached clients when a cache hit exists. Evicted clients are dropped from the cache and their
+// transports are left for garbage collection.
+func NewCachingClientCreator(delegate ClientCreator, opts CacheOptions) (CachingClientCreator, error) {
+	size := opts.MaxSize
+	if size == 0 {
+		size = DefaultCachingClientCapacity
+	}
+
+	c := &cachingClientCreator{
+		delegate: delegate,
+		ttl:      opts.TTL,
+		now:      time.Now,
+	}
+
+	cache, err := lru.NewWithEvict(size, func(key, value interface{}) {
+		atomic.AddUint64(&c.evictions, 1)
+	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create cache")
 	}
+	c.cachedClients = cache
 
-	return &cachingClientCreator{
-		cachedClients: cache,
-		delegate:      delegate,
-	}, nil
+	return c, nil
 }
 
 type cachingClientCreator struct {
 	cachedClients *lru.Cache
 	delegate      ClientCreator
+
+	ttl time.Duration
+	now func() time.Time
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type cachedClient struct {
+	client  interface{}
+	expires time.Time
 }
 
 func (c *cachingClientCreator) NewAppClient() (*github.Client, error) {
@@ -74,11 +149,8 @@ func (c *cachingClientCreator) NewAppV4Client() (*githubv4.Client, error) {
 func (c *cachingClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
 	// if client is in cache, return it
 	key := c.toCacheKey("v3", installationID)
-	val, ok := c.cachedClients.Get(key)
-	if ok {
-		if client, ok := val.(*github.Client); ok {
-			return client, nil
-		}
+	if client, ok := c.get(key).(*github.Client); ok {
+		return client, nil
 	}
 
 	// otherwise, create and return
@@ -86,18 +158,31 @@ func (c *cachingClientCreator) NewInstallationClient(installationID int64) (*git
 	if err != nil {
 		return nil, err
 	}
-	c.cachedClients.Add(key, client)
+	c.add(key, client)
+	return client, nil
+}
+
+func (c *cachingClientCreator) NewInstallationClientContext(ctx context.Context, installationID int64) (*github.Client, error) {
+	// if client is in cache, return it
+	key := c.toCacheKey("v3", installationID)
+	if client, ok := c.get(key).(*github.Client); ok {
+		return client, nil
+	}
+
+	// otherwise, create and return
+	client, err := c.delegate.NewInstallationClientContext(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, client)
 	return client, nil
 }
 
 func (c *cachingClientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
 	// if client is in cache, return it
 	key := c.toCacheKey("v4", installationID)
-	val, ok := c.cachedClients.Get(key)
-	if ok {
-		if client, ok := val.(*githubv4.Client); ok {
-			return client, nil
-		}
+	if client, ok := c.get(key).(*githubv4.Client); ok {
+		return client, nil
 	}
 
 	// otherwise, create and return
@@ -105,7 +190,39 @@ func (c *cachingClientCreator) NewInstallationV4Client(installationID int64) (*g
 	if err != nil {
 		return nil, err
 	}
-	c.cachedClients.Add(key, client)
+	c.add(key, client)
+	return client, nil
+}
+
+func (c *cachingClientCreator) NewInstallationV4ClientContext(ctx context.Context, installationID int64) (*githubv4.Client, error) {
+	// if client is in cache, return it
+	key := c.toCacheKey("v4", installationID)
+	if client, ok := c.get(key).(*githubv4.Client); ok {
+		return client, nil
+	}
+
+	// otherwise, create and return
+	client, err := c.delegate.NewInstallationV4ClientContext(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, client)
+	return client, nil
+}
+
+func (c *cachingClientCreator) NewScopedInstallationClient(installationID int64, opts ScopedTokenOptions) (*github.Client, error) {
+	// scoped clients are cached separately from each other and from unscoped
+	// clients so that tokens with different access never collide
+	key := fmt.Sprintf("%s:%s", c.toCacheKey("v3", installationID), opts.cacheKey())
+	if client, ok := c.get(key).(*github.Client); ok {
+		return client, nil
+	}
+
+	client, err := c.delegate.NewScopedInstallationClient(installationID, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, client)
 	return client, nil
 }
 
@@ -129,6 +246,74 @@ func (c *cachingClientCreator) NewTokenSourceV4Client(ts oauth2.TokenSource) (*g
 	return c.delegate.NewTokenSourceV4Client(ts)
 }
 
+func (c *cachingClientCreator) InstallationToken(ctx context.Context, installationID int64) (string, time.Time, error) {
+	return c.delegate.InstallationToken(ctx, installationID)
+}
+
+func (c *cachingClientCreator) ScopedInstallationToken(ctx context.Context, installationID int64, opts ScopedTokenOptions) (string, time.Time, error) {
+	return c.delegate.ScopedInstallationToken(ctx, installationID, opts)
+}
+
+func (c *cachingClientCreator) RevokeInstallationToken(ctx context.Context, token string) error {
+	return c.delegate.RevokeInstallationToken(ctx, token)
+}
+
+func (c *cachingClientCreator) NewSingleUseInstallationClient(ctx context.Context, installationID int64) (*SingleUseClient, error) {
+	// single-use clients are never cached
+	return c.delegate.NewSingleUseInstallationClient(ctx, installationID)
+}
+
+func (c *cachingClientCreator) PrewarmInstallation(ctx context.Context, installationID int64) error {
+	return c.delegate.PrewarmInstallation(ctx, installationID)
+}
+
+func (c *cachingClientCreator) StartTokenRefresher(ctx context.Context, installationIDs []int64, interval time.Duration) {
+	c.delegate.StartTokenRefresher(ctx, installationIDs, interval)
+}
+
+func (c *cachingClientCreator) RateLimitStatus(installationID int64) (RateLimit, bool) {
+	return c.delegate.RateLimitStatus(installationID)
+}
+
+func (c *cachingClientCreator) TokenCacheStats() TokenCacheStats {
+	return c.delegate.TokenCacheStats()
+}
+
+func (c *cachingClientCreator) AppMetadata(ctx context.Context) (*github.App, error) {
+	return c.delegate.AppMetadata(ctx)
+}
+
+func (c *cachingClientCreator) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// get returns the cached client for key or nil if there is no client or the
+// client expired.
+func (c *cachingClientCreator) get(key string) interface{} {
+	if val, ok := c.cachedClients.Get(key); ok {
+		entry := val.(cachedClient)
+		if entry.expires.IsZero() || c.now().Before(entry.expires) {
+			atomic.AddUint64(&c.hits, 1)
+			return entry.client
+		}
+		c.cachedClients.Remove(key)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return nil
+}
+
+func (c *cachingClientCreator) add(key string, client interface{}) {
+	entry := cachedClient{client: client}
+	if c.ttl > 0 {
+		entry.expires = c.now().Add(c.ttl)
+	}
+	c.cachedClients.Add(key, entry)
+}
+
 func (c *cachingClientCreator) toCacheKey(apiVersion string, installationID int64) string {
 	return fmt.Sprintf("%s:%d", apiVersion, installationID)
 }
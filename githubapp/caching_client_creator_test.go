@@ -0,0 +1,127 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestCachingClientCreator(t *testing.T) {
+	tests := map[string]struct {
+		Options       CacheOptions
+		Installations []int64
+		Advance       time.Duration
+
+		Created int
+		Stats   CacheStats
+	}{
+		"cachesClients": {
+			Installations: []int64{1, 1, 2, 1},
+			Created:       2,
+			Stats:         CacheStats{Hits: 2, Misses: 2},
+		},
+		"evictsLeastRecentlyUsed": {
+			Options:       CacheOptions{MaxSize: 1},
+			Installations: []int64{1, 2, 1},
+			Created:       3,
+			Stats:         CacheStats{Misses: 3, Evictions: 2},
+		},
+		"expiresClients": {
+			Options:       CacheOptions{TTL: time.Minute},
+			Installations: []int64{1, 1, 1},
+			Advance:       time.Minute,
+			Created:       3,
+			Stats:         CacheStats{Misses: 3, Evictions: 2},
+		},
+		"keepsUnexpiredClients": {
+			Options:       CacheOptions{TTL: time.Minute},
+			Installations: []int64{1, 1, 1},
+			Advance:       time.Second,
+			Created:       1,
+			Stats:         CacheStats{Hits: 2, Misses: 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			delegate := &countingClientCreator{}
+
+			cc, err := NewCachingClientCreator(delegate, test.Options)
+			if err != nil {
+				t.Fatalf("unexpected error creating client creator: %v", err)
+			}
+
+			now := time.Now()
+			cc.(*cachingClientCreator).now = func() time.Time { return now }
+
+			for _, id := range test.Installations {
+				if _, err := cc.NewInstallationClientContext(context.Background(), id); err != nil {
+					t.Fatalf("unexpected error creating client: %v", err)
+				}
+				now = now.Add(test.Advance)
+			}
+
+			if delegate.created != test.Created {
+				t.Errorf("incorrect number of created clients: expected %d, actual %d", test.Created, delegate.created)
+			}
+			if stats := cc.CacheStats(); stats != test.Stats {
+				t.Errorf("incorrect stats: expected %+v, actual %+v", test.Stats, stats)
+			}
+		})
+	}
+}
+
+func TestCachingClientCreatorLazyClients(t *testing.T) {
+	delegate := &countingClientCreator{}
+
+	cc, err := NewCachingClientCreator(delegate, CacheOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error creating client creator: %v", err)
+	}
+
+	// clients created without a context must not request a token, so the
+	// cache delegates to the lazy method instead of the context method
+	for i := 0; i < 2; i++ {
+		if _, err := cc.NewInstallationClient(1); err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+	}
+
+	assertField(t, "lazy clients", 1, delegate.lazy)
+	assertField(t, "context clients", 0, delegate.created)
+	assertField(t, "stats", CacheStats{Hits: 1, Misses: 1}, cc.CacheStats())
+}
+
+// countingClientCreator counts the installation clients it creates. Calling
+// any other method panics.
+type countingClientCreator struct {
+	ClientCreator
+	created int
+	lazy    int
+}
+
+func (cc *countingClientCreator) NewInstallationClientContext(ctx context.Context, installationID int64) (*github.Client, error) {
+	cc.created++
+	return github.NewClient(nil), nil
+}
+
+func (cc *countingClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	cc.lazy++
+	return github.NewClient(nil), nil
+}
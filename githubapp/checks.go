@@ -0,0 +1,283 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// MaxAnnotationsPerRequest is the maximum number of annotations GitHub
+// accepts in a single request to create or update a check run.
+const MaxAnnotationsPerRequest = 50
+
+// Check run statuses.
+const (
+	CheckStatusQueued     = "queued"
+	CheckStatusInProgress = "in_progress"
+	CheckStatusCompleted  = "completed"
+)
+
+// Check run conclusions.
+const (
+	CheckConclusionSuccess        = "success"
+	CheckConclusionFailure        = "failure"
+	CheckConclusionNeutral        = "neutral"
+	CheckConclusionCancelled      = "cancelled"
+	CheckConclusionSkipped        = "skipped"
+	CheckConclusionTimedOut       = "timed_out"
+	CheckConclusionActionRequired = "action_required"
+)
+
+// CheckRunRequest describes a check run created by CreateCheckRun or updated
+// by UpdateCheckRun.
+type CheckRunRequest struct {
+	Owner string
+	Repo  string
+	Name  string
+
+	// HeadSHA is the commit the check run reports on. It is required by
+	// CreateCheckRun and ignored by UpdateCheckRun.
+	HeadSHA string
+
+	DetailsURL string
+	ExternalID string
+
+	// Status is the status of the check run. If empty and Conclusion is set,
+	// the check run is completed. If both are empty, new check runs are queued
+	// and existing check runs keep their status.
+	Status     string
+	Conclusion string
+
+	// Title and Summary are required if Text or Annotations are set.
+	Title   string
+	Summary string
+	Text    string
+
+	// Annotations are sent in batches of MaxAnnotationsPerRequest. GitHub
+	// adds the annotations of each request to the annotations already on the
+	// check run.
+	Annotations []*github.CheckRunAnnotation
+
+	Actions []*github.CheckRunAction
+}
+
+// InProgress returns a copy of the request that marks the check run as in
+// progress.
+func (r CheckRunRequest) InProgress() CheckRunRequest {
+	r.Status = CheckStatusInProgress
+	r.Conclusion = ""
+	return r
+}
+
+// Complete returns a copy of the request that completes the check run with
+// a conclusion.
+func (r CheckRunRequest) Complete(conclusion string) CheckRunRequest {
+	r.Status = CheckStatusCompleted
+	r.Conclusion = conclusion
+	return r
+}
+
+// CreateCheckRun creates a check run. If the request has more than
+// MaxAnnotationsPerRequest annotations, the check run is created with the
+// first batch and updated with each remaining batch. When the request
+// completes the check run, it is created as in progress and only completed
+// by the final update, so that the check run never appears complete with
+// partial annotations.
+func CreateCheckRun(ctx context.Context, client *github.Client, req CheckRunRequest) (*github.CheckRun, error) {
+	if req.HeadSHA == "" {
+		return nil, errors.New("check run request must set a head SHA")
+	}
+	status, err := req.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	batches := annotationBatches(req.Annotations)
+	deferred := status == CheckStatusCompleted && len(batches) > 1
+
+	opts := github.CreateCheckRunOptions{
+		Name:       req.Name,
+		HeadSHA:    req.HeadSHA,
+		DetailsURL: optionalString(req.DetailsURL),
+		ExternalID: optionalString(req.ExternalID),
+		Status:     optionalString(status),
+		Output:     req.output(batches[0]),
+		Actions:    req.Actions,
+	}
+	if deferred {
+		opts.Status = github.String(CheckStatusInProgress)
+	}
+	if opts.GetStatus() == CheckStatusInProgress {
+		opts.StartedAt = &github.Timestamp{Time: time.Now()}
+	}
+	if opts.GetStatus() == CheckStatusCompleted {
+		opts.Conclusion = github.String(req.Conclusion)
+		opts.CompletedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped creating check run", "owner", req.Owner, "repo", req.Repo, "name", req.Name, "sha", req.HeadSHA, "status", status)
+		return dryRunCheckRun(req, status), nil
+	}
+
+	run, _, err := client.Checks.CreateCheckRun(ctx, req.Owner, req.Repo, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create check run %q", req.Name)
+	}
+	return addCheckRunAnnotations(ctx, client, req, status, run.GetID(), run, batches[1:])
+}
+
+// UpdateCheckRun updates an existing check run. Like CreateCheckRun, it
+// sends annotations in batches and only completes the check run with the
+// final batch.
+func UpdateCheckRun(ctx context.Context, client *github.Client, checkRunID int64, req CheckRunRequest) (*github.CheckRun, error) {
+	status, err := req.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	batches := annotationBatches(req.Annotations)
+	deferred := status == CheckStatusCompleted && len(batches) > 1
+
+	opts := github.UpdateCheckRunOptions{
+		Name:       req.Name,
+		DetailsURL: optionalString(req.DetailsURL),
+		ExternalID: optionalString(req.ExternalID),
+		Output:     req.output(batches[0]),
+		Actions:    req.Actions,
+	}
+	if !deferred {
+		req.setStatus(&opts, status)
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped updating check run", "owner", req.Owner, "repo", req.Repo, "check_run", checkRunID, "status", status)
+		run := dryRunCheckRun(req, status)
+		run.ID = github.Int64(checkRunID)
+		return run, nil
+	}
+
+	run, _, err := client.Checks.UpdateCheckRun(ctx, req.Owner, req.Repo, checkRunID, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update check run %d", checkRunID)
+	}
+	return addCheckRunAnnotations(ctx, client, req, status, checkRunID, run, batches[1:])
+}
+
+// addCheckRunAnnotations sends the remaining batches of annotations and
+// completes the check run with the last batch, if requested.
+func addCheckRunAnnotations(ctx context.Context, client *github.Client, req CheckRunRequest, status string, checkRunID int64, run *github.CheckRun, batches [][]*github.CheckRunAnnotation) (*github.CheckRun, error) {
+	for i, batch := range batches {
+		opts := github.UpdateCheckRunOptions{
+			Name:   req.Name,
+			Output: req.output(batch),
+		}
+		if i == len(batches)-1 {
+			req.setStatus(&opts, status)
+		}
+
+		var err error
+		if run, _, err = client.Checks.UpdateCheckRun(ctx, req.Owner, req.Repo, checkRunID, opts); err != nil {
+			return nil, errors.Wrapf(err, "failed to add annotations to check run %d", checkRunID)
+		}
+	}
+	return run, nil
+}
+
+// validate checks that the request is consistent and returns the status to
+// set on the check run.
+func (r CheckRunRequest) validate() (string, error) {
+	if r.Name == "" {
+		return "", errors.New("check run request must set a name")
+	}
+	if (r.Text != "" || len(r.Annotations) > 0) && (r.Title == "" || r.Summary == "") {
+		return "", errors.New("check run request with text or annotations must set a title and summary")
+	}
+
+	status := r.Status
+	if status == "" && r.Conclusion != "" {
+		status = CheckStatusCompleted
+	}
+	if status == CheckStatusCompleted && r.Conclusion == "" {
+		return "", errors.New("completed check run request must set a conclusion")
+	}
+	if status != CheckStatusCompleted && r.Conclusion != "" {
+		return "", errors.Errorf("check run request with status %q must not set a conclusion", status)
+	}
+	return status, nil
+}
+
+func (r CheckRunRequest) setStatus(opts *github.UpdateCheckRunOptions, status string) {
+	opts.Status = optionalString(status)
+	if status == CheckStatusCompleted {
+		opts.Conclusion = github.String(r.Conclusion)
+		opts.CompletedAt = &github.Timestamp{Time: time.Now()}
+	}
+}
+
+func (r CheckRunRequest) output(annotations []*github.CheckRunAnnotation) *github.CheckRunOutput {
+	if r.Title == "" && r.Summary == "" {
+		return nil
+	}
+	return &github.CheckRunOutput{
+		Title:       github.String(r.Title),
+		Summary:     github.String(r.Summary),
+		Text:        optionalString(r.Text),
+		Annotations: annotations,
+	}
+}
+
+// annotationBatches splits annotations into batches GitHub accepts. It
+// always returns at least one batch, which may be empty.
+func annotationBatches(annotations []*github.CheckRunAnnotation) [][]*github.CheckRunAnnotation {
+	var batches [][]*github.CheckRunAnnotation
+	for start := 0; start < len(annotations); start += MaxAnnotationsPerRequest {
+		end := start + MaxAnnotationsPerRequest
+		if end > len(annotations) {
+			end = len(annotations)
+		}
+		batches = append(batches, annotations[start:end])
+	}
+	if len(batches) == 0 {
+		batches = append(batches, nil)
+	}
+	return batches
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// dryRunCheckRun returns the check run synthesized for a request in dry-run
+// mode.
+func dryRunCheckRun(req CheckRunRequest, status string) *github.CheckRun {
+	run := &github.CheckRun{
+		NodeID:  github.String(DryRunNodeID),
+		Name:    optionalString(req.Name),
+		HeadSHA: optionalString(req.HeadSHA),
+		Status:  optionalString(status),
+	}
+	if status == CheckStatusCompleted {
+		run.Conclusion = optionalString(req.Conclusion)
+	}
+	return run
+}
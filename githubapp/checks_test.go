@@ -0,0 +1,212 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestCheckRuns(t *testing.T) {
+	tests := map[string]struct {
+		Update      bool
+		Request     CheckRunRequest
+		Annotations int
+
+		Requests []testCheckRunRequest
+	}{
+		"createCompleted": {
+			Request: CheckRunRequest{Title: "Lint", Summary: "No problems"}.Complete(CheckConclusionSuccess),
+			Requests: []testCheckRunRequest{
+				{Method: "POST", Status: "completed", Conclusion: "success", Completed: true},
+			},
+		},
+		"createInProgress": {
+			Request: CheckRunRequest{}.InProgress(),
+			Requests: []testCheckRunRequest{
+				{Method: "POST", Status: "in_progress", Started: true},
+			},
+		},
+		"createBatchesAnnotations": {
+			Request:     CheckRunRequest{Title: "Lint", Summary: "120 problems"}.Complete(CheckConclusionFailure),
+			Annotations: 120,
+			Requests: []testCheckRunRequest{
+				{Method: "POST", Status: "in_progress", Started: true, Annotations: 50},
+				{Method: "PATCH", Annotations: 50},
+				{Method: "PATCH", Status: "completed", Conclusion: "failure", Completed: true, Annotations: 20},
+			},
+		},
+		"createQueuedBatchesAnnotations": {
+			Request:     CheckRunRequest{Title: "Lint", Summary: "60 problems"},
+			Annotations: 60,
+			Requests: []testCheckRunRequest{
+				{Method: "POST", Annotations: 50},
+				{Method: "PATCH", Annotations: 10},
+			},
+		},
+		"updateInProgress": {
+			Update:  true,
+			Request: CheckRunRequest{}.InProgress(),
+			Requests: []testCheckRunRequest{
+				{Method: "PATCH", Status: "in_progress"},
+			},
+		},
+		"updateBatchesAnnotations": {
+			Update:      true,
+			Request:     CheckRunRequest{Title: "Lint", Summary: "51 problems", Conclusion: CheckConclusionFailure},
+			Annotations: 51,
+			Requests: []testCheckRunRequest{
+				{Method: "PATCH", Annotations: 50},
+				{Method: "PATCH", Status: "completed", Conclusion: "failure", Completed: true, Annotations: 1},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestCheckRunServer(t)
+
+			req := test.Request
+			req.Owner, req.Repo, req.Name, req.HeadSHA = "owner", "repo", "lint", "head-sha"
+			for i := 0; i < test.Annotations; i++ {
+				req.Annotations = append(req.Annotations, &github.CheckRunAnnotation{
+					Path:            github.String("main.go"),
+					StartLine:       github.Int(i + 1),
+					EndLine:         github.Int(i + 1),
+					AnnotationLevel: github.String("warning"),
+					Message:         github.String("problem"),
+				})
+			}
+
+			var run *github.CheckRun
+			var err error
+			if test.Update {
+				run, err = UpdateCheckRun(context.Background(), srv.Client(), 42, req)
+			} else {
+				run, err = CreateCheckRun(context.Background(), srv.Client(), req)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if run.GetID() != 42 {
+				t.Errorf("incorrect check run ID: %d", run.GetID())
+			}
+			if !reflect.DeepEqual(test.Requests, srv.Requests) {
+				t.Errorf("incorrect requests:\nexpected: %+v\n  actual: %+v", test.Requests, srv.Requests)
+			}
+		})
+	}
+}
+
+func TestCheckRunRequestErrors(t *testing.T) {
+	tests := map[string]CheckRunRequest{
+		"missingName":    {HeadSHA: "head-sha"},
+		"missingHeadSHA": {Name: "lint"},
+		"missingSummary": {Name: "lint", HeadSHA: "head-sha", Title: "Lint", Text: "details"},
+		"missingConclusion": {
+			Name: "lint", HeadSHA: "head-sha", Status: CheckStatusCompleted,
+		},
+		"conclusionWithStatus": {
+			Name: "lint", HeadSHA: "head-sha", Status: CheckStatusInProgress, Conclusion: CheckConclusionSuccess,
+		},
+	}
+
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestCheckRunServer(t)
+
+			if _, err := CreateCheckRun(context.Background(), srv.Client(), req); err == nil {
+				t.Fatal("expected error, but got nil")
+			}
+			if len(srv.Requests) > 0 {
+				t.Errorf("unexpected requests: %+v", srv.Requests)
+			}
+		})
+	}
+}
+
+type testCheckRunRequest struct {
+	Method      string
+	Status      string
+	Conclusion  string
+	Started     bool
+	Completed   bool
+	Annotations int
+}
+
+// testCheckRunServer records the requests that create and update check
+// runs. All check runs have ID 42.
+type testCheckRunServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	Requests []testCheckRunRequest
+}
+
+func newTestCheckRunServer(t *testing.T) *testCheckRunServer {
+	s := &testCheckRunServer{}
+
+	record := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Status      string  `json:"status"`
+			Conclusion  string  `json:"conclusion"`
+			StartedAt   *string `json:"started_at"`
+			CompletedAt *string `json:"completed_at"`
+			Output      struct {
+				Annotations []json.RawMessage `json:"annotations"`
+			} `json:"output"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+
+		s.mu.Lock()
+		s.Requests = append(s.Requests, testCheckRunRequest{
+			Method:      r.Method,
+			Status:      body.Status,
+			Conclusion:  body.Conclusion,
+			Started:     body.StartedAt != nil,
+			Completed:   body.CompletedAt != nil,
+			Annotations: len(body.Output.Annotations),
+		})
+		s.mu.Unlock()
+
+		fmt.Fprintf(w, `{"id":42,"status":%q}`, body.Status)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/check-runs", record)
+	mux.HandleFunc("/repos/owner/repo/check-runs/42", record)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testCheckRunServer) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
@@ -21,11 +21,12 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v53/github"
 	"github.com/gregjones/httpcache"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/pkg/errors"
 	"github.com/shurcooL/githubv4"
 	"golang.org/x/oauth2"
@@ -62,7 +63,8 @@ type ClientCreator interface {
 	// key, and the given installation ID. The returned client makes all calls using
 	// the application's authorization token. The client gets that token by creating
 	// and signing a JWT for the application and requesting a token using it. The
-	// token is cached by the client and is refreshed as needed if it expires.
+	// token is cached by the ClientCreator, shared by all clients for the
+	// installation, and is refreshed as needed if it expires.
 	//
 	// See the following for more information:
 	//  * https://developer.github.com/apps/building-github-apps/authenticating-with-github-apps/#authenticating-as-an-installation
@@ -75,22 +77,104 @@ type ClientCreator interface {
 	//  * the installation ID is the ID that is shown in the URL of https://{githubURL}/settings/installations/{#}
 	//      (navigate to the "installations" page without the # and go to the app's page to see the number)
 	//  * the key bytes must be a PEM-encoded PKCS1 or PKCS8 private key for the application
+	//
+	// NewInstallationClient does not contact GitHub. The client requests an
+	// installation token for its first request, using the context of that
+	// request. If GitHub reports that the installation does not exist or is
+	// suspended, the request fails with an error that matches
+	// ErrInstallationNotFound or ErrInstallationSuspended when using
+	// errors.Is.
 	NewInstallationClient(installationID int64) (*github.Client, error)
 
+	// NewInstallationClientContext is like NewInstallationClient, but uses
+	// ctx to request the installation token before returning the client, so
+	// a deadline or cancellation in ctx applies to contacting GitHub and
+	// errors for missing or suspended installations are returned
+	// immediately. Tokens requested later, after the initial token expires,
+	// use the context of the API request that needs them.
+	NewInstallationClientContext(ctx context.Context, installationID int64) (*github.Client, error)
+
 	// NewInstallationV4Client returns an installation-authenticated v4 API client, similar to NewInstallationClient.
 	NewInstallationV4Client(installationID int64) (*githubv4.Client, error)
 
+	// NewInstallationV4ClientContext returns an installation-authenticated v4
+	// API client, similar to NewInstallationClientContext.
+	NewInstallationV4ClientContext(ctx context.Context, installationID int64) (*githubv4.Client, error)
+
+	// NewScopedInstallationClient returns an installation client, similar to
+	// NewInstallationClient, that requests tokens restricted to a subset of
+	// the installation's repositories and permissions.
+	//
+	// See the following for more information:
+	//  * https://docs.github.com/en/rest/apps/apps#create-an-installation-access-token-for-an-app
+	NewScopedInstallationClient(installationID int64, opts ScopedTokenOptions) (*github.Client, error)
+
 	// NewTokenSourceClient returns a *github.Client that uses the passed in OAuth token source for authentication.
 	NewTokenSourceClient(ts oauth2.TokenSource) (*github.Client, error)
 
 	// NewTokenSourceClient returns a *githubv4.Client that uses the passed in OAuth token source for authentication.
 	NewTokenSourceV4Client(ts oauth2.TokenSource) (*githubv4.Client, error)
 
+	// InstallationToken returns an installation token and its expiration time
+	// for use outside of GitHub clients, like authenticating git over HTTPS
+	// with "x-access-token" as the username. The token comes from the same
+	// cache used by installation clients, so it may expire soon after it is
+	// returned; callers should request a new token before it expires instead
+	// of storing it.
+	//
+	// The token grants access to the installation and must not be logged.
+	InstallationToken(ctx context.Context, installationID int64) (string, time.Time, error)
+
+	// ScopedInstallationToken returns an installation token, similar to
+	// InstallationToken, restricted to a subset of the installation's
+	// repositories and permissions.
+	ScopedInstallationToken(ctx context.Context, installationID int64, opts ScopedTokenOptions) (string, time.Time, error)
+
+	// RevokeInstallationToken revokes an installation token so that it can
+	// no longer be used and removes it from the token cache. Installation
+	// clients that used the token request a new token for their next request.
+	RevokeInstallationToken(ctx context.Context, token string) error
+
+	// NewSingleUseInstallationClient returns an installation client, similar
+	// to NewInstallationClientContext, with a token that is not shared with
+	// other clients. Closing the client revokes the token, so callers should
+	// close the client as soon as it is no longer needed to limit the impact
+	// of a leaked token.
+	NewSingleUseInstallationClient(ctx context.Context, installationID int64) (*SingleUseClient, error)
+
+	// PrewarmInstallation creates and caches a token for the installation so
+	// that clients created later for the installation do not have to wait for
+	// GitHub to issue a token.
+	PrewarmInstallation(ctx context.Context, installationID int64) error
+
+	// StartTokenRefresher starts a goroutine that checks the cached tokens
+	// for the installations at every interval and replaces tokens that expire
+	// within the next five minutes. Failures are logged with the logger from
+	// ctx and do not remove tokens that are still valid. The refresher stops
+	// when ctx is canceled. If interval is not positive, the refresher checks
+	// tokens every minute.
+	StartTokenRefresher(ctx context.Context, installationIDs []int64, interval time.Duration)
+
 	// NewTokenClient returns a *github.Client that uses the passed in OAuth token for authentication.
 	NewTokenClient(token string) (*github.Client, error)
 
 	// NewTokenV4Client returns a *githubv4.Client that uses the passed in OAuth token for authentication.
 	NewTokenV4Client(token string) (*githubv4.Client, error)
+
+	// RateLimitStatus returns the most recent rate limit state observed by
+	// installation clients for the given installation ID. It returns false if
+	// rate limit tracking is disabled or if no installation client has
+	// received a response for the installation.
+	RateLimitStatus(installationID int64) (RateLimit, bool)
+
+	// TokenCacheStats returns statistics about the installation token cache.
+	// It is safe to call concurrently with other methods.
+	TokenCacheStats() TokenCacheStats
+
+	// AppMetadata returns the app's metadata, like its slug, name, and
+	// permissions, from the "GET /app" endpoint. The result is cached after
+	// the first successful request, so callers should not modify it.
+	AppMetadata(ctx context.Context) (*github.App, error)
 }
 
 var (
@@ -109,6 +193,9 @@ func NewClientCreator(v3BaseURL, v4BaseURL string, integrationID int64, privKeyB
 		v4BaseURL:     v4BaseURL,
 		integrationID: integrationID,
 		privKeyBytes:  privKeyBytes,
+		tokens:        newInstallationTokenCache(),
+
+		installationIDs: newInstallationIDCache(),
 	}
 
 	for _, opt := range opts {
@@ -131,11 +218,41 @@ type clientCreator struct {
 	integrationID  int64
 	privKeyBytes   []byte
 	userAgent      string
+	appSlug        string
 	middleware     []ClientMiddleware
 	cacheFunc      func() httpcache.Cache
 	alwaysValidate bool
 	timeout        time.Duration
 	transport      http.RoundTripper
+	rateLimits     *rateLimitTracker
+	metrics        Metrics
+	tracer         Tracer
+	retry          *RetryConfig
+	tokens         *installationTokenCache
+	tokenHook      TokenHook
+
+	disableTokenCache bool
+
+	graphQLCostHook       GraphQLCostHook
+	secondaryRateLimitMax time.Duration
+	rateLimitMaxWait      time.Duration
+	jwtExpiry             time.Duration
+	jwtClockSkew          *time.Duration
+
+	missingPermissionErrors bool
+
+	conditionalCache *lru.Cache
+	concurrency      *installationLimiter
+
+	transportMiddleware []ClientMiddleware
+
+	appMetadataMu sync.Mutex
+	appMetadata   *github.App
+
+	tokenClientMu sync.Mutex
+	tokenClient   *github.Client
+
+	installationIDs *installationIDCache
 }
 
 var _ ClientCreator = &clientCreator{}
@@ -146,13 +263,27 @@ type ClientOption func(c *clientCreator)
 // functionality, like logging or metrics collection.
 type ClientMiddleware func(http.RoundTripper) http.RoundTripper
 
-// WithClientUserAgent sets the base user agent for all created clients.
+// WithClientUserAgent sets the base user agent for all created clients,
+// including the clients used to create installation tokens. The user agent
+// sent to GitHub starts with the base, followed by details about the client,
+// like the installation ID, and the go-github version. Use a descriptive base,
+// like "my-app/1.0.0", so the application can be identified in audit logs.
 func WithClientUserAgent(agent string) ClientOption {
 	return func(c *clientCreator) {
 		c.userAgent = agent
 	}
 }
 
+// WithClientAppSlug sets the slug of the app, which is included in the user
+// agent of all created clients. This distinguishes requests from different
+// apps in the same program. If the base user agent is not set, the slug is
+// also used as the base.
+func WithClientAppSlug(slug string) ClientOption {
+	return func(c *clientCreator) {
+		c.appSlug = slug
+	}
+}
+
 // WithClientCaching sets an HTTP cache for all created clients
 // using the provided cache implementation
 // If alwaysValidate is true, the cache validates all saved responses before returning them.
@@ -173,6 +304,11 @@ func WithClientTimeout(timeout time.Duration) ClientOption {
 }
 
 // WithClientMiddleware adds middleware that is applied to all created clients.
+// Middleware is applied in order, so the first element is the outermost
+// function. Client middleware wraps the authentication and caching layers: it
+// sees requests before authentication headers are added and receives cached
+// responses. Use WithTransportMiddleware to see the final requests sent to
+// GitHub.
 func WithClientMiddleware(middleware ...ClientMiddleware) ClientOption {
 	return func(c *clientCreator) {
 		c.middleware = middleware
@@ -188,9 +324,45 @@ func WithTransport(transport http.RoundTripper) ClientOption {
 	}
 }
 
+// WithTransportMiddleware adds middleware that wraps the base transport of all
+// created clients, including the requests that app and installation clients
+// make to create tokens. Middleware is applied in order, so the first element
+// is the outermost function.
+//
+// Unlike WithClientMiddleware, transport middleware runs after the
+// authentication and caching layers: it sees each request exactly as it is
+// sent to GitHub, with authentication headers set, and never sees responses
+// served from the cache. This makes it the right place for tracing headers or
+// circuit breakers that must observe all network traffic.
+func WithTransportMiddleware(middleware ...ClientMiddleware) ClientOption {
+	return func(c *clientCreator) {
+		c.transportMiddleware = middleware
+	}
+}
+
+// WithTokenHook sets a function that is called each time an installation
+// client requests a token, either from the cache or from GitHub. The hook is
+// called synchronously before the token is used, so it runs in the same
+// goroutine as the request that needed the token. Hooks should return quickly
+// and must be safe to call concurrently.
+func WithTokenHook(hook TokenHook) ClientOption {
+	return func(c *clientCreator) {
+		c.tokenHook = hook
+	}
+}
+
+// WithRateLimitTracking enables tracking of the rate limit headers returned to
+// installation clients. Use the RateLimitStatus method of the ClientCreator to
+// get the most recent state for an installation.
+func WithRateLimitTracking() ClientOption {
+	return func(c *clientCreator) {
+		c.rateLimits = newRateLimitTracker()
+	}
+}
+
 func (c *clientCreator) NewAppClient() (*github.Client, error) {
 	base := c.newHTTPClient()
-	installation, transportError := newAppInstallation(c.integrationID, c.privKeyBytes, c.v3BaseURL)
+	installation, transportError := c.newAppInstallation()
 
 	middleware := []ClientMiddleware{installation}
 	if c.cacheFunc != nil {
@@ -204,18 +376,22 @@ func (c *clientCreator) NewAppClient() (*github.Client, error) {
 	if *transportError != nil {
 		return nil, *transportError
 	}
+
+	// let FindRepositoryInstallation and FindOrganizationInstallation use
+	// this app's installation ID cache
+	base.Transport = &appTransport{RoundTripper: base.Transport, installationIDs: c.installationIDs}
 	return client, nil
 }
 
 func (c *clientCreator) NewAppV4Client() (*githubv4.Client, error) {
 	base := c.newHTTPClient()
-	installation, transportError := newAppInstallation(c.integrationID, c.privKeyBytes, c.v3BaseURL)
+	installation, transportError := c.newAppInstallation()
 
 	// The v4 API primarily uses POST requests (except for introspection queries)
 	// which we cannot cache, so don't add the cache middleware
 	middleware := []ClientMiddleware{installation}
 
-	client, err := c.newV4Client(base, middleware, "application")
+	client, err := c.newV4Client(base, middleware, "application", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -226,40 +402,81 @@ func (c *clientCreator) NewAppV4Client() (*githubv4.Client, error) {
 }
 
 func (c *clientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	source, err := c.tokenSource(installationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.newSourceClient(source, fmt.Sprintf("installation: %d", installationID))
+}
+
+func (c *clientCreator) NewInstallationClientContext(ctx context.Context, installationID int64) (*github.Client, error) {
+	source, err := c.prefetchTokenSource(ctx, installationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.newSourceClient(source, fmt.Sprintf("installation: %d", installationID))
+}
+
+func (c *clientCreator) NewScopedInstallationClient(installationID int64, opts ScopedTokenOptions) (*github.Client, error) {
+	source, err := c.tokenSource(installationID, &opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.newSourceClient(source, fmt.Sprintf("installation: %d, scoped", installationID))
+}
+
+// prefetchTokenSource returns the token source for the installation and
+// scope after requesting a token with ctx.
+func (c *clientCreator) prefetchTokenSource(ctx context.Context, installationID int64, scope *ScopedTokenOptions) (*installationTokenSource, error) {
+	source, err := c.tokenSource(installationID, scope)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := source.Token(ctx); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// newSourceClient returns an installation client that authenticates with
+// tokens from source. The client requests a token for its first request if
+// the source does not have one.
+func (c *clientCreator) newSourceClient(source *installationTokenSource, details string) (*github.Client, error) {
 	base := c.newHTTPClient()
-	installation, transportError := newInstallation(c.integrationID, installationID, c.privKeyBytes, c.v3BaseURL)
 
-	middleware := []ClientMiddleware{installation}
+	middleware := []ClientMiddleware{installationAuth(source)}
 	if c.cacheFunc != nil {
 		middleware = append(middleware, cache(c.cacheFunc), cacheControl(c.alwaysValidate))
 	}
 
-	client, err := c.newClient(base, middleware, fmt.Sprintf("installation: %d", installationID), installationID)
+	return c.newClient(base, middleware, details, source.installationID)
+}
+
+func (c *clientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+	source, err := c.tokenSource(installationID, nil)
 	if err != nil {
 		return nil, err
 	}
-	if *transportError != nil {
-		return nil, *transportError
+	return c.newSourceV4Client(source)
+}
+
+func (c *clientCreator) NewInstallationV4ClientContext(ctx context.Context, installationID int64) (*githubv4.Client, error) {
+	source, err := c.prefetchTokenSource(ctx, installationID, nil)
+	if err != nil {
+		return nil, err
 	}
-	return client, nil
+	return c.newSourceV4Client(source)
 }
 
-func (c *clientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+// newSourceV4Client is like newSourceClient, but returns a v4 API client.
+func (c *clientCreator) newSourceV4Client(source *installationTokenSource) (*githubv4.Client, error) {
 	base := c.newHTTPClient()
-	installation, transportError := newInstallation(c.integrationID, installationID, c.privKeyBytes, c.v3BaseURL)
 
 	// The v4 API primarily uses POST requests (except for introspection queries)
 	// which we cannot cache, so don't construct the middleware
-	middleware := []ClientMiddleware{installation}
+	middleware := []ClientMiddleware{installationAuth(source)}
 
-	client, err := c.newV4Client(base, middleware, fmt.Sprintf("installation: %d", installationID))
-	if err != nil {
-		return nil, err
-	}
-	if *transportError != nil {
-		return nil, *transportError
-	}
-	return client, nil
+	return c.newV4Client(base, middleware, fmt.Sprintf("installation: %d", source.installationID), source.installationID)
 }
 
 func (c *clientCreator) NewTokenClient(token string) (*github.Client, error) {
@@ -268,7 +485,7 @@ func (c *clientCreator) NewTokenClient(token string) (*github.Client, error) {
 }
 
 func (c *clientCreator) NewTokenSourceClient(ts oauth2.TokenSource) (*github.Client, error) {
-	tc := oauth2.NewClient(context.Background(), ts)
+	tc := c.newTokenSourceHTTPClient(ts)
 
 	middleware := []ClientMiddleware{}
 	if c.cacheFunc != nil {
@@ -284,10 +501,17 @@ func (c *clientCreator) NewTokenV4Client(token string) (*githubv4.Client, error)
 }
 
 func (c *clientCreator) NewTokenSourceV4Client(ts oauth2.TokenSource) (*githubv4.Client, error) {
-	tc := oauth2.NewClient(context.Background(), ts)
+	tc := c.newTokenSourceHTTPClient(ts)
 	// The v4 API primarily uses POST requests (except for introspection queries)
 	// which we cannot cache, so don't construct the middleware
-	return c.newV4Client(tc, nil, "oauth token")
+	return c.newV4Client(tc, nil, "oauth token", 0)
+}
+
+func (c *clientCreator) RateLimitStatus(installationID int64) (RateLimit, bool) {
+	if c.rateLimits == nil {
+		return RateLimit{}, false
+	}
+	return c.rateLimits.Get(installationID)
 }
 
 func (c *clientCreator) newHTTPClient() *http.Client {
@@ -298,15 +522,48 @@ func (c *clientCreator) newHTTPClient() *http.Client {
 		transport = http.DefaultTransport
 	}
 
-	return &http.Client{
+	base := &http.Client{
 		Transport: transport,
 		Timeout:   c.timeout,
 	}
+	// retries happen outside of transport middleware so that it sees each
+	// attempt as a separate request
+	var retryMiddleware []ClientMiddleware
+	if c.retry != nil {
+		retryMiddleware = append(retryMiddleware, retry(*c.retry))
+	}
+	if c.secondaryRateLimitMax > 0 {
+		retryMiddleware = append(retryMiddleware, secondaryRateLimitBackoff(c.secondaryRateLimitMax))
+	}
+	if c.rateLimitMaxWait > 0 {
+		retryMiddleware = append(retryMiddleware, rateLimitWaiter(c.rateLimitMaxWait))
+	}
+
+	applyMiddleware(base, [][]ClientMiddleware{
+		retryMiddleware,
+		c.transportMiddleware,
+		{recordRequestID},
+	})
+	return base
+}
+
+// newTokenSourceHTTPClient returns a client that authenticates with tokens
+// from ts, using the configured transport and transport middleware.
+func (c *clientCreator) newTokenSourceHTTPClient(ts oauth2.TokenSource) *http.Client {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.newHTTPClient())
+	return oauth2.NewClient(ctx, ts)
 }
 
 func (c *clientCreator) newClient(base *http.Client, middleware []ClientMiddleware, details string, installID int64) (*github.Client, error) {
 	applyMiddleware(base, [][]ClientMiddleware{
+		c.traceRequests(),
 		{setInstallationID(installID)},
+		c.limitConcurrency(installID),
+		c.checkPermissions(),
+		c.trackRateLimit(installID),
+		{recordRate},
+		c.reportRequestMetrics(installID),
+		c.conditionalRequests(installID),
 		c.middleware,
 		middleware,
 	})
@@ -318,14 +575,26 @@ func (c *clientCreator) newClient(base *http.Client, middleware []ClientMiddlewa
 
 	client := github.NewClient(base)
 	client.BaseURL = baseURL
-	client.UserAgent = makeUserAgent(c.userAgent, details)
+	if strings.HasSuffix(baseURL.Path, "/api/v3/") {
+		// GitHub Enterprise Server serves uploads from a separate path
+		uploadURL := *baseURL
+		uploadURL.Path = strings.TrimSuffix(baseURL.Path, "v3/") + "uploads/"
+		client.UploadURL = &uploadURL
+	}
+	client.UserAgent = c.makeUserAgent(details)
 
 	return client, nil
 }
 
-func (c *clientCreator) newV4Client(base *http.Client, middleware []ClientMiddleware, details string) (*githubv4.Client, error) {
+func (c *clientCreator) newV4Client(base *http.Client, middleware []ClientMiddleware, details string, installID int64) (*githubv4.Client, error) {
 	applyMiddleware(base, [][]ClientMiddleware{
-		{setUserAgentHeader(makeUserAgent(c.userAgent, details))},
+		c.traceRequests(),
+		{setUserAgentHeader(c.makeUserAgent(details))},
+		c.limitConcurrency(installID),
+		c.trackRateLimit(installID),
+		{recordRate},
+		c.trackGraphQLCost(installID),
+		c.reportRequestMetrics(installID),
 		c.middleware,
 		middleware,
 	})
@@ -339,6 +608,16 @@ func (c *clientCreator) newV4Client(base *http.Client, middleware []ClientMiddle
 	return client, nil
 }
 
+// trackRateLimit returns the middleware that records rate limits for an
+// installation, if tracking is enabled. App and token clients, which have an
+// installation ID of 0, are not tracked.
+func (c *clientCreator) trackRateLimit(installID int64) []ClientMiddleware {
+	if c.rateLimits == nil || installID == 0 {
+		return nil
+	}
+	return []ClientMiddleware{c.rateLimits.middleware(installID)}
+}
+
 // applyMiddleware behaves as if it concatenates all middleware slices in the
 // order given and then composes the middleware so that the first element is
 // the outermost function and the last element is the innermost function.
@@ -350,31 +629,16 @@ func applyMiddleware(base *http.Client, middleware [][]ClientMiddleware) {
 	}
 }
 
-func newAppInstallation(integrationID int64, privKeyBytes []byte, v3BaseURL string) (ClientMiddleware, *error) {
+func (c *clientCreator) newAppInstallation() (ClientMiddleware, *error) {
 	var transportError error
 	installation := func(next http.RoundTripper) http.RoundTripper {
-		itr, err := ghinstallation.NewAppsTransport(next, integrationID, privKeyBytes)
+		// the transport uses the v3 URL since this is used to refresh the
+		// token, not make queries
+		itr, err := c.newAppsTransport(next)
 		if err != nil {
 			transportError = err
 			return next
 		}
-		// leaving the v3 URL since this is used to refresh the token, not make queries
-		itr.BaseURL = strings.TrimSuffix(v3BaseURL, "/")
-		return itr
-	}
-	return installation, &transportError
-}
-
-func newInstallation(integrationID, installationID int64, privKeyBytes []byte, v3BaseURL string) (ClientMiddleware, *error) {
-	var transportError error
-	installation := func(next http.RoundTripper) http.RoundTripper {
-		itr, err := ghinstallation.New(next, integrationID, installationID, privKeyBytes)
-		if err != nil {
-			transportError = err
-			return next
-		}
-		// leaving the v3 URL since this is used to refresh the token, not make queries
-		itr.BaseURL = strings.TrimSuffix(v3BaseURL, "/")
 		return itr
 	}
 	return installation, &transportError
@@ -412,11 +676,20 @@ func cacheControl(alwaysValidate bool) ClientMiddleware {
 	}
 }
 
-func makeUserAgent(base, details string) string {
+// makeUserAgent returns the user agent for a client. The go-github version is
+// kept at the end so that GitHub can still identify the library.
+func (c *clientCreator) makeUserAgent(details string) string {
+	base := c.userAgent
 	if base == "" {
 		base = "github-base-app/undefined"
+		if c.appSlug != "" {
+			base = c.appSlug
+		}
+	}
+	if c.appSlug != "" {
+		details = fmt.Sprintf("app: %s; %s", c.appSlug, details)
 	}
-	return fmt.Sprintf("%s (%s)", base, details)
+	return fmt.Sprintf("%s (%s) go-github/%s", base, details, github.Version)
 }
 
 func setInstallationID(installationID int64) ClientMiddleware {
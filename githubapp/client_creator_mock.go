@@ -0,0 +1,262 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/shurcooL/githubv4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	mockV3BaseURL = "https://api.github.com/"
+	mockV4URL     = "https://api.github.com/graphql"
+)
+
+// MockClientCreator is a ClientCreator for testing handlers without GitHub.
+// Its clients send requests to Transport or, if Transport is nil, respond
+// with the responses registered with Respond. It records the installation
+// IDs of the clients and tokens it creates so tests can check them.
+//
+// Created clients use "https://api.github.com/" as the base URL. Tokens are
+// fake values that are valid for an hour. The zero value is ready to use
+// and a MockClientCreator is safe for concurrent use.
+type MockClientCreator struct {
+	// Transport handles all requests made by created clients. Set it to stub
+	// responses with custom logic.
+	Transport http.RoundTripper
+
+	mu              sync.Mutex
+	installationIDs []int64
+	requests        []string
+	responses       map[string]mockResponse
+}
+
+var _ ClientCreator = &MockClientCreator{}
+
+type mockResponse struct {
+	status int
+	body   []byte
+}
+
+// Respond registers a response for requests with the method and path, like
+// "GET" and "/repos/owner/repo". The path does not include the query string.
+// If status is 0, the response is 200 OK. If body is a string or []byte, it
+// is used as is. Otherwise, it is encoded
+// as JSON. Requests without a registered response receive a 404 Not Found
+// response. Respond panics if body cannot be encoded.
+func (m *MockClientCreator) Respond(method, path string, status int, body interface{}) {
+	var b []byte
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			panic(fmt.Sprintf("githubapp: failed to encode mock response for %s %s: %v", method, path, err))
+		}
+	}
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.responses == nil {
+		m.responses = make(map[string]mockResponse)
+	}
+	m.responses[method+" "+path] = mockResponse{status: status, body: b}
+}
+
+// InstallationIDs returns the installation IDs of the installation clients
+// and tokens created by the MockClientCreator, in the order they were
+// created.
+func (m *MockClientCreator) InstallationIDs() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int64(nil), m.installationIDs...)
+}
+
+// RequestedInstallation returns true if the MockClientCreator created an
+// installation client or token for the installation.
+func (m *MockClientCreator) RequestedInstallation(installationID int64) bool {
+	for _, id := range m.InstallationIDs() {
+		if id == installationID {
+			return true
+		}
+	}
+	return false
+}
+
+// Requests returns the requests made by created clients, formatted as the
+// method and path, like "GET /repos/owner/repo", in the order they were
+// made.
+func (m *MockClientCreator) Requests() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.requests...)
+}
+
+func (m *MockClientCreator) NewAppClient() (*github.Client, error) {
+	return m.newClient(), nil
+}
+
+func (m *MockClientCreator) NewAppV4Client() (*githubv4.Client, error) {
+	return m.newV4Client(), nil
+}
+
+func (m *MockClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	return m.NewInstallationClientContext(context.Background(), installationID)
+}
+
+func (m *MockClientCreator) NewInstallationClientContext(ctx context.Context, installationID int64) (*github.Client, error) {
+	m.recordInstallation(installationID)
+	return m.newClient(), nil
+}
+
+func (m *MockClientCreator) NewInstallationV4Client(installationID int64) (*githubv4.Client, error) {
+	return m.NewInstallationV4ClientContext(context.Background(), installationID)
+}
+
+func (m *MockClientCreator) NewInstallationV4ClientContext(ctx context.Context, installationID int64) (*githubv4.Client, error) {
+	m.recordInstallation(installationID)
+	return m.newV4Client(), nil
+}
+
+func (m *MockClientCreator) NewScopedInstallationClient(installationID int64, opts ScopedTokenOptions) (*github.Client, error) {
+	m.recordInstallation(installationID)
+	return m.newClient(), nil
+}
+
+func (m *MockClientCreator) NewTokenSourceClient(ts oauth2.TokenSource) (*github.Client, error) {
+	return m.newClient(), nil
+}
+
+func (m *MockClientCreator) NewTokenSourceV4Client(ts oauth2.TokenSource) (*githubv4.Client, error) {
+	return m.newV4Client(), nil
+}
+
+func (m *MockClientCreator) NewTokenClient(token string) (*github.Client, error) {
+	return m.newClient(), nil
+}
+
+func (m *MockClientCreator) NewTokenV4Client(token string) (*githubv4.Client, error) {
+	return m.newV4Client(), nil
+}
+
+func (m *MockClientCreator) InstallationToken(ctx context.Context, installationID int64) (string, time.Time, error) {
+	m.recordInstallation(installationID)
+	return fmt.Sprintf("mock-token-%d", installationID), time.Now().Add(time.Hour), nil
+}
+
+func (m *MockClientCreator) ScopedInstallationToken(ctx context.Context, installationID int64, opts ScopedTokenOptions) (string, time.Time, error) {
+	return m.InstallationToken(ctx, installationID)
+}
+
+func (m *MockClientCreator) RevokeInstallationToken(ctx context.Context, token string) error {
+	return nil
+}
+
+func (m *MockClientCreator) NewSingleUseInstallationClient(ctx context.Context, installationID int64) (*SingleUseClient, error) {
+	m.recordInstallation(installationID)
+	return &SingleUseClient{
+		Client: m.newClient(),
+		close:  func(context.Context) error { return nil },
+		logger: LoggerFromContext(ctx),
+	}, nil
+}
+
+func (m *MockClientCreator) PrewarmInstallation(ctx context.Context, installationID int64) error {
+	return nil
+}
+
+func (m *MockClientCreator) StartTokenRefresher(ctx context.Context, installationIDs []int64, interval time.Duration) {
+}
+
+func (m *MockClientCreator) RateLimitStatus(installationID int64) (RateLimit, bool) {
+	return RateLimit{}, false
+}
+
+func (m *MockClientCreator) TokenCacheStats() TokenCacheStats {
+	return TokenCacheStats{}
+}
+
+// AppMetadata returns the app from the response registered for "GET /app".
+// Unlike other ClientCreators, it does not cache the result.
+func (m *MockClientCreator) AppMetadata(ctx context.Context) (*github.App, error) {
+	app, _, err := m.newClient().Apps.Get(ctx, "")
+	return app, err
+}
+
+func (m *MockClientCreator) recordInstallation(installationID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.installationIDs = append(m.installationIDs, installationID)
+}
+
+func (m *MockClientCreator) newClient() *github.Client {
+	client := github.NewClient(&http.Client{Transport: roundTripperFunc(m.roundTrip)})
+	client.BaseURL, _ = url.Parse(mockV3BaseURL)
+	return client
+}
+
+func (m *MockClientCreator) newV4Client() *githubv4.Client {
+	return githubv4.NewEnterpriseClient(mockV4URL, &http.Client{Transport: roundTripperFunc(m.roundTrip)})
+}
+
+func (m *MockClientCreator) roundTrip(r *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, r.Method+" "+r.URL.Path)
+	transport := m.Transport
+	res, ok := m.responses[r.Method+" "+r.URL.Path]
+	m.mu.Unlock()
+
+	if transport != nil {
+		return transport.RoundTrip(r)
+	}
+	if r.Body != nil {
+		_ = r.Body.Close()
+	}
+
+	if !ok {
+		res = mockResponse{status: http.StatusNotFound, body: []byte(`{"message":"Not Found"}`)}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", res.status, http.StatusText(res.status)),
+		StatusCode:    res.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader(res.body)),
+		ContentLength: int64(len(res.body)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestMockClientCreator(t *testing.T) {
+	tests := map[string]struct {
+		Respond   bool
+		Transport http.RoundTripper
+
+		Status int
+		Name   string
+	}{
+		"cannedResponse": {
+			Respond: true,
+			Status:  http.StatusOK,
+			Name:    "go-githubapp",
+		},
+		"notFound": {
+			Status: http.StatusNotFound,
+		},
+		"customTransport": {
+			Respond: true,
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return (&MockClientCreator{}).roundTrip(r)
+			}),
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cc := &MockClientCreator{Transport: test.Transport}
+			if test.Respond {
+				cc.Respond("GET", "/repos/palantir/go-githubapp", http.StatusOK, &github.Repository{Name: github.String("go-githubapp")})
+			}
+
+			client, err := cc.NewInstallationClient(123)
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			repo, res, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp")
+			if res == nil {
+				t.Fatalf("missing response: %v", err)
+			}
+			if res.StatusCode != test.Status {
+				t.Errorf("incorrect status: expected %d, actual %d", test.Status, res.StatusCode)
+			}
+			if test.Status == http.StatusOK && repo.GetName() != test.Name {
+				t.Errorf("incorrect repository name: expected %q, actual %q", test.Name, repo.GetName())
+			}
+
+			if !cc.RequestedInstallation(123) {
+				t.Errorf("installation 123 was not requested: %v", cc.InstallationIDs())
+			}
+			if cc.RequestedInstallation(456) {
+				t.Errorf("installation 456 was requested: %v", cc.InstallationIDs())
+			}
+
+			expected := []string{"GET /repos/palantir/go-githubapp"}
+			if !reflect.DeepEqual(expected, cc.Requests()) {
+				t.Errorf("incorrect requests:\nexpected: %q\n  actual: %q", expected, cc.Requests())
+			}
+		})
+	}
+}
+
+func TestMockClientCreatorInstallations(t *testing.T) {
+	ctx := context.Background()
+	cc := &MockClientCreator{}
+
+	if _, err := cc.NewAppClient(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cc.NewInstallationV4ClientContext(ctx, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cc.NewScopedInstallationClient(2, ScopedTokenOptions{Repositories: []string{"repo"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token, _, err := cc.InstallationToken(ctx, 3); err != nil || token == "" {
+		t.Fatalf("unexpected token result: %q, %v", token, err)
+	}
+
+	client, err := cc.NewSingleUseInstallationClient(ctx, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("unexpected error closing client: %v", err)
+	}
+
+	expected := []int64{1, 2, 3, 4}
+	if ids := cc.InstallationIDs(); !reflect.DeepEqual(expected, ids) {
+		t.Errorf("incorrect installation IDs: expected %v, actual %v", expected, ids)
+	}
+}
@@ -0,0 +1,1057 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestNewScopedInstallationClient(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	client, err := cc.NewScopedInstallationClient(42, ScopedTokenOptions{
+		Repositories: []string{"go-githubapp"},
+		Permissions:  map[string]string{"contents": "read"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+
+	req := server.TokenRequest(42)
+	if req == nil {
+		t.Fatal("no token request was made for the installation")
+	}
+	if len(req.Repositories) != 1 || req.Repositories[0] != "go-githubapp" {
+		t.Errorf("incorrect token repositories: %v", req.Repositories)
+	}
+	if req.Permissions.GetContents() != "read" {
+		t.Errorf("incorrect token contents permission: %q", req.Permissions.GetContents())
+	}
+}
+
+func TestNewInstallationClientContext(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	if _, err := cc.NewInstallationClientContext(context.Background(), 42); err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if server.TokenRequest(42) == nil {
+		t.Fatal("token was not requested when creating the client")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cc.NewInstallationClientContext(ctx, 43); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled error, but got: %v", err)
+	}
+	if _, err := cc.NewInstallationV4ClientContext(ctx, 43); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled error for v4 client, but got: %v", err)
+	}
+}
+
+func TestInstallationToken(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+	ctx := context.Background()
+
+	if _, err := cc.NewInstallationClient(42); err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	token, expiresAt, err := cc.InstallationToken(ctx, 42)
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	assertField(t, "token", "token-42-1", token)
+	if d := time.Until(expiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("incorrect token expiration: %v", expiresAt)
+	}
+
+	scoped, _, err := cc.ScopedInstallationToken(ctx, 42, ScopedTokenOptions{Repositories: []string{"repo"}})
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped token: %v", err)
+	}
+	assertField(t, "scoped token", "token-42-2", scoped)
+
+	if count := server.TokenCount(42); count != 2 {
+		t.Errorf("incorrect token count: expected 2, actual %d", count)
+	}
+}
+
+func TestTokenCacheStats(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	registry := metrics.NewRegistry()
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithTokenCacheMetrics(registry))
+	ctx := context.Background()
+
+	client, err := cc.NewInstallationClient(42)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	if _, _, err := cc.InstallationToken(ctx, 42); err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	if _, _, err := cc.ScopedInstallationToken(ctx, 42, ScopedTokenOptions{Repositories: []string{"repo"}}); err != nil {
+		t.Fatalf("unexpected error getting scoped token: %v", err)
+	}
+
+	expected := TokenCacheStats{Hits: 1, Misses: 2, Mints: 2, Size: 2}
+	if stats := cc.TokenCacheStats(); stats != expected {
+		t.Errorf("incorrect stats:\nexpected: %+v\n  actual: %+v", expected, stats)
+	}
+
+	counters := map[string]int64{
+		MetricsKeyTokenCacheHits:   1,
+		MetricsKeyTokenCacheMisses: 2,
+		MetricsKeyTokenCacheMints:  2,
+	}
+	for key, value := range counters {
+		if count := registry.Get(key).(metrics.Counter).Count(); count != value {
+			t.Errorf("incorrect %s metric: expected %d, actual %d", key, value, count)
+		}
+	}
+	if size := registry.Get(MetricsKeyTokenCacheSize).(metrics.Gauge).Value(); size != 2 {
+		t.Errorf("incorrect %s metric: expected 2, actual %d", MetricsKeyTokenCacheSize, size)
+	}
+}
+
+func TestWithoutTokenCache(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithoutTokenCache())
+	ctx := context.Background()
+
+	first, err := cc.NewInstallationClientContext(ctx, 42)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, err := cc.NewInstallationClientContext(ctx, 42); err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, _, err := first.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+
+	for i, expected := range []string{"token-42-3", "token-42-4"} {
+		token, _, err := cc.InstallationToken(ctx, 42)
+		if err != nil {
+			t.Fatalf("unexpected error getting token: %v", err)
+		}
+		assertField(t, fmt.Sprintf("token %d", i), expected, token)
+	}
+
+	scoped, _, err := cc.ScopedInstallationToken(ctx, 42, ScopedTokenOptions{Repositories: []string{"repo"}})
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped token: %v", err)
+	}
+	if opts := server.TokenScope(scoped); opts == nil || len(opts.Repositories) != 1 {
+		t.Errorf("scoped token was not created with the requested scope: %+v", opts)
+	}
+
+	if err := cc.PrewarmInstallation(ctx, 42); err != nil {
+		t.Fatalf("unexpected error prewarming installation: %v", err)
+	}
+	if count := server.TokenCount(42); count != 5 {
+		t.Errorf("incorrect token count: expected 5, actual %d", count)
+	}
+
+	expected := TokenCacheStats{Hits: 1, Misses: 5, Mints: 5, Size: 0}
+	if stats := cc.TokenCacheStats(); stats != expected {
+		t.Errorf("incorrect stats:\nexpected: %+v\n  actual: %+v", expected, stats)
+	}
+
+	if err := cc.RevokeInstallationToken(ctx, scoped); err != nil {
+		t.Fatalf("unexpected error revoking token: %v", err)
+	}
+	if !server.Revoked(scoped) {
+		t.Errorf("token %q was not revoked", scoped)
+	}
+}
+
+func TestRevokeInstallationToken(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+	ctx := context.Background()
+
+	token, _, err := cc.InstallationToken(ctx, 42)
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	if err := cc.RevokeInstallationToken(ctx, token); err != nil {
+		t.Fatalf("unexpected error revoking token: %v", err)
+	}
+	if !server.Revoked(token) {
+		t.Errorf("token %q was not revoked", token)
+	}
+	if size := cc.TokenCacheStats().Size; size != 0 {
+		t.Errorf("incorrect cache size after revocation: expected 0, actual %d", size)
+	}
+
+	next, _, err := cc.InstallationToken(ctx, 42)
+	if err != nil {
+		t.Fatalf("unexpected error getting token: %v", err)
+	}
+	assertField(t, "token after revocation", "token-42-2", next)
+
+	server.RevokeError = http.StatusInternalServerError
+	if err := cc.RevokeInstallationToken(ctx, next); err == nil {
+		t.Fatal("expected error revoking token, but got nil")
+	}
+	if size := cc.TokenCacheStats().Size; size != 0 {
+		t.Errorf("token was not evicted after failed revocation: size %d", size)
+	}
+}
+
+func TestSingleUseInstallationClient(t *testing.T) {
+	tests := map[string]struct {
+		RevokeError int
+
+		Err bool
+	}{
+		"revokesToken": {},
+		"revocationFails": {
+			RevokeError: http.StatusInternalServerError,
+			Err:         true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestGitHubServer(t, "")
+			server.RevokeError = test.RevokeError
+
+			cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+			ctx := context.Background()
+
+			shared, _, err := cc.InstallationToken(ctx, 42)
+			if err != nil {
+				t.Fatalf("unexpected error getting token: %v", err)
+			}
+
+			client, err := cc.NewSingleUseInstallationClient(ctx, 42)
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+			if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+				t.Fatalf("unexpected error making request: %v", err)
+			}
+			if count := server.TokenCount(42); count != 2 {
+				t.Errorf("single-use client did not create its own token: %d tokens", count)
+			}
+			if size := cc.TokenCacheStats().Size; size != 1 {
+				t.Errorf("single-use token was added to the cache: size %d", size)
+			}
+
+			err = client.Close()
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected error closing client, but got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error closing client: %v", err)
+				}
+				if !server.Revoked("token-42-2") {
+					t.Error("single-use token was not revoked")
+				}
+			}
+			if server.Revoked(shared) {
+				t.Error("shared token was revoked")
+			}
+
+			if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err == nil {
+				t.Error("expected error using closed client, but got nil")
+			}
+			if count := server.TokenCount(42); count != 2 {
+				t.Errorf("closed client created a new token: %d tokens", count)
+			}
+			if cerr := client.Close(); (cerr != nil) != test.Err {
+				t.Errorf("second close returned a different result: %v", cerr)
+			}
+		})
+	}
+}
+
+func TestInstallationErrors(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	server.TokenErrors = map[int64]int{
+		1: http.StatusNotFound,
+		2: http.StatusForbidden,
+		3: http.StatusInternalServerError,
+	}
+
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+	ctx := context.Background()
+
+	_, err := cc.NewInstallationClientContext(ctx, 1)
+	if !errors.Is(err, ErrInstallationNotFound) {
+		t.Errorf("expected ErrInstallationNotFound, but got: %v", err)
+	}
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected error to wrap the GitHub response, but got: %v", err)
+	}
+
+	_, err = cc.NewInstallationClientContext(ctx, 2)
+	if !errors.Is(err, ErrInstallationSuspended) {
+		t.Errorf("expected ErrInstallationSuspended, but got: %v", err)
+	}
+
+	_, err = cc.NewInstallationClientContext(ctx, 3)
+	if err == nil || errors.Is(err, ErrInstallationNotFound) || errors.Is(err, ErrInstallationSuspended) {
+		t.Errorf("expected generic error for server failure, but got: %v", err)
+	}
+
+	client, err := cc.NewInstallationClient(1)
+	if err != nil {
+		t.Fatalf("unexpected error creating client without requesting a token: %v", err)
+	}
+	_, _, err = client.Repositories.Get(ctx, "palantir", "go-githubapp")
+	if !errors.Is(err, ErrInstallationNotFound) {
+		t.Errorf("expected ErrInstallationNotFound from request, but got: %v", err)
+	}
+}
+
+func TestPrewarmInstallation(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	if err := cc.PrewarmInstallation(context.Background(), 42); err != nil {
+		t.Fatalf("unexpected error prewarming installation: %v", err)
+	}
+	assertField(t, "token count after prewarm", 1, server.TokenCount(42))
+
+	if _, err := cc.NewInstallationClient(42); err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, err := cc.NewInstallationV4Client(42); err != nil {
+		t.Fatalf("unexpected error creating v4 client: %v", err)
+	}
+	assertField(t, "token count after creating clients", 1, server.TokenCount(42))
+}
+
+func TestWithTokenHook(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+
+	var events []TokenEvent
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithTokenHook(func(ev TokenEvent) {
+		events = append(events, ev)
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := cc.NewInstallationClientContext(context.Background(), 42); err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cc.NewInstallationClientContext(ctx, 43); err == nil {
+		t.Fatal("expected error creating client with canceled context")
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 token events, but got %d: %+v", len(events), events)
+	}
+
+	assertField(t, "first event installation", int64(42), events[0].InstallationID)
+	assertField(t, "first event cache hit", false, events[0].CacheHit)
+	if events[0].ExpiresAt.IsZero() || events[0].Err != nil {
+		t.Errorf("expected first event to have an expiration and no error: %+v", events[0])
+	}
+
+	assertField(t, "second event cache hit", true, events[1].CacheHit)
+	assertField(t, "second event expiration", events[0].ExpiresAt, events[1].ExpiresAt)
+
+	assertField(t, "third event installation", int64(43), events[2].InstallationID)
+	if events[2].Err == nil {
+		t.Errorf("expected third event to have an error")
+	}
+}
+
+func TestStartTokenRefresher(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	server.TokenLifetime = 2 * time.Minute
+
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+	if err := cc.PrewarmInstallation(context.Background(), 42); err != nil {
+		t.Fatalf("unexpected error prewarming installation: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cc.StartTokenRefresher(ctx, []int64{42}, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for server.TokenCount(42) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.TokenCount(42); n < 3 {
+		t.Fatalf("expected expiring token to be refreshed, but only %d tokens were issued", n)
+	}
+}
+
+func TestStartTokenRefresherInvalidInterval(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a non-positive interval must not panic and uses the default interval
+	cc.StartTokenRefresher(ctx, []int64{42}, 0)
+
+	deadline := time.Now().Add(time.Second)
+	for server.TokenCount(42) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertField(t, "token count", 1, server.TokenCount(42))
+}
+
+func TestTokenSourceEviction(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t)).(*clientCreator)
+	ctx := context.Background()
+
+	if err := cc.PrewarmInstallation(ctx, 42); err != nil {
+		t.Fatalf("unexpected error prewarming installation: %v", err)
+	}
+	if err := cc.PrewarmInstallation(ctx, 43); err != nil {
+		t.Fatalf("unexpected error prewarming installation: %v", err)
+	}
+	assertField(t, "cache size", 2, cc.TokenCacheStats().Size)
+
+	idle, err := cc.tokenSource(42, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting token source: %v", err)
+	}
+	active, err := cc.tokenSource(43, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting token source: %v", err)
+	}
+	if idle.client != active.client {
+		t.Errorf("expected token sources to share a token creation client")
+	}
+
+	// make the first source idle and allow the next lookup to sweep
+	idle.touch(time.Now().Add(-2 * tokenSourceIdleTimeout))
+	cc.tokens.mu.Lock()
+	cc.tokens.lastSweep = time.Time{}
+	cc.tokens.mu.Unlock()
+
+	if s, err := cc.tokenSource(43, nil); err != nil || s != active {
+		t.Fatalf("expected active source to stay cached: %v", err)
+	}
+	assertField(t, "cache size after sweep", 1, cc.TokenCacheStats().Size)
+
+	replacement, err := cc.tokenSource(42, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting token source: %v", err)
+	}
+	if replacement == idle {
+		t.Errorf("expected idle source to be removed from the cache")
+	}
+
+	// clients that still use the removed source keep working
+	if _, err := idle.Token(ctx); err != nil {
+		t.Errorf("unexpected error getting token from removed source: %v", err)
+	}
+	assertField(t, "cache size after using removed source", 1, cc.TokenCacheStats().Size)
+}
+
+func TestWithTransportMiddleware(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+
+	var mu sync.Mutex
+	auth := make(map[string]string)
+	recordAuth := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			auth[r.URL.Path] = r.Header.Get("Authorization")
+			mu.Unlock()
+			return next.RoundTrip(r)
+		})
+	}
+
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithTransportMiddleware(recordAuth))
+
+	client, err := cc.NewInstallationClient(42)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+
+	tokenAuth := auth["/app/installations/42/access_tokens"]
+	if !strings.HasPrefix(tokenAuth, "Bearer ") {
+		t.Errorf("expected token request to use app authentication, but got %q", tokenAuth)
+	}
+	assertField(t, "API request authorization", "token token-42-1", auth["/repos/palantir/go-githubapp"])
+}
+
+func TestInstallationClientRetryUnauthorized(t *testing.T) {
+	tests := map[string]struct {
+		Rejected   []string
+		Body       func() io.Reader
+		Status     int
+		TokenCount int
+	}{
+		"staleToken": {
+			Rejected:   []string{"token-42-1"},
+			Status:     http.StatusOK,
+			TokenCount: 2,
+		},
+		"staleTokenWithBody": {
+			Rejected:   []string{"token-42-1"},
+			Body:       func() io.Reader { return strings.NewReader(`{"name":"test"}`) },
+			Status:     http.StatusOK,
+			TokenCount: 2,
+		},
+		"nonReplayableBody": {
+			Rejected:   []string{"token-42-1"},
+			Body:       func() io.Reader { return io.MultiReader(strings.NewReader(`{"name":"test"}`)) },
+			Status:     http.StatusUnauthorized,
+			TokenCount: 1,
+		},
+		"retryOnce": {
+			Rejected:   []string{"token-42-1", "token-42-2"},
+			Status:     http.StatusUnauthorized,
+			TokenCount: 2,
+		},
+		"validToken": {
+			Status:     http.StatusOK,
+			TokenCount: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestGitHubServer(t, "")
+			server.RejectedTokens = make(map[string]bool)
+			for _, token := range test.Rejected {
+				server.RejectedTokens[token] = true
+			}
+
+			cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+			client, err := cc.NewInstallationClient(42)
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			method, body := http.MethodGet, io.Reader(nil)
+			if test.Body != nil {
+				method, body = http.MethodPost, test.Body()
+			}
+			req, err := http.NewRequest(method, server.URL+"/repos/palantir/go-githubapp/labels", body)
+			if err != nil {
+				t.Fatalf("unexpected error creating request: %v", err)
+			}
+
+			res, err := client.Client().Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error making request: %v", err)
+			}
+			closeBody(res.Body)
+
+			assertField(t, "response status", test.Status, res.StatusCode)
+			assertField(t, "token count", test.TokenCount, server.TokenCount(42))
+		})
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	tests := map[string]struct {
+		Options []ClientOption
+
+		Installation string
+		App          string
+	}{
+		"default": {
+			Installation: "github-base-app/undefined (installation: 42) go-github/" + github.Version,
+			App:          "github-base-app/undefined (application) go-github/" + github.Version,
+		},
+		"userAgent": {
+			Options:      []ClientOption{WithClientUserAgent("my-app/1.0.0")},
+			Installation: "my-app/1.0.0 (installation: 42) go-github/" + github.Version,
+			App:          "my-app/1.0.0 (application) go-github/" + github.Version,
+		},
+		"appSlug": {
+			Options:      []ClientOption{WithClientAppSlug("my-app")},
+			Installation: "my-app (app: my-app; installation: 42) go-github/" + github.Version,
+			App:          "my-app (app: my-app; application) go-github/" + github.Version,
+		},
+		"userAgentAndAppSlug": {
+			Options:      []ClientOption{WithClientUserAgent("bots/2.0"), WithClientAppSlug("my-app")},
+			Installation: "bots/2.0 (app: my-app; installation: 42) go-github/" + github.Version,
+			App:          "bots/2.0 (app: my-app; application) go-github/" + github.Version,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestGitHubServer(t, "")
+
+			var mu sync.Mutex
+			agents := make(map[string]string)
+			recordAgent := func(next http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					mu.Lock()
+					agents[r.URL.Path] = r.Header.Get("User-Agent")
+					mu.Unlock()
+					return next.RoundTrip(r)
+				})
+			}
+
+			opts := append([]ClientOption{WithTransportMiddleware(recordAgent)}, test.Options...)
+			cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), opts...)
+
+			client, err := cc.NewInstallationClient(42)
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+			if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+				t.Fatalf("unexpected error making request: %v", err)
+			}
+
+			assertField(t, "installation user agent", test.Installation, agents["/repos/palantir/go-githubapp"])
+			assertField(t, "token request user agent", test.App, agents["/app/installations/42/access_tokens"])
+		})
+	}
+}
+
+func TestEnterpriseServerURLs(t *testing.T) {
+	server := newTestGitHubServer(t, "/api/v3")
+
+	var c Config
+	c.WebURL = server.URL
+	c.App.IntegrationID = 1
+	c.App.PrivateKey = string(newTestPrivateKey(t))
+
+	cc, err := NewDefaultCachingClientCreator(c)
+	if err != nil {
+		t.Fatalf("unexpected error creating client creator: %v", err)
+	}
+
+	client, err := cc.NewInstallationClient(42)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making v3 request: %v", err)
+	}
+	if server.TokenRequest(42) == nil {
+		t.Fatal("no token request was made to the enterprise API path")
+	}
+
+	v4client, err := cc.NewInstallationV4Client(42)
+	if err != nil {
+		t.Fatalf("unexpected error creating v4 client: %v", err)
+	}
+
+	var q struct {
+		Viewer struct {
+			Login string
+		}
+	}
+	if err := v4client.Query(context.Background(), &q, nil); err != nil {
+		t.Fatalf("unexpected error making v4 request: %v", err)
+	}
+	assertField(t, "viewer login", "octocat", q.Viewer.Login)
+}
+
+func TestScopedTokenOptionsPermissions(t *testing.T) {
+	tests := map[string]struct {
+		Permissions map[string]string
+		Expected    *github.InstallationPermissions
+		Error       string
+	}{
+		"none": {},
+		"known": {
+			Permissions: map[string]string{"contents": "read", "pull_requests": "write"},
+			Expected: &github.InstallationPermissions{
+				Contents:     github.String("read"),
+				PullRequests: github.String("write"),
+			},
+		},
+		"unknown": {
+			Permissions: map[string]string{"pull_request": "write"},
+			Error:       `unknown field "pull_request"`,
+		},
+		"mixed": {
+			Permissions: map[string]string{"contents": "read", "content": "write"},
+			Error:       `unknown field "content"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts, err := ScopedTokenOptions{Permissions: test.Permissions}.toInstallationTokenOptions()
+			if test.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.Error) {
+					t.Fatalf("expected error containing %q, but got: %v", test.Error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(test.Expected, opts.Permissions) {
+				t.Errorf("incorrect permissions:\nexpected: %+v\n  actual: %+v", test.Expected, opts.Permissions)
+			}
+		})
+	}
+
+	server := newTestGitHubServer(t, "")
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+	if _, err := cc.NewScopedInstallationClient(42, ScopedTokenOptions{Permissions: map[string]string{"content": "read"}}); err == nil {
+		t.Error("expected error creating client with unknown permission")
+	}
+	assertField(t, "token count", 0, server.TokenCount(42))
+}
+
+func TestScopedTokenOptionsCacheKey(t *testing.T) {
+	base := ScopedTokenOptions{
+		RepositoryIDs: []int64{2, 1},
+		Repositories:  []string{"repo-a"},
+		Permissions:   map[string]string{"contents": "read", "issues": "write"},
+	}
+
+	tests := map[string]struct {
+		Opts ScopedTokenOptions
+		Same bool
+	}{
+		"reordered": {
+			Opts: ScopedTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Repositories:  []string{"repo-a"},
+				Permissions:   map[string]string{"issues": "write", "contents": "read"},
+			},
+			Same: true,
+		},
+		"duplicatesAndCase": {
+			Opts: ScopedTokenOptions{
+				RepositoryIDs: []int64{1, 2, 1},
+				Repositories:  []string{"Repo-A", "repo-a"},
+				Permissions:   map[string]string{"contents": "read", "issues": "write"},
+			},
+			Same: true,
+		},
+		"differentPermission": {
+			Opts: ScopedTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Repositories:  []string{"repo-a"},
+				Permissions:   map[string]string{"contents": "write", "issues": "write"},
+			},
+		},
+		"supersetRepositories": {
+			Opts: ScopedTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Repositories:  []string{"repo-a", "repo-b"},
+				Permissions:   map[string]string{"contents": "read", "issues": "write"},
+			},
+		},
+		"separatorInName": {
+			Opts: ScopedTokenOptions{
+				RepositoryIDs: []int64{1, 2},
+				Repositories:  []string{"repo-a,repo-b"},
+				Permissions:   map[string]string{"contents": "read", "issues": "write"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if same := base.cacheKey() == test.Opts.cacheKey(); same != test.Same {
+				t.Errorf("incorrect key equality: expected %t, actual %t", test.Same, same)
+			}
+		})
+	}
+}
+
+func TestScopedTokenCache(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+
+	var auth string
+	recordAuth := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if !strings.HasSuffix(r.URL.Path, "/access_tokens") {
+				auth = strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+			}
+			return next.RoundTrip(r)
+		})
+	}
+
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithTransportMiddleware(recordAuth))
+
+	repoA := &ScopedTokenOptions{
+		Repositories: []string{"repo-a"},
+		Permissions:  map[string]string{"contents": "read"},
+	}
+	repoAB := &ScopedTokenOptions{
+		Repositories: []string{"repo-a", "repo-b"},
+		Permissions:  map[string]string{"contents": "read"},
+	}
+	repoAReordered := &ScopedTokenOptions{
+		Repositories: []string{"Repo-A"},
+		Permissions:  map[string]string{"contents": "read"},
+	}
+
+	// requests alternate between scopes; each scope must use its own token
+	steps := []struct {
+		Scope *ScopedTokenOptions
+		Token string
+	}{
+		{Scope: nil, Token: "token-42-1"},
+		{Scope: repoA, Token: "token-42-2"},
+		{Scope: nil, Token: "token-42-1"},
+		{Scope: repoAB, Token: "token-42-3"},
+		{Scope: repoAReordered, Token: "token-42-2"},
+		{Scope: &ScopedTokenOptions{}, Token: "token-42-1"},
+		{Scope: repoAB, Token: "token-42-3"},
+	}
+
+	for i, step := range steps {
+		var client *github.Client
+		var err error
+		if step.Scope == nil {
+			client, err = cc.NewInstallationClient(42)
+		} else {
+			client, err = cc.NewScopedInstallationClient(42, *step.Scope)
+		}
+		if err != nil {
+			t.Fatalf("step %d: unexpected error creating client: %v", i, err)
+		}
+		if _, _, err := client.Repositories.Get(context.Background(), "palantir", "repo-a"); err != nil {
+			t.Fatalf("step %d: unexpected error making request: %v", i, err)
+		}
+
+		if auth != step.Token {
+			t.Errorf("step %d: incorrect token: expected %s, actual %s", i, step.Token, auth)
+		}
+
+		scope := server.TokenScope(auth)
+		if scope == nil {
+			t.Fatalf("step %d: server did not issue token %s", i, auth)
+		}
+
+		var expected []string
+		if step.Scope != nil {
+			expected = step.Scope.Repositories
+		}
+		if !strings.EqualFold(strings.Join(scope.Repositories, ","), strings.Join(expected, ",")) {
+			t.Errorf("step %d: token has incorrect repositories: expected %v, actual %v", i, expected, scope.Repositories)
+		}
+	}
+
+	if count := server.TokenCount(42); count != 3 {
+		t.Errorf("incorrect token count: expected 3, actual %d", count)
+	}
+}
+
+// testGitHubServer is a minimal GitHub API that issues installation tokens,
+// answers GraphQL queries at "/api/graphql" with a fixed viewer, and responds
+// to all other requests with an empty object.
+type testGitHubServer struct {
+	*httptest.Server
+
+	// TokenLifetime is the duration until issued tokens expire
+	TokenLifetime time.Duration
+
+	// TokenErrors maps installation IDs to error status codes returned
+	// instead of tokens
+	TokenErrors map[int64]int
+
+	// RevokeError is the error status code returned for token revocation
+	// requests, if non-zero
+	RevokeError int
+
+	// RejectedTokens contains tokens that API requests fail to authenticate
+	// with, even though they are not expired
+	RejectedTokens map[string]bool
+
+	mu            sync.Mutex
+	tokenRequests map[int64]*github.InstallationTokenOptions
+	tokenCounts   map[int64]int
+	tokenScopes   map[string]*github.InstallationTokenOptions
+	revoked       map[string]bool
+}
+
+func newTestGitHubServer(t *testing.T, prefix string) *testGitHubServer {
+	s := &testGitHubServer{
+		TokenLifetime: time.Hour,
+		tokenRequests: make(map[int64]*github.InstallationTokenOptions),
+		tokenCounts:   make(map[int64]int),
+		tokenScopes:   make(map[string]*github.InstallationTokenOptions),
+		revoked:       make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/app/installations/", func(w http.ResponseWriter, r *http.Request) {
+		var id int64
+		if _, err := fmt.Sscanf(r.URL.Path, prefix+"/app/installations/%d/access_tokens", &id); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		var opts github.InstallationTokenOptions
+		if r.Body != nil {
+			_ = json.NewDecoder(r.Body).Decode(&opts)
+		}
+
+		s.mu.Lock()
+		s.tokenRequests[id] = &opts
+		s.tokenCounts[id]++
+		token := fmt.Sprintf("token-%d-%d", id, s.tokenCounts[id])
+		s.tokenScopes[token] = &opts
+		lifetime := s.TokenLifetime
+		status := s.TokenErrors[id]
+		s.mu.Unlock()
+
+		switch status {
+		case 0:
+		case http.StatusForbidden:
+			writeTestGitHubError(w, status, "This installation has been suspended")
+			return
+		default:
+			writeTestGitHubError(w, status, http.StatusText(status))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      token,
+			"expires_at": time.Now().Add(lifetime),
+		})
+	})
+	mux.HandleFunc(prefix+"/installation/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.Lock()
+		status := s.RevokeError
+		if status == 0 {
+			s.revoked[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] = true
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeTestGitHubError(w, status, http.StatusText(status))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"viewer":{"login":"octocat"}}}`))
+	})
+	mux.HandleFunc(prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		rejected := s.RejectedTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "token ")]
+		s.mu.Unlock()
+
+		if rejected {
+			writeTestGitHubError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		if r.Body != nil {
+			_, _ = io.Copy(io.Discard, r.Body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeTestGitHubError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
+
+// TokenRequest returns the options of the last token request for an
+// installation or nil if there were no requests.
+func (s *testGitHubServer) TokenRequest(installationID int64) *github.InstallationTokenOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests[installationID]
+}
+
+// TokenScope returns the options used to request a token or nil if the server
+// did not issue the token.
+func (s *testGitHubServer) TokenScope(token string) *github.InstallationTokenOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenScopes[token]
+}
+
+// Revoked returns true if the token was revoked.
+func (s *testGitHubServer) Revoked(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revoked[token]
+}
+
+// TokenCount returns the number of tokens issued for an installation.
+func (s *testGitHubServer) TokenCount(installationID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenCounts[installationID]
+}
+
+func newTestPrivateKey(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
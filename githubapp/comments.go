@@ -0,0 +1,209 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// CommentResult is the action taken by CommentDeduper to post a comment.
+type CommentResult int
+
+const (
+	// CommentCreated means a new comment was created.
+	CommentCreated CommentResult = iota
+
+	// CommentUpdated means an existing comment with the same key was edited
+	// to have the new body.
+	CommentUpdated
+
+	// CommentUnchanged means an existing comment already had the body, so no
+	// comment was created or edited.
+	CommentUnchanged
+)
+
+func (r CommentResult) String() string {
+	switch r {
+	case CommentCreated:
+		return "created"
+	case CommentUpdated:
+		return "updated"
+	case CommentUnchanged:
+		return "unchanged"
+	}
+	return "unknown"
+}
+
+// CommentDeduper posts comments on issues and pull requests without repeating
+// comments that were already posted. This keeps threads readable when the
+// same event, like a failing status or a repeated command, is handled many
+// times. The zero value is ready to use.
+type CommentDeduper struct {
+	// Author is the login of the user that posts comments, like
+	// "my-app[bot]". Only comments by this user are replaced. If empty,
+	// comments by any bot user are replaced.
+	Author string
+
+	// DeleteDuplicates enables deleting older comments with the same key
+	// when several comments match. By default, only the most recent comment
+	// is edited and older comments are left unchanged.
+	DeleteDuplicates bool
+}
+
+// UpsertComment creates or updates a "sticky" comment on an issue or pull
+// request that is identified by a hidden marker. The key, like
+// "my-app:coverage", is wrapped in the marker "<!-- my-app:coverage -->"
+// that is added to the body; it must not contain "--" or ">". If a comment
+// by author with the marker exists, the most recent one is edited to have the
+// new body. Otherwise, a new comment is created. It returns the ID of the
+// comment and true if it was created.
+//
+// The author is the login of the app's bot user, usually found with
+// AppLogin and the metadata from ClientCreator.AppMetadata. Comments by other
+// users, including other apps that use the same marker, are never edited.
+//
+// UpsertComment is equivalent to calling Post on a CommentDeduper with the
+// Author set. Use a CommentDeduper directly to delete duplicates.
+func UpsertComment(ctx context.Context, client *github.Client, owner, repo string, number int, author, key, body string) (int64, bool, error) {
+	if author == "" {
+		return 0, false, errors.New("comment author must not be empty")
+	}
+	if key == "" {
+		return 0, false, errors.New("comment key must not be empty")
+	}
+
+	comment, result, err := CommentDeduper{Author: author}.Post(ctx, client, owner, repo, number, key, body)
+	if err != nil {
+		return 0, false, err
+	}
+	return comment.GetID(), result == CommentCreated, nil
+}
+
+// Post posts a comment on an issue or pull request, unless an equivalent
+// comment exists.
+//
+// If key is not empty, the comment is identified by a hidden marker, like
+// "<!-- my-app:deploy -->", that is added to the end of the body. If a
+// comment with the marker exists, it is edited to have the new body instead
+// of creating another comment. If key is empty, a new comment is only created
+// if no comment has exactly the same body.
+//
+// If several comments match, the most recent comment is used and the others
+// are deleted if DeleteDuplicates is set.
+func (d CommentDeduper) Post(ctx context.Context, client *github.Client, owner, repo string, number int, key, body string) (*github.IssueComment, CommentResult, error) {
+	if key != "" {
+		if strings.Contains(key, "--") || strings.Contains(key, ">") {
+			return nil, CommentCreated, errors.Errorf("invalid comment key %q: keys must not contain \"--\" or \">\"", key)
+		}
+		body = body + "\n\n" + commentMarker(key)
+	}
+
+	matches, err := d.find(ctx, client, owner, repo, number, func(c *github.IssueComment) bool {
+		if key != "" {
+			return strings.Contains(c.GetBody(), commentMarker(key))
+		}
+		return c.GetBody() == body
+	})
+	if err != nil {
+		return nil, CommentCreated, err
+	}
+
+	var existing *github.IssueComment
+	if len(matches) > 0 {
+		existing = matches[len(matches)-1]
+		if d.DeleteDuplicates {
+			for _, c := range matches[:len(matches)-1] {
+				if IsDryRun(ctx) {
+					logDryRun(ctx, "skipped deleting duplicate comment", "owner", owner, "repo", repo, "number", number, "comment", c.GetID())
+					continue
+				}
+				if _, err := client.Issues.DeleteComment(ctx, owner, repo, c.GetID()); err != nil {
+					return nil, CommentCreated, errors.Wrapf(err, "failed to delete duplicate comment %d on %s/%s#%d", c.GetID(), owner, repo, number)
+				}
+			}
+		}
+	}
+
+	switch {
+	case existing == nil && IsDryRun(ctx):
+		logDryRun(ctx, "skipped creating comment", "owner", owner, "repo", repo, "number", number)
+		return &github.IssueComment{NodeID: github.String(DryRunNodeID), Body: &body}, CommentCreated, nil
+
+	case existing == nil:
+		comment, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+		if err != nil {
+			return nil, CommentCreated, errors.Wrapf(err, "failed to create comment on %s/%s#%d", owner, repo, number)
+		}
+		return comment, CommentCreated, nil
+
+	case existing.GetBody() == body:
+		return existing, CommentUnchanged, nil
+
+	case IsDryRun(ctx):
+		logDryRun(ctx, "skipped editing comment", "owner", owner, "repo", repo, "number", number, "comment", existing.GetID())
+		return &github.IssueComment{ID: existing.ID, NodeID: github.String(DryRunNodeID), Body: &body}, CommentUpdated, nil
+
+	default:
+		comment, _, err := client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+		if err != nil {
+			return nil, CommentUpdated, errors.Wrapf(err, "failed to edit comment %d on %s/%s#%d", existing.GetID(), owner, repo, number)
+		}
+		return comment, CommentUpdated, nil
+	}
+}
+
+// find returns the comments by the author that match, ordered from oldest to
+// newest.
+func (d CommentDeduper) find(ctx context.Context, client *github.Client, owner, repo string, number int, match func(*github.IssueComment) bool) ([]*github.IssueComment, error) {
+	opts := github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var found []*github.IssueComment
+	for {
+		comments, res, err := client.Issues.ListComments(ctx, owner, repo, number, &opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list comments on %s/%s#%d", owner, repo, number)
+		}
+
+		// comments are listed from oldest to newest
+		for _, c := range comments {
+			if d.isAuthor(c.GetUser()) && match(c) {
+				found = append(found, c)
+			}
+		}
+
+		if res.NextPage == 0 {
+			return found, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+func (d CommentDeduper) isAuthor(u *github.User) bool {
+	if d.Author != "" {
+		return strings.EqualFold(u.GetLogin(), d.Author)
+	}
+	return u.GetType() == "Bot"
+}
+
+// commentMarker returns the hidden marker that identifies comments with key.
+func commentMarker(key string) string {
+	return "<!-- " + key + " -->"
+}
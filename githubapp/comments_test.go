@@ -0,0 +1,333 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestCommentDeduper(t *testing.T) {
+	const marker = "\n\n<!-- my-app:deploy -->"
+
+	tests := map[string]struct {
+		Deduper  CommentDeduper
+		Existing []testComment
+		Key      string
+		Body     string
+
+		Result   CommentResult
+		Bodies   []string
+		EditedID int64
+		Err      bool
+	}{
+		"createsComment": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "octocat", Body: "looks good"},
+			},
+			Body:   "Deployed",
+			Result: CommentCreated,
+			Bodies: []string{"looks good", "Deployed"},
+		},
+		"skipsIdenticalComment": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "my-app[bot]", Body: "Build failed"},
+			},
+			Body:   "Build failed",
+			Result: CommentUnchanged,
+			Bodies: []string{"Build failed"},
+		},
+		"updatesKeyedComment": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "my-app[bot]", Body: "Deploying" + marker},
+				{ID: 2, Author: "octocat", Body: "thanks"},
+			},
+			Key:      "my-app:deploy",
+			Body:     "Deployed",
+			Result:   CommentUpdated,
+			Bodies:   []string{"Deployed" + marker, "thanks"},
+			EditedID: 1,
+		},
+		"updatesMostRecentKeyedComment": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "my-app[bot]", Body: "Deploying" + marker},
+				{ID: 2, Author: "my-app[bot]", Body: "Deploying again" + marker},
+			},
+			Key:      "my-app:deploy",
+			Body:     "Deployed",
+			Result:   CommentUpdated,
+			Bodies:   []string{"Deploying" + marker, "Deployed" + marker},
+			EditedID: 2,
+		},
+		"deletesDuplicates": {
+			Deduper: CommentDeduper{Author: "my-app[bot]", DeleteDuplicates: true},
+			Existing: []testComment{
+				{ID: 1, Author: "my-app[bot]", Body: "Deploying" + marker},
+				{ID: 2, Author: "octocat", Body: "thanks"},
+				{ID: 3, Author: "my-app[bot]", Body: "Deploying again" + marker},
+			},
+			Key:      "my-app:deploy",
+			Body:     "Deployed",
+			Result:   CommentUpdated,
+			Bodies:   []string{"thanks", "Deployed" + marker},
+			EditedID: 3,
+		},
+		"unchangedKeyedComment": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "my-app[bot]", Body: "Deployed" + marker},
+			},
+			Key:    "my-app:deploy",
+			Body:   "Deployed",
+			Result: CommentUnchanged,
+			Bodies: []string{"Deployed" + marker},
+		},
+		"ignoresOtherAuthors": {
+			Deduper: CommentDeduper{Author: "my-app[bot]"},
+			Existing: []testComment{
+				{ID: 1, Author: "octocat", Body: "quoting " + marker},
+			},
+			Key:    "my-app:deploy",
+			Body:   "Deployed",
+			Result: CommentCreated,
+			Bodies: []string{"quoting " + marker, "Deployed" + marker},
+		},
+		"anyBotWithoutAuthor": {
+			Existing: []testComment{
+				{ID: 1, Author: "other-app[bot]", Bot: true, Body: "Deploying" + marker},
+			},
+			Key:      "my-app:deploy",
+			Body:     "Deployed",
+			Result:   CommentUpdated,
+			Bodies:   []string{"Deployed" + marker},
+			EditedID: 1,
+		},
+		"invalidKey": {
+			Key:  "bad-->key",
+			Body: "Deployed",
+			Err:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestCommentServer(t, test.Existing)
+
+			comment, result, err := test.Deduper.Post(context.Background(), srv.Client(), "owner", "repo", 7, test.Key, test.Body)
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if result != test.Result {
+				t.Errorf("incorrect result: expected %s, actual %s", test.Result, result)
+			}
+			if comment == nil {
+				t.Fatal("expected comment, but got nil")
+			}
+			if srv.EditedID != test.EditedID {
+				t.Errorf("incorrect edited comment: expected %d, actual %d", test.EditedID, srv.EditedID)
+			}
+
+			bodies := srv.Bodies()
+			if strings.Join(bodies, "|") != strings.Join(test.Bodies, "|") {
+				t.Errorf("incorrect comments:\nexpected: %q\n  actual: %q", test.Bodies, bodies)
+			}
+		})
+	}
+}
+
+func TestUpsertComment(t *testing.T) {
+	srv := newTestCommentServer(t, []testComment{
+		{ID: 1, Author: "octocat", Body: "looks good"},
+		{ID: 2, Author: "other-app[bot]", Bot: true, Body: "Coverage: 50%\n\n<!-- my-app:coverage -->"},
+	})
+	ctx := context.Background()
+
+	id, created, err := UpsertComment(ctx, srv.Client(), "owner", "repo", 7, "my-app[bot]", "my-app:coverage", "Coverage: 80%")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created || id != 102 {
+		t.Errorf("expected comment 102 to be created, actual id %d, created %t", id, created)
+	}
+
+	id, created, err = UpsertComment(ctx, srv.Client(), "owner", "repo", 7, "my-app[bot]", "my-app:coverage", "Coverage: 85%")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created || id != 102 {
+		t.Errorf("expected comment 102 to be updated, actual id %d, created %t", id, created)
+	}
+
+	expected := []string{
+		"looks good",
+		"Coverage: 50%\n\n<!-- my-app:coverage -->",
+		"Coverage: 85%\n\n<!-- my-app:coverage -->",
+	}
+	if bodies := srv.Bodies(); strings.Join(bodies, "|") != strings.Join(expected, "|") {
+		t.Errorf("incorrect comments:\nexpected: %q\n  actual: %q", expected, bodies)
+	}
+
+	if _, _, err := UpsertComment(ctx, srv.Client(), "owner", "repo", 7, "my-app[bot]", "", "body"); err == nil {
+		t.Error("expected error for empty marker, but got nil")
+	}
+	if _, _, err := UpsertComment(ctx, srv.Client(), "owner", "repo", 7, "", "my-app:coverage", "body"); err == nil {
+		t.Error("expected error for empty author, but got nil")
+	}
+}
+
+type testComment struct {
+	ID     int64
+	Author string
+	Bot    bool
+	Body   string
+}
+
+// testCommentServer implements the comment endpoints for issue 7 in
+// owner/repo. It lists one comment per page to test pagination.
+type testCommentServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	comments []testComment
+	EditedID int64
+}
+
+func newTestCommentServer(t *testing.T, comments []testComment) *testCommentServer {
+	s := &testCommentServer{comments: comments}
+
+	writeComment := func(w http.ResponseWriter, c testComment) {
+		userType := "User"
+		if c.Bot {
+			userType = "Bot"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":   c.ID,
+			"body": c.Body,
+			"user": map[string]string{"login": c.Author, "type": userType},
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch r.Method {
+		case http.MethodGet:
+			page := 1
+			if p := r.URL.Query().Get("page"); p != "" {
+				fmt.Sscanf(p, "%d", &page)
+			}
+			if page < len(s.comments) {
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, s.URL, r.URL.Path, page+1))
+			}
+			if page > len(s.comments) {
+				fmt.Fprint(w, "[]")
+				return
+			}
+			fmt.Fprint(w, "[")
+			writeComment(w, s.comments[page-1])
+			fmt.Fprint(w, "]")
+
+		case http.MethodPost:
+			var c github.IssueComment
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				t.Errorf("failed to decode request body: %v", err)
+			}
+			created := testComment{ID: int64(len(s.comments) + 100), Author: "my-app[bot]", Bot: true, Body: c.GetBody()}
+			s.comments = append(s.comments, created)
+			w.WriteHeader(http.StatusCreated)
+			writeComment(w, created)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/comments/", func(w http.ResponseWriter, r *http.Request) {
+		var id int64
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/issues/comments/"), "%d", &id)
+
+		if r.Method == http.MethodDelete {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			for i := range s.comments {
+				if s.comments[i].ID == id {
+					s.comments = append(s.comments[:i], s.comments[i+1:]...)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			http.NotFound(w, r)
+			return
+		}
+
+		var c github.IssueComment
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.EditedID = id
+		for i := range s.comments {
+			if s.comments[i].ID == id {
+				s.comments[i].Body = c.GetBody()
+				writeComment(w, s.comments[i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testCommentServer) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
+
+func (s *testCommentServer) Bodies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bodies := make([]string, len(s.comments))
+	for i, c := range s.comments {
+		bodies[i] = c.Body
+	}
+	return bodies
+}
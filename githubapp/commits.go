@@ -0,0 +1,264 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// CommitRequest describes a commit created by CommitFiles.
+type CommitRequest struct {
+	Owner string
+	Repo  string
+
+	// Branch is the branch to update. If the branch does not exist, it is
+	// created from BaseBranch.
+	Branch string
+
+	// BaseBranch is the branch used as the parent of the commit if Branch
+	// does not exist. If empty, the repository's default branch is used.
+	BaseBranch string
+
+	Message string
+
+	// Author is the author of the commit. If nil, GitHub uses the app as the
+	// author.
+	Author *github.CommitAuthor
+
+	// Files maps file paths to their new content. Existing files are
+	// replaced.
+	Files map[string][]byte
+
+	// Delete lists the paths of files to remove.
+	Delete []string
+}
+
+// CommitResult is the commit created by CommitFiles.
+type CommitResult struct {
+	SHA     string
+	HTMLURL string
+
+	// CreatedBranch is true if the branch did not exist before the commit.
+	CreatedBranch bool
+
+	// DryRun is true if the commit was not created because dry-run mode is
+	// enabled. See WithDryRun.
+	DryRun bool
+}
+
+// CommitFiles creates a single commit that adds, replaces, and deletes files
+// on a branch. It creates a tree based on the tree of the branch's head
+// commit, creates a commit with the head as the parent, and then moves the
+// branch to the new commit. If the branch does not exist, it is created and
+// the head of the base branch is the parent.
+//
+// Updating the branch fails if the branch moves while the commit is created;
+// callers may retry the request in this case.
+func CommitFiles(ctx context.Context, client *github.Client, req CommitRequest) (CommitResult, error) {
+	if req.Branch == "" {
+		return CommitResult{}, errors.New("commit request must set a branch")
+	}
+	if len(req.Files) == 0 && len(req.Delete) == 0 {
+		return CommitResult{}, errors.New("commit request must add or delete at least one file")
+	}
+
+	var result CommitResult
+
+	parentSHA, err := branchHead(ctx, client, req.Owner, req.Repo, req.Branch)
+	if err != nil {
+		return CommitResult{}, err
+	}
+	if parentSHA == "" {
+		result.CreatedBranch = true
+
+		base := req.BaseBranch
+		if base == "" {
+			if base, err = DefaultBranch(ctx, client, req.Owner, req.Repo); err != nil {
+				return CommitResult{}, err
+			}
+		}
+		if parentSHA, err = branchHead(ctx, client, req.Owner, req.Repo, base); err != nil {
+			return CommitResult{}, err
+		}
+		if parentSHA == "" {
+			return CommitResult{}, errors.Errorf("base branch %q does not exist", base)
+		}
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped commit",
+			"owner", req.Owner,
+			"repo", req.Repo,
+			"branch", req.Branch,
+			"parent", parentSHA,
+			"files", len(req.Files),
+			"deletes", len(req.Delete),
+		)
+		result.DryRun = true
+		return result, nil
+	}
+
+	parent, _, err := client.Git.GetCommit(ctx, req.Owner, req.Repo, parentSHA)
+	if err != nil {
+		return CommitResult{}, errors.Wrapf(err, "failed to get commit %s", parentSHA)
+	}
+
+	entries, err := treeEntries(ctx, client, req)
+	if err != nil {
+		return CommitResult{}, err
+	}
+
+	tree, _, err := client.Git.CreateTree(ctx, req.Owner, req.Repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return CommitResult{}, errors.Wrap(err, "failed to create tree")
+	}
+
+	commit, _, err := client.Git.CreateCommit(ctx, req.Owner, req.Repo, &github.Commit{
+		Message: github.String(req.Message),
+		Author:  req.Author,
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []*github.Commit{{SHA: github.String(parentSHA)}},
+	})
+	if err != nil {
+		return CommitResult{}, errors.Wrap(err, "failed to create commit")
+	}
+
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + req.Branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}
+	if result.CreatedBranch {
+		_, _, err = client.Git.CreateRef(ctx, req.Owner, req.Repo, ref)
+	} else {
+		_, _, err = client.Git.UpdateRef(ctx, req.Owner, req.Repo, ref, false)
+	}
+	if err != nil {
+		return CommitResult{}, errors.Wrapf(err, "failed to update branch %q", req.Branch)
+	}
+
+	result.SHA = commit.GetSHA()
+	result.HTMLURL = commit.GetHTMLURL()
+	return result, nil
+}
+
+// EnsureBranch creates a branch that points at baseSHA if the branch does not
+// exist and returns true if it created the branch. If the branch already
+// exists, EnsureBranch returns false and leaves the branch unchanged, unless
+// force is true, in which case the branch is moved to baseSHA even if this
+// discards commits. It is safe to call repeatedly, like when a command is
+// run again.
+func EnsureBranch(ctx context.Context, client *github.Client, owner, repo, branch, baseSHA string, force bool) (bool, error) {
+	if IsDryRun(ctx) {
+		head, err := branchHead(ctx, client, owner, repo, branch)
+		if err != nil {
+			return false, err
+		}
+		if head == "" || (force && head != baseSHA) {
+			logDryRun(ctx, "skipped branch update", "owner", owner, "repo", repo, "branch", branch, "sha", baseSHA)
+		}
+		return head == "", nil
+	}
+
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(baseSHA)},
+	}
+
+	_, _, err := client.Git.CreateRef(ctx, owner, repo, ref)
+	if err == nil {
+		return true, nil
+	}
+	if !isRefExists(err) {
+		return false, errors.Wrapf(err, "failed to create branch %q", branch)
+	}
+
+	if force {
+		if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, true); err != nil {
+			return false, errors.Wrapf(err, "failed to update branch %q", branch)
+		}
+	}
+	return false, nil
+}
+
+// isRefExists returns true if err is the response GitHub sends when creating
+// a reference that already exists.
+func isRefExists(err error) bool {
+	var rerr *github.ErrorResponse
+	return isUnprocessable(err) && errors.As(err, &rerr) && rerr.Message == "Reference already exists"
+}
+
+// branchHead returns the SHA of the commit at the head of a branch or the
+// empty string if the branch does not exist.
+func branchHead(ctx context.Context, client *github.Client, owner, repo, branch string) (string, error) {
+	ref, res, err := client.Git.GetRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "failed to get branch %q", branch)
+	}
+	return ref.GetObject().GetSHA(), nil
+}
+
+// treeEntries converts the files in a request to tree entries. Files that are
+// not valid UTF-8 are uploaded as blobs first.
+func treeEntries(ctx context.Context, client *github.Client, req CommitRequest) ([]*github.TreeEntry, error) {
+	paths := make([]string, 0, len(req.Files))
+	for path := range req.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var entries []*github.TreeEntry
+	for _, path := range paths {
+		entry := &github.TreeEntry{
+			Path: github.String(path),
+			Mode: github.String("100644"),
+			Type: github.String("blob"),
+		}
+
+		content := req.Files[path]
+		if utf8.Valid(content) {
+			entry.Content = github.String(string(content))
+		} else {
+			blob, _, err := client.Git.CreateBlob(ctx, req.Owner, req.Repo, &github.Blob{
+				Content:  github.String(base64.StdEncoding.EncodeToString(content)),
+				Encoding: github.String("base64"),
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to create blob for %s", path)
+			}
+			entry.SHA = blob.SHA
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, path := range req.Delete {
+		// entries without a SHA or content delete the path
+		entries = append(entries, &github.TreeEntry{
+			Path: github.String(path),
+			Mode: github.String("100644"),
+			Type: github.String("blob"),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestCommitFiles(t *testing.T) {
+	tests := map[string]struct {
+		Branches map[string]string
+		Request  CommitRequest
+
+		CreatedBranch bool
+		RefRequest    string
+		Entries       int
+	}{
+		"updatesExistingBranch": {
+			Branches: map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			Request: CommitRequest{
+				Branch: "feature",
+				Files:  map[string][]byte{"a.txt": []byte("a")},
+			},
+			RefRequest: "PATCH /repos/owner/repo/git/refs/heads/feature",
+			Entries:    1,
+		},
+		"createsMissingBranch": {
+			Branches: map[string]string{"main": "base-sha"},
+			Request: CommitRequest{
+				Branch: "feature",
+				Files:  map[string][]byte{"a.txt": []byte("a"), "bin": {0xff, 0xfe}},
+				Delete: []string{"old.txt"},
+			},
+			CreatedBranch: true,
+			RefRequest:    "POST /repos/owner/repo/git/refs",
+			Entries:       3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestGitServer(t, test.Branches)
+
+			req := test.Request
+			req.Owner, req.Repo, req.Message = "owner", "repo", "Update files"
+
+			res, err := CommitFiles(context.Background(), srv.Client(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.SHA != "new-commit-sha" {
+				t.Errorf("incorrect commit SHA: %q", res.SHA)
+			}
+			if res.HTMLURL != "https://github.com/owner/repo/commit/new-commit-sha" {
+				t.Errorf("incorrect commit URL: %q", res.HTMLURL)
+			}
+			if res.CreatedBranch != test.CreatedBranch {
+				t.Errorf("incorrect created branch: expected %t, actual %t", test.CreatedBranch, res.CreatedBranch)
+			}
+			if srv.RefRequest != test.RefRequest {
+				t.Errorf("incorrect ref request: expected %q, actual %q", test.RefRequest, srv.RefRequest)
+			}
+			if srv.Ref.SHA != "new-commit-sha" {
+				t.Errorf("branch was not moved to the new commit: %q", srv.Ref.SHA)
+			}
+			if len(srv.Tree.Entries) != test.Entries {
+				t.Errorf("incorrect tree entry count: expected %d, actual %d", test.Entries, len(srv.Tree.Entries))
+			}
+		})
+	}
+}
+
+func TestCommitFilesTreeAndParent(t *testing.T) {
+	tests := map[string]struct {
+		Branches map[string]string
+
+		BaseTree string
+		Parent   string
+	}{
+		"existingBranch": {
+			Branches: map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			BaseTree: "feature-sha-tree",
+			Parent:   "feature-sha",
+		},
+		"newBranch": {
+			Branches: map[string]string{"main": "base-sha"},
+			BaseTree: "base-sha-tree",
+			Parent:   "base-sha",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestGitServer(t, test.Branches)
+
+			_, err := CommitFiles(context.Background(), srv.Client(), CommitRequest{
+				Owner:   "owner",
+				Repo:    "repo",
+				Branch:  "feature",
+				Message: "Add file",
+				Files:   map[string][]byte{"file.txt": []byte("content")},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if srv.Tree.BaseTree != test.BaseTree {
+				t.Errorf("incorrect base tree: expected %q, actual %q", test.BaseTree, srv.Tree.BaseTree)
+			}
+			if srv.Commit.Tree != "new-tree-sha" {
+				t.Errorf("incorrect commit tree: expected %q, actual %q", "new-tree-sha", srv.Commit.Tree)
+			}
+			if len(srv.Commit.Parents) != 1 || srv.Commit.Parents[0] != test.Parent {
+				t.Errorf("incorrect commit parents: expected [%s], actual %v", test.Parent, srv.Commit.Parents)
+			}
+			if srv.Ref.SHA != "new-commit-sha" {
+				t.Errorf("incorrect branch SHA: expected %q, actual %q", "new-commit-sha", srv.Ref.SHA)
+			}
+		})
+	}
+}
+
+func TestEnsureBranch(t *testing.T) {
+	tests := map[string]struct {
+		Branches map[string]string
+		Force    bool
+
+		Created    bool
+		RefRequest string
+	}{
+		"createsBranch": {
+			Branches:   map[string]string{"main": "base-sha"},
+			Created:    true,
+			RefRequest: "POST /repos/owner/repo/git/refs",
+		},
+		"keepsExistingBranch": {
+			Branches:   map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			RefRequest: "POST /repos/owner/repo/git/refs",
+		},
+		"forceUpdatesExistingBranch": {
+			Branches:   map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			Force:      true,
+			RefRequest: "PATCH /repos/owner/repo/git/refs/heads/feature",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestGitServer(t, test.Branches)
+
+			created, err := EnsureBranch(context.Background(), srv.Client(), "owner", "repo", "feature", "base-sha", test.Force)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertField(t, "created", test.Created, created)
+			assertField(t, "ref request", test.RefRequest, srv.RefRequest)
+			assertField(t, "ref SHA", "base-sha", srv.Ref.SHA)
+			assertField(t, "forced update", test.Force, srv.Ref.Force)
+		})
+	}
+}
+
+// testGitServer implements the Git database endpoints used by CommitFiles.
+// Each commit's tree SHA is the commit SHA with a "-tree" suffix.
+type testGitServer struct {
+	*httptest.Server
+
+	// Mux serves the endpoints; tests may register additional handlers.
+	Mux *http.ServeMux
+
+	mu sync.Mutex
+
+	Tree struct {
+		BaseTree string            `json:"base_tree"`
+		Entries  []json.RawMessage `json:"tree"`
+	}
+	Commit struct {
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	Ref struct {
+		Ref   string `json:"ref"`
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	RefRequest string
+}
+
+func newTestGitServer(t *testing.T, branches map[string]string) *testGitServer {
+	s := &testGitServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/ref/heads/", func(w http.ResponseWriter, r *http.Request) {
+		sha, ok := branches[strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/git/ref/heads/")]
+		if !ok {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"object":{"sha":%q}}`, sha)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/commits/", func(w http.ResponseWriter, r *http.Request) {
+		sha := strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/git/commits/")
+		fmt.Fprintf(w, `{"sha":%q,"tree":{"sha":%q}}`, sha, sha+"-tree")
+	})
+	mux.HandleFunc("/repos/owner/repo/git/blobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha":"blob-sha"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		s.decode(t, r, &s.Tree)
+		fmt.Fprint(w, `{"sha":"new-tree-sha"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		s.decode(t, r, &s.Commit)
+		fmt.Fprint(w, `{"sha":"new-commit-sha","html_url":"https://github.com/owner/repo/commit/new-commit-sha"}`)
+	})
+	refs := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			s.decode(t, r, &s.Ref)
+		}
+		s.mu.Lock()
+		s.RefRequest = r.Method + " " + r.URL.Path
+		ref := s.Ref.Ref
+		s.mu.Unlock()
+
+		if _, exists := branches[strings.TrimPrefix(ref, "refs/heads/")]; exists && r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message":"Reference already exists"}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}
+	mux.HandleFunc("/repos/owner/repo/git/refs", refs)
+	mux.HandleFunc("/repos/owner/repo/git/refs/", refs)
+
+	s.Mux = mux
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testGitServer) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
+
+func (s *testGitServer) decode(t *testing.T, r *http.Request, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		t.Errorf("failed to decode request body: %v", err)
+	}
+}
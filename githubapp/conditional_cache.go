@@ -0,0 +1,148 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gregjones/httpcache"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// DefaultConditionalCacheSize is the number of responses stored by the
+// cache enabled with WithConditionalRequestCache.
+const DefaultConditionalCacheSize = 1000
+
+// conditionalHeaders are the headers of a 304 Not Modified response that
+// replace the headers of the cached response.
+var conditionalHeaders = []string{
+	"Date",
+	RequestIDHeader,
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+	"X-RateLimit-Used",
+	"X-RateLimit-Resource",
+}
+
+// WithConditionalRequestCache makes conditional requests for resources that
+// installation clients have fetched before. The most recent successful
+// response with an ETag is stored for each installation and URL and the
+// ETag is sent in the If-None-Match header of later requests. If GitHub
+// responds with 304 Not Modified, the client returns the stored response
+// instead, with the X-From-Cache header set. GitHub does not count 304
+// responses against the rate limit.
+//
+// The cache holds at most DefaultConditionalCacheSize responses, removing
+// the least recently used response when full, and is shared by all clients.
+// It only helps GET requests for URLs that are requested repeatedly, like
+// when polling a resource; requests with other methods, app clients, and
+// token clients are not cached. Do not combine this option with
+// WithClientCaching, which also makes conditional requests.
+func WithConditionalRequestCache() ClientOption {
+	return func(c *clientCreator) {
+		// New only fails if the size is not positive
+		c.conditionalCache, _ = lru.New(DefaultConditionalCacheSize)
+	}
+}
+
+type conditionalEntry struct {
+	etag   string
+	status int
+	header http.Header
+	body   []byte
+}
+
+// conditionalRequests returns the middleware that makes conditional
+// requests, if the cache is enabled and the client is an installation
+// client.
+func (c *clientCreator) conditionalRequests(installID int64) []ClientMiddleware {
+	if c.conditionalCache == nil || installID == 0 {
+		return nil
+	}
+
+	cache := c.conditionalCache
+	return []ClientMiddleware{func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			// raw content is not buffered so that large files can be streamed
+			if r.Method != http.MethodGet || r.Header.Get("If-None-Match") != "" || r.Header.Get("Range") != "" || r.Header.Get("Accept") == rawContentMediaType {
+				return next.RoundTrip(r)
+			}
+
+			key := fmt.Sprintf("%d %s %s", installID, r.Header.Get("Accept"), r.URL.String())
+
+			var entry *conditionalEntry
+			if v, ok := cache.Get(key); ok {
+				entry = v.(*conditionalEntry)
+				r = r.Clone(r.Context())
+				r.Header.Set("If-None-Match", entry.etag)
+			}
+
+			res, err := next.RoundTrip(r)
+			if err != nil {
+				return res, err
+			}
+
+			switch {
+			case res.StatusCode == http.StatusNotModified && entry != nil:
+				_ = res.Body.Close()
+				return entry.response(r, res.Header), nil
+
+			case res.StatusCode == http.StatusOK && res.Header.Get("ETag") != "":
+				body, err := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				res.Body = io.NopCloser(bytes.NewReader(body))
+
+				cache.Add(key, &conditionalEntry{
+					etag:   res.Header.Get("ETag"),
+					status: res.StatusCode,
+					header: res.Header.Clone(),
+					body:   body,
+				})
+			}
+			return res, nil
+		})
+	}}
+}
+
+// response returns the stored response, with headers from a 304 Not
+// Modified response.
+func (e *conditionalEntry) response(r *http.Request, notModified http.Header) *http.Response {
+	header := e.header.Clone()
+	for _, name := range conditionalHeaders {
+		if v := notModified.Values(name); len(v) > 0 {
+			header[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	header.Set(httpcache.XFromCache, "1")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       r,
+	}
+}
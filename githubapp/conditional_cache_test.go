@@ -0,0 +1,164 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gregjones/httpcache"
+)
+
+func TestConditionalRequestCache(t *testing.T) {
+	tests := map[string]struct {
+		Installations []int64
+		Disabled      bool
+
+		Full        int
+		NotModified int
+	}{
+		"cachesRepeatedRequests": {
+			Installations: []int64{1, 1, 1},
+			Full:          1,
+			NotModified:   2,
+		},
+		"separatesInstallations": {
+			Installations: []int64{1, 2, 1, 2},
+			Full:          2,
+			NotModified:   2,
+		},
+		"disabledByDefault": {
+			Installations: []int64{1, 1},
+			Disabled:      true,
+			Full:          2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestGitHubServer(t, "")
+			repos := &testETagTransport{}
+
+			opts := []ClientOption{WithTransport(repos)}
+			if !test.Disabled {
+				opts = append(opts, WithConditionalRequestCache())
+			}
+			cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), opts...)
+
+			for i, id := range test.Installations {
+				client, err := cc.NewInstallationClient(id)
+				if err != nil {
+					t.Fatalf("unexpected error creating client: %v", err)
+				}
+
+				repo, res, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp")
+				if err != nil {
+					t.Fatalf("unexpected error in request %d: %v", i, err)
+				}
+				if expected := fmt.Sprintf("repo-%d", id); repo.GetName() != expected {
+					t.Errorf("incorrect repository name in request %d: expected %q, actual %q", i, expected, repo.GetName())
+				}
+				if res.Header.Get(RequestIDHeader) != fmt.Sprintf("request-%d", i+1) {
+					t.Errorf("response in request %d does not have the latest request ID: %q", i, res.Header.Get(RequestIDHeader))
+				}
+
+				cached := res.Header.Get(httpcache.XFromCache) != ""
+				if firstUse := indexOf(test.Installations, id) == i; cached == (firstUse || test.Disabled) {
+					t.Errorf("incorrect cached state in request %d: %t", i, cached)
+				}
+			}
+
+			if repos.Full != test.Full {
+				t.Errorf("incorrect number of full responses: expected %d, actual %d", test.Full, repos.Full)
+			}
+			if repos.NotModified != test.NotModified {
+				t.Errorf("incorrect number of not modified responses: expected %d, actual %d", test.NotModified, repos.NotModified)
+			}
+		})
+	}
+}
+
+func indexOf(ids []int64, id int64) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// testETagTransport responds to requests for repositories with a
+// repository named for the token's installation and an ETag. Other requests
+// are sent to the default transport.
+type testETagTransport struct {
+	mu          sync.Mutex
+	requests    int
+	Full        int
+	NotModified int
+}
+
+func (t *testETagTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path != "/repos/palantir/go-githubapp" {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+
+	var id, n int
+	if _, err := fmt.Sscanf(r.Header.Get("Authorization"), "token token-%d-%d", &id, &n); err != nil {
+		return nil, fmt.Errorf("unexpected authorization: %q", r.Header.Get("Authorization"))
+	}
+	etag := fmt.Sprintf(`"etag-%d"`, id)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+
+	rec := newTestResponse(r)
+	rec.Header.Set(RequestIDHeader, fmt.Sprintf("request-%d", t.requests))
+	if r.Header.Get("If-None-Match") == etag {
+		t.NotModified++
+		rec.StatusCode = http.StatusNotModified
+		rec.Status = "304 Not Modified"
+		return rec, nil
+	}
+
+	t.Full++
+	rec.Header.Set("ETag", etag)
+	rec.Header.Set("Content-Type", "application/json")
+	setTestResponseBody(rec, fmt.Sprintf(`{"name":"repo-%d"}`, id))
+	return rec, nil
+}
+
+func newTestResponse(r *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    r,
+	}
+}
+
+func setTestResponseBody(res *http.Response, body string) {
+	res.Body = io.NopCloser(strings.NewReader(body))
+	res.ContentLength = int64(len(body))
+}
@@ -15,8 +15,18 @@
 package githubapp
 
 import (
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultWebURL   = "https://github.com"
+	DefaultV3APIURL = "https://api.github.com"
+	DefaultV4APIURL = "https://api.github.com/graphql"
 )
 
 type Config struct {
@@ -28,12 +38,32 @@ type Config struct {
 		IntegrationID int64  `yaml:"integration_id" json:"integrationId"`
 		WebhookSecret string `yaml:"webhook_secret" json:"webhookSecret"`
 		PrivateKey    string `yaml:"private_key" json:"privateKey"`
+
+		// PrivateKeyPath is the path of a file containing the private key. It
+		// is used if PrivateKey is empty.
+		PrivateKeyPath string `yaml:"private_key_path" json:"privateKeyPath"`
+
+		// PrivateKeySource loads the private key. If set, it is used instead
+		// of PrivateKey and PrivateKeyPath.
+		PrivateKeySource PrivateKeySource `yaml:"-" json:"-"`
+
+		// WebhookSecrets are additional secrets accepted when validating
+		// webhook payloads. Use this with WebhookSecret to rotate secrets.
+		WebhookSecrets []string `yaml:"webhook_secrets" json:"webhookSecrets"`
+
+		// Slug is the URL-friendly name of the app. If set, it is included
+		// in the user agent of clients created from this configuration.
+		Slug string `yaml:"slug" json:"slug"`
 	} `yaml:"app" json:"app"`
 
 	OAuth struct {
 		ClientID     string `yaml:"client_id" json:"clientId"`
 		ClientSecret string `yaml:"client_secret" json:"clientSecret"`
 	} `yaml:"oauth" json:"oauth"`
+
+	// LogFieldNames sets the keys of fields added to loggers by dispatchers
+	// created with NewDefaultEventDispatcher. Empty names use the defaults.
+	LogFieldNames FieldNames `yaml:"log_field_names" json:"logFieldNames"`
 }
 
 // SetValuesFromEnv sets values in the configuration from coresponding
@@ -47,11 +77,105 @@ func (c *Config) SetValuesFromEnv(prefix string) {
 	setIntFromEnv("GITHUB_APP_INTEGRATION_ID", prefix, &c.App.IntegrationID)
 	setStringFromEnv("GITHUB_APP_WEBHOOK_SECRET", prefix, &c.App.WebhookSecret)
 	setStringFromEnv("GITHUB_APP_PRIVATE_KEY", prefix, &c.App.PrivateKey)
+	setStringFromEnv("GITHUB_APP_PRIVATE_KEY_PATH", prefix, &c.App.PrivateKeyPath)
+	setStringFromEnv("GITHUB_APP_SLUG", prefix, &c.App.Slug)
 
 	setStringFromEnv("GITHUB_OAUTH_CLIENT_ID", prefix, &c.OAuth.ClientID)
 	setStringFromEnv("GITHUB_OAUTH_CLIENT_SECRET", prefix, &c.OAuth.ClientSecret)
 }
 
+// LoadPrivateKey returns the PEM-encoded private key of the app. It uses
+// PrivateKeySource if set, then PrivateKey if it is not empty, and otherwise
+// reads the file at PrivateKeyPath. It returns an error if the key cannot be
+// loaded or is not a valid RSA private key.
+func (c *Config) LoadPrivateKey() ([]byte, error) {
+	source := c.App.PrivateKeySource
+	switch {
+	case source != nil:
+	case c.App.PrivateKey != "":
+		source = PEMBytes(c.App.PrivateKey)
+	case c.App.PrivateKeyPath != "":
+		source = PEMFile(c.App.PrivateKeyPath)
+	default:
+		return nil, errors.New("no private key configured")
+	}
+
+	key, err := source.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParsePrivateKey(key); err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+	return key, nil
+}
+
+// APIURLs returns the v3 (REST) and v4 (GraphQL) API URLs for the
+// configuration. Values set in V3APIURL and V4APIURL are used as-is. Missing
+// values are derived from WebURL: github.com uses the public API endpoints and
+// other hosts use the GitHub Enterprise Server paths, "/api/v3" and
+// "/api/graphql". It returns an error if the resulting URLs are not valid API
+// endpoints.
+func (c *Config) APIURLs() (v3 string, v4 string, err error) {
+	v3, v4 = c.V3APIURL, c.V4APIURL
+
+	if v3 == "" || v4 == "" {
+		webURL := c.WebURL
+		if webURL == "" {
+			webURL = DefaultWebURL
+		}
+
+		u, err := parseBaseURL(webURL)
+		if err != nil {
+			return "", "", errors.Wrap(err, "invalid web URL")
+		}
+
+		var derivedV3, derivedV4 string
+		if u.Host == "github.com" {
+			derivedV3, derivedV4 = DefaultV3APIURL, DefaultV4APIURL
+		} else {
+			base := strings.TrimSuffix(u.String(), "/")
+			derivedV3, derivedV4 = base+"/api/v3", base+"/api/graphql"
+		}
+
+		if v3 == "" {
+			v3 = derivedV3
+		}
+		if v4 == "" {
+			v4 = derivedV4
+		}
+	}
+
+	if _, err := parseBaseURL(v3); err != nil {
+		return "", "", errors.Wrap(err, "invalid v3 API URL")
+	}
+
+	u, err := parseBaseURL(v4)
+	if err != nil {
+		return "", "", errors.Wrap(err, "invalid v4 API URL")
+	}
+	if !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/graphql") {
+		return "", "", errors.Errorf("invalid v4 API URL: %q must be the GraphQL endpoint, like https://github.example.com/api/graphql", v4)
+	}
+
+	return v3, v4, nil
+}
+
+// parseBaseURL parses an absolute HTTP or HTTPS URL.
+func parseBaseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("%q must use the http or https scheme", s)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("%q must include a host", s)
+	}
+	return u, nil
+}
+
 func setStringFromEnv(key, prefix string, value *string) {
 	if v, ok := os.LookupEnv(prefix + key); ok {
 		*value = v
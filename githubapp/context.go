@@ -28,52 +28,133 @@ const (
 	LogKeyRepositoryOwner string = "github_repository_owner"
 	LogKeyPRNum           string = "github_pr_num"
 	LogKeyInstallationID  string = "github_installation_id"
+	LogKeyOrganization    string = "github_organization"
+	LogKeyRequestID       string = "github_request_id"
+	LogKeyTraceID         string = "trace_id"
 )
 
-// PrepareRepoContext adds information about a repository to the logger in a
-// context and returns the modified context and logger.
-func PrepareRepoContext(ctx context.Context, installationID int64, repo *github.Repository) (context.Context, zerolog.Logger) {
-	logctx := zerolog.Ctx(ctx).With()
+type deliveryIDKey struct{}
+
+// DeliveryIDFromContext returns the ID of the webhook delivery that is being
+// handled, as sent in the X-GitHub-Delivery header. The dispatcher sets the ID
+// in the context passed to handlers, including handlers run by asynchronous
+// schedulers, and adds it to the context loggers with the LogKeyDeliveryID
+// key. It returns false if the context is not associated with a delivery.
+func DeliveryIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(deliveryIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+type decoratorsKey struct{}
+
+// withDecorators applies decorators to ctx in order and stores them in the
+// result so they can be applied again to derived contexts.
+func withDecorators(ctx context.Context, decorators []ContextDecorator) context.Context {
+	for _, decorate := range decorators {
+		ctx = decorate(ctx)
+	}
+	return context.WithValue(ctx, decoratorsKey{}, decorators)
+}
+
+// copyDecorators applies the decorators stored in one context to another.
+func copyDecorators(from, to context.Context) context.Context {
+	if decorators, ok := from.Value(decoratorsKey{}).([]ContextDecorator); ok {
+		return withDecorators(to, decorators)
+	}
+	return to
+}
+
+// withDelivery adds the event type and delivery ID to the loggers in a
+// context and stores the delivery ID for DeliveryIDFromContext.
+func withDelivery(ctx context.Context, eventType, deliveryID string) context.Context {
+	names := FieldNamesFromContext(ctx)
+	ctx = context.WithValue(ctx, deliveryIDKey{}, deliveryID)
+	return withLogFields(ctx, names.EventType, eventType, names.DeliveryID, deliveryID)
+}
 
-	logctx = attachInstallationLogKeys(logctx, installationID)
-	logctx = attachRepoLogKeys(logctx, repo)
+// PrepareOrgContext adds information about an organization to the logger in
+// a context and returns the modified context and logger. Use it for events
+// that are not associated with a repository.
+func PrepareOrgContext(ctx context.Context, installationID int64, org *github.Organization) (context.Context, zerolog.Logger) {
+	return prepareContext(ctx, FieldNamesFromContext(ctx).OrgContextFields(installationID, org))
+}
 
-	logger := logctx.Logger()
-	return logger.WithContext(ctx), logger
+// PrepareRepoContext adds information about a repository to the logger in a
+// context and returns the modified context and logger. Use it for events that
+// are not associated with a pull request, like push or release events.
+func PrepareRepoContext(ctx context.Context, installationID int64, repo *github.Repository) (context.Context, zerolog.Logger) {
+	return prepareContext(ctx, FieldNamesFromContext(ctx).RepoContextFields(installationID, repo))
 }
 
 // PreparePRContext adds information about a pull request to the logger in a
 // context and returns the modified context and logger.
 func PreparePRContext(ctx context.Context, installationID int64, repo *github.Repository, number int) (context.Context, zerolog.Logger) {
-	logctx := zerolog.Ctx(ctx).With()
-
-	logctx = attachInstallationLogKeys(logctx, installationID)
-	logctx = attachRepoLogKeys(logctx, repo)
-	logctx = attachPullRequestLogKeys(logctx, number)
+	return prepareContext(ctx, FieldNamesFromContext(ctx).PRContextFields(installationID, repo, number))
+}
 
-	logger := logctx.Logger()
-	return logger.WithContext(ctx), logger
+// OrgContextFields returns the fields that PrepareOrgContext adds to a
+// logger, for use with other logging libraries. Fields are omitted if the
+// installation ID is not positive or the organization is nil.
+func OrgContextFields(installationID int64, org *github.Organization) map[string]interface{} {
+	return DefaultFieldNames().OrgContextFields(installationID, org)
 }
 
-func attachInstallationLogKeys(logctx zerolog.Context, installID int64) zerolog.Context {
-	if installID > 0 {
-		return logctx.Int64(LogKeyInstallationID, installID)
+// OrgContextFields is like the OrgContextFields function, but uses these
+// field names.
+func (n FieldNames) OrgContextFields(installationID int64, org *github.Organization) map[string]interface{} {
+	fields := n.installationFields(installationID)
+	if org != nil {
+		fields[n.Organization] = org.GetLogin()
 	}
-	return logctx
+	return fields
+}
+
+// RepoContextFields returns the fields that PrepareRepoContext adds to a
+// logger, for use with other logging libraries. Fields are omitted if the
+// installation ID is not positive or the repository is nil.
+func RepoContextFields(installationID int64, repo *github.Repository) map[string]interface{} {
+	return DefaultFieldNames().RepoContextFields(installationID, repo)
 }
 
-func attachRepoLogKeys(logctx zerolog.Context, repo *github.Repository) zerolog.Context {
+// RepoContextFields is like the RepoContextFields function, but uses these
+// field names.
+func (n FieldNames) RepoContextFields(installationID int64, repo *github.Repository) map[string]interface{} {
+	fields := n.installationFields(installationID)
 	if repo != nil {
-		return logctx.
-			Str(LogKeyRepositoryOwner, repo.GetOwner().GetLogin()).
-			Str(LogKeyRepositoryName, repo.GetName())
+		fields[n.RepositoryOwner] = repo.GetOwner().GetLogin()
+		fields[n.RepositoryName] = repo.GetName()
 	}
-	return logctx
+	return fields
 }
 
-func attachPullRequestLogKeys(logctx zerolog.Context, number int) zerolog.Context {
+// PRContextFields returns the fields that PreparePRContext adds to a logger,
+// for use with other logging libraries. In addition to the fields from
+// RepoContextFields, it includes the pull request number if it is positive.
+func PRContextFields(installationID int64, repo *github.Repository, number int) map[string]interface{} {
+	return DefaultFieldNames().PRContextFields(installationID, repo, number)
+}
+
+// PRContextFields is like the PRContextFields function, but uses these field
+// names.
+func (n FieldNames) PRContextFields(installationID int64, repo *github.Repository, number int) map[string]interface{} {
+	fields := n.RepoContextFields(installationID, repo)
 	if number > 0 {
-		return logctx.Int(LogKeyPRNum, number)
+		fields[n.PRNum] = number
 	}
-	return logctx
+	return fields
+}
+
+func (n FieldNames) installationFields(installationID int64) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if installationID > 0 {
+		fields[n.InstallationID] = installationID
+	}
+	return fields
+}
+
+// prepareContext adds fields to the loggers in a context and returns the
+// modified context and zerolog logger.
+func prepareContext(ctx context.Context, fields map[string]interface{}) (context.Context, zerolog.Logger) {
+	ctx = withLogFields(ctx, fieldList(fields)...)
+	return ctx, *zerolog.Ctx(ctx)
 }
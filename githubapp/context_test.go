@@ -18,7 +18,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/rs/zerolog"
@@ -53,6 +58,33 @@ func TestPrepareRepoContext(t *testing.T) {
 	assertField(t, "repository name", "test", entry.Name)
 }
 
+func TestPrepareOrgContext(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := zerolog.New(&out)
+	ctx := logger.WithContext(context.Background())
+
+	_, logger = PrepareOrgContext(ctx, 42, &github.Organization{
+		Login: github.String("palantir"),
+	})
+
+	logger.Info().Msg("")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry: %s: %v", out.String(), err)
+	}
+
+	assertField(t, "installation ID", float64(42), entry[LogKeyInstallationID])
+	assertField(t, "organization", "palantir", entry[LogKeyOrganization])
+	if _, ok := entry[LogKeyPRNum]; ok {
+		t.Errorf("unexpected pull request number in log entry: %s", out.String())
+	}
+	if _, ok := entry[LogKeyRepositoryName]; ok {
+		t.Errorf("unexpected repository name in log entry: %s", out.String())
+	}
+}
+
 func TestPreparePRContext(t *testing.T) {
 	var out bytes.Buffer
 
@@ -84,8 +116,229 @@ func TestPreparePRContext(t *testing.T) {
 	assertField(t, "pull request number", 128, entry.Number)
 }
 
+func TestContextFields(t *testing.T) {
+	repo := &github.Repository{
+		Name: github.String("test"),
+		Owner: &github.User{
+			Login: github.String("mhaypenny"),
+		},
+	}
+
+	tests := map[string]struct {
+		Fields   map[string]interface{}
+		Expected map[string]interface{}
+	}{
+		"repo": {
+			Fields: RepoContextFields(42, repo),
+			Expected: map[string]interface{}{
+				LogKeyInstallationID:  int64(42),
+				LogKeyRepositoryOwner: "mhaypenny",
+				LogKeyRepositoryName:  "test",
+			},
+		},
+		"pullRequest": {
+			Fields: PRContextFields(42, repo, 128),
+			Expected: map[string]interface{}{
+				LogKeyInstallationID:  int64(42),
+				LogKeyRepositoryOwner: "mhaypenny",
+				LogKeyRepositoryName:  "test",
+				LogKeyPRNum:           128,
+			},
+		},
+		"organization": {
+			Fields: OrgContextFields(42, &github.Organization{Login: github.String("palantir")}),
+			Expected: map[string]interface{}{
+				LogKeyInstallationID: int64(42),
+				LogKeyOrganization:   "palantir",
+			},
+		},
+		"missingValues": {
+			Fields:   PRContextFields(0, nil, 0),
+			Expected: map[string]interface{}{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.Expected, test.Fields) {
+				t.Errorf("incorrect fields:\nexpected: %v\n  actual: %v", test.Expected, test.Fields)
+			}
+		})
+	}
+}
+
 func assertField(t *testing.T, name string, expected, actual interface{}) {
 	if expected != actual {
 		t.Errorf("incorrect %s: expected %#v (%T), but was %#v (%T)", name, expected, expected, actual, actual)
 	}
 }
+
+func TestFieldNames(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := zerolog.New(&out)
+	ctx := logger.WithContext(context.Background())
+	ctx = WithFieldNames(ctx, FieldNames{
+		RepositoryName:  "github.repo",
+		RepositoryOwner: "github.owner",
+		PRNum:           "github.pr",
+	})
+
+	_, logger = PreparePRContext(ctx, 42, &github.Repository{
+		Name: github.String("test"),
+		Owner: &github.User{
+			Login: github.String("mhaypenny"),
+		},
+	}, 7)
+
+	logger.Info().Msg("")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry: %s: %v", out.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"level":              "info",
+		"github.repo":        "test",
+		"github.owner":       "mhaypenny",
+		"github.pr":          float64(7),
+		LogKeyInstallationID: float64(42),
+	}
+	if !reflect.DeepEqual(expected, entry) {
+		t.Errorf("incorrect log entry:\nexpected: %v\n  actual: %v", expected, entry)
+	}
+}
+
+func TestDeliveryIDFromContext(t *testing.T) {
+	if _, ok := DeliveryIDFromContext(context.Background()); ok {
+		t.Error("expected no delivery ID in an empty context")
+	}
+
+	tests := map[string]struct {
+		Scheduler Scheduler
+	}{
+		"default": {
+			Scheduler: DefaultScheduler(),
+		},
+		"async": {
+			Scheduler: AsyncScheduler(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			type result struct {
+				ID     string
+				Logged string
+			}
+			results := make(chan result, 1)
+
+			h := &TestEventHandler{
+				Types: []string{"pull_request"},
+				Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					var out bytes.Buffer
+					logger := zerolog.Ctx(ctx).Output(&out)
+					logger.Info().Msg("")
+
+					var entry struct {
+						DeliveryID string `json:"github_delivery_id"`
+					}
+					_ = json.Unmarshal(out.Bytes(), &entry)
+
+					id, _ := DeliveryIDFromContext(ctx)
+					results <- result{ID: id, Logged: entry.DeliveryID}
+					return nil
+				},
+			}
+
+			d := NewEventDispatcher([]EventHandler{h}, testHookSecret, WithScheduler(test.Scheduler))
+			d.ServeHTTP(httptest.NewRecorder(), newHookRequest("pull_request", "delivery-"+name, true))
+
+			select {
+			case r := <-results:
+				assertField(t, "delivery ID", "delivery-"+name, r.ID)
+				assertField(t, "logged delivery ID", "delivery-"+name, r.Logged)
+			case <-time.After(time.Second):
+				t.Fatal("handler was not called")
+			}
+		})
+	}
+}
+
+func TestWithContextDecorator(t *testing.T) {
+	type valueKey struct{}
+
+	tests := map[string]struct {
+		Dispatcher func([]EventHandler, ...DispatcherOption) (http.Handler, func())
+	}{
+		"default": {
+			Dispatcher: func(handlers []EventHandler, opts ...DispatcherOption) (http.Handler, func()) {
+				return NewEventDispatcher(handlers, testHookSecret, opts...), func() {}
+			},
+		},
+		"asyncScheduler": {
+			Dispatcher: func(handlers []EventHandler, opts ...DispatcherOption) (http.Handler, func()) {
+				opts = append(opts, WithScheduler(AsyncScheduler()))
+				return NewEventDispatcher(handlers, testHookSecret, opts...), func() {}
+			},
+		},
+		"asyncDispatcher": {
+			Dispatcher: func(handlers []EventHandler, opts ...DispatcherOption) (http.Handler, func()) {
+				d := NewAsyncDispatcher(handlers, testHookSecret, AsyncConfig{Workers: 1}, opts...)
+				return d, func() { _ = d.Shutdown(context.Background()) }
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			type result struct {
+				Value      string
+				App        string
+				DeliveryID string
+			}
+			results := make(chan result, 1)
+
+			h := &TestEventHandler{
+				Types: []string{"pull_request"},
+				Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					var out bytes.Buffer
+					logger := zerolog.Ctx(ctx).Output(&out)
+					logger.Info().Msg("")
+
+					var entry struct {
+						App        string `json:"app"`
+						DeliveryID string `json:"github_delivery_id"`
+					}
+					_ = json.Unmarshal(out.Bytes(), &entry)
+
+					value, _ := ctx.Value(valueKey{}).(string)
+					results <- result{Value: value, App: entry.App, DeliveryID: entry.DeliveryID}
+					return nil
+				},
+			}
+
+			d, shutdown := test.Dispatcher([]EventHandler{h},
+				WithContextDecorator(func(ctx context.Context) context.Context {
+					return context.WithValue(ctx, valueKey{}, "value")
+				}),
+				WithContextDecorator(func(ctx context.Context) context.Context {
+					return zerolog.New(io.Discard).With().Str("app", "test").Logger().WithContext(ctx)
+				}),
+			)
+			defer shutdown()
+
+			d.ServeHTTP(httptest.NewRecorder(), newHookRequest("pull_request", "delivery-"+name, true))
+
+			select {
+			case r := <-results:
+				assertField(t, "context value", "value", r.Value)
+				assertField(t, "logged app", "test", r.App)
+				assertField(t, "logged delivery ID", "delivery-"+name, r.DeliveryID)
+			case <-time.After(time.Second):
+				t.Fatal("handler was not called")
+			}
+		})
+	}
+}
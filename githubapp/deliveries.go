@@ -0,0 +1,225 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// DeliveryFilter selects the webhook deliveries returned by ListDeliveries.
+// The zero value matches all deliveries.
+type DeliveryFilter struct {
+	// EventTypes are the event types to include, like "pull_request". If
+	// empty, deliveries of all event types are included.
+	EventTypes []string
+
+	// Since and Until limit deliveries to those delivered at or after Since
+	// and before Until. Zero times do not limit deliveries.
+	Since time.Time
+	Until time.Time
+}
+
+func (f DeliveryFilter) matches(d *github.HookDelivery) bool {
+	at := d.GetDeliveredAt().Time
+	if !f.Since.IsZero() && at.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !at.Before(f.Until) {
+		return false
+	}
+	if len(f.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range f.EventTypes {
+		if t == d.GetEvent() {
+			return true
+		}
+	}
+	return false
+}
+
+// ListDeliveries returns the app's webhook deliveries that match filter,
+// newest first, following pagination. The client must authenticate as the
+// app. The deliveries only contain summaries; use ReplayDelivery to replay
+// the payload of a delivery. GitHub only keeps recent deliveries.
+func ListDeliveries(ctx context.Context, appClient *github.Client, filter DeliveryFilter) ([]*github.HookDelivery, error) {
+	opt := github.ListCursorOptions{
+		PerPage: 100,
+	}
+
+	var deliveries []*github.HookDelivery
+	for {
+		page, res, err := appClient.Apps.ListHookDeliveries(ctx, &opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list hook deliveries")
+		}
+
+		for _, d := range page {
+			// deliveries are listed newest first, so no later pages match
+			if !filter.Since.IsZero() && d.GetDeliveredAt().Time.Before(filter.Since) {
+				return deliveries, nil
+			}
+			if filter.matches(d) {
+				deliveries = append(deliveries, d)
+			}
+		}
+		if res.Cursor == "" {
+			return deliveries, nil
+		}
+		opt.Cursor = res.Cursor
+	}
+}
+
+// ReplayOptions configures how ReplayDelivery sends a delivery to a handler.
+type ReplayOptions struct {
+	// Secret is the webhook secret used to sign the payload. If empty, the
+	// request is not signed.
+	Secret string
+
+	// Headers are the header names expected by the handler, as set with
+	// WithHeaders. Empty names use the defaults.
+	Headers Headers
+}
+
+// replayRemoteAddr is the source address of replayed requests.
+const replayRemoteAddr = "127.0.0.1:0"
+
+// ReplayDelivery gets the payload of a past webhook delivery and sends it to
+// h, which is usually the handler returned by NewEventDispatcher, as if
+// GitHub delivered it again. The request has the headers of the original
+// delivery, with the event type, delivery ID, and signatures set using the
+// header names and secret in opts. The client must authenticate as the app.
+//
+// Replayed requests come from the loopback address 127.0.0.1. If h restricts
+// request sources with WithAllowedSourceCIDRs or WithGitHubMetaCIDRs, replay
+// to a dispatcher without the restriction or allow the loopback address.
+//
+// The replay is local: GitHub does not send the delivery again. ReplayDelivery
+// returns an error if h responds with a status of 400 or higher.
+func ReplayDelivery(ctx context.Context, appClient *github.Client, h http.Handler, opts ReplayOptions, deliveryID int64) error {
+	d, _, err := appClient.Apps.GetHookDelivery(ctx, deliveryID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get hook delivery %d", deliveryID)
+	}
+	if d.GetRequest() == nil || d.GetRequest().RawPayload == nil {
+		return errors.Errorf("hook delivery %d has no payload", deliveryID)
+	}
+
+	payload := []byte(*d.GetRequest().RawPayload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for hook delivery %d", deliveryID)
+	}
+	req.RemoteAddr = replayRemoteAddr
+
+	headers := opts.Headers.withDefaults()
+	for k, v := range d.GetRequest().Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headers.EventType, d.GetEvent())
+	req.Header.Set(headers.DeliveryID, d.GetGUID())
+	for _, name := range []string{github.SHA256SignatureHeader, github.SHA1SignatureHeader, headers.Signature, headers.SHA1Signature} {
+		req.Header.Del(name)
+	}
+	if opts.Secret != "" {
+		req.Header.Set(headers.Signature, "sha256="+signPayload(sha256.New, opts.Secret, payload))
+		req.Header.Set(headers.SHA1Signature, "sha1="+signPayload(sha1.New, opts.Secret, payload))
+	}
+
+	w := &replayResponse{header: make(http.Header)}
+	h.ServeHTTP(w, req)
+	if w.status() >= http.StatusBadRequest {
+		return errors.Errorf("replay of hook delivery %d failed with status %d: %s", deliveryID, w.status(), bytes.TrimSpace(w.body.Bytes()))
+	}
+	return nil
+}
+
+// replayResponse records the response to a replayed delivery.
+type replayResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *replayResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *replayResponse) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *replayResponse) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *replayResponse) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// ReplayDeliveries replays the deliveries that match filter, oldest first,
+// using ReplayDelivery. Each event is replayed once, even if GitHub delivered
+// it more than once. It stops at the first failure and returns the number of
+// deliveries replayed before the failure, so recovery can resume later.
+func ReplayDeliveries(ctx context.Context, appClient *github.Client, h http.Handler, opts ReplayOptions, filter DeliveryFilter) (int, error) {
+	deliveries, err := ListDeliveries(ctx, appClient, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed int
+	seen := make(map[string]bool)
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		d := deliveries[i]
+		if guid := d.GetGUID(); guid != "" {
+			if seen[guid] {
+				continue
+			}
+			seen[guid] = true
+		}
+
+		if err := ReplayDelivery(ctx, appClient, h, opts, d.GetID()); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func signPayload(h func() hash.Hash, secret string, payload []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestListDeliveries(t *testing.T) {
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		Filter   DeliveryFilter
+		Expected []int64
+		Pages    int
+	}{
+		"all": {
+			Expected: []int64{6, 5, 4, 3, 2, 1},
+			Pages:    3,
+		},
+		"eventTypes": {
+			Filter:   DeliveryFilter{EventTypes: []string{"push"}},
+			Expected: []int64{6, 5, 3, 1},
+			Pages:    3,
+		},
+		"since": {
+			Filter:   DeliveryFilter{Since: start.Add(4 * time.Minute)},
+			Expected: []int64{6, 5, 4},
+			Pages:    2,
+		},
+		"until": {
+			Filter:   DeliveryFilter{Until: start.Add(3 * time.Minute)},
+			Expected: []int64{2, 1},
+			Pages:    3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestDeliveriesServer(t, start)
+			client := newTestDeliveriesClient(t, server.URL)
+
+			deliveries, err := ListDeliveries(context.Background(), client, test.Filter)
+			if err != nil {
+				t.Fatalf("unexpected error listing deliveries: %v", err)
+			}
+
+			var ids []int64
+			for _, d := range deliveries {
+				ids = append(ids, d.GetID())
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(test.Expected) {
+				t.Errorf("incorrect deliveries: expected %v, actual %v", test.Expected, ids)
+			}
+			if server.pages != test.Pages {
+				t.Errorf("incorrect number of pages: expected %d, actual %d", test.Pages, server.pages)
+			}
+		})
+	}
+}
+
+func TestReplayDeliveries(t *testing.T) {
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	server := newTestDeliveriesServer(t, start)
+	client := newTestDeliveriesClient(t, server.URL)
+
+	var handled []string
+	handler := &TestEventHandler{
+		Types: []string{"push", "pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			var p struct{ Delivery int64 }
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			handled = append(handled, fmt.Sprintf("%s %s %d", eventType, deliveryID, p.Delivery))
+			return nil
+		},
+	}
+	d := NewEventDispatcher([]EventHandler{handler}, testHookSecret)
+
+	n, err := ReplayDeliveries(context.Background(), client, d, ReplayOptions{Secret: testHookSecret}, DeliveryFilter{Since: start.Add(3 * time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error replaying deliveries: %v", err)
+	}
+
+	// delivery 6 is a redelivery of delivery 5
+	expected := []string{"push guid-3 3", "pull_request guid-4 4", "push guid-5 5"}
+	assertField(t, "replayed deliveries", len(expected), n)
+	if fmt.Sprint(handled) != fmt.Sprint(expected) {
+		t.Errorf("incorrect handled deliveries\nexpected: %v\n  actual: %v", expected, handled)
+	}
+
+	t.Run("invalidSignature", func(t *testing.T) {
+		err := ReplayDelivery(context.Background(), client, d, ReplayOptions{Secret: "wrong-secret"}, 1)
+		if err == nil {
+			t.Fatal("expected error replaying delivery, but got nil")
+		}
+	})
+
+	t.Run("customHeaders", func(t *testing.T) {
+		handled = nil
+
+		headers := Headers{
+			EventType:  "X-Proxy-GitHub-Event",
+			DeliveryID: "X-Proxy-GitHub-Delivery",
+			Signature:  "X-Proxy-Hub-Signature-256",
+		}
+		d := NewEventDispatcher([]EventHandler{handler}, testHookSecret, WithHeaders(headers))
+
+		opts := ReplayOptions{Secret: testHookSecret, Headers: headers}
+		if err := ReplayDelivery(context.Background(), client, d, opts, 1); err != nil {
+			t.Fatalf("unexpected error replaying delivery: %v", err)
+		}
+		assertField(t, "handled deliveries", "[push guid-1 1]", fmt.Sprint(handled))
+	})
+
+	t.Run("loopbackSource", func(t *testing.T) {
+		handled = nil
+
+		_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+		d := NewEventDispatcher([]EventHandler{handler}, testHookSecret, WithAllowedSourceCIDRs([]net.IPNet{*loopback}))
+
+		if err := ReplayDelivery(context.Background(), client, d, ReplayOptions{Secret: testHookSecret}, 1); err != nil {
+			t.Fatalf("unexpected error replaying delivery: %v", err)
+		}
+		assertField(t, "handled deliveries", "[push guid-1 1]", fmt.Sprint(handled))
+	})
+}
+
+type testDeliveriesServer struct {
+	*httptest.Server
+	pages int
+}
+
+// newTestDeliveriesServer serves six deliveries, one per minute after start,
+// in pages of two. Delivery 6 is a redelivery of delivery 5.
+func newTestDeliveriesServer(t *testing.T, start time.Time) *testDeliveriesServer {
+	var deliveries []*github.HookDelivery
+	for i := int64(6); i >= 1; i-- {
+		event, guid := "push", fmt.Sprintf("guid-%d", i)
+		if i%2 == 0 {
+			event = "pull_request"
+		}
+		if i == 6 {
+			event, guid = "push", "guid-5"
+		}
+		deliveries = append(deliveries, &github.HookDelivery{
+			ID:          github.Int64(i),
+			GUID:        github.String(guid),
+			Event:       github.String(event),
+			DeliveredAt: &github.Timestamp{Time: start.Add(time.Duration(i) * time.Minute)},
+			Redelivery:  github.Bool(i == 6),
+		})
+	}
+
+	s := &testDeliveriesServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/hook/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		s.pages++
+
+		var page int
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			_, _ = fmt.Sscanf(c, "page-%d", &page)
+		}
+		if end := 2 * (page + 1); end < len(deliveries) {
+			next := url.URL{Path: r.URL.Path, RawQuery: fmt.Sprintf("cursor=page-%d", page+1)}
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, s.URL, next.String()))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(deliveries[2*page : 2*(page+1)])
+	})
+	mux.HandleFunc("/app/hook/deliveries/", func(w http.ResponseWriter, r *http.Request) {
+		var id int64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/app/hook/deliveries/"), "%d", &id); err != nil || id < 1 || id > 6 {
+			http.NotFound(w, r)
+			return
+		}
+
+		d := *deliveries[6-id]
+		payload := json.RawMessage(fmt.Sprintf(`{"delivery":%d}`, id))
+		d.Request = &github.HookRequest{
+			Headers: map[string]string{
+				"X-GitHub-Event":      d.GetEvent(),
+				"X-GitHub-Delivery":   d.GetGUID(),
+				"X-Hub-Signature-256": "sha256=original",
+			},
+			RawPayload: &payload,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestDeliveriesClient(t *testing.T, baseURL string) *github.Client {
+	client := github.NewClient(nil)
+	u, err := url.Parse(baseURL + "/")
+	if err != nil {
+		t.Fatalf("invalid base URL: %v", err)
+	}
+	client.BaseURL = u
+	return client
+}
@@ -15,20 +15,42 @@
 package githubapp
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/pkg/errors"
 	"github.com/rcrowley/go-metrics"
-	"github.com/rs/zerolog"
 )
 
 const (
 	DefaultWebhookRoute string = "/api/github/hook"
+
+	// DefaultMaxPayloadBytes is the default maximum size of a webhook
+	// payload. GitHub caps payloads at 25 MB.
+	DefaultMaxPayloadBytes int64 = 25 << 20
+)
+
+var (
+	// ErrPayloadTooLarge is the cause of a ValidationError for a webhook
+	// payload that exceeds the maximum size of the dispatcher.
+	ErrPayloadTooLarge = errors.New("payload exceeds maximum size")
 )
 
+// EventHandler handles GitHub webhook events. Handlers may also implement an
+// optional Name() string method to set the name used to identify the handler
+// in metrics. See HandlerName for details.
 type EventHandler interface {
 	// Handles returns a list of GitHub events that this handler handles
 	// See https://developer.github.com/v3/activity/events/types/
@@ -39,19 +61,51 @@ type EventHandler interface {
 	// only be called for the events returned by Handles().
 	//
 	// If Handle returns an error, processing stops and the error is passed
-	// directly to the configured error handler.
+	// directly to the configured error handler. If Handle panics, the
+	// dispatcher recovers, logs the panic, and calls the panic handler, if
+	// set, but does not call the error handler.
 	Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error
 }
 
+// ResponseHandler is an EventHandler that also sets the status code of the
+// response sent to GitHub. If a handler implements this interface, the
+// dispatcher calls HandleResponse instead of Handle.
+//
+// If HandleResponse returns an error, the status code is ignored and the
+// error is passed to the error handler. Otherwise, a non-zero status code is
+// sent as the response, replacing any responder set by SetResponder. Status
+// codes are only sent when events are handled synchronously; asynchronous
+// schedulers respond before handlers run.
+type ResponseHandler interface {
+	EventHandler
+
+	HandleResponse(ctx context.Context, eventType, deliveryID string, payload []byte) (int, error)
+}
+
 // ErrorCallback is called when an event handler returns an error. The error
 // from the handler is passed directly as the final argument.
 type ErrorCallback func(w http.ResponseWriter, r *http.Request, err error)
 
+// PanicHandler is called when an event handler panics. It is passed the
+// handler's context, the value recovered from the panic, and the stack trace
+// of the panicking goroutine.
+type PanicHandler func(ctx context.Context, recovered interface{}, stack []byte)
+
 // ResponseCallback is called to send a response to GitHub after an event is
 // handled. It is passed the event type and a flag indicating if an event
 // handler was called for the event.
 type ResponseCallback func(w http.ResponseWriter, r *http.Request, event string, handled bool)
 
+// UnhandledEventCallback is called for events that do not have a registered
+// handler. It is passed the request context, which includes a logger with the
+// event type and delivery ID, and the validated payload.
+type UnhandledEventCallback func(ctx context.Context, eventType, deliveryID string, payload []byte)
+
+// DispatcherMiddleware wraps an event handler to add behavior before or after
+// the handler runs. Middleware usually returns a type that embeds the next
+// handler and overrides the Handle method.
+type DispatcherMiddleware func(next EventHandler) EventHandler
+
 // DispatcherOption configures properties of an event dispatcher.
 type DispatcherOption func(*eventDispatcher)
 
@@ -73,6 +127,102 @@ func WithResponseCallback(onResponse ResponseCallback) DispatcherOption {
 	}
 }
 
+// WithMaxPayloadBytes sets the maximum size of a webhook payload. Larger
+// requests are rejected before their signature is validated. If not set, the
+// dispatcher uses DefaultMaxPayloadBytes.
+func WithMaxPayloadBytes(n int64) DispatcherOption {
+	return func(d *eventDispatcher) {
+		if n > 0 {
+			d.maxPayloadBytes = n
+		}
+	}
+}
+
+// WithMiddleware adds middleware that wraps every event handler. Middleware is
+// applied in order, so the first middleware is the outermost. Middleware runs
+// in the context used by the scheduler, which includes a logger with the
+// event type and delivery ID.
+func WithMiddleware(middleware ...DispatcherMiddleware) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.middleware = append(d.middleware, middleware...)
+	}
+}
+
+// ContextDecorator adds values to the context of a webhook request, such as
+// configuration, clients, or other resources used by event handlers.
+type ContextDecorator func(ctx context.Context) context.Context
+
+// WithContextDecorator adds a decorator that is called with the context of
+// each webhook request. Decorators are applied in order before the dispatcher
+// validates the request and before it adds the event type and delivery ID to
+// the context loggers. A decorator that replaces the logger in the context
+// therefore sees only the logger of the HTTP request, and the dispatcher adds
+// the delivery fields to the replacement.
+//
+// Asynchronous schedulers run handlers in a new context. DefaultContextDeriver
+// calls the decorators again with the new context before it copies the
+// loggers from the request context, so values added by decorators are
+// available to all handlers. Custom context derivers must copy these values
+// themselves.
+func WithContextDecorator(decorator ContextDecorator) DispatcherOption {
+	return func(d *eventDispatcher) {
+		if decorator != nil {
+			d.decorators = append(d.decorators, decorator)
+		}
+	}
+}
+
+// decorate applies the context decorators to ctx and records them so that
+// DefaultContextDeriver can apply them to derived contexts.
+func (d *eventDispatcher) decorate(ctx context.Context) context.Context {
+	if len(d.decorators) == 0 {
+		return ctx
+	}
+	return withDecorators(ctx, d.decorators)
+}
+
+// RecoverMiddleware converts panics in the wrapped handler to errors of type
+// HandlerPanicError and logs the stack trace. The dispatcher already recovers
+// panics from event handlers, so this is only needed to recover panics from
+// other middleware.
+func RecoverMiddleware(next EventHandler) EventHandler {
+	return &recoveringHandler{EventHandler: next}
+}
+
+// WithPingHandler enables or disables the built-in handler for ping events.
+// The built-in handler is enabled by default and is only used if no
+// registered handler handles ping events. It responds with a 200 OK status
+// and the "zen" value from the event and logs a warning if the webhook is not
+// subscribed to all of the events with registered handlers.
+func WithPingHandler(enabled bool) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.handlePing = enabled
+	}
+}
+
+// OnUnhandled sets a function that is called for events that do not have a
+// registered handler, like new event types that the application does not yet
+// support. Use this to log or forward these events. The function is called
+// before the dispatcher responds and the response callback is then called as
+// if a handler processed the event, so the default callback responds with a
+// 200 OK status instead of 202 Accepted.
+//
+// The built-in ping handler, if enabled, has priority over the function.
+func OnUnhandled(fn UnhandledEventCallback) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.onUnhandled = fn
+	}
+}
+
+// WithPanicHandler sets a function that is called when an event handler
+// panics, in addition to logging the panic. Use this to report panics to an
+// external error tracking service.
+func WithPanicHandler(onPanic PanicHandler) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.onPanic = onPanic
+	}
+}
+
 // WithScheduler sets the scheduler used to process events. Setting a
 // non-default scheduler can enable asynchronous processing. When a scheduler
 // is asynchronous, the dispatcher validatates event payloads, queues valid
@@ -87,6 +237,53 @@ func WithScheduler(s Scheduler) DispatcherOption {
 	}
 }
 
+// WithWebhookSecrets adds secrets that are accepted when validating payloads,
+// in addition to the secret passed to NewEventDispatcher. A payload is valid if
+// its signature matches any of the secrets. Configuring multiple secrets
+// allows rotating the webhook secret without rejecting deliveries.
+func WithWebhookSecrets(secrets ...string) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.secrets = append(d.secrets, secrets...)
+	}
+}
+
+// WithAllowSHA1 allows payloads that are only signed with SHA-1, using the
+// X-Hub-Signature header. By default, payloads must be signed with SHA-256
+// using the X-Hub-Signature-256 header. Use WithHeaders to change the names of
+// the headers. If a payload has both headers, only
+// the SHA-256 signature is checked.
+func WithAllowSHA1() DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.allowSHA1 = true
+	}
+}
+
+// InsecureConfirmation confirms a dangerous option. See IReallyMeanIt.
+type InsecureConfirmation bool
+
+// IReallyMeanIt confirms that WithInsecureSkipSignatureValidation should
+// disable signature validation even though a webhook secret is configured.
+const IReallyMeanIt InsecureConfirmation = true
+
+// WithInsecureSkipSignatureValidation disables signature validation, so the
+// dispatcher accepts payloads from anyone who can send requests to it. This
+// is only intended for local development, like when forwarding webhooks with
+// "gh webhook forward" or sending test payloads with curl. Never use this
+// option in production.
+//
+// The dispatcher logs a warning for every request while validation is
+// disabled. If the dispatcher has a non-empty webhook secret, which usually
+// means it is configured for a real app, NewEventDispatcher panics unless the
+// option is confirmed by passing IReallyMeanIt.
+func WithInsecureSkipSignatureValidation(confirm ...InsecureConfirmation) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.skipSignatures = true
+		for _, c := range confirm {
+			d.skipSignaturesConfirmed = d.skipSignaturesConfirmed || bool(c)
+		}
+	}
+}
+
 // ValidationError is passed to error callbacks when the webhook payload fails
 // validation.
 type ValidationError struct {
@@ -99,20 +296,61 @@ func (ve ValidationError) Error() string {
 	return fmt.Sprintf("invalid event: %v", ve.Cause)
 }
 
-type eventDispatcher struct {
-	handlerMap map[string]EventHandler
-	secret     string
+func (ve ValidationError) Unwrap() error {
+	return ve.Cause
+}
 
-	scheduler  Scheduler
-	onError    ErrorCallback
-	onResponse ResponseCallback
+type eventDispatcher struct {
+	handlerMap      map[string]EventHandler
+	actionHandlers  map[actionKey][]EventHandler
+	actionEvents    map[string]bool
+	secrets         []string
+	allowSHA1       bool
+	maxPayloadBytes int64
+	handlePing      bool
+
+	headers           Headers
+	requireDeliveryID bool
+
+	validateStructure bool
+	appID             int64
+	appIDExempt       map[string]bool
+
+	skipSignatures          bool
+	skipSignaturesConfirmed bool
+
+	restrictSources bool
+	allowedSources  []net.IPNet
+	metaSources     *metaCIDRs
+	proxyHeader     string
+
+	concurrentHandlers bool
+	decoder            Decoder
+	handlerTimeout     time.Duration
+	sharedCalls        *SharedCalls
+
+	scheduler   Scheduler
+	onError     ErrorCallback
+	onResponse  ResponseCallback
+	onPanic     PanicHandler
+	onUnhandled UnhandledEventCallback
+	metrics     metrics.Registry
+	sink        Metrics
+	tracer      Tracer
+	fieldNames  *FieldNames
+	middleware  []DispatcherMiddleware
+	decorators  []ContextDecorator
 }
 
 // NewDefaultEventDispatcher is a convenience method to create an event
 // dispatcher from configuration using the default error and response
-// callbacks.
+// callbacks. Payloads are validated using all of the configured webhook
+// secrets.
 func NewDefaultEventDispatcher(c Config, handlers ...EventHandler) http.Handler {
-	return NewEventDispatcher(handlers, c.App.WebhookSecret)
+	return NewEventDispatcher(handlers, c.App.WebhookSecret,
+		WithWebhookSecrets(c.App.WebhookSecrets...),
+		WithLogFieldNames(c.LogFieldNames),
+	)
 }
 
 // NewEventDispatcher creates an http.Handler that dispatches GitHub webhook
@@ -132,30 +370,100 @@ func NewEventDispatcher(handlers []EventHandler, secret string, opts ...Dispatch
 	}
 
 	d := &eventDispatcher{
-		handlerMap: handlerMap,
-		secret:     secret,
-		scheduler:  DefaultScheduler(),
-		onError:    DefaultErrorCallback,
-		onResponse: DefaultResponseCallback,
+		handlerMap:      handlerMap,
+		secrets:         []string{secret},
+		maxPayloadBytes: DefaultMaxPayloadBytes,
+		handlePing:      true,
+		headers:         DefaultHeaders(),
+		scheduler:       DefaultScheduler(),
+		onError:         DefaultErrorCallback,
+		onResponse:      DefaultResponseCallback,
+		sharedCalls:     NewSharedCalls(),
 	}
 
 	for _, opt := range opts {
 		opt(d)
 	}
 
+	if d.skipSignatures && !d.skipSignaturesConfirmed {
+		for _, secret := range d.secrets {
+			if secret != "" {
+				panic("NewEventDispatcher: WithInsecureSkipSignatureValidation must be confirmed with IReallyMeanIt when a webhook secret is set")
+			}
+		}
+	}
+
+	for event, h := range d.handlerMap {
+		if th, ok := h.(*typedEventHandler); ok {
+			th.concurrent = d.concurrentHandlers
+		}
+		d.setDecoder(h)
+		d.handlerMap[event] = d.wrap(h)
+	}
+
+	d.actionEvents = make(map[string]bool)
+	for key, hs := range d.actionHandlers {
+		for i, h := range hs {
+			d.setDecoder(h)
+			hs[i] = d.wrap(h)
+		}
+		d.actionEvents[key.event] = true
+	}
+
 	return d
 }
 
+// wrap adds the standard wrappers and middleware to an event handler.
+func (d *eventDispatcher) wrap(h EventHandler) EventHandler {
+	policy, hasPolicy := h.(*policyHandler)
+	if hasPolicy {
+		h = policy.EventHandler
+	}
+
+	serial := isSerial(h)
+	timeout := d.timeoutFor(h)
+	if rh, ok := h.(ResponseHandler); ok {
+		h = &statusHandler{ResponseHandler: rh}
+	}
+	h = &sharedCallsHandler{EventHandler: h, calls: d.sharedCalls}
+	if timeout > 0 {
+		h = &timeoutHandler{EventHandler: h, timeout: timeout, registry: d.metrics, sink: d.sink}
+	}
+	h = &recoveringHandler{EventHandler: h, onPanic: d.onPanic}
+	if d.metrics != nil || d.sink != nil {
+		h = newMeteredHandler(h, d.metrics, d.sink)
+	}
+	for i := len(d.middleware) - 1; i >= 0; i-- {
+		h = d.middleware[i](h)
+	}
+	if serial {
+		h = &serialHandler{EventHandler: h}
+	}
+	if hasPolicy {
+		h = policy.withHandler(h)
+	}
+	return h
+}
+
 // ServeHTTP processes a webhook request from GitHub.
 func (d *eventDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// initialize context for SetResponder/GetResponder
 	ctx = InitializeResponder(ctx)
+	ctx = d.decorate(ctx)
+	ctx = withHeaders(ctx, d.headers)
 	r = r.WithContext(ctx)
 
-	eventType := r.Header.Get("X-GitHub-Event")
-	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if d.restrictSources {
+		if err := d.checkSource(r); err != nil {
+			d.onError(w, r, err)
+			return
+		}
+	}
+
+	eventType := d.eventType(r)
+	deliveryID := d.deliveryID(r)
 
 	if eventType == "" {
 		d.onError(w, r, ValidationError{
@@ -165,17 +473,35 @@ func (d *eventDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if deliveryID == "" && d.requireDeliveryID {
+		d.onError(w, r, ValidationError{
+			EventType:  eventType,
+			DeliveryID: deliveryID,
+			Cause:      errors.Errorf("missing %s header", d.headers.DeliveryID),
+		})
+		return
+	}
+
+	if d.fieldNames != nil {
+		ctx = WithFieldNames(ctx, *d.fieldNames)
+	}
 
-	logger := zerolog.Ctx(ctx).With().
-		Str(LogKeyEventType, eventType).
-		Str(LogKeyDeliveryID, deliveryID).
-		Logger()
+	var span Span
+	if d.tracer != nil {
+		ctx, span = d.startDeliverySpan(ctx, eventType, deliveryID)
+		defer span.End()
+	}
 
 	// initialize context with event logger
-	ctx = logger.WithContext(ctx)
+	ctx = withDelivery(ctx, eventType, deliveryID)
 	r = r.WithContext(ctx)
+	logger := LoggerFromContext(ctx)
+
+	if d.skipSignatures {
+		logger.Warn("INSECURE: webhook signature validation is disabled; do not use WithInsecureSkipSignatureValidation in production")
+	}
 
-	payloadBytes, err := github.ValidatePayload(r, []byte(d.secret))
+	payloadBytes, err := d.validatePayload(r)
 	if err != nil {
 		d.onError(w, r, ValidationError{
 			EventType:  eventType,
@@ -184,10 +510,40 @@ func (d *eventDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if d.validateStructure {
+		if err := checkPayloadStructure(eventType, payloadBytes); err != nil {
+			d.rejectMalformedPayload(w, r, payloadBytes, err)
+			return
+		}
+	}
+	if d.appIDExempt != nil {
+		if err := d.checkAppID(r, eventType, payloadBytes); err != nil {
+			d.onError(w, r, ValidationError{
+				EventType:  eventType,
+				DeliveryID: deliveryID,
+				Cause:      err,
+			})
+			return
+		}
+	}
 
-	logger.Info().Msgf("Received webhook event")
+	logger.Info("Received webhook event")
+	eventCounter(d.metrics, eventType).Inc(1)
+	if d.sink != nil {
+		d.sink.Counter(MetricsKeyEventsReceived, 1, "event", eventType)
+	}
+	d.recordEventLag(eventType, payloadBytes)
 
-	handler, ok := d.handlerMap[eventType]
+	handler, ok := d.handler(eventType, payloadBytes)
+	if !ok && eventType == "ping" && d.handlePing {
+		d.respondToPing(w, r, payloadBytes)
+		return
+	}
+	if !ok && d.onUnhandled != nil {
+		d.onUnhandled(ctx, eventType, deliveryID, payloadBytes)
+		d.onResponse(w, r, eventType, true)
+		return
+	}
 	if ok {
 		if err := d.scheduler.Schedule(ctx, Dispatch{
 			Handler:    handler,
@@ -195,13 +551,182 @@ func (d *eventDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			DeliveryID: deliveryID,
 			Payload:    payloadBytes,
 		}); err != nil {
-			d.onError(w, r, err)
-			return
+			// panics are already reported by the handler wrapper and
+			// redelivering the event is unlikely to succeed
+			if span != nil {
+				span.RecordError(err)
+			}
+
+			var perr HandlerPanicError
+			if !errors.As(err, &perr) {
+				d.onError(w, r, err)
+				return
+			}
 		}
 	}
 	d.onResponse(w, r, eventType, ok)
 }
 
+// respondToPing responds to a ping event with the event's zen value and warns
+// if the webhook is not subscribed to events that have handlers.
+func (d *eventDispatcher) respondToPing(w http.ResponseWriter, r *http.Request, payload []byte) {
+	var event github.PingEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		d.onError(w, r, ValidationError{
+			EventType:  "ping",
+			DeliveryID: d.deliveryID(r),
+			Cause:      errors.Wrap(err, "failed to parse ping event"),
+		})
+		return
+	}
+
+	if hook := event.GetHook(); hook != nil && len(hook.Events) > 0 {
+		subscribed := make(map[string]bool)
+		for _, e := range hook.Events {
+			subscribed[e] = true
+		}
+
+		var missing []string
+		for e := range d.handlerMap {
+			if !subscribed[e] && !subscribed["*"] {
+				missing = append(missing, e)
+			}
+		}
+		for e := range d.actionEvents {
+			if _, ok := d.handlerMap[e]; !ok && !subscribed[e] && !subscribed["*"] {
+				missing = append(missing, e)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			LoggerFromContext(r.Context()).Warn("Webhook is not subscribed to all events with registered handlers", "events", missing)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, event.GetZen())
+}
+
+// statusHandler adapts a ResponseHandler to send the returned status code.
+type statusHandler struct {
+	ResponseHandler
+}
+
+func (h *statusHandler) Name() string {
+	return HandlerName(h.ResponseHandler)
+}
+
+func (h *statusHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	status, err := h.HandleResponse(ctx, eventType, deliveryID, payload)
+	if err != nil {
+		return err
+	}
+
+	// custom context derivers may not initialize the responder
+	if status != 0 && ctx.Value(responderKey{}) != nil {
+		SetResponder(ctx, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+	}
+	return nil
+}
+
+// recoveringHandler converts panics in an event handler to errors.
+type recoveringHandler struct {
+	EventHandler
+	onPanic PanicHandler
+}
+
+func (h *recoveringHandler) Name() string {
+	return HandlerName(h.EventHandler)
+}
+
+func (h *recoveringHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = HandlerPanicError{
+				value: r,
+				stack: getStack(1),
+			}
+
+			stack := debug.Stack()
+			LoggerFromContext(ctx).Error(fmt.Sprintf("Recovered from %v in event handler", err), "handler", h.Name(), "stack", string(stack))
+
+			if h.onPanic != nil {
+				h.onPanic(ctx, r, stack)
+			}
+		}
+	}()
+
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
+
+// validatePayload reads the payload from the request and checks that its
+// signature matches one of the dispatcher's secrets. Secrets are tried in
+// order. If no secrets are set, the signature is only checked if present. If
+// signature validation is disabled, the signature is never checked.
+func (d *eventDispatcher) validatePayload(r *http.Request) ([]byte, error) {
+	signature := r.Header.Get(d.headers.Signature)
+	if signature == "" && d.allowSHA1 {
+		signature = r.Header.Get(d.headers.SHA1Signature)
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	// check the declared length first to avoid reading oversized bodies, but
+	// also limit the read in case the length is missing or incorrect
+	if r.ContentLength > d.maxPayloadBytes {
+		return nil, ErrPayloadTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, d.maxPayloadBytes+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read payload")
+	}
+	if int64(len(body)) > d.maxPayloadBytes {
+		return nil, ErrPayloadTooLarge
+	}
+
+	if d.skipSignatures {
+		return github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), "", nil)
+	}
+
+	var secrets [][]byte
+	for _, secret := range d.secrets {
+		if secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+	if len(secrets) == 0 {
+		return github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), signature, nil)
+	}
+	if signature == "" {
+		if r.Header.Get(d.headers.SHA1Signature) != "" {
+			return nil, errors.Errorf("missing %s header: SHA-1 signatures are not allowed", d.headers.Signature)
+		}
+		return nil, errors.Errorf("missing %s header", d.headers.Signature)
+	}
+	// go-github picks the hash from the signature's prefix, so a SHA-1 value
+	// in the SHA-256 header would otherwise validate
+	if !d.allowSHA1 && !strings.HasPrefix(signature, "sha256=") {
+		return nil, errors.Errorf("invalid %s header: SHA-1 signatures are not allowed", d.headers.Signature)
+	}
+
+	for _, secret := range secrets {
+		// ValidatePayloadFromBody compares signatures in constant time
+		payload, verr := github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), signature, secret)
+		if verr == nil {
+			return payload, nil
+		}
+		err = verr
+	}
+	return nil, err
+}
+
 // DefaultErrorCallback logs errors and responds with an appropriate status code.
 func DefaultErrorCallback(w http.ResponseWriter, r *http.Request, err error) {
 	defaultErrorCallback(w, r, err)
@@ -210,25 +735,45 @@ func DefaultErrorCallback(w http.ResponseWriter, r *http.Request, err error) {
 var defaultErrorCallback = MetricsErrorCallback(nil)
 
 // MetricsErrorCallback logs errors, increments an error counter, and responds
-// with an appropriate status code.
+// with an appropriate status code. The counter is tagged with the event type
+// from the header configured by WithHeaders for the dispatcher that received
+// the request.
 func MetricsErrorCallback(reg metrics.Registry) ErrorCallback {
 	return func(w http.ResponseWriter, r *http.Request, err error) {
-		logger := zerolog.Ctx(r.Context())
+		logger := LoggerFromContext(r.Context())
+
+		if errors.Is(err, ErrPayloadTooLarge) {
+			logger.Warn("Received webhook payload that exceeds the maximum size", "content_length", r.ContentLength)
+			payloadTooLargeCounter(reg).Inc(1)
+			http.Error(w, "Webhook payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if errors.Is(err, ErrSourceNotAllowed) {
+			logger.Warn("Rejected webhook request from a source that is not allowed", "error", err)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
 
 		var ve ValidationError
 		if errors.As(err, &ve) {
-			logger.Warn().Err(ve.Cause).Msgf("Received invalid webhook headers or payload")
+			logger.Warn("Received invalid webhook headers or payload", "error", ve.Cause)
 			http.Error(w, "Invalid webhook headers or payload", http.StatusBadRequest)
 			return
 		}
 		if errors.Is(err, ErrCapacityExceeded) {
-			logger.Warn().Msg("Dropping webhook event due to over-capacity scheduler")
+			logger.Warn("Dropping webhook event due to over-capacity scheduler")
 			http.Error(w, "No capacity available to processes this event", http.StatusServiceUnavailable)
 			return
 		}
+		if errors.Is(err, ErrSchedulerClosed) {
+			logger.Warn("Dropping webhook event due to scheduler shutdown")
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
 
-		logger.Error().Err(err).Msg("Unexpected error handling webhook")
-		errorCounter(reg, r.Header.Get("X-Github-Event")).Inc(1)
+		logger.Error("Unexpected error handling webhook", "error", err)
+		errorCounter(reg, eventTypeFromRequest(r)).Inc(1)
 
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
@@ -257,8 +802,14 @@ type responderKey struct{}
 // GetResponder. It is used to test handlers that call SetResponder or to
 // implement custom event dispatchers that support responders.
 func InitializeResponder(ctx context.Context) context.Context {
-	var responder func(http.ResponseWriter, *http.Request)
-	return context.WithValue(ctx, responderKey{}, &responder)
+	return context.WithValue(ctx, responderKey{}, &responder{})
+}
+
+// responder stores the response function set by a handler. Handlers for the
+// same event may run concurrently, so access is synchronized.
+type responder struct {
+	mu sync.Mutex
+	fn func(http.ResponseWriter, *http.Request)
 }
 
 // SetResponder sets a function that sends a response to GitHub after event
@@ -268,21 +819,27 @@ func InitializeResponder(ctx context.Context) context.Context {
 // Customizing individual handler responses should be rare. Applications that
 // want to modify the standard responses should consider registering a response
 // callback before using this function.
-func SetResponder(ctx context.Context, responder func(http.ResponseWriter, *http.Request)) {
-	r, ok := ctx.Value(responderKey{}).(*func(http.ResponseWriter, *http.Request))
+func SetResponder(ctx context.Context, fn func(http.ResponseWriter, *http.Request)) {
+	r, ok := ctx.Value(responderKey{}).(*responder)
 	if !ok || r == nil {
 		panic("SetResponder() must be called with an initialized context, such as one from the event dispatcher")
 	}
-	*r = responder
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fn = fn
 }
 
 // GetResponder returns the response function that was set by an event handler.
 // If no response function exists, it returns nil. There is usually no reason
 // to call this outside of a response callback implementation.
 func GetResponder(ctx context.Context) func(http.ResponseWriter, *http.Request) {
-	r, ok := ctx.Value(responderKey{}).(*func(http.ResponseWriter, *http.Request))
+	r, ok := ctx.Value(responderKey{}).(*responder)
 	if !ok || r == nil {
 		return nil
 	}
-	return *r
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fn
 }
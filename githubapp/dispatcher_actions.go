@@ -0,0 +1,153 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// actionKey identifies handlers registered for an event type and action.
+type actionKey struct {
+	event  string
+	action string
+}
+
+// WithActionHandler registers a handler that is only called for events of the
+// given type with the given action, like "pull_request" events with the
+// "opened" action. The handler's Handles method is not used.
+//
+// Action handlers are called before the handler registered for all actions of
+// the same event type, if any, and in the order they are registered. Processing
+// stops at the first handler that returns an error.
+//
+// WithActionHandler panics if events of the given type do not have an action.
+func WithActionHandler(eventType, action string, h EventHandler) DispatcherOption {
+	if !hasAction(eventType) {
+		panic(errors.Errorf("WithActionHandler: %s events do not have an action", eventType))
+	}
+	return func(d *eventDispatcher) {
+		if d.actionHandlers == nil {
+			d.actionHandlers = make(map[actionKey][]EventHandler)
+		}
+		key := actionKey{event: eventType, action: action}
+		d.actionHandlers[key] = append(d.actionHandlers[key], h)
+	}
+}
+
+// hasAction returns true if events of the given type have an action field.
+func hasAction(eventType string) bool {
+	// PushEvent has an action field, but GitHub does not set it
+	if eventType == "push" {
+		return false
+	}
+
+	var event interface{}
+	if te, ok := typedEvents[eventType]; ok {
+		// includes events that go-github does not define
+		event, _ = te.parse(json.Unmarshal, []byte("{}"))
+	} else {
+		var err error
+		if event, err = github.ParseWebHook(eventType, []byte("{}")); err != nil {
+			return false
+		}
+	}
+	v := reflect.ValueOf(event)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Struct && v.FieldByName("Action").IsValid()
+}
+
+// handler returns the wrapped handler for an event. If handlers are
+// registered for the event's action, it returns a handler that calls them
+// before the handler for all actions.
+func (d *eventDispatcher) handler(eventType string, payload []byte) (EventHandler, bool) {
+	var handlers []EventHandler
+	if d.actionEvents[eventType] {
+		var event struct {
+			Action string `json:"action"`
+		}
+		if err := json.Unmarshal(payload, &event); err == nil {
+			handlers = append(handlers, d.actionHandlers[actionKey{event: eventType, action: event.Action}]...)
+		}
+	}
+	if h, ok := d.handlerMap[eventType]; ok {
+		handlers = append(handlers, h)
+	}
+
+	switch len(handlers) {
+	case 0:
+		return nil, false
+	case 1:
+		return handlers[0], true
+	default:
+		return &handlerChain{handlers: handlers, concurrent: d.concurrentHandlers}, true
+	}
+}
+
+// handlerChain calls multiple handlers for an event. See runHandlers.
+type handlerChain struct {
+	handlers   []EventHandler
+	concurrent bool
+}
+
+// schedulingKey returns the scheduling key of the handlers with policies in
+// the chain. If the handlers return different keys, the chain has no key and
+// each handler waits for its own key.
+func (c *handlerChain) schedulingKey(eventType string, payload []byte) (policyKey, bool) {
+	var key policyKey
+	var found bool
+	for _, h := range c.handlers {
+		kh, ok := h.(keyedScheduling)
+		if !ok {
+			continue
+		}
+		k, ok := kh.schedulingKey(eventType, payload)
+		if !ok {
+			continue
+		}
+		if found && k != key {
+			return policyKey{}, false
+		}
+		key, found = k, true
+	}
+	return key, found
+}
+
+func (c *handlerChain) Handles() []string {
+	var events []string
+	for _, h := range c.handlers {
+		events = append(events, h.Handles()...)
+	}
+	return events
+}
+
+func (c *handlerChain) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	// share decoded events between the typed handlers in the chain
+	ctx = withDecodedEvents(ctx)
+	return runHandlers(ctx, c.concurrent, len(c.handlers),
+		func(i int) bool {
+			return isSerial(c.handlers[i])
+		},
+		func(i int) error {
+			return c.handlers[i].Handle(ctx, eventType, deliveryID, payload)
+		},
+	)
+}
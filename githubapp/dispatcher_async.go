@@ -0,0 +1,140 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	DefaultAsyncWorkers   = 10
+	DefaultAsyncQueueSize = 100
+)
+
+// AsyncConfig configures the worker pool of an asynchronous dispatcher.
+type AsyncConfig struct {
+	// Workers is the number of goroutines that run event handlers. If zero,
+	// use DefaultAsyncWorkers.
+	Workers int
+
+	// Queue stores events until a worker is available. If nil, use a queue
+	// created by NewMemoryQueue with QueueSize and QueueTimeout.
+	Queue Queue
+
+	// QueueSize is the number of events that can wait for a worker in the
+	// default queue. If zero, use DefaultAsyncQueueSize.
+	QueueSize int
+
+	// QueueTimeout is how long to wait for space when the default queue is
+	// full. If zero, events are rejected immediately when the queue is full.
+	// Rejected events receive a 503 Service Unavailable response.
+	QueueTimeout time.Duration
+
+	// BaseContext is the context used to derive the context of events from
+	// queues shared with other processes, which do not have a request
+	// context. Its loggers are copied by the default context deriver. If nil,
+	// use context.Background().
+	BaseContext context.Context
+
+	// Metrics, if set, is the registry for the scheduling metrics, including
+	// the count of rejected events.
+	Metrics metrics.Registry
+
+	// SchedulerOptions are additional options for the scheduler, like the
+	// error callback or the context deriver.
+	SchedulerOptions []SchedulerOption
+}
+
+// AsyncDispatcher is an http.Handler that runs event handlers on a pool of
+// worker goroutines. Call Shutdown to stop the workers.
+type AsyncDispatcher struct {
+	http.Handler
+
+	scheduler ShutdownScheduler
+}
+
+// Shutdown stops accepting new events and waits for queued and running
+// handlers to finish or for ctx to end. While shutting down, the dispatcher
+// responds to new events with 503 Service Unavailable so that GitHub records
+// the deliveries as failed and they can be redelivered.
+//
+// If ctx ends before all queued events start, the remaining events are
+// dropped and Shutdown returns a ShutdownError with the number of dropped
+// events. Handlers that are already running are not canceled.
+func (d *AsyncDispatcher) Shutdown(ctx context.Context) error {
+	return d.scheduler.Shutdown(ctx)
+}
+
+// NewAsyncDispatcher creates an http.Handler like NewEventDispatcher that
+// runs event handlers on a bounded pool of worker goroutines. The dispatcher
+// validates each webhook, queues handled events, and responds to GitHub with
+// 202 Accepted without waiting for handlers to complete.
+//
+// Handlers run with a new context derived from the request context, so they
+// are not canceled when the response is sent. The default deriver keeps the
+// request logger, which includes the event type and delivery ID. Events that
+// were queued by a different process use a context derived from
+// config.BaseContext instead, with any context decorators applied.
+//
+// Options are applied after the asynchronous defaults, so callers may
+// override the response callback or the scheduler. Shutdown only stops the
+// default scheduler.
+func NewAsyncDispatcher(handlers []EventHandler, secret string, config AsyncConfig, opts ...DispatcherOption) *AsyncDispatcher {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	queue := config.Queue
+	if queue == nil {
+		queueSize := config.QueueSize
+		if queueSize <= 0 {
+			queueSize = DefaultAsyncQueueSize
+		}
+		queue = NewMemoryQueue(queueSize, config.QueueTimeout)
+	}
+
+	var schedulerOpts []SchedulerOption
+	if config.Metrics != nil {
+		schedulerOpts = append(schedulerOpts, WithSchedulingMetrics(config.Metrics))
+	}
+	schedulerOpts = append(schedulerOpts, config.SchedulerOptions...)
+
+	scheduler := newJobScheduler(queue, config.BaseContext, schedulerOpts...)
+
+	dispatcherOpts := []DispatcherOption{
+		WithScheduler(scheduler),
+		WithResponseCallback(AsyncResponseCallback),
+	}
+	dispatcherOpts = append(dispatcherOpts, opts...)
+
+	d := NewEventDispatcher(handlers, secret, dispatcherOpts...).(*eventDispatcher)
+	scheduler.start(workers, d.handler, d.decorate, d.fieldNames)
+
+	return &AsyncDispatcher{
+		Handler:   d,
+		scheduler: scheduler,
+	}
+}
+
+// AsyncResponseCallback responds with a 202 Accepted status for all events.
+// It is intended for dispatchers with asynchronous schedulers, where handled
+// events are queued instead of processed before the response.
+func AsyncResponseCallback(w http.ResponseWriter, r *http.Request, event string, handled bool) {
+	w.WriteHeader(http.StatusAccepted)
+}
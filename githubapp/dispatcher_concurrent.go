@@ -0,0 +1,129 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// SerialHandler is implemented by handlers that must not run at the same time
+// as other handlers for the same event, usually because they modify state
+// shared with the other handlers. The marker only has an effect when the
+// dispatcher is created with WithConcurrentHandlers.
+type SerialHandler interface {
+	RequiresSerialExecution() bool
+}
+
+// WithConcurrentHandlers runs all of the handlers for an event at the same
+// time instead of in order. This applies when multiple handlers are
+// registered for the same event, like typed handlers for the same event type
+// or action handlers and the handler for all actions.
+//
+// Every handler runs even if others fail. If one handler fails, its error is
+// returned directly; if more than one fails, the dispatcher returns
+// HandlerErrors containing every error.
+//
+// Handlers that implement SerialHandler run after the concurrent handlers
+// finish, one at a time in registration order.
+func WithConcurrentHandlers() DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.concurrentHandlers = true
+	}
+}
+
+// isSerial returns true if a handler requires serial execution.
+func isSerial(h interface{}) bool {
+	sh, ok := h.(SerialHandler)
+	return ok && sh.RequiresSerialExecution()
+}
+
+// serialHandler preserves the SerialHandler marker of a wrapped handler.
+type serialHandler struct {
+	EventHandler
+}
+
+func (h *serialHandler) Name() string {
+	return HandlerName(h.EventHandler)
+}
+
+func (h *serialHandler) RequiresSerialExecution() bool {
+	return true
+}
+
+// runHandlers calls n handlers. If concurrent is false, it calls the handlers
+// in order until one returns an error. Otherwise, it calls every handler that
+// is not serial in a new goroutine, waits for them to finish, calls the serial
+// handlers in order, and combines the errors.
+func runHandlers(ctx context.Context, concurrent bool, n int, serial func(i int) bool, call func(i int) error) error {
+	if !concurrent || n == 1 {
+		for i := 0; i < n; i++ {
+			if err := call(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if serial(i) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				// panics in other goroutines are not recovered by the dispatcher
+				if r := recover(); r != nil {
+					errs[i] = HandlerPanicError{
+						value: r,
+						stack: getStack(1),
+					}
+					LoggerFromContext(ctx).Error(fmt.Sprintf("Recovered from %v in event handler", errs[i]), "stack", string(debug.Stack()))
+				}
+			}()
+			errs[i] = call(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if serial(i) {
+			errs[i] = call(i)
+		}
+	}
+
+	var failed HandlerErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return failed
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestConcurrentHandlers(t *testing.T) {
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+
+	tests := map[string]struct {
+		Errors []error
+		Serial []bool
+
+		ResponseCode int
+		Last         string
+	}{
+		"runsConcurrently": {
+			Errors:       []error{nil, nil, nil},
+			Serial:       []bool{false, false, false},
+			ResponseCode: http.StatusOK,
+		},
+		"runsSerialHandlersLast": {
+			Errors:       []error{nil, nil, nil},
+			Serial:       []bool{true, false, false},
+			ResponseCode: http.StatusOK,
+			Last:         "0",
+		},
+		"returnsAllErrors": {
+			Errors:       []error{errFirst, nil, errSecond},
+			Serial:       []bool{false, false, false},
+			ResponseCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var order []string
+			var handlerErr error
+
+			// concurrent handlers wait until all of them start
+			var started sync.WaitGroup
+			for _, serial := range test.Serial {
+				if !serial {
+					started.Add(1)
+				}
+			}
+
+			var handlers []interface{}
+			for i := range test.Errors {
+				h := &testConcurrentHandler{
+					ID:     string(rune('0' + i)),
+					Err:    test.Errors[i],
+					Serial: test.Serial[i],
+				}
+				h.Fn = func(id string, serial bool) {
+					if !serial {
+						started.Done()
+						if !waitTimeout(&started, time.Second) {
+							t.Errorf("handler %s did not run concurrently", id)
+						}
+					}
+					mu.Lock()
+					order = append(order, id)
+					mu.Unlock()
+				}
+				handlers = append(handlers, h)
+			}
+
+			d := NewTypedDispatcher(handlers, testHookSecret,
+				WithConcurrentHandlers(),
+				WithErrorCallback(func(w http.ResponseWriter, r *http.Request, err error) {
+					handlerErr = err
+					DefaultErrorCallback(w, r, err)
+				}),
+			)
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newHookRequest("pull_request", name, true))
+
+			if test.ResponseCode != res.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+			}
+			if len(order) != len(handlers) {
+				t.Errorf("incorrect number of handler calls: expected %d, actual %d", len(handlers), len(order))
+			}
+			if test.Last != "" && (len(order) == 0 || order[len(order)-1] != test.Last) {
+				t.Errorf("incorrect last handler: expected %s, actual order %v", test.Last, order)
+			}
+			for _, err := range test.Errors {
+				if err != nil && !errors.Is(handlerErr, err) {
+					t.Errorf("expected error to include %q, but got: %v", err, handlerErr)
+				}
+			}
+		})
+	}
+}
+
+func TestActionHandlersConcurrent(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(2)
+
+	h := &TestEventHandler{
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			started.Done()
+			if !waitTimeout(&started, time.Second) {
+				return errors.New("handlers did not run concurrently")
+			}
+			return nil
+		},
+	}
+	all := &TestEventHandler{Types: []string{"pull_request"}, Fn: h.Fn}
+
+	d := NewEventDispatcher([]EventHandler{all}, testHookSecret,
+		WithActionHandler("pull_request", "opened", h),
+		WithConcurrentHandlers(),
+	)
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newPayloadRequest("pull_request", "concurrent", []byte(`{"action":"opened"}`), true))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+	}
+}
+
+type testConcurrentHandler struct {
+	ID     string
+	Err    error
+	Serial bool
+	Fn     func(id string, serial bool)
+}
+
+func (h *testConcurrentHandler) HandlePullRequest(ctx context.Context, event *github.PullRequestEvent) error {
+	h.Fn(h.ID, h.Serial)
+	return h.Err
+}
+
+func (h *testConcurrentHandler) RequiresSerialExecution() bool {
+	return h.Serial
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
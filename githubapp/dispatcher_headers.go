@@ -0,0 +1,102 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// Headers are the names of the request headers that contain webhook metadata.
+// GitHub sends the headers returned by DefaultHeaders, but proxies and API
+// gateways may rename them.
+type Headers struct {
+	EventType     string
+	DeliveryID    string
+	Signature     string
+	SHA1Signature string
+}
+
+// DefaultHeaders returns the header names that GitHub uses for webhooks.
+func DefaultHeaders() Headers {
+	return Headers{
+		EventType:     "X-GitHub-Event",
+		DeliveryID:    "X-GitHub-Delivery",
+		Signature:     github.SHA256SignatureHeader,
+		SHA1Signature: github.SHA1SignatureHeader,
+	}
+}
+
+// withDefaults returns a copy of h with empty names replaced by the defaults.
+func (h Headers) withDefaults() Headers {
+	d := DefaultHeaders()
+	if h.EventType != "" {
+		d.EventType = h.EventType
+	}
+	if h.DeliveryID != "" {
+		d.DeliveryID = h.DeliveryID
+	}
+	if h.Signature != "" {
+		d.Signature = h.Signature
+	}
+	if h.SHA1Signature != "" {
+		d.SHA1Signature = h.SHA1Signature
+	}
+	return d
+}
+
+// WithHeaders sets the names of the headers that contain the event type,
+// delivery ID, and signatures of webhook requests, for use behind proxies
+// that rename GitHub's headers. Empty names use the defaults from
+// DefaultHeaders.
+//
+// When custom headers are set, requests must include the event type and
+// delivery ID headers, and, if the dispatcher has a secret, the signature
+// header. Requests missing a header fail validation with an error that names
+// the configured header.
+func WithHeaders(h Headers) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.headers = h.withDefaults()
+		d.requireDeliveryID = true
+	}
+}
+
+func (d *eventDispatcher) eventType(r *http.Request) string {
+	return r.Header.Get(d.headers.EventType)
+}
+
+func (d *eventDispatcher) deliveryID(r *http.Request) string {
+	return r.Header.Get(d.headers.DeliveryID)
+}
+
+type headersKey struct{}
+
+// withHeaders stores the header names of a dispatcher in ctx, so that error
+// callbacks, which only receive the request, can read the event type.
+func withHeaders(ctx context.Context, h Headers) context.Context {
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+// eventTypeFromRequest returns the event type of a request, using the header
+// names of the dispatcher that received it or the defaults if there is none.
+func eventTypeFromRequest(r *http.Request) string {
+	h, ok := r.Context().Value(headersKey{}).(Headers)
+	if !ok {
+		h = DefaultHeaders()
+	}
+	return r.Header.Get(h.EventType)
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	MetricsKeyEventsReceived  = "github.event.received"
+	MetricsKeyHandlerDuration = "github.handler.duration"
+	MetricsKeyHandlerFailures = "github.handler.failures"
+	MetricsKeyEventLag        = "github.event.lag"
+)
+
+// WithDispatchMetrics records metrics about received events and handler
+// execution in the registry:
+//
+//   - github.event.received[event:<type>] counts valid events of each type
+//   - github.handler.duration[handler:<name>,event:<type>] times each handler
+//   - github.handler.failures[handler:<name>,event:<type>] counts handler errors
+//   - github.event.lag[event:<type>] times the delay between GitHub generating
+//     an event and the dispatcher receiving it, for events with a known
+//     EventTimestamp
+//
+// Handler names come from the optional Name method of an EventHandler. If a
+// handler does not have this method, its name is the name of its type.
+func WithDispatchMetrics(registry metrics.Registry) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.metrics = registry
+	}
+}
+
+// HandlerName returns the name of an event handler. If the handler has a
+// Name() string method, it returns the result of that method. Otherwise, it
+// returns the name of the handler's type, ignoring pointers.
+func HandlerName(h EventHandler) string {
+	if n, ok := h.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+
+	t := reflect.TypeOf(h)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if name := t.Name(); name != "" {
+		return name
+	}
+	return t.String()
+}
+
+// recordEventLag records the delay between GitHub generating an event and the
+// dispatcher receiving it, if the event has a known timestamp.
+func (d *eventDispatcher) recordEventLag(eventType string, payload []byte) {
+	if d.metrics == nil && d.sink == nil {
+		return
+	}
+
+	generated, ok := EventTimestamp(payload, eventType)
+	if !ok {
+		return
+	}
+	lag := time.Since(generated)
+	if lag < 0 {
+		// the clocks of GitHub and this server differ
+		lag = 0
+	}
+
+	if d.metrics != nil {
+		metrics.GetOrRegisterTimer(fmt.Sprintf("%s[event:%s]", MetricsKeyEventLag, eventType), d.metrics).Update(lag)
+	}
+	if d.sink != nil {
+		d.sink.Histogram(MetricsKeyEventLag, lag.Seconds(), "event", eventType)
+	}
+}
+
+func eventCounter(r metrics.Registry, event string) metrics.Counter {
+	if r == nil {
+		return metrics.NilCounter{}
+	}
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("%s[event:%s]", MetricsKeyEventsReceived, event), r)
+}
+
+// meteredHandler records the duration and failures of calls to an event
+// handler in a registry, a Metrics implementation, or both.
+type meteredHandler struct {
+	EventHandler
+	name     string
+	registry metrics.Registry
+	sink     Metrics
+}
+
+func newMeteredHandler(h EventHandler, r metrics.Registry, m Metrics) EventHandler {
+	return &meteredHandler{
+		EventHandler: h,
+		name:         HandlerName(h),
+		registry:     r,
+		sink:         m,
+	}
+}
+
+func (h *meteredHandler) Name() string {
+	return h.name
+}
+
+func (h *meteredHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	start := time.Now()
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	elapsed := time.Since(start)
+
+	if h.registry != nil {
+		tags := fmt.Sprintf("[handler:%s,event:%s]", h.name, eventType)
+		metrics.GetOrRegisterTimer(MetricsKeyHandlerDuration+tags, h.registry).Update(elapsed)
+		if err != nil {
+			metrics.GetOrRegisterCounter(MetricsKeyHandlerFailures+tags, h.registry).Inc(1)
+		}
+	}
+	if h.sink != nil {
+		h.sink.Histogram(MetricsKeyHandlerDuration, elapsed.Seconds(), "handler", h.name, "event", eventType)
+		if err != nil {
+			h.sink.Counter(MetricsKeyHandlerFailures, 1, "handler", h.name, "event", eventType)
+		}
+	}
+	return err
+}
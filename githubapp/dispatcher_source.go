@@ -0,0 +1,234 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMetaRefreshInterval is the default interval at which the hook
+	// source IP ranges fetched by WithGitHubMetaCIDRs are refreshed.
+	DefaultMetaRefreshInterval = time.Hour
+
+	metaFetchTimeout  = 30 * time.Second
+	metaMinRetryDelay = time.Second
+	metaMaxRetryDelay = time.Minute
+)
+
+// ErrSourceNotAllowed is the cause of errors passed to error callbacks when a
+// webhook request comes from an IP address that is not allowed. The default
+// callback responds with a 403 Forbidden status.
+var ErrSourceNotAllowed = errors.New("request source is not allowed")
+
+// WithAllowedSourceCIDRs restricts webhook requests to clients with addresses
+// in the given ranges. Requests from other addresses are rejected before the
+// payload is read. If combined with WithGitHubMetaCIDRs, requests from
+// addresses in either set of ranges are allowed.
+//
+// This check is in addition to validating the payload signature. By default,
+// the client address is the remote address of the connection; use
+// WithTrustedProxyHeader if the server is behind a proxy.
+func WithAllowedSourceCIDRs(cidrs []net.IPNet) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.restrictSources = true
+		d.allowedSources = append(d.allowedSources, cidrs...)
+	}
+}
+
+// WithGitHubMetaCIDRs restricts webhook requests to clients with addresses in
+// the hook source ranges published by the GitHub meta API. The ranges are
+// fetched using client in the background when the dispatcher is created and
+// are refreshed after each interval, as GitHub changes the ranges from time
+// to time. If client is nil, an unauthenticated client for GitHub.com is
+// used. If interval is not positive, DefaultMetaRefreshInterval is used.
+//
+// Requests never wait for the ranges: until the first fetch succeeds, they
+// are rejected with an error. Failed fetches are retried with increasing
+// delays, up to one minute. If a refresh fails, the previous ranges are used
+// until a later refresh succeeds.
+func WithGitHubMetaCIDRs(client *github.Client, interval time.Duration) DispatcherOption {
+	return func(d *eventDispatcher) {
+		if client == nil {
+			client = github.NewClient(nil)
+		}
+		if interval <= 0 {
+			interval = DefaultMetaRefreshInterval
+		}
+		d.restrictSources = true
+		d.metaSources = newMetaCIDRs(client, interval)
+	}
+}
+
+// WithTrustedProxyHeader sets the header that contains the client address
+// when the server is behind a proxy, like "X-Forwarded-For" or "X-Real-IP".
+// The header is only used by WithAllowedSourceCIDRs and WithGitHubMetaCIDRs.
+//
+// If the header has multiple addresses, the last one is used, because it is
+// the address added by the proxy closest to the server. Only configure this
+// option if all requests pass through a proxy that sets the header, otherwise
+// clients can forge their address.
+func WithTrustedProxyHeader(header string) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.proxyHeader = header
+	}
+}
+
+// checkSource returns an error if the request comes from an address that is
+// not allowed.
+func (d *eventDispatcher) checkSource(r *http.Request) error {
+	ip := clientIP(r, d.proxyHeader)
+	if ip == nil {
+		return errors.Wrap(ErrSourceNotAllowed, "invalid client address")
+	}
+
+	if containsIP(d.allowedSources, ip) {
+		return nil
+	}
+	if d.metaSources != nil {
+		nets, err := d.metaSources.get(r.Context())
+		if err != nil {
+			return err
+		}
+		if containsIP(nets, ip) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrSourceNotAllowed, "client address %s", ip)
+}
+
+// clientIP returns the address of the client that sent a request or nil if
+// the address is not valid.
+func clientIP(r *http.Request, proxyHeader string) net.IP {
+	if proxyHeader != "" {
+		if values := r.Header.Values(proxyHeader); len(values) > 0 {
+			addrs := strings.Split(values[len(values)-1], ",")
+			return net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func containsIP(nets []net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaCIDRs caches the hook source ranges from the GitHub meta API. The
+// ranges are only fetched in the background, so requests are never blocked by
+// a slow or failing meta API.
+type metaCIDRs struct {
+	client   *github.Client
+	interval time.Duration
+
+	mu         sync.Mutex
+	nets       []net.IPNet
+	nextFetch  time.Time
+	failures   int
+	refreshing bool
+}
+
+// newMetaCIDRs returns a cache and starts fetching the ranges.
+func newMetaCIDRs(client *github.Client, interval time.Duration) *metaCIDRs {
+	m := &metaCIDRs{
+		client:     client,
+		interval:   interval,
+		refreshing: true,
+	}
+	go m.refresh(LoggerFromContext(context.Background()))
+	return m
+}
+
+// get returns the cached ranges or an error if they were never fetched. If
+// the ranges are due for a refresh, they are refreshed in the background.
+func (m *metaCIDRs) get(ctx context.Context) ([]net.IPNet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.refreshing && !time.Now().Before(m.nextFetch) {
+		m.refreshing = true
+		go m.refresh(LoggerFromContext(ctx))
+	}
+
+	if m.nets == nil {
+		return nil, errors.New("GitHub hook source IP ranges are not available yet")
+	}
+	return m.nets, nil
+}
+
+func (m *metaCIDRs) refresh(logger Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), metaFetchTimeout)
+	defer cancel()
+
+	nets, err := m.fetch(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshing = false
+	if err != nil {
+		delay := metaMinRetryDelay << m.failures
+		if delay <= 0 || delay > metaMaxRetryDelay {
+			delay = metaMaxRetryDelay
+		} else {
+			m.failures++
+		}
+		if delay > m.interval {
+			delay = m.interval
+		}
+
+		logger.Warn("Failed to refresh GitHub hook source IP ranges", "error", err, "retry_delay", delay)
+		m.nextFetch = time.Now().Add(delay)
+		return
+	}
+	m.nets, m.nextFetch, m.failures = nets, time.Now().Add(m.interval), 0
+}
+
+func (m *metaCIDRs) fetch(ctx context.Context) ([]net.IPNet, error) {
+	meta, _, err := m.client.APIMeta(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get GitHub meta information")
+	}
+	if len(meta.Hooks) == 0 {
+		return nil, errors.New("GitHub meta information does not include hook source IP ranges")
+	}
+
+	nets := make([]net.IPNet, 0, len(meta.Hooks))
+	for _, cidr := range meta.Hooks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid hook source IP range %q", cidr)
+		}
+		nets = append(nets, *n)
+	}
+	return nets, nil
+}
@@ -18,14 +18,23 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
-	"crypto/sha1"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/go-github/v53/github"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
 )
 
@@ -139,6 +148,17 @@ func TestEventDispatcher(t *testing.T) {
 			ResponseCode: 404,
 			ResponseBody: "No handler for the issue_comment event!\n",
 		},
+		"recoversFromHandlerPanic": {
+			Handler: TestEventHandler{
+				Types: []string{"pull_request"},
+				Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					panic("handler panic")
+				},
+			},
+			Event:        "pull_request",
+			ResponseCode: 200,
+			CallCount:    1,
+		},
 		"callsHandlerResponder": {
 			Handler: TestEventHandler{
 				Types: []string{"pull_request"},
@@ -178,6 +198,1186 @@ func TestEventDispatcher(t *testing.T) {
 	}
 }
 
+func TestAsyncDispatcher(t *testing.T) {
+	called := make(chan string, 1)
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			called <- deliveryID
+			return nil
+		},
+	}
+
+	d := NewAsyncDispatcher([]EventHandler{&h}, testHookSecret, AsyncConfig{Workers: 1, QueueSize: 1})
+
+	req := newHookRequest("pull_request", "async-delivery", true)
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, req)
+
+	if res.Code != http.StatusAccepted {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusAccepted, res.Code)
+	}
+
+	select {
+	case id := <-called:
+		if id != "async-delivery" {
+			t.Errorf("incorrect delivery ID: %q", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+}
+
+func TestAsyncDispatcherShutdown(t *testing.T) {
+	called := make(chan string, 1)
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			called <- deliveryID
+			return nil
+		},
+	}
+
+	d := NewAsyncDispatcher([]EventHandler{&h}, testHookSecret, AsyncConfig{Workers: 1, QueueSize: 1})
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newHookRequest("pull_request", "before-shutdown", true))
+	if res.Code != http.StatusAccepted {
+		t.Errorf("incorrect response code before shutdown: expected %d, actual %d", http.StatusAccepted, res.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error shutting down: %v", err)
+	}
+	if id := <-called; id != "before-shutdown" {
+		t.Errorf("incorrect delivery ID: %q", id)
+	}
+
+	res = httptest.NewRecorder()
+	d.ServeHTTP(res, newHookRequest("pull_request", "after-shutdown", true))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("incorrect response code after shutdown: expected %d, actual %d", http.StatusServiceUnavailable, res.Code)
+	}
+}
+
+func TestActionHandlers(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Payload   string
+
+		Calls        []string
+		ResponseCode int
+	}{
+		"callsActionHandler": {
+			EventType:    "pull_request",
+			Payload:      `{"action":"opened"}`,
+			Calls:        []string{"opened", "all"},
+			ResponseCode: http.StatusOK,
+		},
+		"skipsOtherActions": {
+			EventType:    "pull_request",
+			Payload:      `{"action":"closed"}`,
+			Calls:        []string{"all"},
+			ResponseCode: http.StatusOK,
+		},
+		"notHandledWithoutMatch": {
+			EventType:    "issue_comment",
+			Payload:      `{"action":"edited"}`,
+			ResponseCode: http.StatusAccepted,
+		},
+		"callsOnlyActionHandler": {
+			EventType:    "issue_comment",
+			Payload:      `{"action":"created"}`,
+			Calls:        []string{"created"},
+			ResponseCode: http.StatusOK,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls []string
+			handler := func(name string) *TestEventHandler {
+				return &TestEventHandler{
+					Types: []string{"pull_request"},
+					Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+						calls = append(calls, name)
+						return nil
+					},
+				}
+			}
+
+			d := NewEventDispatcher([]EventHandler{handler("all")}, testHookSecret,
+				WithActionHandler("pull_request", "opened", handler("opened")),
+				WithActionHandler("issue_comment", "created", handler("created")),
+			)
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newPayloadRequest(test.EventType, name, []byte(test.Payload), true))
+
+			if test.ResponseCode != res.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+			}
+			if !reflect.DeepEqual(test.Calls, calls) {
+				t.Errorf("incorrect handler calls: expected %v, actual %v", test.Calls, calls)
+			}
+		})
+	}
+}
+
+func TestActionHandlerRegistration(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Panics    bool
+	}{
+		"eventWithAction": {
+			EventType: "check_run",
+		},
+		"eventWithoutAction": {
+			EventType: "push",
+			Panics:    true,
+		},
+		"unknownEvent": {
+			EventType: "not_an_event",
+			Panics:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != test.Panics {
+					t.Errorf("incorrect panic state: expected %t, actual %v", test.Panics, r)
+				}
+			}()
+			WithActionHandler(test.EventType, "created", &TestEventHandler{})
+		})
+	}
+}
+
+func TestResponseHandler(t *testing.T) {
+	tests := map[string]struct {
+		Status int
+		Err    error
+
+		ResponseCode int
+	}{
+		"sendsStatus": {
+			Status:       http.StatusAccepted,
+			ResponseCode: http.StatusAccepted,
+		},
+		"sendsErrorStatus": {
+			Status:       http.StatusBadRequest,
+			ResponseCode: http.StatusBadRequest,
+		},
+		"zeroStatusUsesDefault": {
+			ResponseCode: http.StatusOK,
+		},
+		"errorIgnoresStatus": {
+			Status:       http.StatusAccepted,
+			Err:          errors.New("handler failure"),
+			ResponseCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := statusEventHandler{
+				TestEventHandler: TestEventHandler{Types: []string{"pull_request"}},
+				Status:           test.Status,
+				Err:              test.Err,
+			}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret)
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newHookRequest("pull_request", name, true))
+
+			if test.ResponseCode != res.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+			}
+			if h.Count != 0 {
+				t.Errorf("Handle was called instead of HandleResponse")
+			}
+		})
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) DispatcherMiddleware {
+		return func(next EventHandler) EventHandler {
+			return &middlewareEventHandler{EventHandler: next, before: func() {
+				calls = append(calls, name)
+			}}
+		}
+	}
+	panics := func(next EventHandler) EventHandler {
+		return &middlewareEventHandler{EventHandler: next, before: func() {
+			panic("middleware panic")
+		}}
+	}
+
+	h := TestEventHandler{Types: []string{"pull_request"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithMiddleware(record("first"), RecoverMiddleware, record("second"), panics))
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newHookRequest("pull_request", "middleware", true))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Errorf("incorrect middleware calls: %v", calls)
+	}
+	if h.Count != 0 {
+		t.Errorf("handler was called after middleware panic")
+	}
+}
+
+func TestPingHandler(t *testing.T) {
+	tests := map[string]struct {
+		Handler TestEventHandler
+		Options []DispatcherOption
+
+		ResponseCode int
+		ResponseBody string
+		CallCount    int
+	}{
+		"echoesZen": {
+			Handler: TestEventHandler{
+				Types: []string{"pull_request"},
+			},
+			ResponseCode: 200,
+			ResponseBody: "Keep it logically awesome.",
+		},
+		"disabled": {
+			Handler: TestEventHandler{
+				Types: []string{"pull_request"},
+			},
+			Options:      []DispatcherOption{WithPingHandler(false)},
+			ResponseCode: 200,
+		},
+		"registeredHandlerTakesPriority": {
+			Handler: TestEventHandler{
+				Types: []string{"ping"},
+			},
+			ResponseCode: 200,
+			CallCount:    1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := test.Handler
+			d := NewEventDispatcher([]EventHandler{&h}, "", test.Options...)
+
+			body := `{"zen":"Keep it logically awesome.","hook":{"events":["issue_comment"]}}`
+			req := httptest.NewRequest(http.MethodPost, "/api/github/hook", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Github-Event", "ping")
+			req.Header.Set("X-Github-Delivery", name)
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+
+			if test.ResponseCode != res.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+			}
+			if test.ResponseBody != res.Body.String() {
+				t.Errorf("incorrect response body:\nexpected: %q\n  actual: %q", test.ResponseBody, res.Body.String())
+			}
+			if test.CallCount != h.Count {
+				t.Errorf("incorrect call count: expected %d, actual %d", test.CallCount, h.Count)
+			}
+		})
+	}
+}
+
+func TestUnhandledEvents(t *testing.T) {
+	tests := map[string]struct {
+		Options   []DispatcherOption
+		Fallback  bool
+		EventType string
+
+		Code      int
+		Unhandled string
+		Handled   bool
+	}{
+		"defaultAccepted": {
+			EventType: "installation_target",
+			Code:      http.StatusAccepted,
+		},
+		"callsFallback": {
+			Fallback:  true,
+			EventType: "installation_target",
+			Code:      http.StatusOK,
+			Unhandled: "installation_target",
+		},
+		"handledEventSkipsFallback": {
+			Fallback:  true,
+			EventType: "pull_request",
+			Code:      http.StatusOK,
+			Handled:   true,
+		},
+		"pingSkipsFallback": {
+			Fallback:  true,
+			EventType: "ping",
+			Code:      http.StatusOK,
+		},
+		"pingWithoutBuiltinHandler": {
+			Options:   []DispatcherOption{WithPingHandler(false)},
+			Fallback:  true,
+			EventType: "ping",
+			Code:      http.StatusOK,
+			Unhandled: "ping",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var unhandled, deliveryID string
+			var payload []byte
+
+			opts := test.Options
+			if test.Fallback {
+				opts = append(opts, OnUnhandled(func(ctx context.Context, eventType, id string, p []byte) {
+					unhandled, deliveryID, payload = eventType, id, p
+				}))
+			}
+
+			h := TestEventHandler{Types: []string{"pull_request"}}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, opts...)
+
+			body := []byte(`{"action":"added"}`)
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newPayloadRequest(test.EventType, "delivery", body, true))
+
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if unhandled != test.Unhandled {
+				t.Errorf("incorrect unhandled event: expected %q, actual %q", test.Unhandled, unhandled)
+			}
+			if unhandled != "" {
+				if deliveryID != "delivery" {
+					t.Errorf("incorrect delivery ID: %q", deliveryID)
+				}
+				if !bytes.Equal(payload, body) {
+					t.Errorf("incorrect payload: %s", payload)
+				}
+			}
+			if handled := h.Count > 0; handled != test.Handled {
+				t.Errorf("incorrect handled state: expected %t, actual %t", test.Handled, handled)
+			}
+		})
+	}
+}
+
+func TestMaxPayloadBytes(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	h := TestEventHandler{Types: []string{"pull_request"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret,
+		WithMaxPayloadBytes(16),
+		WithErrorCallback(MetricsErrorCallback(registry)),
+	)
+
+	t.Run("declaredLength", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newHookRequest("pull_request", "declared", true))
+
+		if res.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("incorrect response code: expected %d, actual %d", http.StatusRequestEntityTooLarge, res.Code)
+		}
+	})
+
+	t.Run("unknownLength", func(t *testing.T) {
+		req := newHookRequest("pull_request", "unknown", true)
+		req.ContentLength = -1
+
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, req)
+
+		if res.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("incorrect response code: expected %d, actual %d", http.StatusRequestEntityTooLarge, res.Code)
+		}
+	})
+
+	if h.Count != 0 {
+		t.Errorf("handler was called %d times for oversized payloads", h.Count)
+	}
+	if c := registry.Get(MetricsKeyPayloadTooLarge).(metrics.Counter).Count(); c != 2 {
+		t.Errorf("incorrect count for oversized payloads: expected 2, actual %d", c)
+	}
+}
+
+func TestPayloadValidation(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Payload   string
+
+		Code   int
+		Called bool
+	}{
+		"validPayload": {
+			EventType: "pull_request",
+			Payload:   `{"action":"opened","repository":{"id":1},"installation":{"id":2}}`,
+			Code:      http.StatusOK,
+			Called:    true,
+		},
+		"truncatedPayload": {
+			EventType: "pull_request",
+			Payload:   `{"action":"opened","repository":{"id":1},"installa`,
+			Code:      http.StatusBadRequest,
+		},
+		"notAnObject": {
+			EventType: "pull_request",
+			Payload:   `["opened"]`,
+			Code:      http.StatusBadRequest,
+		},
+		"missingField": {
+			EventType: "pull_request",
+			Payload:   `{"action":"opened","repository":{"id":1}}`,
+			Code:      http.StatusBadRequest,
+		},
+		"nullField": {
+			EventType: "push",
+			Payload:   `{"repository":null,"installation":{"id":2}}`,
+			Code:      http.StatusBadRequest,
+		},
+		"unknownEventType": {
+			EventType: "custom_event",
+			Payload:   `{}`,
+			Code:      http.StatusOK,
+			Called:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := TestEventHandler{Types: []string{test.EventType}}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithPayloadValidation())
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newPayloadRequest(test.EventType, name, []byte(test.Payload), true))
+
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if called := h.Count > 0; called != test.Called {
+				t.Errorf("incorrect called state: expected %t, actual %t", test.Called, called)
+			}
+		})
+	}
+
+	t.Run("disabledByDefault", func(t *testing.T) {
+		h := TestEventHandler{Types: []string{"pull_request"}}
+		d := NewEventDispatcher([]EventHandler{&h}, testHookSecret)
+
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newPayloadRequest("pull_request", "default", []byte(`{"action":"opened"}`), true))
+
+		if res.Code != http.StatusOK {
+			t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+		}
+	})
+}
+
+func TestEnforceAppID(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Payload   string
+		TargetID  string
+
+		Code   int
+		Called bool
+	}{
+		"matchingHeader": {
+			EventType: "pull_request",
+			Payload:   `{"installation":{"id":2}}`,
+			TargetID:  "1",
+			Code:      http.StatusOK,
+			Called:    true,
+		},
+		"mismatchedHeader": {
+			EventType: "pull_request",
+			Payload:   `{"installation":{"id":2}}`,
+			TargetID:  "3",
+			Code:      http.StatusBadRequest,
+		},
+		"invalidHeader": {
+			EventType: "pull_request",
+			Payload:   `{"installation":{"id":2}}`,
+			TargetID:  "app",
+			Code:      http.StatusBadRequest,
+		},
+		"matchingInstallation": {
+			EventType: "installation",
+			Payload:   `{"installation":{"id":2,"app_id":1}}`,
+			Code:      http.StatusOK,
+			Called:    true,
+		},
+		"mismatchedInstallation": {
+			EventType: "installation",
+			Payload:   `{"installation":{"id":2,"app_id":3}}`,
+			TargetID:  "1",
+			Code:      http.StatusBadRequest,
+		},
+		"mismatchedTopLevel": {
+			EventType: "github_app_authorization",
+			Payload:   `{"app_id":3}`,
+			Code:      http.StatusBadRequest,
+		},
+		"missingAppID": {
+			EventType: "pull_request",
+			Payload:   `{"installation":{"id":2}}`,
+			Code:      http.StatusBadRequest,
+		},
+		"exemptEvent": {
+			EventType: "custom_event",
+			Payload:   `{}`,
+			Code:      http.StatusOK,
+			Called:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := TestEventHandler{Types: []string{test.EventType}}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithEnforceAppID(1, "custom_event"))
+
+			req := newPayloadRequest(test.EventType, name, []byte(test.Payload), true)
+			if test.TargetID != "" {
+				req.Header.Set(HookTargetTypeHeader, "integration")
+				req.Header.Set(HookTargetIDHeader, test.TargetID)
+			}
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if called := h.Count > 0; called != test.Called {
+				t.Errorf("incorrect called state: expected %t, actual %t", test.Called, called)
+			}
+		})
+	}
+}
+
+func TestSourceRestriction(t *testing.T) {
+	mustParseCIDR := func(s string) net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("invalid CIDR %q: %v", s, err)
+		}
+		return *n
+	}
+	allowed := []net.IPNet{mustParseCIDR("192.30.252.0/22"), mustParseCIDR("2a0a:a440::/29")}
+
+	tests := map[string]struct {
+		Options    []DispatcherOption
+		RemoteAddr string
+		Header     []string
+
+		Code int
+	}{
+		"allowsListedAddress": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed)},
+			RemoteAddr: "192.30.252.10:4321",
+			Code:       http.StatusOK,
+		},
+		"allowsListedIPv6Address": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed)},
+			RemoteAddr: "[2a0a:a440::1]:4321",
+			Code:       http.StatusOK,
+		},
+		"rejectsUnlistedAddress": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed)},
+			RemoteAddr: "10.0.0.1:4321",
+			Code:       http.StatusForbidden,
+		},
+		"ignoresHeaderByDefault": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed)},
+			RemoteAddr: "10.0.0.1:4321",
+			Header:     []string{"192.30.252.10"},
+			Code:       http.StatusForbidden,
+		},
+		"usesTrustedProxyHeader": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed), WithTrustedProxyHeader("X-Forwarded-For")},
+			RemoteAddr: "10.0.0.1:4321",
+			Header:     []string{"192.30.252.10"},
+			Code:       http.StatusOK,
+		},
+		"usesLastProxyAddress": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed), WithTrustedProxyHeader("X-Forwarded-For")},
+			RemoteAddr: "10.0.0.1:4321",
+			Header:     []string{"192.30.252.10, 10.0.0.2"},
+			Code:       http.StatusForbidden,
+		},
+		"usesLastProxyHeader": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed), WithTrustedProxyHeader("X-Forwarded-For")},
+			RemoteAddr: "10.0.0.1:4321",
+			Header:     []string{"10.0.0.2", "10.0.0.3, 192.30.252.10"},
+			Code:       http.StatusOK,
+		},
+		"rejectsInvalidProxyAddress": {
+			Options:    []DispatcherOption{WithAllowedSourceCIDRs(allowed), WithTrustedProxyHeader("X-Forwarded-For")},
+			RemoteAddr: "192.30.252.10:4321",
+			Header:     []string{"unknown"},
+			Code:       http.StatusForbidden,
+		},
+		"allowsAllByDefault": {
+			RemoteAddr: "10.0.0.1:4321",
+			Code:       http.StatusOK,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := TestEventHandler{Types: []string{"pull_request"}}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, test.Options...)
+
+			req := newHookRequest("pull_request", name, true)
+			req.RemoteAddr = test.RemoteAddr
+			for _, v := range test.Header {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if called := h.Count > 0; called != (test.Code == http.StatusOK) {
+				t.Errorf("incorrect called state: %t", called)
+			}
+		})
+	}
+}
+
+func TestGitHubMetaCIDRs(t *testing.T) {
+	var mu sync.Mutex
+	var fetches int
+	hooks := `["192.30.252.0/22"]`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		fmt.Fprintf(w, `{"hooks":%s}`, hooks)
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	h := TestEventHandler{Types: []string{"pull_request"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithGitHubMetaCIDRs(client, 10*time.Millisecond))
+
+	send := func(addr string) int {
+		req := newHookRequest("pull_request", "meta", true)
+		req.RemoteAddr = addr + ":4321"
+
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, req)
+		return res.Code
+	}
+	getFetches := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	// the ranges are fetched in the background when the dispatcher is created
+	for i := 0; send("192.30.252.10") != http.StatusOK; i++ {
+		if i > 1000 {
+			t.Fatal("ranges were not fetched")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := send("140.82.112.1"); code != http.StatusForbidden {
+		t.Errorf("incorrect response code for other address: %d", code)
+	}
+	if n := getFetches(); n != 1 {
+		t.Fatalf("incorrect number of fetches: expected 1, actual %d", n)
+	}
+
+	mu.Lock()
+	hooks = `["140.82.112.0/20"]`
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+
+	// stale ranges are used while they are refreshed in the background
+	if code := send("192.30.252.10"); code != http.StatusOK {
+		t.Errorf("incorrect response code while refreshing: %d", code)
+	}
+	for i := 0; send("140.82.112.1") != http.StatusOK; i++ {
+		if i > 100 {
+			t.Fatal("ranges were not refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGitHubMetaCIDRsUnavailable(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		writeTestGitHubError(w, http.StatusServiceUnavailable, "unavailable")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	h := TestEventHandler{Types: []string{"pull_request"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithGitHubMetaCIDRs(client, time.Hour))
+
+	// requests fail without waiting for the meta API or starting more fetches
+	for i := 0; i < 10; i++ {
+		req := newHookRequest("pull_request", "meta", true)
+		req.RemoteAddr = "192.30.252.10:4321"
+
+		done := make(chan int, 1)
+		go func() {
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+			done <- res.Code
+		}()
+
+		select {
+		case code := <-done:
+			if code != http.StatusInternalServerError {
+				t.Errorf("incorrect response code: expected %d, actual %d", http.StatusInternalServerError, code)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("request waited for the meta API")
+		}
+	}
+
+	if h.Count > 0 {
+		t.Error("handler was called before the ranges were fetched")
+	}
+	if n := atomic.LoadInt32(&fetches); n > 1 {
+		t.Errorf("incorrect number of fetches: expected at most 1, actual %d", n)
+	}
+}
+
+func TestDispatcherFieldNames(t *testing.T) {
+	var out bytes.Buffer
+	var names FieldNames
+
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			names = FieldNamesFromContext(ctx)
+			return nil
+		},
+	}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithLogFieldNames(FieldNames{EventType: "github.event"}))
+
+	req := newHookRequest("pull_request", "names", true)
+	req = req.WithContext(zerolog.New(&out).WithContext(req.Context()))
+	d.ServeHTTP(httptest.NewRecorder(), req)
+
+	if names.EventType != "github.event" || names.DeliveryID != LogKeyDeliveryID {
+		t.Errorf("incorrect field names in handler context: %+v", names)
+	}
+	if !strings.Contains(out.String(), `"github.event":"pull_request"`) {
+		t.Errorf("log entry does not use custom event type field: %s", out.String())
+	}
+	if !strings.Contains(out.String(), `"`+LogKeyDeliveryID+`":"names"`) {
+		t.Errorf("log entry does not use default delivery ID field: %s", out.String())
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			panic("handler panic")
+		},
+	}
+
+	var recovered interface{}
+	var stack []byte
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithPanicHandler(func(ctx context.Context, r interface{}, s []byte) {
+		recovered, stack = r, s
+	}))
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newHookRequest("pull_request", "panic", true))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+	}
+	if recovered != "handler panic" {
+		t.Errorf("incorrect recovered value: %v", recovered)
+	}
+	if len(stack) == 0 {
+		t.Error("panic handler was called without a stack trace")
+	}
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	tests := map[string]struct {
+		Secret       string
+		ResponseCode int
+	}{
+		"primarySecret":    {Secret: testHookSecret, ResponseCode: 200},
+		"additionalSecret": {Secret: "rotatedhooksecret", ResponseCode: 200},
+		"unknownSecret":    {Secret: "unknownhooksecret", ResponseCode: 400},
+	}
+
+	var c Config
+	c.App.WebhookSecret = testHookSecret
+	c.App.WebhookSecrets = []string{"rotatedhooksecret"}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := TestEventHandler{Types: []string{"pull_request"}}
+			d := NewDefaultEventDispatcher(c, &h)
+
+			req := newHookRequest("pull_request", name, false)
+			body := []byte(`{"type":"pull_request"}`)
+
+			mac := hmac.New(sha256.New, []byte(test.Secret))
+			mac.Write(body)
+			req.Header.Set("X-Hub-Signature-256", fmt.Sprintf("sha256=%x", mac.Sum(nil)))
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+
+			if test.ResponseCode != res.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+			}
+		})
+	}
+}
+
+func TestSignatureValidation(t *testing.T) {
+	// test vectors from GitHub's documentation on validating webhook deliveries
+	const (
+		secret          = "It's a Secret to Everybody"
+		payload         = "Hello, World!"
+		sha256Signature = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+		sha1Signature   = "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59"
+	)
+
+	tests := map[string]struct {
+		Secrets []string
+		Options []DispatcherOption
+		Headers map[string]string
+
+		Err bool
+	}{
+		"sha256": {
+			Secrets: []string{secret},
+			Headers: map[string]string{"X-Hub-Signature-256": sha256Signature},
+		},
+		"sha256Invalid": {
+			Secrets: []string{secret},
+			Headers: map[string]string{"X-Hub-Signature-256": "sha256=0000000000000000000000000000000000000000000000000000000000000000"},
+			Err:     true,
+		},
+		"sha1Rejected": {
+			Secrets: []string{secret},
+			Headers: map[string]string{"X-Hub-Signature": sha1Signature},
+			Err:     true,
+		},
+		"sha1InSHA256HeaderRejected": {
+			Secrets: []string{secret},
+			Headers: map[string]string{"X-Hub-Signature-256": sha1Signature},
+			Err:     true,
+		},
+		"sha1Allowed": {
+			Secrets: []string{secret},
+			Options: []DispatcherOption{WithAllowSHA1()},
+			Headers: map[string]string{"X-Hub-Signature": sha1Signature},
+		},
+		"sha256Preferred": {
+			Secrets: []string{secret},
+			Options: []DispatcherOption{WithAllowSHA1()},
+			Headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=0000000000000000000000000000000000000000000000000000000000000000",
+				"X-Hub-Signature":     sha1Signature,
+			},
+			Err: true,
+		},
+		"missingSignature": {
+			Secrets: []string{secret},
+			Err:     true,
+		},
+		"missingSignatureWithoutSecret": {},
+		"customHeader": {
+			Secrets: []string{secret},
+			Options: []DispatcherOption{WithHeaders(Headers{Signature: "X-Proxy-Hub-Signature-256"})},
+			Headers: map[string]string{"X-Proxy-Hub-Signature-256": sha256Signature},
+		},
+		"customHeaderIgnoresDefault": {
+			Secrets: []string{secret},
+			Options: []DispatcherOption{WithHeaders(Headers{Signature: "X-Proxy-Hub-Signature-256"})},
+			Headers: map[string]string{"X-Hub-Signature-256": sha256Signature},
+			Err:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]DispatcherOption{WithWebhookSecrets(test.Secrets...)}, test.Options...)
+			d := NewEventDispatcher(nil, "", opts...).(*eventDispatcher)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/github/hook", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range test.Headers {
+				req.Header.Set(k, v)
+			}
+
+			body, err := d.validatePayload(req)
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected validation error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+			if string(body) != payload {
+				t.Errorf("incorrect payload: %q", body)
+			}
+		})
+	}
+}
+
+func TestInsecureSkipSignatureValidation(t *testing.T) {
+	tests := map[string]struct {
+		Secret  string
+		Options []DispatcherOption
+		Signed  bool
+
+		Panic bool
+		Code  int
+	}{
+		"unsignedWithoutSecret": {
+			Options: []DispatcherOption{WithInsecureSkipSignatureValidation()},
+			Code:    http.StatusOK,
+		},
+		"invalidSignatureWithoutSecret": {
+			Options: []DispatcherOption{WithInsecureSkipSignatureValidation()},
+			Signed:  true,
+			Code:    http.StatusOK,
+		},
+		"unconfirmedWithSecret": {
+			Secret:  testHookSecret,
+			Options: []DispatcherOption{WithInsecureSkipSignatureValidation()},
+			Panic:   true,
+		},
+		"unconfirmedWithAdditionalSecret": {
+			Options: []DispatcherOption{WithWebhookSecrets(testHookSecret), WithInsecureSkipSignatureValidation()},
+			Panic:   true,
+		},
+		"confirmedWithSecret": {
+			Secret:  testHookSecret,
+			Options: []DispatcherOption{WithInsecureSkipSignatureValidation(IReallyMeanIt)},
+			Code:    http.StatusOK,
+		},
+		"disabledByDefault": {
+			Secret: testHookSecret,
+			Code:   http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != test.Panic {
+					t.Errorf("incorrect panic: expected %t, actual %v", test.Panic, r)
+				}
+			}()
+
+			h := TestEventHandler{Types: []string{"pull_request"}}
+			d := NewEventDispatcher([]EventHandler{&h}, test.Secret, test.Options...)
+
+			var out bytes.Buffer
+			req := newHookRequest("pull_request", name, test.Signed)
+			if test.Signed {
+				// an invalid signature is also ignored
+				req.Header.Set("X-Hub-Signature-256", "sha256=0000000000000000000000000000000000000000000000000000000000000000")
+			}
+			req = req.WithContext(zerolog.New(&out).WithContext(req.Context()))
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, req)
+
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if warned := strings.Contains(out.String(), "INSECURE"); warned != (len(test.Options) > 0) {
+				t.Errorf("incorrect warning state: expected %t, actual %t", len(test.Options) > 0, warned)
+			}
+		})
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	custom := Headers{
+		EventType:  "X-Proxy-GitHub-Event",
+		DeliveryID: "X-Proxy-GitHub-Delivery",
+		Signature:  "X-Proxy-Hub-Signature-256",
+	}
+
+	// Headers maps request headers to the header of a standard request that
+	// contains the value
+	tests := map[string]struct {
+		Headers map[string]string
+		Status  int
+	}{
+		"customHeaders": {
+			Headers: map[string]string{
+				custom.EventType:  "X-GitHub-Event",
+				custom.DeliveryID: "X-GitHub-Delivery",
+				custom.Signature:  "X-Hub-Signature-256",
+			},
+			Status: http.StatusOK,
+		},
+		"defaultHeaders": {
+			Headers: map[string]string{
+				"X-GitHub-Event":      "X-GitHub-Event",
+				"X-GitHub-Delivery":   "X-GitHub-Delivery",
+				"X-Hub-Signature-256": "X-Hub-Signature-256",
+			},
+			Status: http.StatusBadRequest,
+		},
+		"missingDeliveryID": {
+			Headers: map[string]string{
+				custom.EventType: "X-GitHub-Event",
+				custom.Signature: "X-Hub-Signature-256",
+			},
+			Status: http.StatusBadRequest,
+		},
+		"missingSignature": {
+			Headers: map[string]string{
+				custom.EventType:  "X-GitHub-Event",
+				custom.DeliveryID: "X-GitHub-Delivery",
+			},
+			Status: http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := &TestEventHandler{Types: []string{"pull_request"}}
+			d := NewEventDispatcher([]EventHandler{handler}, testHookSecret, WithHeaders(custom))
+
+			standard := newHookRequest("pull_request", "delivery-id", true)
+			req := httptest.NewRequest(http.MethodPost, "/api/github/hook", standard.Body)
+			req.Header.Set("Content-Type", "application/json")
+			for h, from := range test.Headers {
+				req.Header.Set(h, standard.Header.Get(from))
+			}
+
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, req)
+
+			if w.Code != test.Status {
+				t.Errorf("incorrect status code: expected %d, actual %d", test.Status, w.Code)
+			}
+			if expected := test.Status == http.StatusOK; (handler.Count == 1) != expected {
+				t.Errorf("incorrect handler calls: %d", handler.Count)
+			}
+		})
+	}
+}
+
+func TestCustomHeadersErrorMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	custom := Headers{EventType: "X-Proxy-Event", DeliveryID: "X-Proxy-Delivery"}
+
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			return errors.New("handler failed")
+		},
+	}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret,
+		WithHeaders(custom),
+		WithErrorCallback(MetricsErrorCallback(registry)),
+	)
+
+	standard := newHookRequest("pull_request", "delivery-id", true)
+	req := httptest.NewRequest(http.MethodPost, "/api/github/hook", standard.Body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(custom.EventType, "pull_request")
+	req.Header.Set(custom.DeliveryID, "delivery-id")
+	req.Header.Set("X-Hub-Signature-256", standard.Header.Get("X-Hub-Signature-256"))
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("incorrect status code: expected %d, actual %d", http.StatusInternalServerError, w.Code)
+	}
+	if c, ok := registry.Get(MetricsKeyHandlerError + "[event:pull_request]").(metrics.Counter); !ok || c.Count() != 1 {
+		t.Errorf("error was not counted for the event type: %v", registry.GetAll())
+	}
+}
+
+func TestDispatchMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			return errors.New("handler failure")
+		},
+	}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithDispatchMetrics(registry))
+
+	for _, event := range []string{"pull_request", "pull_request", "issue_comment"} {
+		d.ServeHTTP(httptest.NewRecorder(), newHookRequest(event, "metrics", true))
+	}
+
+	counts := map[string]int64{
+		"github.event.received[event:pull_request]":                            2,
+		"github.event.received[event:issue_comment]":                           1,
+		"github.handler.duration[handler:TestEventHandler,event:pull_request]": 2,
+		"github.handler.failures[handler:TestEventHandler,event:pull_request]": 2,
+	}
+	for key, expected := range counts {
+		var actual int64
+		switch m := registry.Get(key).(type) {
+		case metrics.Counter:
+			actual = m.Count()
+		case metrics.Timer:
+			actual = m.Count()
+		default:
+			t.Errorf("missing metric %q", key)
+			continue
+		}
+		if expected != actual {
+			t.Errorf("incorrect count for %q: expected %d, actual %d", key, expected, actual)
+		}
+	}
+}
+
+func TestHandlerName(t *testing.T) {
+	if name := HandlerName(&TestEventHandler{}); name != "TestEventHandler" {
+		t.Errorf("incorrect name for unnamed handler: %q", name)
+	}
+	if name := HandlerName(&namedEventHandler{}); name != "custom-name" {
+		t.Errorf("incorrect name for named handler: %q", name)
+	}
+}
+
 func TestSetAndGetResponder(t *testing.T) {
 	t.Run("setPanicsOutsideOfDispatcher", func(t *testing.T) {
 		defer func() {
@@ -193,16 +1393,19 @@ func TestSetAndGetResponder(t *testing.T) {
 
 func newHookRequest(eventType, id string, signed bool) *http.Request {
 	body := []byte(fmt.Sprintf(`{"type":"%s"}`, eventType))
+	return newPayloadRequest(eventType, id, body, signed)
+}
 
+func newPayloadRequest(eventType, id string, body []byte, signed bool) *http.Request {
 	req := httptest.NewRequest(http.MethodPost, "/api/github/hook", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Github-Event", eventType)
 	req.Header.Set("X-Github-Delivery", id)
 
 	if signed {
-		mac := hmac.New(sha1.New, []byte(testHookSecret))
+		mac := hmac.New(sha256.New, []byte(testHookSecret))
 		mac.Write(body)
-		req.Header.Set("X-Hub-Signature", fmt.Sprintf("sha1=%x", mac.Sum(nil)))
+		req.Header.Set("X-Hub-Signature-256", fmt.Sprintf("sha256=%x", mac.Sum(nil)))
 	}
 
 	log := zerolog.New(os.Stdout)
@@ -228,3 +1431,31 @@ func (h *TestEventHandler) Handle(ctx context.Context, eventType, deliveryID str
 	}
 	return nil
 }
+
+type namedEventHandler struct {
+	TestEventHandler
+}
+
+func (h *namedEventHandler) Name() string {
+	return "custom-name"
+}
+
+type statusEventHandler struct {
+	TestEventHandler
+	Status int
+	Err    error
+}
+
+func (h *statusEventHandler) HandleResponse(ctx context.Context, eventType, deliveryID string, payload []byte) (int, error) {
+	return h.Status, h.Err
+}
+
+type middlewareEventHandler struct {
+	EventHandler
+	before func()
+}
+
+func (h *middlewareEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.before()
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
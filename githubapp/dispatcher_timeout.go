@@ -0,0 +1,120 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	MetricsKeyHandlerTimeouts = "github.handler.timeouts"
+)
+
+// ErrHandlerTimeout matches the errors of handlers that fail after the
+// timeout set by WithHandlerTimeout. Use errors.Is to check for it.
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// TimeoutHandler is implemented by handlers that need a different timeout
+// than the one set by WithHandlerTimeout. If HandlerTimeout returns zero or a
+// negative duration, the handler runs without a timeout.
+type TimeoutHandler interface {
+	HandlerTimeout() time.Duration
+}
+
+// WithHandlerTimeout cancels the context passed to each event handler after
+// the timeout. This applies to every handler call, including handlers run by
+// an asynchronous scheduler, so a handler blocked on a network call cannot
+// hold a worker forever. Handlers must respect context cancellation for the
+// timeout to have an effect.
+//
+// If a handler returns an error after its timeout expires, the dispatcher
+// wraps it in a HandlerTimeoutError, which matches ErrHandlerTimeout, and
+// increments github.handler.timeouts[handler:<name>,event:<type>] in the
+// registry set by WithDispatchMetrics and github.handler.timeouts in the
+// Metrics set by WithMetrics.
+//
+// Handlers can change or disable the timeout by implementing TimeoutHandler.
+// With NewTypedDispatcher, the timeout applies to all typed handlers for an
+// event together.
+func WithHandlerTimeout(timeout time.Duration) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.handlerTimeout = timeout
+	}
+}
+
+// timeoutFor returns the timeout for a handler.
+func (d *eventDispatcher) timeoutFor(h EventHandler) time.Duration {
+	if th, ok := h.(TimeoutHandler); ok {
+		return th.HandlerTimeout()
+	}
+	return d.handlerTimeout
+}
+
+// timeoutHandler cancels the context of an event handler after a timeout.
+type timeoutHandler struct {
+	EventHandler
+	timeout  time.Duration
+	registry metrics.Registry
+	sink     Metrics
+}
+
+func (h *timeoutHandler) Name() string {
+	return HandlerName(h.EventHandler)
+}
+
+func (h *timeoutHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	tctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := h.EventHandler.Handle(tctx, eventType, deliveryID, payload)
+	if err == nil || ctx.Err() != nil || !errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	name := h.Name()
+	if h.registry != nil {
+		key := fmt.Sprintf("%s[handler:%s,event:%s]", MetricsKeyHandlerTimeouts, name, eventType)
+		metrics.GetOrRegisterCounter(key, h.registry).Inc(1)
+	}
+	if h.sink != nil {
+		h.sink.Counter(MetricsKeyHandlerTimeouts, 1, "handler", name, "event", eventType)
+	}
+	return &HandlerTimeoutError{handler: name, timeout: h.timeout, err: err}
+}
+
+// HandlerTimeoutError is returned when an event handler fails after its
+// timeout expires. It matches ErrHandlerTimeout with errors.Is.
+type HandlerTimeoutError struct {
+	handler string
+	timeout time.Duration
+	err     error
+}
+
+func (e *HandlerTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.handler, e.timeout, e.err)
+}
+
+func (e *HandlerTimeoutError) Is(target error) bool {
+	return target == ErrHandlerTimeout
+}
+
+func (e *HandlerTimeoutError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	waitForCancel := func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+
+	tests := map[string]struct {
+		Handler EventHandler
+
+		Timeout  bool
+		Timeouts int64
+	}{
+		"timeout": {
+			Handler:  &TestEventHandler{Types: []string{"pull_request"}, Fn: waitForCancel},
+			Timeout:  true,
+			Timeouts: 1,
+		},
+		"fastHandler": {
+			Handler: &TestEventHandler{Types: []string{"pull_request"}},
+		},
+		"optOut": {
+			Handler: &testTimeoutHandler{
+				TestEventHandler: TestEventHandler{Types: []string{"pull_request"}, Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					if _, ok := ctx.Deadline(); ok {
+						return errors.New("handler context has a deadline")
+					}
+					return nil
+				}},
+			},
+		},
+		"longerTimeout": {
+			Handler: &testTimeoutHandler{
+				TestEventHandler: TestEventHandler{Types: []string{"pull_request"}, Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					time.Sleep(20 * time.Millisecond)
+					return ctx.Err()
+				}},
+				Timeout: time.Minute,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var handlerErr error
+			registry := metrics.NewRegistry()
+
+			d := NewEventDispatcher([]EventHandler{test.Handler}, testHookSecret,
+				WithHandlerTimeout(10*time.Millisecond),
+				WithDispatchMetrics(registry),
+				WithErrorCallback(func(w http.ResponseWriter, r *http.Request, err error) {
+					handlerErr = err
+					w.WriteHeader(http.StatusInternalServerError)
+				}),
+			)
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newHookRequest("pull_request", name, true))
+
+			if test.Timeout {
+				if !errors.Is(handlerErr, ErrHandlerTimeout) {
+					t.Errorf("expected ErrHandlerTimeout, but got %v", handlerErr)
+				}
+				if !errors.Is(handlerErr, context.DeadlineExceeded) {
+					t.Errorf("expected error to wrap the handler error, but got %v", handlerErr)
+				}
+			} else if handlerErr != nil {
+				t.Errorf("unexpected error: %v", handlerErr)
+			}
+
+			var timeouts int64
+			if c, ok := registry.Get(MetricsKeyHandlerTimeouts + "[handler:TestEventHandler,event:pull_request]").(metrics.Counter); ok {
+				timeouts = c.Count()
+			}
+			if timeouts != test.Timeouts {
+				t.Errorf("incorrect timeout count: expected %d, actual %d", test.Timeouts, timeouts)
+			}
+		})
+	}
+}
+
+type testTimeoutHandler struct {
+	TestEventHandler
+	Timeout time.Duration
+}
+
+func (h *testTimeoutHandler) HandlerTimeout() time.Duration {
+	return h.Timeout
+}
@@ -0,0 +1,401 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// CheckRunHandler handles check_run events.
+type CheckRunHandler interface {
+	HandleCheckRun(ctx context.Context, event *github.CheckRunEvent) error
+}
+
+// CheckSuiteHandler handles check_suite events.
+type CheckSuiteHandler interface {
+	HandleCheckSuite(ctx context.Context, event *github.CheckSuiteEvent) error
+}
+
+// CodeScanningAlertHandler handles code_scanning_alert events.
+type CodeScanningAlertHandler interface {
+	HandleCodeScanningAlert(ctx context.Context, event *github.CodeScanningAlertEvent) error
+}
+
+// DependabotAlertHandler handles dependabot_alert events.
+type DependabotAlertHandler interface {
+	HandleDependabotAlert(ctx context.Context, event *DependabotAlertEvent) error
+}
+
+// InstallationHandler handles installation events.
+type InstallationHandler interface {
+	HandleInstallation(ctx context.Context, event *github.InstallationEvent) error
+}
+
+// InstallationRepositoriesHandler handles installation_repositories events.
+type InstallationRepositoriesHandler interface {
+	HandleInstallationRepositories(ctx context.Context, event *github.InstallationRepositoriesEvent) error
+}
+
+// IssueCommentHandler handles issue_comment events.
+type IssueCommentHandler interface {
+	HandleIssueComment(ctx context.Context, event *github.IssueCommentEvent) error
+}
+
+// IssuesHandler handles issues events.
+type IssuesHandler interface {
+	HandleIssues(ctx context.Context, event *github.IssuesEvent) error
+}
+
+// PullRequestHandler handles pull_request events.
+type PullRequestHandler interface {
+	HandlePullRequest(ctx context.Context, event *github.PullRequestEvent) error
+}
+
+// PullRequestReviewHandler handles pull_request_review events.
+type PullRequestReviewHandler interface {
+	HandlePullRequestReview(ctx context.Context, event *github.PullRequestReviewEvent) error
+}
+
+// PullRequestReviewCommentHandler handles pull_request_review_comment events.
+type PullRequestReviewCommentHandler interface {
+	HandlePullRequestReviewComment(ctx context.Context, event *github.PullRequestReviewCommentEvent) error
+}
+
+// PushHandler handles push events.
+type PushHandler interface {
+	HandlePush(ctx context.Context, event *github.PushEvent) error
+}
+
+// ReleaseHandler handles release events.
+type ReleaseHandler interface {
+	HandleRelease(ctx context.Context, event *github.ReleaseEvent) error
+}
+
+// SecretScanningAlertHandler handles secret_scanning_alert events.
+type SecretScanningAlertHandler interface {
+	HandleSecretScanningAlert(ctx context.Context, event *github.SecretScanningAlertEvent) error
+}
+
+// StatusHandler handles status events.
+type StatusHandler interface {
+	HandleStatus(ctx context.Context, event *github.StatusEvent) error
+}
+
+// WorkflowJobHandler handles workflow_job events.
+type WorkflowJobHandler interface {
+	HandleWorkflowJob(ctx context.Context, event *github.WorkflowJobEvent) error
+}
+
+// WorkflowRunHandler handles workflow_run events.
+type WorkflowRunHandler interface {
+	HandleWorkflowRun(ctx context.Context, event *github.WorkflowRunEvent) error
+}
+
+// typedEvent parses payloads and calls the typed handler method for an event
+// type.
+type typedEvent struct {
+	handles func(h interface{}) bool
+	parse   func(decode Decoder, payload []byte) (interface{}, error)
+	call    func(ctx context.Context, h interface{}, event interface{}) error
+}
+
+func newTypedEvent[H any, E any](method func(H, context.Context, *E) error) typedEvent {
+	return typedEvent{
+		handles: func(h interface{}) bool {
+			_, ok := h.(H)
+			return ok
+		},
+		parse: func(decode Decoder, payload []byte) (interface{}, error) {
+			event := new(E)
+			if err := decode(payload, event); err != nil {
+				return nil, err
+			}
+			return event, nil
+		},
+		call: func(ctx context.Context, h interface{}, event interface{}) error {
+			e, ok := event.(*E)
+			if !ok {
+				return errors.Errorf("unexpected event type %T", event)
+			}
+			return method(h.(H), ctx, e)
+		},
+	}
+}
+
+var typedEvents = map[string]typedEvent{
+	"check_run":                   newTypedEvent(CheckRunHandler.HandleCheckRun),
+	"check_suite":                 newTypedEvent(CheckSuiteHandler.HandleCheckSuite),
+	"code_scanning_alert":         newTypedEvent(CodeScanningAlertHandler.HandleCodeScanningAlert),
+	"dependabot_alert":            newTypedEvent(DependabotAlertHandler.HandleDependabotAlert),
+	"installation":                newTypedEvent(InstallationHandler.HandleInstallation),
+	"installation_repositories":   newTypedEvent(InstallationRepositoriesHandler.HandleInstallationRepositories),
+	"issue_comment":               newTypedEvent(IssueCommentHandler.HandleIssueComment),
+	"issues":                      newTypedEvent(IssuesHandler.HandleIssues),
+	"pull_request":                newTypedEvent(PullRequestHandler.HandlePullRequest),
+	"pull_request_review":         newTypedEvent(PullRequestReviewHandler.HandlePullRequestReview),
+	"pull_request_review_comment": newTypedEvent(PullRequestReviewCommentHandler.HandlePullRequestReviewComment),
+	"push":                        newTypedEvent(PushHandler.HandlePush),
+	"release":                     newTypedEvent(ReleaseHandler.HandleRelease),
+	"secret_scanning_alert":       newTypedEvent(SecretScanningAlertHandler.HandleSecretScanningAlert),
+	"status":                      newTypedEvent(StatusHandler.HandleStatus),
+	"workflow_job":                newTypedEvent(WorkflowJobHandler.HandleWorkflowJob),
+	"workflow_run":                newTypedEvent(WorkflowRunHandler.HandleWorkflowRun),
+}
+
+// Decoder decodes a JSON payload into v, which is a pointer to an event
+// struct. json.Unmarshal is a Decoder, and most JSON libraries provide a
+// compatible function.
+type Decoder func(data []byte, v interface{}) error
+
+// WithDecoder sets the function that typed dispatchers use to decode
+// payloads into events. Use it to replace encoding/json with a faster
+// library or a pooled decoder for high event volumes. The decoder must
+// support the encoding/json struct tags used by go-github events. The default
+// is json.Unmarshal.
+//
+// The decoder is also used by handlers created with TypedEventHandler that
+// are registered with the dispatcher.
+func WithDecoder(decoder Decoder) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.decoder = decoder
+	}
+}
+
+// decoderSetter is implemented by handlers that decode payloads with the
+// dispatcher's Decoder.
+type decoderSetter interface {
+	setDecoder(decoder Decoder)
+}
+
+// setDecoder sets the dispatcher's Decoder on a handler, if the dispatcher
+// has a Decoder and the handler uses it.
+func (d *eventDispatcher) setDecoder(h EventHandler) {
+	if ds, ok := h.(decoderSetter); ok && d.decoder != nil {
+		ds.setDecoder(d.decoder)
+	}
+}
+
+// NewTypedDispatcher creates an http.Handler like NewEventDispatcher that
+// parses each payload once and passes the parsed event to handlers that
+// implement typed handler interfaces, like IssueCommentHandler. A handler may
+// implement several typed interfaces. All typed handlers for an event are
+// called in order until one returns an error, unless the dispatcher is
+// created with WithConcurrentHandlers.
+//
+// Handlers may also be EventHandlers, which receive the raw payload. They are
+// only called for events that do not have typed handlers.
+//
+// NewTypedDispatcher panics if a handler does not implement any typed handler
+// interface or EventHandler.
+//
+// Each payload is decoded once per delivery and the same event is passed to
+// all typed handlers and to handlers created with TypedEventHandler, so
+// handlers must not modify the event. Use Clone to get a copy that can be
+// modified.
+func NewTypedDispatcher(handlers []interface{}, secret string, opts ...DispatcherOption) http.Handler {
+	typed := &typedEventHandler{
+		handlers: make(map[string][]interface{}),
+		decode:   json.Unmarshal,
+	}
+
+	var raw []EventHandler
+	for _, h := range handlers {
+		matched := false
+		for event, te := range typedEvents {
+			if te.handles(h) {
+				typed.handlers[event] = append(typed.handlers[event], h)
+				matched = true
+			}
+		}
+		if eh, ok := h.(EventHandler); ok {
+			raw = append(raw, eh)
+			matched = true
+		}
+		if !matched {
+			panic(errors.Errorf("NewTypedDispatcher: %T does not implement a handler interface", h))
+		}
+	}
+
+	// typed handlers have priority over raw handlers for the same event
+	return NewEventDispatcher(append([]EventHandler{typed}, raw...), secret, opts...)
+}
+
+// typedEventHandler parses payloads and calls typed handlers.
+type typedEventHandler struct {
+	handlers   map[string][]interface{}
+	concurrent bool
+	decode     Decoder
+}
+
+func (h *typedEventHandler) setDecoder(decoder Decoder) {
+	h.decode = decoder
+}
+
+func (h *typedEventHandler) Name() string {
+	return "TypedDispatcher"
+}
+
+func (h *typedEventHandler) Handles() []string {
+	events := make([]string, 0, len(h.handlers))
+	for event := range h.handlers {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+func (h *typedEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	te := typedEvents[eventType]
+	event, err := decodeEvent(ctx, eventType, func() (interface{}, error) {
+		return te.parse(h.decode, payload)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s event payload", eventType)
+	}
+
+	handlers := h.handlers[eventType]
+	return runHandlers(ctx, h.concurrent, len(handlers),
+		func(i int) bool {
+			return isSerial(handlers[i])
+		},
+		func(i int) error {
+			return te.call(ctx, handlers[i], event)
+		},
+	)
+}
+
+// TypedEventHandler returns an EventHandler for a single event type that
+// parses the payload and passes the parsed event to fn. E must be the type
+// returned by github.ParseWebHook for the event type, like
+// *github.WorkflowJobEvent for "workflow_job" events.
+//
+// This is most useful with WithActionHandler to handle typed events with a
+// specific action:
+//
+//	WithActionHandler("workflow_job", "queued", TypedEventHandler("workflow_job", startRunner))
+//
+// Like typed dispatchers, handlers created with TypedEventHandler share the
+// decoded event with other handlers for the same delivery and must not
+// modify it.
+func TypedEventHandler[E any](eventType string, fn func(ctx context.Context, event E) error) EventHandler {
+	return &typedFuncHandler[E]{eventType: eventType, fn: fn}
+}
+
+type typedFuncHandler[E any] struct {
+	eventType string
+	fn        func(context.Context, E) error
+	decode    Decoder
+}
+
+func (h *typedFuncHandler[E]) setDecoder(decoder Decoder) {
+	h.decode = decoder
+}
+
+func (h *typedFuncHandler[E]) Handles() []string {
+	return []string{h.eventType}
+}
+
+func (h *typedFuncHandler[E]) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	event, err := decodeEvent(ctx, eventType, func() (interface{}, error) {
+		te, ok := typedEvents[eventType]
+		if !ok {
+			return github.ParseWebHook(eventType, payload)
+		}
+		if h.decode != nil {
+			return te.parse(h.decode, payload)
+		}
+		return te.parse(json.Unmarshal, payload)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s event payload", eventType)
+	}
+
+	e, ok := event.(E)
+	if !ok {
+		return errors.Errorf("unexpected event type %T for %s event", event, eventType)
+	}
+	return h.fn(ctx, e)
+}
+
+// decodedEventsKey is the context key for the events decoded for a delivery.
+type decodedEventsKey struct{}
+
+// decodedEvents caches the events decoded for a delivery so that handlers for
+// the same delivery share one decoded event.
+type decodedEvents struct {
+	mu     sync.Mutex
+	events map[string]*decodedEvent
+}
+
+type decodedEvent struct {
+	once  sync.Once
+	event interface{}
+	err   error
+}
+
+// withDecodedEvents returns a context with an empty cache of decoded events.
+func withDecodedEvents(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decodedEventsKey{}, &decodedEvents{events: make(map[string]*decodedEvent)})
+}
+
+// decodeEvent returns the cached event for the event type in ctx or calls
+// decode and caches the result. If ctx does not have a cache, it calls decode.
+func decodeEvent(ctx context.Context, eventType string, decode func() (interface{}, error)) (interface{}, error) {
+	cache, ok := ctx.Value(decodedEventsKey{}).(*decodedEvents)
+	if !ok {
+		return decode()
+	}
+
+	cache.mu.Lock()
+	e, ok := cache.events[eventType]
+	if !ok {
+		e = &decodedEvent{}
+		cache.events[eventType] = e
+	}
+	cache.mu.Unlock()
+
+	e.once.Do(func() {
+		e.event, e.err = decode()
+	})
+	return e.event, e.err
+}
+
+// Clone returns a deep copy of an event, for handlers that need to modify
+// an event shared with other handlers. The copy is made by encoding the event
+// as JSON and decoding the result, so fields without JSON tags are not
+// copied.
+func Clone[T any](event *T) (*T, error) {
+	if event == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode event")
+	}
+
+	clone := new(T)
+	if err := json.Unmarshal(b, clone); err != nil {
+		return nil, errors.Wrap(err, "failed to decode event")
+	}
+	return clone, nil
+}
@@ -0,0 +1,340 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestTypedDispatcher(t *testing.T) {
+	first := &testCommentHandler{}
+	second := &testCommentHandler{}
+	raw := &TestEventHandler{Types: []string{"issue_comment", "push"}}
+
+	d := NewTypedDispatcher([]interface{}{first, second, raw}, testHookSecret)
+
+	tests := map[string]struct {
+		Event string
+
+		CommentCalls int
+		RawCalls     int
+	}{
+		"typedHandlers": {
+			Event:        "issue_comment",
+			CommentCalls: 1,
+		},
+		"rawFallback": {
+			Event:    "push",
+			RawCalls: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			first.Count, second.Count, raw.Count = 0, 0, 0
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newHookRequest(test.Event, name, true))
+
+			if res.Code != http.StatusOK {
+				t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+			}
+			if first.Count != test.CommentCalls || second.Count != test.CommentCalls {
+				t.Errorf("incorrect typed call counts: expected %d, actual %d and %d", test.CommentCalls, first.Count, second.Count)
+			}
+			if raw.Count != test.RawCalls {
+				t.Errorf("incorrect raw call count: expected %d, actual %d", test.RawCalls, raw.Count)
+			}
+		})
+	}
+
+	t.Run("panicsOnUnknownHandler", func(t *testing.T) {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("expected NewTypedDispatcher to panic, but it did not!")
+			}
+		}()
+		NewTypedDispatcher([]interface{}{"not a handler"}, testHookSecret)
+	})
+}
+
+func TestTypedDispatcherWorkflowEvents(t *testing.T) {
+	h := &testWorkflowHandler{}
+	d := NewTypedDispatcher([]interface{}{h}, testHookSecret)
+
+	tests := map[string]struct {
+		Event string
+		Body  string
+
+		JobCalls int
+		RunCalls int
+	}{
+		"workflowJob": {
+			Event:    "workflow_job",
+			Body:     `{"action":"queued","workflow_job":{"id":1,"labels":["self-hosted"]}}`,
+			JobCalls: 1,
+		},
+		"workflowRun": {
+			Event:    "workflow_run",
+			Body:     `{"action":"completed","workflow_run":{"id":2,"conclusion":"success"}}`,
+			RunCalls: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h.JobCount, h.RunCount = 0, 0
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newPayloadRequest(test.Event, name, []byte(test.Body), true))
+
+			if res.Code != http.StatusOK {
+				t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+			}
+			if h.JobCount != test.JobCalls {
+				t.Errorf("incorrect workflow_job call count: expected %d, actual %d", test.JobCalls, h.JobCount)
+			}
+			if h.RunCount != test.RunCalls {
+				t.Errorf("incorrect workflow_run call count: expected %d, actual %d", test.RunCalls, h.RunCount)
+			}
+		})
+	}
+}
+
+func TestTypedEventHandler(t *testing.T) {
+	var queued, completed []int64
+	d := NewEventDispatcher(nil, testHookSecret,
+		WithActionHandler("workflow_job", "queued", TypedEventHandler("workflow_job", func(ctx context.Context, event *github.WorkflowJobEvent) error {
+			queued = append(queued, event.GetWorkflowJob().GetID())
+			return nil
+		})),
+		WithActionHandler("workflow_job", "completed", TypedEventHandler("workflow_job", func(ctx context.Context, event *github.WorkflowJobEvent) error {
+			completed = append(completed, event.GetWorkflowJob().GetID())
+			return nil
+		})),
+	)
+
+	for i, action := range []string{"queued", "in_progress", "completed"} {
+		body := fmt.Sprintf(`{"action":"%s","workflow_job":{"id":%d}}`, action, i+1)
+
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newPayloadRequest("workflow_job", action, []byte(body), true))
+
+		if res.Code >= http.StatusBadRequest {
+			t.Errorf("unexpected error response code for %s: %d", action, res.Code)
+		}
+	}
+
+	if len(queued) != 1 || queued[0] != 1 {
+		t.Errorf("incorrect queued jobs: expected [1], actual %v", queued)
+	}
+	if len(completed) != 1 || completed[0] != 3 {
+		t.Errorf("incorrect completed jobs: expected [3], actual %v", completed)
+	}
+
+	t.Run("wrongEventType", func(t *testing.T) {
+		h := TypedEventHandler("workflow_job", func(ctx context.Context, event *github.WorkflowRunEvent) error {
+			return nil
+		})
+		if err := h.Handle(context.Background(), "workflow_job", "1", []byte(`{"action":"queued"}`)); err == nil {
+			t.Errorf("expected error for mismatched event type, but got nil")
+		}
+	})
+}
+
+func TestTypedDispatcherRelease(t *testing.T) {
+	h := &testReleaseHandler{}
+	var published []string
+
+	d := NewTypedDispatcher([]interface{}{h}, testHookSecret,
+		WithActionHandler("release", "published", TypedEventHandler("release", func(ctx context.Context, event *github.ReleaseEvent) error {
+			published = append(published, event.GetRelease().GetTagName())
+			return nil
+		})),
+	)
+
+	for _, action := range []string{"created", "published", "released", "prereleased"} {
+		body := fmt.Sprintf(`{"action":"%s","release":{"tag_name":"v1.0.0"}}`, action)
+
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newPayloadRequest("release", action, []byte(body), true))
+
+		if res.Code != http.StatusOK {
+			t.Errorf("incorrect response code for %s: expected %d, actual %d", action, http.StatusOK, res.Code)
+		}
+	}
+
+	if len(h.Actions) != 4 {
+		t.Errorf("incorrect typed handler calls: expected 4, actual %v", h.Actions)
+	}
+	if len(published) != 1 || published[0] != "v1.0.0" {
+		t.Errorf("incorrect published releases: expected [v1.0.0], actual %v", published)
+	}
+}
+
+func TestTypedDispatcherDecoder(t *testing.T) {
+	tests := map[string]struct {
+		DecodeErr error
+
+		Status int
+		Calls  int
+	}{
+		"customDecoder": {
+			Status: http.StatusOK,
+			Calls:  1,
+		},
+		"decodeError": {
+			DecodeErr: errors.New("decode failed"),
+			Status:    http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := &testReleaseHandler{}
+			var decoded []interface{}
+
+			d := NewTypedDispatcher([]interface{}{h}, testHookSecret, WithDecoder(func(data []byte, v interface{}) error {
+				decoded = append(decoded, v)
+				if test.DecodeErr != nil {
+					return test.DecodeErr
+				}
+				return json.Unmarshal(data, v)
+			}))
+
+			res := httptest.NewRecorder()
+			d.ServeHTTP(res, newPayloadRequest("release", name, []byte(`{"action":"published"}`), true))
+
+			if res.Code != test.Status {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Status, res.Code)
+			}
+			if len(decoded) != 1 {
+				t.Fatalf("expected decoder to be called once, but it was called %d times", len(decoded))
+			}
+			if _, ok := decoded[0].(*github.ReleaseEvent); !ok {
+				t.Errorf("incorrect decode target: expected *github.ReleaseEvent, actual %T", decoded[0])
+			}
+			if len(h.Actions) != test.Calls {
+				t.Errorf("incorrect handler calls: expected %d, actual %d", test.Calls, len(h.Actions))
+			}
+		})
+	}
+}
+
+func TestTypedDispatcherSharedEvent(t *testing.T) {
+	var decodes int
+	var events []*github.ReleaseEvent
+	record := func(ctx context.Context, event *github.ReleaseEvent) error {
+		events = append(events, event)
+		return nil
+	}
+
+	d := NewTypedDispatcher([]interface{}{&testReleaseFuncHandler{fn: record}}, testHookSecret,
+		WithActionHandler("release", "published", TypedEventHandler("release", record)),
+		WithDecoder(func(data []byte, v interface{}) error {
+			decodes++
+			return json.Unmarshal(data, v)
+		}),
+	)
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newPayloadRequest("release", "shared", []byte(`{"action":"published"}`), true))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+	}
+	if decodes != 1 {
+		t.Errorf("incorrect number of decodes: expected 1, actual %d", decodes)
+	}
+	if len(events) != 2 {
+		t.Fatalf("incorrect handler calls: expected 2, actual %d", len(events))
+	}
+	if events[0] != events[1] {
+		t.Error("handlers received different events, expected a shared event")
+	}
+}
+
+func TestClone(t *testing.T) {
+	event := &github.ReleaseEvent{
+		Action:  github.String("published"),
+		Release: &github.RepositoryRelease{TagName: github.String("v1.0.0")},
+	}
+
+	clone, err := Clone(event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clone.Release.TagName = github.String("v2.0.0")
+
+	if event.GetRelease().GetTagName() != "v1.0.0" {
+		t.Errorf("modifying the clone modified the original event: %q", event.GetRelease().GetTagName())
+	}
+	if clone.GetAction() != "published" {
+		t.Errorf("incorrect clone action: %q", clone.GetAction())
+	}
+
+	if clone, err := Clone[github.ReleaseEvent](nil); err != nil || clone != nil {
+		t.Errorf("expected nil clone of nil event, got %v, %v", clone, err)
+	}
+}
+
+type testReleaseFuncHandler struct {
+	fn func(ctx context.Context, event *github.ReleaseEvent) error
+}
+
+func (h *testReleaseFuncHandler) HandleRelease(ctx context.Context, event *github.ReleaseEvent) error {
+	return h.fn(ctx, event)
+}
+
+type testReleaseHandler struct {
+	Actions []string
+}
+
+func (h *testReleaseHandler) HandleRelease(ctx context.Context, event *github.ReleaseEvent) error {
+	h.Actions = append(h.Actions, event.GetAction())
+	return nil
+}
+
+type testWorkflowHandler struct {
+	JobCount int
+	RunCount int
+}
+
+func (h *testWorkflowHandler) HandleWorkflowJob(ctx context.Context, event *github.WorkflowJobEvent) error {
+	h.JobCount++
+	return nil
+}
+
+func (h *testWorkflowHandler) HandleWorkflowRun(ctx context.Context, event *github.WorkflowRunEvent) error {
+	h.RunCount++
+	return nil
+}
+
+type testCommentHandler struct {
+	Count int
+}
+
+func (h *testCommentHandler) HandleIssueComment(ctx context.Context, event *github.IssueCommentEvent) error {
+	h.Count++
+	return nil
+}
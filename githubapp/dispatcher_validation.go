@@ -0,0 +1,191 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// payloadLogBytes is the number of bytes of an invalid payload included in
+// log messages.
+const payloadLogBytes = 256
+
+// requiredPayloadFields lists the top-level fields that must be present in
+// payloads of common event types. Payloads of other event types are only
+// checked for valid JSON.
+var requiredPayloadFields = map[string][]string{
+	"check_run":                   {"action", "repository", "installation"},
+	"check_suite":                 {"action", "repository", "installation"},
+	"create":                      {"repository", "installation"},
+	"delete":                      {"repository", "installation"},
+	"installation":                {"action", "installation"},
+	"installation_repositories":   {"action", "installation"},
+	"issue_comment":               {"action", "repository", "installation"},
+	"issues":                      {"action", "repository", "installation"},
+	"pull_request":                {"action", "repository", "installation"},
+	"pull_request_review":         {"action", "repository", "installation"},
+	"pull_request_review_comment": {"action", "repository", "installation"},
+	"push":                        {"repository", "installation"},
+	"release":                     {"action", "repository", "installation"},
+	"status":                      {"repository", "installation"},
+	"workflow_job":                {"action", "repository", "installation"},
+	"workflow_run":                {"action", "repository", "installation"},
+}
+
+// WithPayloadValidation enables a structural check of webhook payloads before
+// they are dispatched. The dispatcher rejects payloads that are not JSON
+// objects and payloads of common event types that are missing required
+// top-level fields, like "action", "repository", or "installation". This
+// catches bodies that are truncated or modified by proxies before they reach
+// handlers.
+//
+// Payloads that fail the check are logged with the first bytes of the body
+// and passed to the error callback as a ValidationError, which the default
+// callback reports with a 400 Bad Request status.
+func WithPayloadValidation() DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.validateStructure = true
+	}
+}
+
+// WithEnforceAppID rejects deliveries that are not for the app with the given
+// ID. This protects against processing webhooks from a different app with the
+// wrong credentials if the webhook URL or secret is misconfigured.
+//
+// The dispatcher reads the app ID from the X-GitHub-Hook-Installation-Target-ID
+// header and from the installation.app_id or top-level app_id fields of the
+// payload. Deliveries fail validation if any of these IDs does not match or if
+// none are present, unless the event type is in exemptEvents. Rejected
+// deliveries are passed to the error callback as a ValidationError, which the
+// default callback reports with a 400 Bad Request status. The check runs after
+// signature validation.
+func WithEnforceAppID(appID int64, exemptEvents ...string) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.appID = appID
+		d.appIDExempt = make(map[string]bool)
+		for _, event := range exemptEvents {
+			d.appIDExempt[event] = true
+		}
+	}
+}
+
+// checkAppID returns an error if the delivery is not for the dispatcher's app.
+func (d *eventDispatcher) checkAppID(r *http.Request, eventType string, payload []byte) error {
+	if d.appIDExempt[eventType] {
+		return nil
+	}
+
+	var ids []int64
+	id, ok, err := headerAppID(r)
+	if err != nil {
+		return err
+	}
+	if ok {
+		ids = append(ids, id)
+	}
+	ids = append(ids, payloadAppIDs(payload)...)
+
+	if len(ids) == 0 {
+		return errors.Errorf("delivery does not contain an app ID")
+	}
+	for _, id := range ids {
+		if id != d.appID {
+			return errors.Errorf("delivery is for app %d, not app %d", id, d.appID)
+		}
+	}
+	return nil
+}
+
+// headerAppID returns the app ID from the webhook target headers. It returns
+// false if the headers are missing or the target is not an app.
+func headerAppID(r *http.Request) (int64, bool, error) {
+	if r.Header.Get(HookTargetTypeHeader) != "integration" {
+		return 0, false, nil
+	}
+	v := r.Header.Get(HookTargetIDHeader)
+	if v == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s header", HookTargetIDHeader)
+	}
+	return id, true, nil
+}
+
+// payloadAppIDs returns the app IDs in the installation.app_id and top-level
+// app_id fields of a payload, if they are present.
+func payloadAppIDs(payload []byte) []int64 {
+	var event struct {
+		AppID        int64 `json:"app_id"`
+		Installation struct {
+			AppID int64 `json:"app_id"`
+		} `json:"installation"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil
+	}
+
+	var ids []int64
+	if event.Installation.AppID != 0 {
+		ids = append(ids, event.Installation.AppID)
+	}
+	if event.AppID != 0 {
+		ids = append(ids, event.AppID)
+	}
+	return ids
+}
+
+// checkPayloadStructure returns an error if the payload is not a JSON object
+// or is missing a required field for the event type. It does not validate
+// the type or content of the fields.
+func checkPayloadStructure(eventType string, payload []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return errors.Wrap(err, "payload is not a valid JSON object")
+	}
+
+	var missing []string
+	for _, name := range requiredPayloadFields[eventType] {
+		if v, ok := fields[name]; !ok || string(v) == "null" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("payload is missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// rejectMalformedPayload logs a payload that failed the structure check and
+// passes the error to the error callback.
+func (d *eventDispatcher) rejectMalformedPayload(w http.ResponseWriter, r *http.Request, payload []byte, err error) {
+	prefix := payload
+	if len(prefix) > payloadLogBytes {
+		prefix = prefix[:payloadLogBytes]
+	}
+	LoggerFromContext(r.Context()).Warn("Received malformed webhook payload", "error", err, "payload_size", len(payload), "payload_prefix", string(prefix))
+
+	d.onError(w, r, ValidationError{
+		EventType:  d.eventType(r),
+		DeliveryID: d.deliveryID(r),
+		Cause:      err,
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+)
+
+// DryRunNodeID is the node ID of objects returned by helpers in dry-run
+// mode instead of objects created or modified on GitHub.
+const DryRunNodeID = "DRY_RUN"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context that enables or disables dry-run mode for the
+// mutation helpers in this package: CommitFiles, EnsureBranch,
+// CreatePullRequest, AddLabels, AssignUsers, RequestReviewers, UpsertComment,
+// CommentDeduper.Post, CreateCheckRun, UpdateCheckRun, UploadReleaseAsset, and
+// the helpers that resolve and dismiss security alerts. In the commands
+// package, AddReaction, AckCommand, and the usage replies of a Router also
+// respect the mode. Requests made directly with a client are not affected.
+//
+// In dry-run mode, the helpers still make requests that read data, like
+// finding the head of a branch or existing comments, but log the requests
+// that would modify data instead of making them. They return synthesized
+// results: objects from GitHub have DryRunNodeID as their node ID and zero
+// IDs, CommitResult has DryRun set, and alerts only have their number and new
+// state.
+//
+// To enable dry-run mode for all handlers, add it to each event's context
+// with WithContextDecorator. To override the mode for a single call, pass a
+// context from WithDryRun to that call.
+func WithDryRun(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, enabled)
+}
+
+// IsDryRun returns true if dry-run mode is enabled in the context.
+func IsDryRun(ctx context.Context) bool {
+	enabled, _ := ctx.Value(dryRunKey{}).(bool)
+	return enabled
+}
+
+// logDryRun logs a request that was skipped in dry-run mode.
+func logDryRun(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	LoggerFromContext(ctx).Info("Dry run: "+msg, keysAndValues...)
+}
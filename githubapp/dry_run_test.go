@@ -0,0 +1,165 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestDryRun(t *testing.T) {
+	tests := map[string]struct {
+		Call func(ctx context.Context, client *github.Client) (nodeID string, err error)
+	}{
+		"commitFiles": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				res, err := CommitFiles(ctx, client, CommitRequest{
+					Owner:   "octo",
+					Repo:    "repo",
+					Branch:  "feature",
+					Message: "Add file",
+					Files:   map[string][]byte{"README.md": []byte("hello")},
+				})
+				if !res.DryRun || !res.CreatedBranch {
+					t.Errorf("incorrect commit result: %+v", res)
+				}
+				return DryRunNodeID, err
+			},
+		},
+		"ensureBranch": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				created, err := EnsureBranch(ctx, client, "octo", "repo", "feature", "abc", false)
+				if !created {
+					t.Error("expected branch to be created")
+				}
+				return DryRunNodeID, err
+			},
+		},
+		"createPullRequest": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				pr, err := CreatePullRequest(ctx, client, PRRequest{
+					Owner:     "octo",
+					Repo:      "repo",
+					Title:     "Update",
+					Head:      "feature",
+					Files:     map[string][]byte{"README.md": []byte("hello")},
+					Labels:    []string{"bot"},
+					Reviewers: []string{"octocat"},
+				})
+				if pr.GetHead().GetRef() != "feature" || pr.GetBase().GetRef() != "main" {
+					t.Errorf("incorrect pull request branches: %s <- %s", pr.GetBase().GetRef(), pr.GetHead().GetRef())
+				}
+				return pr.GetNodeID(), err
+			},
+		},
+		"addLabels": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				res, err := AddLabels(ctx, client, "octo", "repo", 1, "bug", "bug")
+				if len(res.Succeeded) != 1 {
+					t.Errorf("incorrect labels: %v", res.Succeeded)
+				}
+				return DryRunNodeID, err
+			},
+		},
+		"assignUsers": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				res, err := AssignUsers(ctx, client, "octo", "repo", 1, "octocat")
+				if len(res.Succeeded) != 1 {
+					t.Errorf("incorrect assignees: %v", res.Succeeded)
+				}
+				return DryRunNodeID, err
+			},
+		},
+		"postComment": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				comment, result, err := CommentDeduper{}.Post(ctx, client, "octo", "repo", 1, "status", "Deploying")
+				if result != CommentCreated {
+					t.Errorf("incorrect comment result: %v", result)
+				}
+				return comment.GetNodeID(), err
+			},
+		},
+		"uploadReleaseAsset": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				asset, err := UploadReleaseAsset(ctx, client, "octo", "repo", 1, ReleaseAsset{
+					Name:    "app.tar.gz",
+					Content: strings.NewReader("release binary"),
+					Size:    14,
+				}, RetryConfig{})
+				if asset.GetName() != "app.tar.gz" || asset.GetSize() != 14 {
+					t.Errorf("incorrect release asset: %+v", asset)
+				}
+				return asset.GetNodeID(), err
+			},
+		},
+		"createCheckRun": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				run, err := CreateCheckRun(ctx, client, CheckRunRequest{
+					Owner:   "octo",
+					Repo:    "repo",
+					Name:    "lint",
+					HeadSHA: "abc",
+				})
+				return run.GetNodeID(), err
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cc := &MockClientCreator{}
+			cc.Respond("GET", "/repos/octo/repo", 0, `{"default_branch":"main"}`)
+			cc.Respond("GET", "/repos/octo/repo/git/ref/heads/main", 0, `{"object":{"sha":"abc"}}`)
+			cc.Respond("GET", "/repos/octo/repo/issues/1/comments", 0, `[]`)
+
+			client, err := cc.NewInstallationClient(1)
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			nodeID, err := test.Call(WithDryRun(context.Background(), true), client)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if nodeID != DryRunNodeID {
+				t.Errorf("incorrect node ID: expected %q, actual %q", DryRunNodeID, nodeID)
+			}
+			for _, req := range cc.Requests() {
+				if !strings.HasPrefix(req, http.MethodGet+" ") {
+					t.Errorf("unexpected mutating request in dry-run mode: %s", req)
+				}
+			}
+		})
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	ctx := context.Background()
+	if IsDryRun(ctx) {
+		t.Error("dry-run mode is enabled by default")
+	}
+
+	ctx = WithDryRun(ctx, true)
+	if !IsDryRun(ctx) {
+		t.Error("dry-run mode is not enabled")
+	}
+	if IsDryRun(WithDryRun(ctx, false)) {
+		t.Error("dry-run mode is not disabled by an override")
+	}
+}
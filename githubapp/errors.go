@@ -18,12 +18,14 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"strings"
 
 	"github.com/rcrowley/go-metrics"
 )
 
 const (
-	MetricsKeyHandlerError = "github.handler.error"
+	MetricsKeyHandlerError    = "github.handler.error"
+	MetricsKeyPayloadTooLarge = "github.event.too_large"
 )
 
 var (
@@ -44,6 +46,31 @@ func errorCounter(r metrics.Registry, event string) metrics.Counter {
 	return metrics.GetOrRegisterCounter(key, r)
 }
 
+func payloadTooLargeCounter(r metrics.Registry) metrics.Counter {
+	if r == nil {
+		return metrics.NilCounter{}
+	}
+	return metrics.GetOrRegisterCounter(MetricsKeyPayloadTooLarge, r)
+}
+
+// HandlerErrors is returned when more than one event handler for an event
+// fails. It is only returned when handlers run concurrently; see
+// WithConcurrentHandlers. Use errors.Is or errors.As to check the errors of
+// individual handlers.
+type HandlerErrors []error
+
+func (e HandlerErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d event handlers failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e HandlerErrors) Unwrap() []error {
+	return e
+}
+
 // HandlerPanicError is an error created from a recovered handler panic.
 type HandlerPanicError struct {
 	value interface{}
@@ -0,0 +1,106 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// eventTimestampFields lists, for each event type, the payload fields that
+// are set when GitHub generates the event. Fields are paths separated by
+// dots. If several fields are set, the most recent time is used.
+var eventTimestampFields = map[string][]string{
+	"check_run":                   {"check_run.started_at", "check_run.completed_at"},
+	"check_suite":                 {"check_suite.updated_at"},
+	"commit_comment":              {"comment.updated_at"},
+	"deployment":                  {"deployment.updated_at"},
+	"deployment_status":           {"deployment_status.updated_at"},
+	"issue_comment":               {"comment.updated_at"},
+	"issues":                      {"issue.updated_at"},
+	"pull_request":                {"pull_request.updated_at"},
+	"pull_request_review":         {"review.submitted_at"},
+	"pull_request_review_comment": {"comment.updated_at"},
+	"push":                        {"repository.pushed_at"},
+	"release":                     {"release.created_at", "release.published_at"},
+	"status":                      {"updated_at"},
+	"workflow_job":                {"workflow_job.created_at", "workflow_job.started_at", "workflow_job.completed_at"},
+	"workflow_run":                {"workflow_run.updated_at"},
+}
+
+// EventTimestamp returns the time when GitHub generated an event, using the
+// timestamps in the payload, like the update time of the comment in an
+// issue_comment event. GitHub does not send the time in a header, so the
+// result is an estimate that depends on the event type. It returns false if
+// the time is unknown, like for event types without a suitable timestamp or
+// events that delete the object that has the timestamp.
+func EventTimestamp(payload []byte, eventType string) (time.Time, bool) {
+	fields, ok := eventTimestampFields[eventType]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return time.Time{}, false
+	}
+
+	var action string
+	if raw, ok := event["action"]; ok {
+		_ = json.Unmarshal(raw, &action)
+	}
+	if action == "deleted" {
+		return time.Time{}, false
+	}
+
+	var latest time.Time
+	for _, field := range fields {
+		if t, ok := payloadTimestamp(event, strings.Split(field, ".")); ok && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// payloadTimestamp returns the timestamp at a path in a decoded payload. It
+// supports RFC 3339 strings and Unix timestamps, which GitHub uses for some
+// fields of push events.
+func payloadTimestamp(obj map[string]json.RawMessage, path []string) (time.Time, bool) {
+	raw, ok := obj[path[0]]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if len(path) > 1 {
+		var next map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &next); err != nil {
+			return time.Time{}, false
+		}
+		return payloadTimestamp(next, path[1:])
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil
+	}
+
+	var unix int64
+	if err := json.Unmarshal(raw, &unix); err == nil && unix > 0 {
+		return time.Unix(unix, 0), true
+	}
+	return time.Time{}, false
+}
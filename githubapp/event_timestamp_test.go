@@ -0,0 +1,77 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventTimestamp(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Payload   string
+
+		Time time.Time
+		OK   bool
+	}{
+		"issueComment": {
+			EventType: "issue_comment",
+			Payload:   `{"action":"edited","comment":{"created_at":"2023-05-01T10:00:00Z","updated_at":"2023-05-01T12:00:00Z"}}`,
+			Time:      time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+			OK:        true,
+		},
+		"pushUnixTime": {
+			EventType: "push",
+			Payload:   `{"repository":{"pushed_at":1682942400}}`,
+			Time:      time.Unix(1682942400, 0),
+			OK:        true,
+		},
+		"latestField": {
+			EventType: "workflow_job",
+			Payload:   `{"action":"completed","workflow_job":{"started_at":"2023-05-01T10:00:00Z","completed_at":"2023-05-01T10:05:00Z"}}`,
+			Time:      time.Date(2023, 5, 1, 10, 5, 0, 0, time.UTC),
+			OK:        true,
+		},
+		"missingField": {
+			EventType: "workflow_job",
+			Payload:   `{"action":"queued","workflow_job":{"completed_at":null}}`,
+		},
+		"deleted": {
+			EventType: "issue_comment",
+			Payload:   `{"action":"deleted","comment":{"updated_at":"2023-05-01T12:00:00Z"}}`,
+		},
+		"unknownEvent": {
+			EventType: "create",
+			Payload:   `{"ref":"main"}`,
+		},
+		"invalidPayload": {
+			EventType: "issues",
+			Payload:   `{"issue":`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ts, ok := EventTimestamp([]byte(test.Payload), test.EventType)
+			if ok != test.OK {
+				t.Fatalf("expected ok=%t, got %t", test.OK, ok)
+			}
+			if !ts.Equal(test.Time) {
+				t.Errorf("incorrect timestamp: expected %v, actual %v", test.Time, ts)
+			}
+		})
+	}
+}
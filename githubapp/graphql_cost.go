@@ -0,0 +1,121 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// GraphQLCost is the rate limit cost of a GraphQL query.
+type GraphQLCost struct {
+	// InstallationID is the installation that made the query, or 0 for app
+	// and token clients.
+	InstallationID int64
+
+	// Cost is the number of points the query used. It is only known if the
+	// query requested the rateLimit field. Otherwise, it is zero and only the
+	// values from the rate limit headers are set.
+	Cost      int
+	CostKnown bool
+
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// GraphQLCostHook is called with the cost of each GraphQL query.
+type GraphQLCostHook func(GraphQLCost)
+
+// WithGraphQLCostHook sets a function that is called after every GraphQL
+// query made by v4 clients. To know the exact cost of a query, include the
+// rateLimit field in the query:
+//
+//	rateLimit { cost limit remaining resetAt }
+//
+// For queries without this field, the hook receives the remaining budget from
+// the response headers. The hook is not called if a response contains neither.
+func WithGraphQLCostHook(hook GraphQLCostHook) ClientOption {
+	return func(c *clientCreator) {
+		c.graphQLCostHook = hook
+	}
+}
+
+// trackGraphQLCost returns the middleware that reports query costs, if a hook
+// is configured.
+func (c *clientCreator) trackGraphQLCost(installID int64) []ClientMiddleware {
+	if c.graphQLCostHook == nil {
+		return nil
+	}
+	return []ClientMiddleware{graphQLCost(installID, c.graphQLCostHook)}
+}
+
+func graphQLCost(installationID int64, hook GraphQLCostHook) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+			if err != nil || res == nil || res.StatusCode != http.StatusOK {
+				return res, err
+			}
+
+			cost := GraphQLCost{InstallationID: installationID}
+			limit, found := parseRateLimit(res.Header)
+			if found {
+				cost.Limit = limit.Limit
+				cost.Remaining = limit.Remaining
+				cost.ResetAt = limit.Reset
+			}
+
+			body, readErr := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			res.Body = io.NopCloser(bytes.NewReader(body))
+			if readErr != nil {
+				return res, readErr
+			}
+
+			var payload struct {
+				Data struct {
+					RateLimit *struct {
+						Cost      int       `json:"cost"`
+						Limit     int       `json:"limit"`
+						Remaining int       `json:"remaining"`
+						ResetAt   time.Time `json:"resetAt"`
+					} `json:"rateLimit"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &payload); err == nil && payload.Data.RateLimit != nil {
+				rl := payload.Data.RateLimit
+				found = true
+				cost.Cost = rl.Cost
+				cost.CostKnown = true
+				cost.Remaining = rl.Remaining
+				if rl.Limit > 0 {
+					cost.Limit = rl.Limit
+				}
+				if !rl.ResetAt.IsZero() {
+					cost.ResetAt = rl.ResetAt
+				}
+			}
+
+			if found {
+				hook(cost)
+			}
+			return res, nil
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQLCost(t *testing.T) {
+	resetAt := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		Status  int
+		Headers map[string]string
+		Body    string
+
+		Called   bool
+		Expected GraphQLCost
+	}{
+		"rateLimitField": {
+			Status: http.StatusOK,
+			Body:   `{"data":{"rateLimit":{"cost":12,"limit":5000,"remaining":4900,"resetAt":"2023-06-01T12:00:00Z"}}}`,
+			Called: true,
+			Expected: GraphQLCost{
+				InstallationID: 42,
+				Cost:           12,
+				CostKnown:      true,
+				Limit:          5000,
+				Remaining:      4900,
+				ResetAt:        resetAt,
+			},
+		},
+		"headersOnly": {
+			Status: http.StatusOK,
+			Headers: map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "4999",
+				"X-RateLimit-Reset":     "1685620800",
+			},
+			Body:   `{"data":{"viewer":{"login":"octocat"}}}`,
+			Called: true,
+			Expected: GraphQLCost{
+				InstallationID: 42,
+				Limit:          5000,
+				Remaining:      4999,
+				ResetAt:        time.Unix(1685620800, 0),
+			},
+		},
+		"noRateLimit": {
+			Status: http.StatusOK,
+			Body:   `{"data":{"viewer":{"login":"octocat"}}}`,
+		},
+		"invalidBody": {
+			Status: http.StatusOK,
+			Body:   `not json`,
+		},
+		"errorStatus": {
+			Status: http.StatusBadGateway,
+			Body:   `{"data":{"rateLimit":{"cost":1}}}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var called bool
+			var cost GraphQLCost
+			hook := func(c GraphQLCost) {
+				called, cost = true, c
+			}
+
+			next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				header := make(http.Header)
+				for k, v := range test.Headers {
+					header.Set(k, v)
+				}
+				return &http.Response{
+					StatusCode: test.Status,
+					Header:     header,
+					Body:       io.NopCloser(strings.NewReader(test.Body)),
+				}, nil
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+			res, err := graphQLCost(42, hook)(next).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if string(body) != test.Body {
+				t.Errorf("incorrect body: expected %q, actual %q", test.Body, string(body))
+			}
+
+			if called != test.Called {
+				t.Fatalf("incorrect called state: expected %t, actual %t", test.Called, called)
+			}
+			if !cost.ResetAt.Equal(test.Expected.ResetAt) {
+				t.Errorf("incorrect reset time: expected %v, actual %v", test.Expected.ResetAt, cost.ResetAt)
+			}
+			cost.ResetAt = test.Expected.ResetAt
+			if cost != test.Expected {
+				t.Errorf("incorrect cost:\nexpected: %+v\n  actual: %+v", test.Expected, cost)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthCacheDuration is how long HealthHandler caches a
+	// successful check.
+	DefaultHealthCacheDuration = 30 * time.Second
+)
+
+// HealthOption configures a handler created by HealthHandler.
+type HealthOption func(*healthHandler)
+
+// WithHealthCacheDuration sets how long a successful check is cached. Use
+// zero to check with GitHub on every request.
+func WithHealthCacheDuration(d time.Duration) HealthOption {
+	return func(h *healthHandler) {
+		h.cacheDuration = d
+	}
+}
+
+// HealthHandler returns an http.Handler for readiness probes that checks that
+// the app can authenticate with GitHub. On each request, it creates an app
+// client and calls the GET /app endpoint, responding with 200 OK if GitHub
+// accepts the app's credentials and 503 Service Unavailable otherwise.
+//
+// Successful checks are cached for DefaultHealthCacheDuration so that
+// frequent probes do not use the app's rate limit. Failed checks are not
+// cached, but only one check runs at a time.
+func HealthHandler(cc ClientCreator, opts ...HealthOption) http.Handler {
+	h := &healthHandler{
+		cc:            cc,
+		cacheDuration: DefaultHealthCacheDuration,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+type healthHandler struct {
+	cc            ClientCreator
+	cacheDuration time.Duration
+
+	mu        sync.Mutex
+	healthyAt time.Time
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cacheDuration > 0 && time.Since(h.healthyAt) < h.cacheDuration {
+		writeHealthy(w)
+		return
+	}
+
+	ctx := r.Context()
+	client, err := h.cc.NewAppClient()
+	if err == nil {
+		_, _, err = client.Apps.Get(ctx, "")
+	}
+	if err != nil {
+		LoggerFromContext(ctx).Error("GitHub app health check failed", "error", err)
+		http.Error(w, "GitHub app authentication failed", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.healthyAt = time.Now()
+	writeHealthy(w)
+}
+
+// LivenessHandler returns an http.Handler for liveness probes that always
+// responds with 200 OK. Unlike HealthHandler, it does not contact GitHub, so
+// GitHub outages do not cause the process to restart.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthy(w)
+	})
+}
+
+func writeHealthy(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := map[string]struct {
+		Status        int
+		CacheDuration time.Duration
+
+		ResponseCode int
+		AppRequests  int64
+	}{
+		"healthy": {
+			Status:        http.StatusOK,
+			CacheDuration: DefaultHealthCacheDuration,
+			ResponseCode:  http.StatusOK,
+			AppRequests:   1,
+		},
+		"healthyWithoutCache": {
+			Status:       http.StatusOK,
+			ResponseCode: http.StatusOK,
+			AppRequests:  2,
+		},
+		"badCredentials": {
+			Status:        http.StatusUnauthorized,
+			CacheDuration: DefaultHealthCacheDuration,
+			ResponseCode:  http.StatusServiceUnavailable,
+			AppRequests:   2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/app" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+					writeTestGitHubError(w, http.StatusNotFound, "Not Found")
+					return
+				}
+				atomic.AddInt64(&requests, 1)
+
+				if test.Status != http.StatusOK {
+					writeTestGitHubError(w, test.Status, "Bad credentials")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":1,"slug":"test-app"}`))
+			}))
+			defer srv.Close()
+
+			cc := NewClientCreator(srv.URL, srv.URL, 1, newTestPrivateKey(t))
+			h := HealthHandler(cc, WithHealthCacheDuration(test.CacheDuration))
+
+			for i := 0; i < 2; i++ {
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+				if res.Code != test.ResponseCode {
+					t.Errorf("incorrect response code: expected %d, actual %d", test.ResponseCode, res.Code)
+				}
+			}
+
+			if requests != test.AppRequests {
+				t.Errorf("incorrect number of requests to GitHub: expected %d, actual %d", test.AppRequests, requests)
+			}
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	res := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/live", nil))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+	}
+}
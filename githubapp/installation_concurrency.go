@@ -0,0 +1,112 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithPerInstallationConcurrency limits the number of requests in progress
+// at the same time for each installation to n, across all installation
+// clients created by the ClientCreator. Requests beyond the limit wait until
+// an earlier request for the same installation finishes or until the request
+// context is canceled. Requests for other installations are not affected.
+//
+// Limiting concurrency helps avoid secondary rate limits, which GitHub
+// applies to bursts of concurrent requests. A request holds its place while
+// it is retried and until the response body is closed. If n is not positive,
+// requests are not limited.
+func WithPerInstallationConcurrency(n int) ClientOption {
+	return func(c *clientCreator) {
+		if n > 0 {
+			c.concurrency = newInstallationLimiter(n)
+		} else {
+			c.concurrency = nil
+		}
+	}
+}
+
+// installationLimiter holds a semaphore for each installation.
+type installationLimiter struct {
+	n int
+
+	mu   sync.Mutex
+	sems map[int64]chan struct{}
+}
+
+func newInstallationLimiter(n int) *installationLimiter {
+	return &installationLimiter{
+		n:    n,
+		sems: make(map[int64]chan struct{}),
+	}
+}
+
+func (l *installationLimiter) semaphore(installationID int64) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.sems[installationID]
+	if !ok {
+		sem = make(chan struct{}, l.n)
+		l.sems[installationID] = sem
+	}
+	return sem
+}
+
+// middleware returns a ClientMiddleware that limits concurrent requests for
+// the installation.
+func (l *installationLimiter) middleware(installationID int64) ClientMiddleware {
+	sem := l.semaphore(installationID)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			select {
+			case sem <- struct{}{}:
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+
+			release := func() { <-sem }
+			res, err := next.RoundTrip(r)
+			if err != nil || res == nil || res.Body == nil {
+				release()
+				return res, err
+			}
+			res.Body = &releaseOnClose{ReadCloser: res.Body, release: release}
+			return res, nil
+		})
+	}
+}
+
+func (c *clientCreator) limitConcurrency(installID int64) []ClientMiddleware {
+	if c.concurrency == nil || installID == 0 {
+		return nil
+	}
+	return []ClientMiddleware{c.concurrency.middleware(installID)}
+}
+
+// releaseOnClose calls release the first time the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
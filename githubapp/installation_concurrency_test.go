@@ -0,0 +1,156 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPerInstallationConcurrency(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	repos := &testConcurrencyTransport{
+		active:    make(map[int64]int),
+		maxActive: make(map[int64]int),
+	}
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t),
+		WithTransport(repos),
+		WithPerInstallationConcurrency(2),
+	)
+
+	var wg sync.WaitGroup
+	for _, id := range []int64{1, 2} {
+		client, err := cc.NewInstallationClient(id)
+		if err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+					t.Errorf("unexpected error making request: %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, id := range []int64{1, 2} {
+		if repos.maxActive[id] != 2 {
+			t.Errorf("incorrect maximum concurrent requests for installation %d: expected 2, actual %d", id, repos.maxActive[id])
+		}
+	}
+
+	t.Run("contextCanceled", func(t *testing.T) {
+		client, err := cc.NewInstallationClient(3)
+		if err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+
+		release := make(chan struct{})
+		repos.setBlock(release)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, _ = client.Repositories.Get(context.Background(), "palantir", "go-githubapp")
+			}()
+		}
+		repos.waitForActive(t, 3, 2)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, _, err = client.Repositories.Get(ctx, "palantir", "go-githubapp")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded error, but got: %v", err)
+		}
+
+		close(release)
+		wg.Wait()
+	})
+}
+
+// testConcurrencyTransport responds to requests for repositories after a
+// short delay, tracking the number of concurrent requests by installation.
+// Other requests are sent to the default transport.
+type testConcurrencyTransport struct {
+	mu        sync.Mutex
+	active    map[int64]int
+	maxActive map[int64]int
+	block     chan struct{}
+}
+
+func (t *testConcurrencyTransport) setBlock(c chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.block = c
+}
+
+func (t *testConcurrencyTransport) waitForActive(tb testing.TB, id int64, n int) {
+	for i := 0; i < 100; i++ {
+		t.mu.Lock()
+		active := t.active[id]
+		t.mu.Unlock()
+		if active == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	tb.Fatalf("timed out waiting for %d active requests for installation %d", n, id)
+}
+
+func (t *testConcurrencyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path != "/repos/palantir/go-githubapp" {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+
+	var id, n int64
+	if _, err := fmt.Sscanf(r.Header.Get("Authorization"), "token token-%d-%d", &id, &n); err != nil {
+		return nil, fmt.Errorf("unexpected authorization: %q", r.Header.Get("Authorization"))
+	}
+
+	t.mu.Lock()
+	t.active[id]++
+	if t.active[id] > t.maxActive[id] {
+		t.maxActive[id] = t.active[id]
+	}
+	block := t.block
+	t.mu.Unlock()
+
+	if block != nil {
+		<-block
+	} else {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.mu.Lock()
+	t.active[id]--
+	t.mu.Unlock()
+
+	res := newTestResponse(r)
+	res.Header.Set("Content-Type", "application/json")
+	setTestResponseBody(res, `{"name":"go-githubapp"}`)
+	return res, nil
+}
@@ -0,0 +1,699 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	MetricsKeyTokenCacheHits   = "github.token_cache.hits"
+	MetricsKeyTokenCacheMisses = "github.token_cache.misses"
+	MetricsKeyTokenCacheMints  = "github.token_cache.mints"
+	MetricsKeyTokenCacheSize   = "github.token_cache.size"
+)
+
+const (
+	// tokenExpiryMargin is how long before expiration a token is considered
+	// expired and replaced when requested by a client.
+	tokenExpiryMargin = time.Minute
+
+	// tokenRefreshMargin is how long before expiration the background
+	// refresher replaces a token.
+	tokenRefreshMargin = 5 * time.Minute
+
+	// tokenSourceIdleTimeout is how long a token source is kept in the cache
+	// after it was last used. GitHub issues tokens that expire after an hour,
+	// so the token of an idle source has expired by the time it is removed.
+	tokenSourceIdleTimeout = time.Hour
+
+	// tokenSourceSweepInterval is the minimum time between checks for idle
+	// token sources.
+	tokenSourceSweepInterval = time.Minute
+
+	// defaultTokenRefreshInterval is the interval used by StartTokenRefresher
+	// when the requested interval is not positive.
+	defaultTokenRefreshInterval = time.Minute
+)
+
+var (
+	// ErrInstallationNotFound is returned when GitHub cannot create a token
+	// because the installation does not exist, usually because the app was
+	// uninstalled.
+	ErrInstallationNotFound = errors.New("installation not found")
+
+	// ErrInstallationSuspended is returned when GitHub cannot create a token
+	// because the installation is suspended.
+	ErrInstallationSuspended = errors.New("installation suspended")
+)
+
+// installationError wraps the GitHub response for a failed token request and
+// matches one of the installation error values.
+type installationError struct {
+	kind  error
+	cause *github.ErrorResponse
+}
+
+func (e *installationError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.cause)
+}
+
+func (e *installationError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *installationError) Unwrap() error {
+	return e.cause
+}
+
+func (e *installationError) RequestID() string {
+	return responseRequestID(e.cause.Response)
+}
+
+// classifyTokenError converts errors for missing or suspended installations
+// to errors that match ErrInstallationNotFound or ErrInstallationSuspended.
+func classifyTokenError(err error) error {
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Response == nil {
+		return err
+	}
+
+	switch {
+	case rerr.Response.StatusCode == http.StatusNotFound:
+		return &installationError{kind: ErrInstallationNotFound, cause: rerr}
+	case rerr.Response.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(rerr.Message), "suspended"):
+		return &installationError{kind: ErrInstallationSuspended, cause: rerr}
+	}
+	return err
+}
+
+// TokenEvent describes a request for an installation token.
+type TokenEvent struct {
+	InstallationID int64
+
+	// CacheHit is true if the token was returned from the cache and false if
+	// a new token was requested from GitHub.
+	CacheHit bool
+
+	// ExpiresAt is the expiration time of the returned token. It is the zero
+	// time if Err is non-nil.
+	ExpiresAt time.Time
+
+	// Err is the error from requesting a new token, if any.
+	Err error
+}
+
+// TokenHook is called for each token event.
+type TokenHook func(ev TokenEvent)
+
+// TokenCacheStats contains statistics about the installation token cache of a
+// ClientCreator.
+type TokenCacheStats struct {
+	// Hits is the number of token requests answered with a cached token.
+	Hits uint64
+
+	// Misses is the number of token requests that needed a new token because
+	// there was no cached token or the cached token was about to expire.
+	Misses uint64
+
+	// Mints is the number of tokens created, including tokens created by the
+	// token refresher.
+	Mints uint64
+
+	// Size is the number of installations and scopes with a cached token.
+	Size int
+}
+
+// installationToken is an installation access token and its expiration.
+type installationToken struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+func (t *installationToken) expiresWithin(d time.Duration) bool {
+	return t == nil || time.Now().Add(d).After(t.ExpiresAt)
+}
+
+// installationTokenSource creates and caches tokens for an installation. A
+// source is shared by all clients for the same installation and token scope
+// so that they reuse the same token.
+type installationTokenSource struct {
+	installationID int64
+	opts           *github.InstallationTokenOptions
+	client         *github.Client
+	hook           TokenHook
+	cache          *installationTokenCache
+	uncached       bool
+
+	// lastUsed is the time, in Unix nanoseconds, when the source was last
+	// returned from the cache or asked for a token
+	lastUsed atomic.Int64
+
+	mu     sync.Mutex
+	token  *installationToken
+	closed bool
+}
+
+// touch records that the source was used.
+func (s *installationTokenSource) touch(now time.Time) {
+	s.lastUsed.Store(now.UnixNano())
+}
+
+// idleSince returns true if the source was not used after t.
+func (s *installationTokenSource) idleSince(t time.Time) bool {
+	return s.lastUsed.Load() < t.UnixNano()
+}
+
+// Token returns a valid token for the installation, creating a new token if
+// there is no cached token or if the cached token is about to expire.
+func (s *installationTokenSource) Token(ctx context.Context) (string, error) {
+	token, err := s.installationToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.Value, nil
+}
+
+// installationToken is like Token, but also returns the token's expiration.
+func (s *installationTokenSource) installationToken(ctx context.Context) (installationToken, error) {
+	s.touch(time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return installationToken{}, errors.Errorf("token source for installation %d is closed", s.installationID)
+	}
+
+	if s.token.expiresWithin(tokenExpiryMargin) {
+		s.cache.record(&s.cache.misses, s.cache.missCounter, MetricsKeyTokenCacheMisses)
+
+		token, err := s.createToken(ctx)
+		if err != nil {
+			return installationToken{}, err
+		}
+		s.setToken(token)
+	} else {
+		s.cache.record(&s.cache.hits, s.cache.hitCounter, MetricsKeyTokenCacheHits)
+		s.notify(TokenEvent{InstallationID: s.installationID, CacheHit: true, ExpiresAt: s.token.ExpiresAt})
+	}
+	return *s.token, nil
+}
+
+// Refresh replaces the cached token if it expires within the margin. If
+// creating a new token fails, the existing token is kept.
+func (s *installationTokenSource) Refresh(ctx context.Context, margin time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.token.expiresWithin(margin) {
+		return nil
+	}
+
+	token, err := s.createToken(ctx)
+	if err != nil {
+		return err
+	}
+	s.setToken(token)
+	return nil
+}
+
+// setToken replaces the cached token. The caller must hold the lock.
+func (s *installationTokenSource) setToken(token *installationToken) {
+	if s.token == nil && !s.uncached {
+		s.cache.resize(1)
+	}
+	s.token = token
+}
+
+// clearToken removes the cached token if its value matches token. It returns
+// true if the token was removed.
+func (s *installationTokenSource) clearToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil || s.token.Value != token {
+		return false
+	}
+	s.token = nil
+	if !s.uncached {
+		s.cache.resize(-1)
+	}
+	return true
+}
+
+// release removes the source's token from the cache statistics after the
+// source is removed from the cache. The source continues to work for any
+// clients that still use it, but its tokens are no longer shared.
+func (s *installationTokenSource) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && !s.uncached {
+		s.cache.resize(-1)
+	}
+	s.uncached = true
+}
+
+// close prevents the source from creating new tokens and returns the cached
+// token, if any.
+func (s *installationTokenSource) close() *installationToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := s.token
+	if token != nil {
+		s.token = nil
+		if !s.uncached {
+			s.cache.resize(-1)
+		}
+	}
+	s.closed = true
+	return token
+}
+
+func (s *installationTokenSource) createToken(ctx context.Context) (*installationToken, error) {
+	token, _, err := s.client.Apps.CreateInstallationToken(ctx, s.installationID, s.opts)
+	if err != nil {
+		err = errors.Wrapf(classifyTokenError(err), "failed to create token for installation %d", s.installationID)
+		s.notify(TokenEvent{InstallationID: s.installationID, Err: err})
+		return nil, err
+	}
+
+	s.cache.record(&s.cache.mints, s.cache.mintCounter, MetricsKeyTokenCacheMints)
+
+	t := &installationToken{
+		Value:     token.GetToken(),
+		ExpiresAt: token.GetExpiresAt().Time,
+	}
+	s.notify(TokenEvent{InstallationID: s.installationID, ExpiresAt: t.ExpiresAt})
+	return t, nil
+}
+
+func (s *installationTokenSource) notify(ev TokenEvent) {
+	if s.hook != nil {
+		s.hook(ev)
+	}
+}
+
+// installationTokenCache stores token sources for a client creator. Sources
+// that are not used for longer than the idle timeout are removed, so the
+// cache only holds sources for recently active installations and scopes.
+type installationTokenCache struct {
+	mu          sync.Mutex
+	sources     map[string]*installationTokenSource
+	idleTimeout time.Duration
+	lastSweep   time.Time
+
+	hits   uint64
+	misses uint64
+	mints  uint64
+	size   int64
+
+	hitCounter  metrics.Counter
+	missCounter metrics.Counter
+	mintCounter metrics.Counter
+
+	sink Metrics
+}
+
+func newInstallationTokenCache() *installationTokenCache {
+	return &installationTokenCache{
+		sources:     make(map[string]*installationTokenSource),
+		idleTimeout: tokenSourceIdleTimeout,
+		hitCounter:  metrics.NilCounter{},
+		missCounter: metrics.NilCounter{},
+		mintCounter: metrics.NilCounter{},
+		sink:        NopMetrics{},
+	}
+}
+
+// record increments a statistic and its metrics.
+func (c *installationTokenCache) record(stat *uint64, counter metrics.Counter, name string) {
+	atomic.AddUint64(stat, 1)
+	counter.Inc(1)
+	c.sink.Counter(name, 1)
+}
+
+// resize changes the number of cached tokens and reports the new size.
+func (c *installationTokenCache) resize(delta int64) {
+	c.sink.Gauge(MetricsKeyTokenCacheSize, float64(atomic.AddInt64(&c.size, delta)))
+}
+
+func (c *installationTokenCache) stats() TokenCacheStats {
+	return TokenCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Mints:  atomic.LoadUint64(&c.mints),
+		Size:   int(atomic.LoadInt64(&c.size)),
+	}
+}
+
+// sweep removes sources that were not used within the idle timeout and
+// returns them so the caller can release them after unlocking the cache.
+// Sources are checked at most once per sweep interval. The caller must hold
+// the lock.
+func (c *installationTokenCache) sweep(now time.Time) []*installationTokenSource {
+	if now.Sub(c.lastSweep) < tokenSourceSweepInterval {
+		return nil
+	}
+	c.lastSweep = now
+
+	var idle []*installationTokenSource
+	for key, s := range c.sources {
+		if s.idleSince(now.Add(-c.idleTimeout)) {
+			delete(c.sources, key)
+			idle = append(idle, s)
+		}
+	}
+	return idle
+}
+
+// evict removes a token from the cache so that the next request for the
+// token's installation and scope creates a new token.
+func (c *installationTokenCache) evict(token string) {
+	c.mu.Lock()
+	sources := make([]*installationTokenSource, 0, len(c.sources))
+	for _, s := range c.sources {
+		sources = append(sources, s)
+	}
+	c.mu.Unlock()
+
+	// sources hold their lock while creating tokens, so do not hold the cache
+	// lock while checking them
+	for _, s := range sources {
+		if s.clearToken(token) {
+			return
+		}
+	}
+}
+
+func (c *installationTokenCache) registerMetrics(r metrics.Registry) {
+	c.hitCounter = metrics.GetOrRegisterCounter(MetricsKeyTokenCacheHits, r)
+	c.missCounter = metrics.GetOrRegisterCounter(MetricsKeyTokenCacheMisses, r)
+	c.mintCounter = metrics.GetOrRegisterCounter(MetricsKeyTokenCacheMints, r)
+	metrics.NewRegisteredFunctionalGauge(MetricsKeyTokenCacheSize, r, func() int64 {
+		return atomic.LoadInt64(&c.size)
+	})
+}
+
+// WithTokenCacheMetrics registers metrics for the installation token cache
+// in the registry. The metrics count cache hits, cache misses, and created
+// tokens and report the number of cached tokens. Use the TokenCacheStats
+// method of the ClientCreator to read the same values directly.
+func WithTokenCacheMetrics(r metrics.Registry) ClientOption {
+	return func(c *clientCreator) {
+		c.tokens.registerMetrics(r)
+	}
+}
+
+// WithoutTokenCache disables the installation token cache. Each installation
+// client, including scoped clients, creates a new token for its first request
+// and uses it until it is about to expire, and InstallationToken and
+// ScopedInstallationToken create a new token on every call. This limits the
+// usefulness of a leaked token to a single client, but every client costs an
+// extra request to GitHub, which adds latency and counts against the app's
+// rate limit. Do not combine this option with a caching ClientCreator, which
+// reuses clients and their tokens.
+//
+// Without the cache, PrewarmInstallation and StartTokenRefresher do nothing,
+// and RevokeInstallationToken revokes tokens without affecting other
+// clients. Clients that use a revoked token fail until they are recreated;
+// use NewSingleUseInstallationClient to revoke a client's token when it is no
+// longer needed. TokenCacheStats counts created tokens as misses and mints,
+// and always reports a size of zero.
+func WithoutTokenCache() ClientOption {
+	return func(c *clientCreator) {
+		c.disableTokenCache = true
+	}
+}
+
+func (c *clientCreator) TokenCacheStats() TokenCacheStats {
+	return c.tokens.stats()
+}
+
+// tokenSource returns the shared token source for the installation and scope.
+// A nil or empty scope requests tokens with the full access of the
+// installation. Sources are keyed by the installation ID and the exact scope,
+// so a token is never used for a request with a different scope, even if the
+// token's scope includes the requested scope.
+func (c *clientCreator) tokenSource(installationID int64, scope *ScopedTokenOptions) (*installationTokenSource, error) {
+	key := fmt.Sprintf("%d", installationID)
+
+	var opts *github.InstallationTokenOptions
+	if scope != nil && !scope.isEmpty() {
+		var err error
+		if opts, err = scope.toInstallationTokenOptions(); err != nil {
+			return nil, err
+		}
+		key = fmt.Sprintf("%s:%s", key, scope.cacheKey())
+	}
+
+	if c.disableTokenCache {
+		s, err := c.newTokenSource(installationID, opts, c.tokens)
+		if err != nil {
+			return nil, err
+		}
+		s.uncached = true
+		return s, nil
+	}
+
+	now := time.Now()
+
+	c.tokens.mu.Lock()
+	idle := c.tokens.sweep(now)
+	s, ok := c.tokens.sources[key]
+	if !ok {
+		var err error
+		if s, err = c.newTokenSource(installationID, opts, c.tokens); err != nil {
+			c.tokens.mu.Unlock()
+			return nil, err
+		}
+		c.tokens.sources[key] = s
+	}
+	s.touch(now)
+	c.tokens.mu.Unlock()
+
+	// sources hold their lock while creating tokens, so do not hold the cache
+	// lock while releasing them
+	for _, s := range idle {
+		s.release()
+	}
+	return s, nil
+}
+
+// newTokenSource returns a token source that records statistics in cache.
+func (c *clientCreator) newTokenSource(installationID int64, opts *github.InstallationTokenOptions, cache *installationTokenCache) (*installationTokenSource, error) {
+	client, err := c.tokenCreationClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &installationTokenSource{
+		installationID: installationID,
+		opts:           opts,
+		client:         client,
+		hook:           c.tokenHook,
+		cache:          cache,
+	}, nil
+}
+
+// tokenCreationClient returns the client shared by all token sources to
+// create installation tokens.
+func (c *clientCreator) tokenCreationClient() (*github.Client, error) {
+	c.tokenClientMu.Lock()
+	defer c.tokenClientMu.Unlock()
+
+	if c.tokenClient != nil {
+		return c.tokenClient, nil
+	}
+
+	client, err := c.newTokenCreationClient()
+	if err != nil {
+		return nil, err
+	}
+	c.tokenClient = client
+	return client, nil
+}
+
+// newTokenCreationClient returns a client that authenticates as the
+// application and is used to create installation tokens.
+func (c *clientCreator) newTokenCreationClient() (*github.Client, error) {
+	base := c.newHTTPClient()
+
+	atr, err := c.newAppsTransport(base.Transport)
+	if err != nil {
+		return nil, err
+	}
+	base.Transport = atr
+
+	baseURL, err := url.Parse(c.v3BaseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse base URL: %q", c.v3BaseURL)
+	}
+
+	client := github.NewClient(base)
+	client.BaseURL = baseURL
+	client.UserAgent = c.makeUserAgent("application")
+	return client, nil
+}
+
+// installationAuth returns middleware that authenticates requests with tokens
+// from the source.
+//
+// If GitHub rejects a token that the source considered valid, like when the
+// token expires early or the clocks of GitHub and this server differ, the
+// middleware removes the token from the cache and retries the request once
+// with a new token. Requests with bodies that cannot be replayed are not
+// retried.
+func installationAuth(source *installationTokenSource) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			token, err := source.Token(r.Context())
+			if err != nil {
+				closeRequestBody(r)
+				return nil, err
+			}
+
+			res, err := next.RoundTrip(withInstallationToken(r, token))
+			if err != nil || res.StatusCode != http.StatusUnauthorized || !canRewindBody(r) {
+				return res, err
+			}
+
+			// another request may have already replaced the token, in which
+			// case the cached token is used for the retry
+			source.clearToken(token)
+
+			retry, err := rewindRequest(r)
+			if err != nil {
+				return res, nil
+			}
+			if token, err = source.Token(r.Context()); err != nil {
+				closeRequestBody(retry)
+				return res, nil
+			}
+
+			LoggerFromContext(r.Context()).Debug("Retrying request with a new installation token after authentication failed", "installation_id", source.installationID)
+			closeBody(res.Body)
+			return next.RoundTrip(withInstallationToken(retry, token))
+		})
+	}
+}
+
+// withInstallationToken returns a copy of the request that authenticates with
+// the token. Per the RoundTripper contract, the original request is not
+// modified.
+func withInstallationToken(r *http.Request, token string) *http.Request {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "token "+token)
+	if r.Header.Get("Accept") == "" {
+		r.Header.Set("Accept", "application/vnd.github.v3+json")
+	}
+	return r
+}
+
+func (c *clientCreator) InstallationToken(ctx context.Context, installationID int64) (string, time.Time, error) {
+	return c.installationToken(ctx, installationID, nil)
+}
+
+func (c *clientCreator) ScopedInstallationToken(ctx context.Context, installationID int64, opts ScopedTokenOptions) (string, time.Time, error) {
+	return c.installationToken(ctx, installationID, &opts)
+}
+
+func (c *clientCreator) installationToken(ctx context.Context, installationID int64, scope *ScopedTokenOptions) (string, time.Time, error) {
+	source, err := c.tokenSource(installationID, scope)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := source.installationToken(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token.Value, token.ExpiresAt, nil
+}
+
+func (c *clientCreator) PrewarmInstallation(ctx context.Context, installationID int64) error {
+	if c.disableTokenCache {
+		return nil
+	}
+
+	source, err := c.tokenSource(installationID, nil)
+	if err != nil {
+		return err
+	}
+	_, err = source.Token(ctx)
+	return err
+}
+
+func (c *clientCreator) StartTokenRefresher(ctx context.Context, installationIDs []int64, interval time.Duration) {
+	if c.disableTokenCache {
+		return
+	}
+	if interval <= 0 {
+		LoggerFromContext(ctx).Warn("Token refresher interval is not positive, using the default", "interval", interval.String(), "default", defaultTokenRefreshInterval.String())
+		interval = defaultTokenRefreshInterval
+	}
+
+	ids := append([]int64(nil), installationIDs...)
+
+	refresh := func() {
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+
+			source, err := c.tokenSource(id, nil)
+			if err == nil {
+				err = source.Refresh(ctx, tokenRefreshMargin)
+			}
+			if err != nil {
+				LoggerFromContext(ctx).Warn("Failed to refresh installation token", "error", err, FieldNamesFromContext(ctx).InstallationID, id)
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		refresh()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+}
+
+func closeRequestBody(r *http.Request) {
+	if r.Body != nil {
+		closeBody(r.Body)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func (c *clientCreator) RevokeInstallationToken(ctx context.Context, token string) error {
+	// evict the token first so that it is not used while it is revoked, even
+	// if revocation fails
+	c.tokens.evict(token)
+
+	client, err := c.NewTokenClient(token)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Apps.RevokeInstallationToken(ctx); err != nil {
+		return errors.Wrap(err, "failed to revoke installation token")
+	}
+	return nil
+}
+
+func (c *clientCreator) NewSingleUseInstallationClient(ctx context.Context, installationID int64) (*SingleUseClient, error) {
+	// the source is not added to the shared cache and uses a separate cache
+	// for statistics, so its token is never returned to other clients
+	source, err := c.newTokenSource(installationID, nil, newInstallationTokenCache())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := source.Token(ctx); err != nil {
+		return nil, err
+	}
+
+	client, err := c.newSourceClient(source, fmt.Sprintf("installation: %d, single-use", installationID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SingleUseClient{
+		Client: client,
+		close: func(ctx context.Context) error {
+			if token := source.close(); token != nil {
+				return c.RevokeInstallationToken(ctx, token.Value)
+			}
+			return nil
+		},
+		logger: LoggerFromContext(ctx).With(FieldNamesFromContext(ctx).InstallationID, installationID),
+	}, nil
+}
+
+// SingleUseClient is an installation client with a token that is not shared
+// with other clients. Call Close when the client is no longer needed to
+// revoke the token.
+type SingleUseClient struct {
+	*github.Client
+
+	close  func(context.Context) error
+	logger Logger
+
+	once sync.Once
+	err  error
+}
+
+// Close revokes the client's token. After Close returns, requests made with
+// the client fail without contacting GitHub. Revocation failures are logged
+// and returned, but the client is closed even if revocation fails. Calling
+// Close more than once returns the result of the first call.
+func (c *SingleUseClient) Close() error {
+	return c.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but uses ctx for the revocation request.
+func (c *SingleUseClient) CloseContext(ctx context.Context) error {
+	c.once.Do(func() {
+		if c.err = c.close(ctx); c.err != nil {
+			c.logger.Warn("Failed to revoke single-use installation token", "error", c.err)
+		}
+	})
+	return c.err
+}
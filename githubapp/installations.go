@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/pkg/errors"
@@ -36,9 +37,24 @@ type InstallationSource interface {
 }
 
 // GetInstallationIDFromEvent returns the installation ID from a GitHub webhook
-// event payload.
+// event payload. It returns 0 if the payload does not contain an installation,
+// which is never a valid installation ID. Use LookupInstallationID to check
+// for this case explicitly.
 func GetInstallationIDFromEvent(event InstallationSource) int64 {
-	return event.GetInstallation().GetID()
+	id, _ := LookupInstallationID(event)
+	return id
+}
+
+// LookupInstallationID returns the installation ID from a GitHub webhook event
+// payload and true, or 0 and false if the payload does not contain an
+// installation. Events sent to a GitHub app contain an installation, but
+// events from repository or organization webhooks do not.
+func LookupInstallationID(event InstallationSource) (int64, bool) {
+	if event == nil {
+		return 0, false
+	}
+	id := event.GetInstallation().GetID()
+	return id, id > 0
 }
 
 // InstallationsService retrieves installation information for a given app.
@@ -86,26 +102,58 @@ func isNotFound(err error) bool {
 }
 
 func (i defaultInstallationsService) ListAll(ctx context.Context) ([]Installation, error) {
-	opt := github.ListOptions{
-		PerPage: 100,
+	var allInstallations []Installation
+	err := EachInstallation(ctx, i.Client, func(inst *github.Installation) error {
+		allInstallations = append(allInstallations, toInstallation(inst))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return allInstallations, nil
+}
 
-	var allInstallations []Installation
-	for {
-		installations, res, err := i.Apps.ListInstallations(ctx, &opt)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to list installations")
-		}
-		for _, inst := range installations {
-			allInstallations = append(allInstallations, toInstallation(inst))
-		}
-		if res.NextPage == 0 {
-			break
-		}
-		opt.Page = res.NextPage
+// ListInstallations returns all installations of the app, following
+// pagination. The client must authenticate as the app. See EachInstallation
+// for details about rate limits.
+func ListInstallations(ctx context.Context, appClient *github.Client) ([]*github.Installation, error) {
+	var installations []*github.Installation
+	err := EachInstallation(ctx, appClient, func(inst *github.Installation) error {
+		installations = append(installations, inst)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return installations, nil
+}
 
-	return allInstallations, nil
+// EachInstallation calls fn for each installation of the app, requesting
+// pages of installations as needed. The client must authenticate as the app.
+// If fn returns an error, iteration stops and EachInstallation returns the
+// error unmodified.
+//
+// If the app exhausts its rate limit while listing installations,
+// EachInstallation waits until the limit resets before requesting the next
+// page. It returns early with the context's error if ctx is canceled while
+// waiting.
+func EachInstallation(ctx context.Context, appClient *github.Client, fn func(*github.Installation) error) error {
+	opt := github.ListOptions{PerPage: defaultPerPage}
+
+	// wait only when the app's rate limit is exhausted
+	return Paginate(ctx, PaginationConfig{MinRemaining: -1}, func(ctx context.Context, page int) ([]*github.Installation, *github.Response, error) {
+		opt.Page = page
+		installations, res, err := appClient.Apps.ListInstallations(ctx, &opt)
+		return installations, res, errors.Wrap(err, "failed to list installations")
+	}, fn)
+}
+
+// waitForReset blocks until the reset time of rate or until ctx is canceled.
+func waitForReset(ctx context.Context, rate github.Rate) error {
+	if d := time.Until(rate.Reset.Time); d > 0 {
+		return sleepContext(ctx, d)
+	}
+	return nil
 }
 
 func (i defaultInstallationsService) GetByOwner(ctx context.Context, owner string) (Installation, error) {
@@ -0,0 +1,133 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// DefaultInstallationCacheExpiry is how long FindRepositoryInstallation
+	// and FindOrganizationInstallation cache installation IDs.
+	DefaultInstallationCacheExpiry = 10 * time.Minute
+
+	installationIDCacheSize = 1000
+)
+
+// FindRepositoryInstallation returns the ID of the app's installation that
+// includes the repository owner/repo, for use when the repository comes from
+// a source other than a webhook, like a scheduled job or an admin command.
+// The client must authenticate as the app. If the app is not installed on the
+// repository, it returns an InstallationNotFound error.
+//
+// If the client was created by ClientCreator.NewAppClient, found IDs are
+// cached by the client creator for DefaultInstallationCacheExpiry, so a
+// changed installation is used after the cached value expires. Other clients
+// look up the installation on every call.
+func FindRepositoryInstallation(ctx context.Context, appClient *github.Client, owner, repo string) (int64, error) {
+	key := strings.ToLower(fmt.Sprintf("repo:%s/%s", owner, repo))
+	return findInstallationID(appClient, key, func() (Installation, error) {
+		return NewInstallationsService(appClient).GetByRepository(ctx, owner, repo)
+	})
+}
+
+// FindOrganizationInstallation returns the ID of the app's installation on
+// the organization or user owner. The client must authenticate as the app. If
+// the app is not installed for the owner, it returns an InstallationNotFound
+// error. Found IDs are cached like with FindRepositoryInstallation.
+func FindOrganizationInstallation(ctx context.Context, appClient *github.Client, owner string) (int64, error) {
+	key := strings.ToLower(fmt.Sprintf("owner:%s", owner))
+	return findInstallationID(appClient, key, func() (Installation, error) {
+		return NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	})
+}
+
+func findInstallationID(appClient *github.Client, key string, find func() (Installation, error)) (int64, error) {
+	var cache *installationIDCache
+	if t, ok := appClient.Client().Transport.(*appTransport); ok {
+		cache = t.installationIDs
+	}
+
+	if id, ok := cache.get(key); ok {
+		return id, nil
+	}
+
+	installation, err := find()
+	if err != nil {
+		return 0, err
+	}
+
+	cache.set(key, installation.ID)
+	return installation.ID, nil
+}
+
+// appTransport marks the transport of clients created by NewAppClient so
+// that installation lookups can find the cache of the client creator that
+// owns the app.
+type appTransport struct {
+	http.RoundTripper
+	installationIDs *installationIDCache
+}
+
+// installationIDCache is a bounded cache of installation IDs for a single
+// app. A nil cache never stores values.
+type installationIDCache struct {
+	entries *lru.Cache
+	expiry  time.Duration
+}
+
+type installationIDEntry struct {
+	id      int64
+	expires time.Time
+}
+
+func newInstallationIDCache() *installationIDCache {
+	// lru.New only returns an error for a non-positive size
+	entries, _ := lru.New(installationIDCacheSize)
+	return &installationIDCache{
+		entries: entries,
+		expiry:  DefaultInstallationCacheExpiry,
+	}
+}
+
+func (c *installationIDCache) get(key string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	v, ok := c.entries.Get(key)
+	if !ok {
+		return 0, false
+	}
+	entry := v.(installationIDEntry)
+	if time.Now().After(entry.expires) {
+		c.entries.Remove(key)
+		return 0, false
+	}
+	return entry.id, true
+}
+
+func (c *installationIDCache) set(key string, id int64) {
+	if c == nil {
+		return
+	}
+	c.entries.Add(key, installationIDEntry{id: id, expires: time.Now().Add(c.expiry)})
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// SuspendedInstallations tracks suspended installations using the suspend
+// and unsuspend actions of installation events. Register it with a
+// dispatcher, as an EventHandler or a typed handler, and use
+// IsInstallationSuspended in other handlers to skip work for installations
+// that cannot create tokens. Installation clients for suspended
+// installations fail with errors that match ErrInstallationSuspended.
+//
+// Installations are removed from the set when they are unsuspended, created,
+// or deleted. The set is kept in memory, so it is empty after a restart and
+// is not shared between instances of an app.
+//
+// The zero value is ready to use and a SuspendedInstallations is safe for
+// concurrent use.
+type SuspendedInstallations struct {
+	// OnSuspend, if set, is called after an installation is suspended.
+	OnSuspend func(ctx context.Context, event *github.InstallationEvent) error
+
+	// OnUnsuspend, if set, is called after an installation is unsuspended.
+	OnUnsuspend func(ctx context.Context, event *github.InstallationEvent) error
+
+	mu  sync.RWMutex
+	ids map[int64]bool
+}
+
+var (
+	_ EventHandler        = &SuspendedInstallations{}
+	_ InstallationHandler = &SuspendedInstallations{}
+)
+
+// IsInstallationSuspended returns true if the last installation event for
+// the installation suspended it.
+func (s *SuspendedInstallations) IsInstallationSuspended(installationID int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ids[installationID]
+}
+
+// Suspended returns the IDs of the suspended installations, in no
+// particular order.
+func (s *SuspendedInstallations) Suspended() []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int64, 0, len(s.ids))
+	for id := range s.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *SuspendedInstallations) Handles() []string {
+	return []string{"installation"}
+}
+
+func (s *SuspendedInstallations) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.InstallationEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse installation event payload")
+	}
+	return s.HandleInstallation(ctx, &event)
+}
+
+func (s *SuspendedInstallations) HandleInstallation(ctx context.Context, event *github.InstallationEvent) error {
+	id := event.GetInstallation().GetID()
+	if id == 0 {
+		return nil
+	}
+
+	switch event.GetAction() {
+	case "suspend":
+		s.set(id, true)
+		if s.OnSuspend != nil {
+			return s.OnSuspend(ctx, event)
+		}
+	case "unsuspend":
+		s.set(id, false)
+		if s.OnUnsuspend != nil {
+			return s.OnUnsuspend(ctx, event)
+		}
+	case "created", "deleted":
+		s.set(id, false)
+	}
+	return nil
+}
+
+func (s *SuspendedInstallations) set(installationID int64, suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !suspended {
+		delete(s.ids, installationID)
+		return
+	}
+	if s.ids == nil {
+		s.ids = make(map[int64]bool)
+	}
+	s.ids[installationID] = true
+}
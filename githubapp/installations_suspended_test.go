@@ -0,0 +1,109 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestSuspendedInstallations(t *testing.T) {
+	tests := map[string]struct {
+		Actions []string
+
+		Suspended bool
+		Suspends  int
+		Resumes   int
+	}{
+		"suspend": {
+			Actions:   []string{"suspend"},
+			Suspended: true,
+			Suspends:  1,
+		},
+		"unsuspend": {
+			Actions:  []string{"suspend", "unsuspend"},
+			Suspends: 1,
+			Resumes:  1,
+		},
+		"deleted": {
+			Actions:  []string{"suspend", "deleted"},
+			Suspends: 1,
+		},
+		"otherActions": {
+			Actions:   []string{"suspend", "new_permissions_accepted"},
+			Suspended: true,
+			Suspends:  1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var suspends, resumes int
+			s := &SuspendedInstallations{
+				OnSuspend: func(ctx context.Context, event *github.InstallationEvent) error {
+					suspends++
+					return nil
+				},
+				OnUnsuspend: func(ctx context.Context, event *github.InstallationEvent) error {
+					resumes++
+					return nil
+				},
+			}
+			d := NewTypedDispatcher([]interface{}{s}, testHookSecret)
+
+			for i, action := range test.Actions {
+				body := []byte(fmt.Sprintf(`{"action":%q,"installation":{"id":42}}`, action))
+				res := httptest.NewRecorder()
+				d.ServeHTTP(res, newPayloadRequest("installation", fmt.Sprintf("%s-%d", name, i), body, true))
+				if res.Code != http.StatusOK {
+					t.Fatalf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+				}
+			}
+
+			if suspended := s.IsInstallationSuspended(42); suspended != test.Suspended {
+				t.Errorf("expected suspended=%t, got %t", test.Suspended, suspended)
+			}
+			if s.IsInstallationSuspended(43) {
+				t.Error("unrelated installation is suspended")
+			}
+			if n := len(s.Suspended()); (n == 1) != test.Suspended {
+				t.Errorf("incorrect number of suspended installations: %d", n)
+			}
+			if suspends != test.Suspends || resumes != test.Resumes {
+				t.Errorf("incorrect callback counts: expected %d suspends and %d resumes, got %d and %d", test.Suspends, test.Resumes, suspends, resumes)
+			}
+		})
+	}
+
+	t.Run("rawHandler", func(t *testing.T) {
+		var s SuspendedInstallations
+		d := NewEventDispatcher([]EventHandler{&s}, testHookSecret)
+
+		body := []byte(`{"action":"suspend","installation":{"id":42}}`)
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newPayloadRequest("installation", "raw", body, true))
+		if res.Code != http.StatusOK {
+			t.Fatalf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+		}
+		if !s.IsInstallationSuspended(42) {
+			t.Error("installation is not suspended")
+		}
+	})
+}
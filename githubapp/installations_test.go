@@ -0,0 +1,401 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestLookupInstallationID(t *testing.T) {
+	tests := map[string]struct {
+		EventType string
+		Payload   string
+
+		ID    int64
+		Found bool
+	}{
+		"push": {
+			EventType: "push",
+			Payload:   `{"ref":"refs/heads/main","installation":{"id":1}}`,
+			ID:        1,
+			Found:     true,
+		},
+		"pullRequest": {
+			EventType: "pull_request",
+			Payload:   `{"action":"opened","number":2,"installation":{"id":2}}`,
+			ID:        2,
+			Found:     true,
+		},
+		"issueComment": {
+			EventType: "issue_comment",
+			Payload:   `{"action":"created","installation":{"id":3}}`,
+			ID:        3,
+			Found:     true,
+		},
+		"installation": {
+			EventType: "installation",
+			Payload:   `{"action":"created","installation":{"id":4,"account":{"login":"octocat"}},"repositories":[]}`,
+			ID:        4,
+			Found:     true,
+		},
+		"installationRepositories": {
+			EventType: "installation_repositories",
+			Payload:   `{"action":"added","installation":{"id":5},"repository_selection":"selected"}`,
+			ID:        5,
+			Found:     true,
+		},
+		"organization": {
+			EventType: "organization",
+			Payload:   `{"action":"member_added","installation":{"id":6}}`,
+			ID:        6,
+			Found:     true,
+		},
+		"organizationWithoutInstallation": {
+			EventType: "organization",
+			Payload:   `{"action":"member_added"}`,
+		},
+		"pushWithoutInstallation": {
+			EventType: "push",
+			Payload:   `{"ref":"refs/heads/main"}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			event, err := github.ParseWebHook(test.EventType, []byte(test.Payload))
+			if err != nil {
+				t.Fatalf("failed to parse event: %v", err)
+			}
+
+			source, ok := event.(InstallationSource)
+			if !ok {
+				t.Fatalf("event type %T does not implement InstallationSource", event)
+			}
+
+			id, found := LookupInstallationID(source)
+			if id != test.ID || found != test.Found {
+				t.Errorf("incorrect installation: expected (%d, %t), actual (%d, %t)", test.ID, test.Found, id, found)
+			}
+			if id := GetInstallationIDFromEvent(source); id != test.ID {
+				t.Errorf("incorrect installation ID: expected %d, actual %d", test.ID, id)
+			}
+		})
+	}
+
+	t.Run("nilEvent", func(t *testing.T) {
+		var event *github.PushEvent
+		if id, found := LookupInstallationID(event); id != 0 || found {
+			t.Errorf("incorrect installation: expected (0, false), actual (%d, %t)", id, found)
+		}
+		if id, found := LookupInstallationID(nil); id != 0 || found {
+			t.Errorf("incorrect installation: expected (0, false), actual (%d, %t)", id, found)
+		}
+	})
+}
+
+func TestEachInstallation(t *testing.T) {
+	tests := map[string]struct {
+		Installations int
+		StopAfter     int
+		RateLimited   bool
+
+		Visited  int
+		Requests int32
+		Err      bool
+	}{
+		"singlePage": {
+			Installations: 3,
+			Visited:       3,
+			Requests:      1,
+		},
+		"multiplePages": {
+			Installations: 250,
+			Visited:       250,
+			Requests:      3,
+		},
+		"empty": {
+			Requests: 1,
+		},
+		"stopsOnError": {
+			Installations: 250,
+			StopAfter:     120,
+			Visited:       120,
+			Requests:      2,
+			Err:           true,
+		},
+		"retriesRateLimitedPage": {
+			Installations: 150,
+			RateLimited:   true,
+			Visited:       150,
+			Requests:      3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, requests := newTestInstallationServer(t, test.Installations, test.RateLimited)
+
+			var visited int
+			err := EachInstallation(context.Background(), srv, func(inst *github.Installation) error {
+				visited++
+				if inst.GetID() != int64(visited) {
+					t.Errorf("incorrect installation order: expected %d, actual %d", visited, inst.GetID())
+				}
+				if visited == test.StopAfter {
+					return fmt.Errorf("stop")
+				}
+				return nil
+			})
+
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if visited != test.Visited {
+				t.Errorf("incorrect visited count: expected %d, actual %d", test.Visited, visited)
+			}
+			if n := atomic.LoadInt32(requests); n != test.Requests {
+				t.Errorf("incorrect request count: expected %d, actual %d", test.Requests, n)
+			}
+		})
+	}
+}
+
+func TestListInstallations(t *testing.T) {
+	client, _ := newTestInstallationServer(t, 201, false)
+
+	installations, err := ListInstallations(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(installations) != 201 {
+		t.Fatalf("incorrect installation count: expected 201, actual %d", len(installations))
+	}
+	if installations[200].GetAccount().GetLogin() != "owner-201" {
+		t.Errorf("incorrect last installation owner: %q", installations[200].GetAccount().GetLogin())
+	}
+
+	all, err := NewInstallationsService(client).ListAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 201 {
+		t.Errorf("incorrect ListAll count: expected 201, actual %d", len(all))
+	}
+}
+
+// newTestInstallationServer returns a client for a server that lists n
+// installations with sequential IDs. If rateLimited is true, the first
+// request for the second page fails with a rate limit error that has
+// already reset.
+func newTestInstallationServer(t *testing.T, n int, rateLimited bool) (*github.Client, *int32) {
+	var requests int32
+	var limited int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/app/installations" {
+			http.NotFound(w, r)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+
+		if rateLimited && page == 2 && atomic.CompareAndSwapInt32(&limited, 0, 1) {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+
+		start := (page - 1) * perPage
+		end := start + perPage
+		if end >= n {
+			end = n
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/app/installations?page=%d&per_page=%d>; rel="next"`, "http://"+r.Host, page+1, perPage))
+		}
+
+		fmt.Fprint(w, "[")
+		for i := start; i < end; i++ {
+			if i > start {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":%d,"account":{"login":"owner-%d","id":%d}}`, i+1, i+1, i+1)
+		}
+		fmt.Fprint(w, "]")
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client, &requests
+}
+
+func TestFindInstallation(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/repos/palantir/go-githubapp/installation", "/orgs/palantir/installation":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":1234,"app_id":1,"account":{"login":"palantir"}}`))
+		case "/users/octocat/installation":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":5678,"app_id":1,"account":{"login":"octocat"}}`))
+		default:
+			writeTestGitHubError(w, http.StatusNotFound, "Not Found")
+		}
+	}))
+	defer srv.Close()
+
+	cc := NewClientCreator(srv.URL, srv.URL, 1, newTestPrivateKey(t))
+	client, err := cc.NewAppClient()
+	if err != nil {
+		t.Fatalf("failed to create app client: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		Find func() (int64, error)
+
+		ID       int64
+		NotFound bool
+		Requests int32
+	}{
+		"repository": {
+			Find:     func() (int64, error) { return FindRepositoryInstallation(ctx, client, "palantir", "go-githubapp") },
+			ID:       1234,
+			Requests: 1,
+		},
+		"organization": {
+			Find:     func() (int64, error) { return FindOrganizationInstallation(ctx, client, "palantir") },
+			ID:       1234,
+			Requests: 1,
+		},
+		"user": {
+			Find:     func() (int64, error) { return FindOrganizationInstallation(ctx, client, "octocat") },
+			ID:       5678,
+			Requests: 2,
+		},
+		"repositoryNotFound": {
+			Find:     func() (int64, error) { return FindRepositoryInstallation(ctx, client, "palantir", "missing") },
+			NotFound: true,
+			Requests: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+
+			// the second call uses the cache if the first call succeeds
+			for i := 0; i < 2; i++ {
+				id, err := test.Find()
+				if test.NotFound {
+					if _, ok := err.(InstallationNotFound); !ok {
+						t.Fatalf("expected InstallationNotFound error, but got: %v", err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertField(t, "installation ID", test.ID, id)
+			}
+
+			if n := atomic.LoadInt32(&requests); n != test.Requests {
+				t.Errorf("incorrect request count: expected %d, actual %d", test.Requests, n)
+			}
+		})
+	}
+}
+
+func TestFindInstallationPerApp(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		// each app is installed with a different ID; apps are identified by
+		// the issuer of their JWT, and unauthenticated requests use app 0
+		var claims struct {
+			Issuer string `json:"iss"`
+		}
+		if parts := strings.Split(r.Header.Get("Authorization"), "."); len(parts) == 3 {
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			_ = json.Unmarshal(payload, &claims)
+		}
+		appID, _ := strconv.ParseInt(claims.Issuer, 10, 64)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":%d,"app_id":%d,"account":{"login":"palantir"}}`, 100*appID+1, appID)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	find := func(client *github.Client) int64 {
+		id, err := FindRepositoryInstallation(ctx, client, "palantir", "go-githubapp")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return id
+	}
+
+	for _, appID := range []int64{1, 2} {
+		client, err := NewClientCreator(srv.URL, srv.URL, appID, newTestPrivateKey(t)).NewAppClient()
+		if err != nil {
+			t.Fatalf("failed to create app client: %v", err)
+		}
+
+		atomic.StoreInt32(&requests, 0)
+		for i := 0; i < 2; i++ {
+			assertField(t, fmt.Sprintf("app %d installation ID", appID), 100*appID+1, find(client))
+		}
+		assertField(t, fmt.Sprintf("app %d requests", appID), int32(1), atomic.LoadInt32(&requests))
+	}
+
+	// clients not created by a client creator do not cache IDs
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	atomic.StoreInt32(&requests, 0)
+	for i := 0; i < 2; i++ {
+		assertField(t, "installation ID", int64(1), find(client))
+	}
+	assertField(t, "requests", int32(2), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// PartialResult reports which items were applied by helpers like AddLabels
+// that tolerate failures of individual items.
+type PartialResult struct {
+	// Succeeded lists the items that were applied, in request order.
+	Succeeded []string
+
+	// Failed maps items that were not applied to the reason they failed.
+	Failed map[string]error
+}
+
+// Err returns an error that describes the failed items, or nil if all items
+// succeeded.
+func (r PartialResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+
+	items := make([]string, 0, len(r.Failed))
+	for item := range r.Failed {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+
+	msgs := make([]string, 0, len(items))
+	for _, item := range items {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", item, r.Failed[item]))
+	}
+	return errors.Errorf("%d of %d items failed: %s", len(r.Failed), len(r.Failed)+len(r.Succeeded), strings.Join(msgs, "; "))
+}
+
+func (r *PartialResult) fail(item string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]error)
+	}
+	r.Failed[item] = err
+}
+
+// AddLabels adds labels to an issue or pull request. If GitHub rejects the
+// request, each label is added separately so that one invalid label does not
+// prevent the others from being added. The returned error is non-nil if any
+// label was not added and is the same as the result's Err.
+func AddLabels(ctx context.Context, client *github.Client, owner, repo string, number int, labels ...string) (PartialResult, error) {
+	if IsDryRun(ctx) {
+		return dryRunEach(ctx, "skipped adding labels", owner, repo, number, labels), nil
+	}
+
+	res := applyEach(uniqueItems(labels), func(items []string) error {
+		_, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, number, items)
+		return err
+	})
+	return res, res.Err()
+}
+
+// AssignUsers adds assignees to an issue or pull request. GitHub silently
+// ignores users who cannot be assigned, like users without access to the
+// repository, so AssignUsers reports these users as failed. The returned
+// error is non-nil if any user was not assigned and is the same as the
+// result's Err.
+func AssignUsers(ctx context.Context, client *github.Client, owner, repo string, number int, logins ...string) (PartialResult, error) {
+	var res PartialResult
+
+	if IsDryRun(ctx) {
+		return dryRunEach(ctx, "skipped assigning users", owner, repo, number, logins), nil
+	}
+
+	logins = uniqueItems(logins)
+	if len(logins) == 0 {
+		return res, nil
+	}
+
+	issue, _, err := client.Issues.AddAssignees(ctx, owner, repo, number, logins)
+	if err != nil {
+		for _, login := range logins {
+			res.fail(login, err)
+		}
+		return res, res.Err()
+	}
+
+	assigned := make(map[string]bool)
+	for _, u := range issue.Assignees {
+		assigned[strings.ToLower(u.GetLogin())] = true
+	}
+	for _, login := range logins {
+		if assigned[strings.ToLower(login)] {
+			res.Succeeded = append(res.Succeeded, login)
+		} else {
+			res.fail(login, errors.Errorf("user cannot be assigned to %s/%s#%d", owner, repo, number))
+		}
+	}
+	return res, res.Err()
+}
+
+// dryRunEach logs items that were not applied in dry-run mode and returns a
+// result in which all items succeeded.
+func dryRunEach(ctx context.Context, msg, owner, repo string, number int, items []string) PartialResult {
+	var res PartialResult
+	if items = uniqueItems(items); len(items) > 0 {
+		logDryRun(ctx, msg, "owner", owner, "repo", repo, "number", number, "items", items)
+		res.Succeeded = items
+	}
+	return res
+}
+
+// applyEach applies all items in one request. If the request fails because
+// GitHub rejected its content, it applies each item in a separate request to
+// find the items that fail.
+func applyEach(items []string, apply func([]string) error) PartialResult {
+	var res PartialResult
+	if len(items) == 0 {
+		return res
+	}
+
+	err := apply(items)
+	if err == nil {
+		res.Succeeded = items
+		return res
+	}
+	if len(items) == 1 || !isUnprocessable(err) {
+		for _, item := range items {
+			res.fail(item, err)
+		}
+		return res
+	}
+
+	for _, item := range items {
+		if err := apply([]string{item}); err != nil {
+			res.fail(item, err)
+		} else {
+			res.Succeeded = append(res.Succeeded, item)
+		}
+	}
+	return res
+}
+
+// isUnprocessable returns true if err is a 422 Unprocessable Entity response,
+// which GitHub returns when it rejects the content of a request.
+func isUnprocessable(err error) bool {
+	var rerr *github.ErrorResponse
+	return errors.As(err, &rerr) && rerr.Response != nil && rerr.Response.StatusCode == http.StatusUnprocessableEntity
+}
+
+// uniqueItems returns the non-empty items without duplicates, in order.
+func uniqueItems(items []string) []string {
+	seen := make(map[string]bool)
+
+	var unique []string
+	for _, item := range items {
+		if item != "" && !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestAddLabels(t *testing.T) {
+	tests := map[string]struct {
+		Labels []string
+
+		Succeeded []string
+		Failed    []string
+		Requests  int
+	}{
+		"allSucceed": {
+			Labels:    []string{"bug", "bot", "bug"},
+			Succeeded: []string{"bug", "bot"},
+			Requests:  1,
+		},
+		"partialFailure": {
+			Labels:    []string{"bug", "invalid", "bot"},
+			Succeeded: []string{"bug", "bot"},
+			Failed:    []string{"invalid"},
+			Requests:  4,
+		},
+		"empty": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestIssueServer(t)
+
+			res, err := AddLabels(context.Background(), srv.Client(), "owner", "repo", 7, test.Labels...)
+			assertPartialResult(t, res, err, test.Succeeded, test.Failed)
+			assertField(t, "request count", test.Requests, srv.Requests)
+		})
+	}
+}
+
+func TestAssignUsers(t *testing.T) {
+	tests := map[string]struct {
+		Logins []string
+
+		Succeeded []string
+		Failed    []string
+	}{
+		"allSucceed": {
+			Logins:    []string{"octocat", "Hubot"},
+			Succeeded: []string{"octocat", "Hubot"},
+		},
+		"ignoredUser": {
+			Logins:    []string{"octocat", "ghost"},
+			Succeeded: []string{"octocat"},
+			Failed:    []string{"ghost"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestIssueServer(t)
+
+			res, err := AssignUsers(context.Background(), srv.Client(), "owner", "repo", 7, test.Logins...)
+			assertPartialResult(t, res, err, test.Succeeded, test.Failed)
+		})
+	}
+}
+
+func assertPartialResult(t *testing.T, res PartialResult, err error, succeeded, failed []string) {
+	t.Helper()
+
+	if !reflect.DeepEqual(res.Succeeded, succeeded) {
+		t.Errorf("incorrect succeeded items: expected %v, actual %v", succeeded, res.Succeeded)
+	}
+	if len(res.Failed) != len(failed) {
+		t.Errorf("incorrect failed items: expected %v, actual %v", failed, res.Failed)
+	}
+	for _, item := range failed {
+		if res.Failed[item] == nil {
+			t.Errorf("expected %q to fail", item)
+		}
+	}
+	if (err != nil) != (len(failed) > 0) {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+// testIssueServer implements the label, assignee, and reviewer endpoints for
+// issue 7. It rejects the label "invalid", the reviewer "ghost", and the team
+// "missing", and ignores the assignee "ghost".
+type testIssueServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	Requests int
+}
+
+func newTestIssueServer(t *testing.T) *testIssueServer {
+	s := &testIssueServer{}
+
+	reject := func(w http.ResponseWriter, message string) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, `{"message":%q}`, message)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		var labels []string
+		s.decode(t, r, &labels)
+		for _, l := range labels {
+			if l == "invalid" {
+				reject(w, "Validation Failed")
+				return
+			}
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/assignees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Assignees []string `json:"assignees"`
+		}
+		s.decode(t, r, &body)
+
+		var issue github.Issue
+		for _, login := range body.Assignees {
+			if login != "ghost" {
+				issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(login)})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(issue)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		var body github.ReviewersRequest
+		s.decode(t, r, &body)
+		for _, u := range body.Reviewers {
+			if u == "ghost" {
+				reject(w, "Reviews may only be requested from collaborators.")
+				return
+			}
+		}
+		for _, team := range body.TeamReviewers {
+			if team == "missing" {
+				reject(w, "Could not resolve to a node")
+				return
+			}
+		}
+		fmt.Fprint(w, `{"number":7}`)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testIssueServer) Client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
+
+func (s *testIssueServer) decode(t *testing.T, r *http.Request, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Requests++
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		t.Errorf("failed to decode request body: %v", err)
+	}
+}
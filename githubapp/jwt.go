@@ -0,0 +1,122 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"crypto/rsa"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultJWTClockSkew is how far the issue time of app JWTs is set in the
+	// past to tolerate clocks that are ahead of GitHub's clock.
+	DefaultJWTClockSkew = 60 * time.Second
+
+	// DefaultJWTExpiry is how long app JWTs are valid after their issue time.
+	DefaultJWTExpiry = 5 * time.Minute
+
+	// MaxJWTExpiry is the longest validity GitHub accepts for app JWTs.
+	MaxJWTExpiry = 10 * time.Minute
+)
+
+// WithJWTExpiry sets how long the JWTs used to authenticate as the app are
+// valid after their issue time. Values larger than MaxJWTExpiry are reduced
+// to MaxJWTExpiry. The default is DefaultJWTExpiry.
+func WithJWTExpiry(expiry time.Duration) ClientOption {
+	return func(c *clientCreator) {
+		c.jwtExpiry = expiry
+	}
+}
+
+// WithJWTClockSkew sets how far the issue time of the JWTs used to
+// authenticate as the app is set in the past. GitHub rejects JWTs issued in
+// the future, so this avoids authentication failures on hosts with clocks
+// that are slightly ahead. The default is DefaultJWTClockSkew.
+func WithJWTClockSkew(skew time.Duration) ClientOption {
+	return func(c *clientCreator) {
+		c.jwtClockSkew = &skew
+	}
+}
+
+// jwtSigner signs app JWTs, replacing the issue and expiration times set by
+// the transport.
+type jwtSigner struct {
+	key    *rsa.PrivateKey
+	skew   time.Duration
+	expiry time.Duration
+	now    func() time.Time
+}
+
+func (s *jwtSigner) Sign(claims jwt.Claims) (string, error) {
+	rc, ok := claims.(*jwt.RegisteredClaims)
+	if !ok {
+		return "", errors.Errorf("unsupported JWT claims type: %T", claims)
+	}
+
+	// GitHub rejects timestamps that are not integers
+	iat := s.now().Add(-s.skew).Truncate(time.Second)
+	exp := iat.Add(s.expiry)
+
+	c := *rc
+	c.IssuedAt = jwt.NewNumericDate(iat)
+	c.ExpiresAt = jwt.NewNumericDate(exp)
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, &c).SignedString(s.key)
+}
+
+func (c *clientCreator) newJWTSigner() (*jwtSigner, error) {
+	key, err := ParsePrivateKey(c.privKeyBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse private key")
+	}
+
+	s := &jwtSigner{
+		key:    key,
+		skew:   DefaultJWTClockSkew,
+		expiry: c.jwtExpiry,
+		now:    time.Now,
+	}
+	if c.jwtClockSkew != nil {
+		s.skew = *c.jwtClockSkew
+	}
+	if s.expiry <= 0 {
+		s.expiry = DefaultJWTExpiry
+	}
+	if s.expiry > MaxJWTExpiry {
+		s.expiry = MaxJWTExpiry
+	}
+	return s, nil
+}
+
+// newAppsTransport returns a transport that authenticates requests as the
+// app using JWTs.
+func (c *clientCreator) newAppsTransport(next http.RoundTripper) (*ghinstallation.AppsTransport, error) {
+	signer, err := c.newJWTSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	atr, err := ghinstallation.NewAppsTransportWithOptions(next, c.integrationID, ghinstallation.WithSigner(signer))
+	if err != nil {
+		return nil, err
+	}
+	atr.BaseURL = strings.TrimSuffix(c.v3BaseURL, "/")
+	return atr, nil
+}
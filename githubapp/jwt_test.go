@@ -0,0 +1,89 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWTSigner(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := map[string]struct {
+		Options []ClientOption
+
+		IssuedAt  time.Time
+		ExpiresAt time.Time
+	}{
+		"defaults": {
+			IssuedAt:  now.Add(-DefaultJWTClockSkew).Truncate(time.Second),
+			ExpiresAt: now.Add(-DefaultJWTClockSkew).Truncate(time.Second).Add(DefaultJWTExpiry),
+		},
+		"customSkewAndExpiry": {
+			Options:   []ClientOption{WithJWTClockSkew(10 * time.Second), WithJWTExpiry(time.Minute)},
+			IssuedAt:  now.Add(-10 * time.Second).Truncate(time.Second),
+			ExpiresAt: now.Add(-10 * time.Second).Truncate(time.Second).Add(time.Minute),
+		},
+		"noSkew": {
+			Options:   []ClientOption{WithJWTClockSkew(0)},
+			IssuedAt:  now.Truncate(time.Second),
+			ExpiresAt: now.Truncate(time.Second).Add(DefaultJWTExpiry),
+		},
+		"expiryCapped": {
+			Options:   []ClientOption{WithJWTExpiry(time.Hour)},
+			IssuedAt:  now.Add(-DefaultJWTClockSkew).Truncate(time.Second),
+			ExpiresAt: now.Add(-DefaultJWTClockSkew).Truncate(time.Second).Add(MaxJWTExpiry),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cc := NewClientCreator("https://api.github.com/", "https://api.github.com/graphql", 1234, newTestPrivateKey(t), test.Options...)
+
+			signer, err := cc.(*clientCreator).newJWTSigner()
+			if err != nil {
+				t.Fatalf("unexpected error creating signer: %v", err)
+			}
+			signer.now = func() time.Time { return now }
+
+			token, err := signer.Sign(&jwt.RegisteredClaims{Issuer: "1234"})
+			if err != nil {
+				t.Fatalf("unexpected error signing token: %v", err)
+			}
+
+			var claims jwt.RegisteredClaims
+			parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+			if _, err := parser.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+				return &signer.key.PublicKey, nil
+			}); err != nil {
+				t.Fatalf("failed to parse token: %v", err)
+			}
+
+			assertField(t, "issuer", "1234", claims.Issuer)
+			assertField(t, "issued at", test.IssuedAt.Unix(), claims.IssuedAt.Unix())
+			assertField(t, "expires at", test.ExpiresAt.Unix(), claims.ExpiresAt.Unix())
+
+			if validity := claims.ExpiresAt.Sub(claims.IssuedAt.Time); validity > MaxJWTExpiry {
+				t.Errorf("token is valid for %s, longer than the maximum of %s", validity, MaxJWTExpiry)
+			}
+			if claims.IssuedAt.After(now) {
+				t.Errorf("token is issued in the future: %s", claims.IssuedAt)
+			}
+		})
+	}
+}
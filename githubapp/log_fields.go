@@ -0,0 +1,100 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+)
+
+// FieldNames sets the keys of the fields that the library adds to loggers.
+// Use it to match the field names of a shared logging schema. Empty names
+// use the default keys, given by the LogKey constants.
+type FieldNames struct {
+	EventType       string `yaml:"event_type" json:"eventType"`
+	DeliveryID      string `yaml:"delivery_id" json:"deliveryId"`
+	RepositoryName  string `yaml:"repository_name" json:"repositoryName"`
+	RepositoryOwner string `yaml:"repository_owner" json:"repositoryOwner"`
+	PRNum           string `yaml:"pr_num" json:"prNum"`
+	InstallationID  string `yaml:"installation_id" json:"installationId"`
+	Organization    string `yaml:"organization" json:"organization"`
+	RequestID       string `yaml:"request_id" json:"requestId"`
+	TraceID         string `yaml:"trace_id" json:"traceId"`
+}
+
+// DefaultFieldNames returns the default field names.
+func DefaultFieldNames() FieldNames {
+	return FieldNames{
+		EventType:       LogKeyEventType,
+		DeliveryID:      LogKeyDeliveryID,
+		RepositoryName:  LogKeyRepositoryName,
+		RepositoryOwner: LogKeyRepositoryOwner,
+		PRNum:           LogKeyPRNum,
+		InstallationID:  LogKeyInstallationID,
+		Organization:    LogKeyOrganization,
+		RequestID:       LogKeyRequestID,
+		TraceID:         LogKeyTraceID,
+	}
+}
+
+// withDefaults returns a copy of the names with empty names replaced by the
+// default names.
+func (n FieldNames) withDefaults() FieldNames {
+	setDefault := func(name *string, def string) {
+		if *name == "" {
+			*name = def
+		}
+	}
+	setDefault(&n.EventType, LogKeyEventType)
+	setDefault(&n.DeliveryID, LogKeyDeliveryID)
+	setDefault(&n.RepositoryName, LogKeyRepositoryName)
+	setDefault(&n.RepositoryOwner, LogKeyRepositoryOwner)
+	setDefault(&n.PRNum, LogKeyPRNum)
+	setDefault(&n.InstallationID, LogKeyInstallationID)
+	setDefault(&n.Organization, LogKeyOrganization)
+	setDefault(&n.RequestID, LogKeyRequestID)
+	setDefault(&n.TraceID, LogKeyTraceID)
+	return n
+}
+
+type fieldNamesKey struct{}
+
+// WithFieldNames returns a context with the field names used by the library
+// when adding fields to the loggers in the context, like in PrepareRepoContext
+// or when logging requests. The dispatcher sets the names for the contexts
+// passed to handlers if it is created with the WithLogFieldNames option. Use
+// this function to set the names for other contexts, like the base context of
+// background jobs.
+func WithFieldNames(ctx context.Context, names FieldNames) context.Context {
+	return context.WithValue(ctx, fieldNamesKey{}, names.withDefaults())
+}
+
+// FieldNamesFromContext returns the field names set by WithFieldNames or the
+// default names if none are set.
+func FieldNamesFromContext(ctx context.Context) FieldNames {
+	if names, ok := ctx.Value(fieldNamesKey{}).(FieldNames); ok {
+		return names
+	}
+	return DefaultFieldNames()
+}
+
+// WithLogFieldNames sets the names of the fields that the dispatcher adds to
+// loggers and stores the names in the context passed to handlers. See
+// WithFieldNames for details.
+func WithLogFieldNames(names FieldNames) DispatcherOption {
+	return func(d *eventDispatcher) {
+		names := names.withDefaults()
+		d.fieldNames = &names
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"sort"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger is a leveled, structured logger. Fields are given as alternating
+// keys and values, like "handler", "push", "attempt", 2. Use WithLogger to
+// set the logger used by the library for a context.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+
+	// With returns a logger that adds the fields to every message.
+	With(keysAndValues ...interface{}) Logger
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context with a logger used by the library instead of
+// the zerolog logger in the context. Fields added by the library, like the
+// event type and delivery ID, are added to both loggers so that handlers
+// using zerolog.Ctx continue to work.
+func WithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger set by WithLogger. If no logger is set,
+// it returns a Logger that writes to the zerolog logger in the context.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return ZerologLogger(*zerolog.Ctx(ctx))
+}
+
+// withLogFields adds fields to the Logger and the zerolog logger in a
+// context.
+func withLogFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		ctx = WithLogger(ctx, logger.With(keysAndValues...))
+	}
+	return zerolog.Ctx(ctx).With().Fields(keysAndValues).Logger().WithContext(ctx)
+}
+
+// copyLoggers copies the Logger and the zerolog logger from one context to
+// another.
+func copyLoggers(from, to context.Context) context.Context {
+	if logger, ok := from.Value(loggerKey{}).(Logger); ok {
+		to = WithLogger(to, logger)
+	}
+	return zerolog.Ctx(from).WithContext(to)
+}
+
+// fieldList converts a map of fields to a list of keys and values, sorted
+// by key.
+func fieldList(fields map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kv = append(kv, k, fields[k])
+	}
+	return kv
+}
+
+// ZerologLogger returns a Logger that writes to a zerolog logger.
+func ZerologLogger(logger zerolog.Logger) Logger {
+	return zerologLogger{logger: logger}
+}
+
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+func (l zerologLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug().Fields(keysAndValues).Msg(msg)
+}
+
+func (l zerologLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info().Fields(keysAndValues).Msg(msg)
+}
+
+func (l zerologLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn().Fields(keysAndValues).Msg(msg)
+}
+
+func (l zerologLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error().Fields(keysAndValues).Msg(msg)
+}
+
+func (l zerologLogger) With(keysAndValues ...interface{}) Logger {
+	return zerologLogger{logger: l.logger.With().Fields(keysAndValues).Logger()}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package githubapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewJSONHandler(&out, nil))).With(LogKeyEventType, "push")
+	logger.Error("message", "attempt", 2)
+
+	var entry struct {
+		Level     string `json:"level"`
+		Message   string `json:"msg"`
+		EventType string `json:"github_event_type"`
+		Attempt   int    `json:"attempt"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry: %s: %v", out.String(), err)
+	}
+
+	assertField(t, "level", "ERROR", entry.Level)
+	assertField(t, "message", "message", entry.Message)
+	assertField(t, "event type", "push", entry.EventType)
+	assertField(t, "attempt", 2, entry.Attempt)
+}
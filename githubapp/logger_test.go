@@ -0,0 +1,156 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/rs/zerolog"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	var out bytes.Buffer
+	ctx := zerolog.New(&out).WithContext(context.Background())
+
+	logger := LoggerFromContext(ctx).With("handler", "test")
+	logger.Warn("message", "attempt", 2)
+
+	var entry struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+		Handler string `json:"handler"`
+		Attempt int    `json:"attempt"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry: %s: %v", out.String(), err)
+	}
+
+	assertField(t, "level", "warn", entry.Level)
+	assertField(t, "message", "message", entry.Message)
+	assertField(t, "handler", "test", entry.Handler)
+	assertField(t, "attempt", 2, entry.Attempt)
+}
+
+func TestWithLogger(t *testing.T) {
+	var out bytes.Buffer
+	logs := &recordingLogger{}
+
+	ctx := zerolog.New(&out).WithContext(context.Background())
+	ctx = WithLogger(ctx, logs)
+
+	ctx, _ = PreparePRContext(ctx, 42, &github.Repository{
+		Name:  github.String("test"),
+		Owner: &github.User{Login: github.String("mhaypenny")},
+	}, 128)
+	LoggerFromContext(ctx).Info("message")
+
+	expected := []interface{}{
+		LogKeyInstallationID, int64(42),
+		LogKeyPRNum, 128,
+		LogKeyRepositoryName, "test",
+		LogKeyRepositoryOwner, "mhaypenny",
+	}
+	if len(logs.entries) != 1 || !reflect.DeepEqual(expected, logs.entries[0].fields) {
+		t.Errorf("incorrect log entries: %+v", logs.entries)
+	}
+
+	zerolog.Ctx(ctx).Info().Msg("")
+	var entry struct {
+		Number int `json:"github_pr_num"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry: %s: %v", out.String(), err)
+	}
+	assertField(t, "pull request number", 128, entry.Number)
+}
+
+func TestDispatcherLogger(t *testing.T) {
+	logs := &recordingLogger{}
+
+	h := TestEventHandler{Types: []string{"pull_request"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret)
+
+	req := newHookRequest("pull_request", "logger", true)
+	req = req.WithContext(WithLogger(req.Context(), logs))
+	d.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(logs.entries) == 0 {
+		t.Fatal("expected dispatcher to log, but no entries were recorded")
+	}
+
+	entry := logs.entries[0]
+	assertField(t, "message", "Received webhook event", entry.msg)
+
+	expected := []interface{}{LogKeyEventType, "pull_request", LogKeyDeliveryID, "logger"}
+	if !reflect.DeepEqual(expected, entry.fields) {
+		t.Errorf("incorrect fields:\nexpected: %v\n  actual: %v", expected, entry.fields)
+	}
+}
+
+type recordedLog struct {
+	level  string
+	msg    string
+	fields []interface{}
+}
+
+type recordingLogger struct {
+	entries []recordedLog
+	fields  []interface{}
+
+	// parent is the logger that records entries for loggers created by With
+	parent *recordingLogger
+}
+
+func (l *recordingLogger) record(level, msg string, keysAndValues []interface{}) {
+	root := l
+	if l.parent != nil {
+		root = l.parent
+	}
+	fields := append(append([]interface{}{}, l.fields...), keysAndValues...)
+	root.entries = append(root.entries, recordedLog{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.record("debug", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record("info", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.record("warn", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.record("error", msg, keysAndValues)
+}
+
+func (l *recordingLogger) With(keysAndValues ...interface{}) Logger {
+	root := l
+	if l.parent != nil {
+		root = l.parent
+	}
+	return &recordingLogger{
+		fields: append(append([]interface{}{}, l.fields...), keysAndValues...),
+		parent: root,
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultManifestCookieName is the name of the cookie that stores the
+	// state of a manifest flow.
+	DefaultManifestCookieName = "githubapp_manifest_state"
+
+	// manifestStateMaxAge is how long users have to create the app after
+	// starting the manifest flow.
+	manifestStateMaxAge = time.Hour
+)
+
+// ErrInvalidManifestState is passed to the error callback of a manifest
+// handler if the state returned by GitHub does not match the state of the
+// user's session.
+var ErrInvalidManifestState = errors.New("invalid manifest state")
+
+// AppManifest describes a GitHub App to create with the manifest flow. See
+// https://docs.github.com/en/apps/sharing-github-apps/registering-a-github-app-from-a-manifest
+// for details about the fields.
+type AppManifest struct {
+	Name        string `json:"name,omitempty"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	Public      bool   `json:"public"`
+
+	HookAttributes *ManifestHookAttributes `json:"hook_attributes,omitempty"`
+
+	// RedirectURL is where GitHub sends users after they create the app. If
+	// empty, the manifest handler uses its own URL.
+	RedirectURL  string   `json:"redirect_url,omitempty"`
+	CallbackURLs []string `json:"callback_urls,omitempty"`
+	SetupURL     string   `json:"setup_url,omitempty"`
+
+	DefaultPermissions map[string]string `json:"default_permissions,omitempty"`
+	DefaultEvents      []string          `json:"default_events,omitempty"`
+}
+
+// ManifestHookAttributes configures the webhook of an app created from a
+// manifest.
+type ManifestHookAttributes struct {
+	URL    string `json:"url"`
+	Active bool   `json:"active"`
+}
+
+// AppCredentials are the credentials of an app created with the manifest
+// flow. GitHub only returns them once, so applications must store them.
+type AppCredentials struct {
+	ID      int64
+	Slug    string
+	Name    string
+	HTMLURL string
+
+	ClientID      string
+	ClientSecret  string
+	WebhookSecret string
+
+	// PrivateKey is the PEM-encoded private key of the app.
+	PrivateKey string
+}
+
+// SetConfig sets the app and OAuth values in c from the credentials.
+func (creds AppCredentials) SetConfig(c *Config) {
+	c.App.IntegrationID = creds.ID
+	c.App.Slug = creds.Slug
+	c.App.WebhookSecret = creds.WebhookSecret
+	c.App.PrivateKey = creds.PrivateKey
+	c.OAuth.ClientID = creds.ClientID
+	c.OAuth.ClientSecret = creds.ClientSecret
+}
+
+// ManifestCallback is called with the credentials of an app created with the
+// manifest flow. It must write the response, like a redirect to the page for
+// installing the app.
+type ManifestCallback func(w http.ResponseWriter, r *http.Request, creds AppCredentials)
+
+// ManifestOption configures a manifest handler.
+type ManifestOption func(*manifestHandler)
+
+// WithManifestConfig sets the GitHub web and API URLs used by a manifest
+// handler from the configuration. By default, the handler uses github.com.
+func WithManifestConfig(c Config) ManifestOption {
+	return func(h *manifestHandler) {
+		h.config = c
+	}
+}
+
+// WithManifestOrganization creates the app in an organization instead of the
+// account of the user who completes the flow.
+func WithManifestOrganization(org string) ManifestOption {
+	return func(h *manifestHandler) {
+		h.org = org
+	}
+}
+
+// OnManifestError sets the callback for errors in the manifest flow. By
+// default, the handler responds with 400 Bad Request for invalid states and
+// 500 Internal Server Error for other errors.
+func OnManifestError(onError func(w http.ResponseWriter, r *http.Request, err error)) ManifestOption {
+	return func(h *manifestHandler) {
+		h.onError = onError
+	}
+}
+
+type manifestHandler struct {
+	manifest  AppManifest
+	onCreated ManifestCallback
+	onError   func(w http.ResponseWriter, r *http.Request, err error)
+
+	config Config
+	org    string
+}
+
+// ManifestHandler returns an http.Handler that creates a GitHub App from a
+// manifest. The handler implements both steps of the flow on a single
+// endpoint: requests without a code respond with a page that submits the
+// manifest to GitHub, and requests with the code GitHub returns exchange it
+// for the app's credentials and pass them to onCreated. The handler does not
+// store the credentials.
+//
+// The handler stores a random state in a secure cookie to verify that the
+// user who created the app is the user who started the flow.
+func ManifestHandler(manifest AppManifest, onCreated ManifestCallback, opts ...ManifestOption) http.Handler {
+	h := &manifestHandler{
+		manifest:  manifest,
+		onCreated: onCreated,
+		onError:   defaultManifestErrorCallback,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func defaultManifestErrorCallback(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrInvalidManifestState) {
+		http.Error(w, "invalid state parameter", http.StatusBadRequest)
+		return
+	}
+	LoggerFromContext(r.Context()).Error("Failed to create GitHub App from manifest", "error", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func (h *manifestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+	if code == "" {
+		h.start(w, r)
+		return
+	}
+
+	c, err := r.Cookie(DefaultManifestCookieName)
+	state := r.FormValue("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Value)) != 1 {
+		h.onError(w, r, ErrInvalidManifestState)
+		return
+	}
+	http.SetCookie(w, h.stateCookie(r, "", -1))
+
+	creds, err := h.convert(r.Context(), code)
+	if err != nil {
+		h.onError(w, r, err)
+		return
+	}
+	h.onCreated(w, r, creds)
+}
+
+// start responds with a page that submits the manifest to GitHub.
+func (h *manifestHandler) start(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		h.onError(w, r, errors.Wrap(err, "failed to generate state value"))
+		return
+	}
+	state := hex.EncodeToString(b)
+
+	manifest := h.manifest
+	if manifest.RedirectURL == "" {
+		manifest.RedirectURL = requestURL(r)
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		h.onError(w, r, errors.Wrap(err, "failed to encode manifest"))
+		return
+	}
+
+	webURL := h.config.WebURL
+	if webURL == "" {
+		webURL = DefaultWebURL
+	}
+	action := strings.TrimSuffix(webURL, "/") + "/settings/apps/new"
+	if h.org != "" {
+		action = strings.TrimSuffix(webURL, "/") + "/organizations/" + url.PathEscape(h.org) + "/settings/apps/new"
+	}
+	action += "?state=" + url.QueryEscape(state)
+
+	http.SetCookie(w, h.stateCookie(r, state, int(manifestStateMaxAge.Seconds())))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := manifestPage.Execute(w, map[string]string{"Action": action, "Manifest": string(manifestJSON)}); err != nil {
+		LoggerFromContext(r.Context()).Error("Failed to render manifest page", "error", err)
+	}
+}
+
+func (h *manifestHandler) stateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     DefaultManifestCookieName,
+		Value:    value,
+		Path:     r.URL.Path,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// convert exchanges a manifest code for the credentials of the new app. The
+// request does not need authentication.
+func (h *manifestHandler) convert(ctx context.Context, code string) (AppCredentials, error) {
+	v3, _, err := h.config.APIURLs()
+	if err != nil {
+		return AppCredentials{}, err
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(v3, "/") + "/")
+	if err != nil {
+		return AppCredentials{}, errors.Wrapf(err, "failed to parse base URL: %q", v3)
+	}
+
+	client := github.NewClient(nil)
+	client.BaseURL = baseURL
+
+	app, _, err := client.Apps.CompleteAppManifest(ctx, code)
+	if err != nil {
+		return AppCredentials{}, errors.Wrap(err, "failed to exchange manifest code")
+	}
+
+	return AppCredentials{
+		ID:            app.GetID(),
+		Slug:          app.GetSlug(),
+		Name:          app.GetName(),
+		HTMLURL:       app.GetHTMLURL(),
+		ClientID:      app.GetClientID(),
+		ClientSecret:  app.GetClientSecret(),
+		WebhookSecret: app.GetWebhookSecret(),
+		PrivateKey:    app.GetPEM(),
+	}, nil
+}
+
+// requestURL returns the URL of the request without its query.
+func requestURL(r *http.Request) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   r.Host,
+		Path:   r.URL.Path,
+	}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+var manifestPage = template.Must(template.New("manifest").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Create GitHub App</title></head>
+<body>
+<form id="manifest" action="{{.Action}}" method="post">
+<input type="hidden" name="manifest" value="{{.Manifest}}">
+<button type="submit">Create GitHub App</button>
+</form>
+<script>document.getElementById("manifest").submit();</script>
+</body>
+</html>
+`))
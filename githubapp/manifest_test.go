@@ -0,0 +1,129 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestManifestHandler(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app-manifests/abc123/conversions" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":42,"slug":"my-app","name":"My App","html_url":"https://github.com/apps/my-app","client_id":"Iv1.abc","client_secret":"csecret","webhook_secret":"wsecret","pem":"PEM"}`))
+	}))
+	defer api.Close()
+
+	config := Config{WebURL: "https://github.example.com", V3APIURL: api.URL, V4APIURL: api.URL + "/graphql"}
+	manifest := AppManifest{
+		Name:           "My App",
+		URL:            "https://example.com",
+		HookAttributes: &ManifestHookAttributes{URL: "https://example.com/api/github/hook", Active: true},
+	}
+
+	tests := map[string]struct {
+		Org         string
+		Query       string
+		StateCookie string
+
+		Status  int
+		Created bool
+		Body    []string
+	}{
+		"start": {
+			Status: http.StatusOK,
+			Body: []string{
+				`action="https://github.example.com/settings/apps/new?state=`,
+				`&#34;redirect_url&#34;:&#34;http://app.example.com/setup&#34;`,
+				`&#34;hook_attributes&#34;:{&#34;url&#34;:&#34;https://example.com/api/github/hook&#34;,&#34;active&#34;:true}`,
+			},
+		},
+		"startOrganization": {
+			Org:    "octo org",
+			Status: http.StatusOK,
+			Body:   []string{`action="https://github.example.com/organizations/octo%20org/settings/apps/new?state=`},
+		},
+		"convert": {
+			Query:       "code=abc123&state=s1",
+			StateCookie: "s1",
+			Status:      http.StatusOK,
+			Created:     true,
+		},
+		"missingCookie": {
+			Query:  "code=abc123&state=s1",
+			Status: http.StatusBadRequest,
+		},
+		"stateMismatch": {
+			Query:       "code=abc123&state=s2",
+			StateCookie: "s1",
+			Status:      http.StatusBadRequest,
+		},
+		"conversionFailed": {
+			Query:       "code=unknown&state=s1",
+			StateCookie: "s1",
+			Status:      http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var creds AppCredentials
+			var created bool
+			h := ManifestHandler(manifest, func(w http.ResponseWriter, r *http.Request, c AppCredentials) {
+				creds, created = c, true
+			}, WithManifestConfig(config), WithManifestOrganization(test.Org))
+
+			req := httptest.NewRequest(http.MethodGet, "http://app.example.com/setup?"+test.Query, nil)
+			if test.StateCookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultManifestCookieName, Value: test.StateCookie})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != test.Status {
+				t.Fatalf("expected status %d, got %d: %s", test.Status, rec.Code, rec.Body.String())
+			}
+			for _, s := range test.Body {
+				if !strings.Contains(rec.Body.String(), s) {
+					t.Errorf("expected body to contain %q, got:\n%s", s, rec.Body.String())
+				}
+			}
+			if created != test.Created {
+				t.Fatalf("expected created=%t, got %t", test.Created, created)
+			}
+			if created {
+				expected := AppCredentials{
+					ID:            42,
+					Slug:          "my-app",
+					Name:          "My App",
+					HTMLURL:       "https://github.com/apps/my-app",
+					ClientID:      "Iv1.abc",
+					ClientSecret:  "csecret",
+					WebhookSecret: "wsecret",
+					PrivateKey:    "PEM",
+				}
+				if creds != expected {
+					t.Errorf("expected credentials %+v, got %+v", expected, creds)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gregjones/httpcache"
+)
+
+// Metrics receives metrics emitted by the library. It allows reporting to
+// metrics systems other than go-metrics, like OpenTelemetry or Prometheus,
+// without the library depending on their clients.
+//
+// Names are the MetricsKey constants. Tags are alternating keys and values,
+// like "event", "push", and each metric always uses the same keys in the
+// same order. Durations are reported in seconds. Implementations must be
+// safe for concurrent use.
+type Metrics interface {
+	// Counter adds delta to a counter.
+	Counter(name string, delta int64, tags ...string)
+
+	// Histogram records an observation of a distribution.
+	Histogram(name string, value float64, tags ...string)
+
+	// Gauge sets the current value of a gauge.
+	Gauge(name string, value float64, tags ...string)
+}
+
+// NopMetrics is a Metrics implementation that discards all metrics.
+type NopMetrics struct{}
+
+func (NopMetrics) Counter(name string, delta int64, tags ...string)     {}
+func (NopMetrics) Histogram(name string, value float64, tags ...string) {}
+func (NopMetrics) Gauge(name string, value float64, tags ...string)     {}
+
+// WithMetrics reports metrics about received events and handler execution to
+// m, in addition to any registry set by WithDispatchMetrics:
+//
+//   - github.event.received (event) counts valid events of each type
+//   - github.handler.duration (handler, event) observes handler durations
+//   - github.handler.failures (handler, event) counts handler errors
+//   - github.event.lag (event) observes the delay between GitHub generating
+//     an event and the dispatcher receiving it, for events with a known
+//     EventTimestamp
+func WithMetrics(m Metrics) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.sink = m
+	}
+}
+
+// WithClientMetrics reports metrics about requests, rate limits, and the
+// installation token cache of created clients to m:
+//
+//   - github.requests (status) counts responses by status class, like "2xx"
+//   - github.requests.cached counts responses served from the cache
+//   - github.rate.limit (installation) is the rate limit of an installation
+//   - github.rate.remaining (installation) is the remaining rate limit
+//   - github.token_cache.hits, github.token_cache.misses, and
+//     github.token_cache.mints count token cache lookups and created tokens
+//   - github.token_cache.size is the number of cached tokens
+//
+// Unlike the ClientMetrics middleware, which records requests made by all
+// clients, rate limits are only reported for installation clients.
+func WithClientMetrics(m Metrics) ClientOption {
+	return func(c *clientCreator) {
+		if m != nil {
+			c.metrics = m
+			c.tokens.sink = m
+		}
+	}
+}
+
+// reportRequestMetrics returns the middleware that reports request metrics,
+// if client metrics are enabled.
+func (c *clientCreator) reportRequestMetrics(installID int64) []ClientMiddleware {
+	if c.metrics == nil {
+		return nil
+	}
+
+	m := c.metrics
+	installation := strconv.FormatInt(installID, 10)
+
+	return []ClientMiddleware{func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+			if res == nil {
+				return res, err
+			}
+
+			m.Counter(MetricsKeyRequests, 1, "status", strconv.Itoa(res.StatusCode/100)+"xx")
+			if res.Header.Get(httpcache.XFromCache) != "" {
+				m.Counter(MetricsKeyRequestsCached, 1)
+			}
+
+			if installID != 0 {
+				if v, perr := strconv.ParseFloat(res.Header.Get("X-RateLimit-Limit"), 64); perr == nil {
+					m.Gauge(MetricsKeyRateLimit, v, "installation", installation)
+				}
+				if v, perr := strconv.ParseFloat(res.Header.Get("X-RateLimit-Remaining"), 64); perr == nil {
+					m.Gauge(MetricsKeyRateLimitRemaining, v, "installation", installation)
+				}
+			}
+			return res, err
+		})
+	}}
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultPrometheusBuckets are the histogram buckets used by
+// PrometheusMetrics if no buckets are given. They match the default buckets
+// of the Prometheus client and are suitable for durations in seconds.
+var DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics implementation that serves metrics in the
+// Prometheus text format. Register it as an http.Handler on the path
+// scraped by Prometheus, like "/metrics".
+//
+// Metric names are converted to valid Prometheus names by replacing invalid
+// characters with underscores, so "github.event.received" becomes
+// "github_event_received_total". To combine these metrics with metrics from
+// the Prometheus client, implement Metrics using the client's collectors
+// instead.
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mu     sync.Mutex
+	kinds  map[string]string
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	kind   string
+	name   string
+	labels string
+
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics. If namespace is not
+// empty, it is added as a prefix to all metric names. If buckets is empty,
+// DefaultPrometheusBuckets are used.
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{
+		namespace: namespace,
+		buckets:   buckets,
+		kinds:     make(map[string]string),
+		series:    make(map[string]*promSeries),
+	}
+}
+
+func (p *PrometheusMetrics) Counter(name string, delta int64, tags ...string) {
+	p.update("counter", name+"_total", tags, func(s *promSeries) {
+		s.value += float64(delta)
+	})
+}
+
+func (p *PrometheusMetrics) Histogram(name string, value float64, tags ...string) {
+	p.update("histogram", name, tags, func(s *promSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+		for i, b := range p.buckets {
+			if value <= b {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += value
+	})
+}
+
+func (p *PrometheusMetrics) Gauge(name string, value float64, tags ...string) {
+	p.update("gauge", name, tags, func(s *promSeries) {
+		s.value = value
+	})
+}
+
+func (p *PrometheusMetrics) update(kind, name string, tags []string, fn func(*promSeries)) {
+	if p.namespace != "" {
+		name = p.namespace + "_" + name
+	}
+	name = promName(name)
+	labels := promLabels(tags)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Prometheus requires all series of a metric to have the same type
+	if k, ok := p.kinds[name]; ok && k != kind {
+		return
+	}
+	p.kinds[name] = kind
+
+	s, ok := p.series[name+labels]
+	if !ok {
+		s = &promSeries{kind: kind, name: name, labels: labels}
+		p.series[name+labels] = s
+	}
+	fn(s)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text format to w.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	series := make([]promSeries, 0, len(p.series))
+	for _, s := range p.series {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		series = append(series, c)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return series[i].labels < series[j].labels
+	})
+
+	var b strings.Builder
+	for i, s := range series {
+		if i == 0 || series[i-1].name != s.name {
+			fmt.Fprintf(&b, "# TYPE %s %s\n", s.name, s.kind)
+		}
+		if s.kind != "histogram" {
+			fmt.Fprintf(&b, "%s%s %s\n", s.name, braces(s.labels), promValue(s.value))
+			continue
+		}
+		for i, bound := range p.buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, braces(joinLabels(s.labels, `le="`+promValue(bound)+`"`)), s.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, braces(joinLabels(s.labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", s.name, braces(s.labels), promValue(s.value))
+		fmt.Fprintf(&b, "%s_count%s %d\n", s.name, braces(s.labels), s.count)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// promName replaces characters that are not valid in Prometheus metric
+// names with underscores.
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels formats tags as Prometheus labels, without braces. A key
+// without a value is ignored.
+func promLabels(tags []string) string {
+	var labels []string
+	for i := 0; i+1 < len(tags); i += 2 {
+		labels = append(labels, promName(tags[i])+`="`+labelEscaper.Replace(tags[i+1])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func promValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
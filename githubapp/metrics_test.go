@@ -0,0 +1,221 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithMetrics(t *testing.T) {
+	m := newTestMetrics()
+
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			return errors.New("handler failed")
+		},
+	}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithMetrics(m))
+
+	for i := 0; i < 2; i++ {
+		d.ServeHTTP(httptest.NewRecorder(), newHookRequest("pull_request", "metrics", true))
+	}
+
+	counters := map[string]float64{
+		"github.event.received[event:pull_request]":                            2,
+		"github.handler.failures[handler:TestEventHandler,event:pull_request]": 2,
+	}
+	if !reflect.DeepEqual(counters, m.Counters()) {
+		t.Errorf("incorrect counters:\nexpected: %v\n  actual: %v", counters, m.Counters())
+	}
+	if n := m.Observations("github.handler.duration[handler:TestEventHandler,event:pull_request]"); n != 2 {
+		t.Errorf("incorrect number of duration observations: expected 2, actual %d", n)
+	}
+}
+
+func TestEventLagMetric(t *testing.T) {
+	m := newTestMetrics()
+
+	h := TestEventHandler{Types: []string{"issue_comment", "create"}}
+	d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithMetrics(m))
+
+	body := []byte(`{"action":"created","comment":{"updated_at":"` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"}}`)
+	d.ServeHTTP(httptest.NewRecorder(), newPayloadRequest("issue_comment", "lag", body, true))
+	d.ServeHTTP(httptest.NewRecorder(), newPayloadRequest("create", "lag", []byte(`{"ref":"main"}`), true))
+
+	if n := m.Observations("github.event.lag[event:issue_comment]"); n != 1 {
+		t.Errorf("incorrect number of lag observations: expected 1, actual %d", n)
+	}
+	if n := m.Observations("github.event.lag[event:create]"); n != 0 {
+		t.Errorf("recorded lag for event without timestamp: %d observations", n)
+	}
+}
+
+func TestWithClientMetrics(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	m := newTestMetrics()
+
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if res != nil {
+			res.Header.Set("X-RateLimit-Limit", "5000")
+			res.Header.Set("X-RateLimit-Remaining", "4990")
+		}
+		return res, err
+	})
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithTransport(transport), WithClientMetrics(m))
+
+	client, err := cc.NewInstallationClient(42)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+			t.Fatalf("unexpected error making request: %v", err)
+		}
+	}
+
+	counters := map[string]float64{
+		"github.requests[status:2xx]": 2,
+		"github.token_cache.hits":     1,
+		"github.token_cache.misses":   1,
+		"github.token_cache.mints":    1,
+	}
+	if !reflect.DeepEqual(counters, m.Counters()) {
+		t.Errorf("incorrect counters:\nexpected: %v\n  actual: %v", counters, m.Counters())
+	}
+
+	gauges := map[string]float64{
+		"github.rate.limit[installation:42]":     5000,
+		"github.rate.remaining[installation:42]": 4990,
+		"github.token_cache.size":                1,
+	}
+	if !reflect.DeepEqual(gauges, m.Gauges()) {
+		t.Errorf("incorrect gauges:\nexpected: %v\n  actual: %v", gauges, m.Gauges())
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	p := NewPrometheusMetrics("app", 0.1, 1)
+	p.Counter(MetricsKeyEventsReceived, 2, "event", "push")
+	p.Counter(MetricsKeyEventsReceived, 1, "event", "pull_request")
+	p.Gauge(MetricsKeyTokenCacheSize, 3)
+	p.Gauge(MetricsKeyRateLimit, 5000, "installation", `a"b`)
+	p.Histogram(MetricsKeyHandlerDuration, 0.05, "handler", "h")
+	p.Histogram(MetricsKeyHandlerDuration, 0.5, "handler", "h")
+	p.Histogram(MetricsKeyHandlerDuration, 2, "handler", "h")
+
+	// a metric with a different type than an existing metric is ignored
+	p.Gauge(MetricsKeyEventsReceived+"_total", 10, "event", "push")
+
+	expected := strings.Join([]string{
+		`# TYPE app_github_event_received_total counter`,
+		`app_github_event_received_total{event="pull_request"} 1`,
+		`app_github_event_received_total{event="push"} 2`,
+		`# TYPE app_github_handler_duration histogram`,
+		`app_github_handler_duration_bucket{handler="h",le="0.1"} 1`,
+		`app_github_handler_duration_bucket{handler="h",le="1"} 2`,
+		`app_github_handler_duration_bucket{handler="h",le="+Inf"} 3`,
+		`app_github_handler_duration_sum{handler="h"} 2.55`,
+		`app_github_handler_duration_count{handler="h"} 3`,
+		`# TYPE app_github_rate_limit gauge`,
+		`app_github_rate_limit{installation="a\"b"} 5000`,
+		`# TYPE app_github_token_cache_size gauge`,
+		`app_github_token_cache_size 3`,
+		``,
+	}, "\n")
+
+	res := httptest.NewRecorder()
+	p.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if body := res.Body.String(); body != expected {
+		t.Errorf("incorrect output:\nexpected:\n%s\nactual:\n%s", expected, body)
+	}
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("incorrect content type: %q", ct)
+	}
+}
+
+// testMetrics records metrics by name and tags, formatted like the keys
+// used in go-metrics registries.
+type testMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]float64
+	gauges       map[string]float64
+	observations map[string]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		counters:     make(map[string]float64),
+		gauges:       make(map[string]float64),
+		observations: make(map[string]int),
+	}
+}
+
+func (m *testMetrics) Counter(name string, delta int64, tags ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[testMetricKey(name, tags)] += float64(delta)
+}
+
+func (m *testMetrics) Histogram(name string, value float64, tags ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations[testMetricKey(name, tags)]++
+}
+
+func (m *testMetrics) Gauge(name string, value float64, tags ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[testMetricKey(name, tags)] = value
+}
+
+func (m *testMetrics) Counters() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters
+}
+
+func (m *testMetrics) Gauges() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges
+}
+
+func (m *testMetrics) Observations(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.observations[key]
+}
+
+func testMetricKey(name string, tags []string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	var pairs []string
+	for i := 0; i+1 < len(tags); i += 2 {
+		pairs = append(pairs, tags[i]+":"+tags[i+1])
+	}
+	return name + "[" + strings.Join(pairs, ",") + "]"
+}
@@ -53,7 +53,7 @@ func ClientLogging(lvl zerolog.Level, opts ...ClientLoggingOption) ClientMiddlew
 			evt := zerolog.Ctx(r.Context()).
 				WithLevel(lvl).
 				Str("method", r.Method).
-				Str("path", r.URL.String()).
+				Str("path", r.URL.Redacted()).
 				Dur("elapsed", elapsed)
 
 			if reqBody != nil {
@@ -64,6 +64,9 @@ func ClientLogging(lvl zerolog.Level, opts ...ClientLoggingOption) ClientMiddlew
 				cached := res.Header.Get(httpcache.XFromCache) != ""
 				evt.Bool("cached", cached).
 					Int("status", res.StatusCode)
+				if id := res.Header.Get(RequestIDHeader); id != "" {
+					evt.Str(FieldNamesFromContext(r.Context()).RequestID, id)
+				}
 
 				size := res.ContentLength
 				if requestMatches(r, options.ResponseBodyPatterns) {
@@ -73,7 +76,7 @@ func ClientLogging(lvl zerolog.Level, opts ...ClientLoggingOption) ClientMiddlew
 					if size < 0 {
 						size = int64(len(resBody))
 					}
-					evt.Int64("size", size).Bytes("response_body", resBody)
+					evt.Int64("size", size).Bytes("response_body", redactTokens(resBody))
 				} else {
 					evt.Int64("size", size)
 				}
@@ -89,6 +92,15 @@ func ClientLogging(lvl zerolog.Level, opts ...ClientLoggingOption) ClientMiddlew
 	}
 }
 
+// tokenPattern matches token values in JSON responses, like the response to a
+// request for an installation token.
+var tokenPattern = regexp.MustCompile(`("token"\s*:\s*")[^"]*(")`)
+
+// redactTokens replaces token values in a response body.
+func redactTokens(body []byte) []byte {
+	return tokenPattern.ReplaceAll(body, []byte("${1}REDACTED${2}"))
+}
+
 // ClientLoggingOption controls behavior of client request logs.
 type ClientLoggingOption func(*clientLoggingOptions)
 
@@ -0,0 +1,216 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// HookTargetIDHeader is the header that contains the ID of the GitHub App
+	// that a webhook was sent to.
+	HookTargetIDHeader = "X-GitHub-Hook-Installation-Target-ID"
+
+	// HookTargetTypeHeader is the header that contains the type of the
+	// webhook target. It is "integration" for GitHub App webhooks.
+	HookTargetTypeHeader = "X-GitHub-Hook-Installation-Target-Type"
+)
+
+// App is a GitHub App served by a MultiAppDispatcher.
+type App struct {
+	// Name identifies the app in the dispatcher.
+	Name string
+
+	// Config is the configuration of the app. The dispatcher uses the app ID
+	// to route deliveries and the webhook secrets to validate them.
+	Config Config
+
+	// ClientCreator creates clients for the app. If nil, the dispatcher
+	// creates one with NewDefaultCachingClientCreator.
+	ClientCreator ClientCreator
+}
+
+type appKey struct{}
+
+// AppFromContext returns the app that received the webhook being handled. It
+// returns false if the context was not created by a MultiAppDispatcher.
+func AppFromContext(ctx context.Context) (App, bool) {
+	app, ok := ctx.Value(appKey{}).(App)
+	return app, ok
+}
+
+// MultiAppDispatcher is an http.Handler that dispatches webhooks for several
+// GitHub Apps to the same event handlers. Each app has its own client creator
+// and webhook secrets. Handlers get the app that received a delivery, and its
+// client creator, with AppFromContext.
+//
+// ServeHTTP routes each request by the app ID in the
+// X-GitHub-Hook-Installation-Target-ID header or, if the header is missing,
+// by the installation.app_id field of the payload. To route by path instead,
+// register the handler returned by Handler for each app.
+//
+// Requests that cannot be routed are passed to the error callback set with
+// WithErrorCallback, and routing uses the header names and payload limit set
+// with WithHeaders and WithMaxPayloadBytes.
+type MultiAppDispatcher struct {
+	apps     map[string]http.Handler
+	appsByID map[int64]http.Handler
+
+	onError         ErrorCallback
+	headers         Headers
+	maxPayloadBytes int64
+}
+
+// NewMultiAppDispatcher creates a dispatcher for the given apps. Each app
+// uses a dispatcher created by NewEventDispatcher with the handlers and
+// options, the webhook secrets of the app, and a context decorator that
+// stores the app for AppFromContext.
+func NewMultiAppDispatcher(apps []App, handlers []EventHandler, opts ...DispatcherOption) (*MultiAppDispatcher, error) {
+	d := &MultiAppDispatcher{
+		apps:            make(map[string]http.Handler),
+		appsByID:        make(map[int64]http.Handler),
+		onError:         DefaultErrorCallback,
+		headers:         DefaultHeaders(),
+		maxPayloadBytes: DefaultMaxPayloadBytes,
+	}
+
+	for _, app := range apps {
+		if app.Name == "" {
+			return nil, errors.New("app name must not be empty")
+		}
+		if _, exists := d.apps[app.Name]; exists {
+			return nil, errors.Errorf("duplicate app name %q", app.Name)
+		}
+
+		id := app.Config.App.IntegrationID
+		if _, exists := d.appsByID[id]; exists && id != 0 {
+			return nil, errors.Errorf("duplicate app ID %d", id)
+		}
+
+		if app.ClientCreator == nil {
+			cc, err := NewDefaultCachingClientCreator(app.Config)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to create client creator for app %q", app.Name)
+			}
+			app.ClientCreator = cc
+		}
+
+		appOpts := []DispatcherOption{
+			WithWebhookSecrets(app.Config.App.WebhookSecrets...),
+			WithLogFieldNames(app.Config.LogFieldNames),
+		}
+		appOpts = append(appOpts, opts...)
+		appOpts = append(appOpts, withApp(app))
+
+		h := NewEventDispatcher(handlers, app.Config.App.WebhookSecret, appOpts...)
+		d.apps[app.Name] = h
+		if ed, ok := h.(*eventDispatcher); ok {
+			// all apps share the options, so any app's dispatcher has the
+			// settings used for routing
+			d.onError = ed.onError
+			d.headers = ed.headers
+			d.maxPayloadBytes = ed.maxPayloadBytes
+		}
+		if id != 0 {
+			d.appsByID[id] = h
+		}
+	}
+
+	return d, nil
+}
+
+func withApp(app App) DispatcherOption {
+	return WithContextDecorator(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, appKey{}, app)
+	})
+}
+
+// Handler returns the http.Handler for the app with the given name, or nil if
+// there is no such app.
+func (d *MultiAppDispatcher) Handler(name string) http.Handler {
+	return d.apps[name]
+}
+
+func (d *MultiAppDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := InitializeResponder(r.Context())
+	ctx = withHeaders(ctx, d.headers)
+	r = r.WithContext(ctx)
+
+	id, err := appID(r, d.maxPayloadBytes)
+	if err != nil {
+		d.onError(w, r, ValidationError{
+			EventType:  r.Header.Get(d.headers.EventType),
+			DeliveryID: r.Header.Get(d.headers.DeliveryID),
+			Cause:      err,
+		})
+		return
+	}
+
+	h, ok := d.appsByID[id]
+	if !ok {
+		d.onError(w, r, ValidationError{
+			EventType:  r.Header.Get(d.headers.EventType),
+			DeliveryID: r.Header.Get(d.headers.DeliveryID),
+			Cause:      errors.Errorf("no app with ID %d", id),
+		})
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// appID returns the ID of the app that a webhook request was sent to. It
+// reads the payload if the request does not have a target ID header, and
+// replaces the request body so the payload can be read again. Payloads larger
+// than maxPayloadBytes are rejected.
+func appID(r *http.Request, maxPayloadBytes int64) (int64, error) {
+	if id, ok, err := headerAppID(r); ok || err != nil {
+		return id, err
+	}
+
+	if r.ContentLength > maxPayloadBytes {
+		return 0, ErrPayloadTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadBytes+1))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read payload")
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if int64(len(body)) > maxPayloadBytes {
+		return 0, ErrPayloadTooLarge
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return 0, err
+	}
+	payload, err := github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), "", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := payloadAppIDs(payload)
+	if len(ids) == 0 {
+		return 0, errors.Errorf("missing %s header and app ID in payload", HookTargetIDHeader)
+	}
+	return ids[0], nil
+}
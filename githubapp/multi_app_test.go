@@ -0,0 +1,223 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultiAppDispatcher(t *testing.T) {
+	apps := []App{
+		newTestApp(t, "public", 1, "public-secret"),
+		newTestApp(t, "internal", 2, "internal-secret"),
+	}
+
+	var handled string
+	h := &TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			app, ok := AppFromContext(ctx)
+			if !ok {
+				return fmt.Errorf("missing app in context")
+			}
+			if app.ClientCreator == nil {
+				return fmt.Errorf("missing client creator for app %s", app.Name)
+			}
+			handled = app.Name
+			return nil
+		},
+	}
+
+	d, err := NewMultiAppDispatcher(apps, []EventHandler{h})
+	if err != nil {
+		t.Fatalf("unexpected error creating dispatcher: %v", err)
+	}
+
+	tests := map[string]struct {
+		Handler  http.Handler
+		Body     string
+		Secret   string
+		TargetID string
+		Code     int
+		App      string
+	}{
+		"targetHeader": {
+			Handler:  d,
+			Body:     `{}`,
+			Secret:   "internal-secret",
+			TargetID: "2",
+			Code:     http.StatusOK,
+			App:      "internal",
+		},
+		"payloadAppID": {
+			Handler: d,
+			Body:    `{"installation":{"id":10,"app_id":1}}`,
+			Secret:  "public-secret",
+			Code:    http.StatusOK,
+			App:     "public",
+		},
+		"path": {
+			Handler: d.Handler("internal"),
+			Body:    `{}`,
+			Secret:  "internal-secret",
+			Code:    http.StatusOK,
+			App:     "internal",
+		},
+		"wrongSecret": {
+			Handler:  d,
+			Body:     `{}`,
+			Secret:   "public-secret",
+			TargetID: "2",
+			Code:     http.StatusBadRequest,
+		},
+		"unknownApp": {
+			Handler:  d,
+			Body:     `{}`,
+			Secret:   "public-secret",
+			TargetID: "3",
+			Code:     http.StatusBadRequest,
+		},
+		"missingAppID": {
+			Handler: d,
+			Body:    `{"installation":{"id":10}}`,
+			Secret:  "public-secret",
+			Code:    http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			handled = ""
+
+			req := newPayloadRequest("pull_request", name, []byte(test.Body), false)
+			mac := hmac.New(sha256.New, []byte(test.Secret))
+			mac.Write([]byte(test.Body))
+			req.Header.Set("X-Hub-Signature-256", fmt.Sprintf("sha256=%x", mac.Sum(nil)))
+			if test.TargetID != "" {
+				req.Header.Set(HookTargetTypeHeader, "integration")
+				req.Header.Set(HookTargetIDHeader, test.TargetID)
+			}
+
+			w := httptest.NewRecorder()
+			test.Handler.ServeHTTP(w, req)
+
+			assertField(t, "status code", test.Code, w.Code)
+			assertField(t, "handling app", test.App, handled)
+		})
+	}
+}
+
+func TestMultiAppDispatcherRoutingOptions(t *testing.T) {
+	apps := []App{newTestApp(t, "public", 1, "public-secret")}
+
+	var routingErr error
+	var eventType string
+	d, err := NewMultiAppDispatcher(apps, nil,
+		WithErrorCallback(func(w http.ResponseWriter, r *http.Request, err error) {
+			routingErr = err
+			eventType = eventTypeFromRequest(r)
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		WithHeaders(Headers{EventType: "X-Proxy-GitHub-Event"}),
+		WithMaxPayloadBytes(8),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error creating dispatcher: %v", err)
+	}
+
+	tests := map[string]struct {
+		Body     string
+		TargetID string
+		Err      error
+	}{
+		"unknownApp": {
+			Body:     `{}`,
+			TargetID: "3",
+		},
+		"payloadTooLarge": {
+			Body: `{"installation":{"id":10,"app_id":1}}`,
+			Err:  ErrPayloadTooLarge,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			routingErr, eventType = nil, ""
+
+			req := newPayloadRequest("pull_request", name, []byte(test.Body), false)
+			req.Header.Set("X-Proxy-GitHub-Event", "issues")
+			if test.TargetID != "" {
+				req.Header.Set(HookTargetTypeHeader, "integration")
+				req.Header.Set(HookTargetIDHeader, test.TargetID)
+			}
+
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, req)
+
+			assertField(t, "status code", http.StatusTeapot, w.Code)
+			assertField(t, "event type", "issues", eventType)
+
+			var verr ValidationError
+			if !errors.As(routingErr, &verr) {
+				t.Fatalf("expected ValidationError, but got: %v", routingErr)
+			}
+			assertField(t, "validation event type", "issues", verr.EventType)
+			if test.Err != nil && !errors.Is(routingErr, test.Err) {
+				t.Errorf("expected %v, but got: %v", test.Err, routingErr)
+			}
+		})
+	}
+}
+
+func TestNewMultiAppDispatcherErrors(t *testing.T) {
+	tests := map[string][]App{
+		"emptyName": {
+			newTestApp(t, "", 1, "secret"),
+		},
+		"duplicateName": {
+			newTestApp(t, "app", 1, "secret"),
+			newTestApp(t, "app", 2, "secret"),
+		},
+		"duplicateID": {
+			newTestApp(t, "public", 1, "secret"),
+			newTestApp(t, "internal", 1, "secret"),
+		},
+	}
+
+	for name, apps := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMultiAppDispatcher(apps, nil); err == nil {
+				t.Fatal("expected error, but got nil")
+			}
+		})
+	}
+}
+
+func newTestApp(t *testing.T, name string, id int64, secret string) App {
+	app := App{
+		Name:          name,
+		ClientCreator: NewClientCreator(DefaultV3APIURL, DefaultV4APIURL, id, newTestPrivateKey(t)),
+	}
+	app.Config.App.IntegrationID = id
+	app.Config.App.WebhookSecret = secret
+	return app
+}
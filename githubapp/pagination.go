@@ -0,0 +1,178 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPaginationMinRemaining is the number of remaining requests in
+	// the rate limit at which Paginate waits for the limit to reset.
+	DefaultPaginationMinRemaining = 100
+
+	// defaultPerPage is the page size used by the Each functions if the
+	// options do not set one. It is the largest size GitHub allows.
+	defaultPerPage = 100
+)
+
+// paginationRetry limits how often Paginate requests a page again after the
+// request fails because the rate limit is exhausted.
+var paginationRetry = RetryConfig{
+	MaxAttempts: DefaultRetryMaxAttempts,
+	BaseDelay:   DefaultRetryBaseDelay,
+	MaxDelay:    DefaultRetryMaxDelay,
+}
+
+// PageFunc requests one page of items. The page is 0 for the first request,
+// in which case the function should request the page set in its options, if
+// any.
+type PageFunc[T any] func(ctx context.Context, page int) ([]T, *github.Response, error)
+
+// PaginationConfig configures Paginate.
+type PaginationConfig struct {
+	// MinRemaining is the number of remaining requests in the rate limit at
+	// or below which Paginate waits for the limit to reset before requesting
+	// the next page. If zero, DefaultPaginationMinRemaining is used. If
+	// negative, Paginate only waits after the limit is exhausted.
+	MinRemaining int
+}
+
+// Paginate calls fn for each item returned by list, requesting pages as
+// needed. If fn returns an error, iteration stops and Paginate returns the
+// error unmodified.
+//
+// When the rate limit reported with a page falls to config.MinRemaining,
+// Paginate waits until the limit resets before requesting the next page, so
+// that listing many items does not exhaust the limit for other work. If a
+// request fails because the limit is exhausted, Paginate waits and requests
+// the page again, waiting at least a short, increasing delay even if the
+// reported reset time has passed. If the page fails DefaultRetryMaxAttempts
+// times in a row, Paginate returns the rate limit error. It returns early
+// with the context's error if ctx is canceled while waiting.
+func Paginate[T any](ctx context.Context, config PaginationConfig, list PageFunc[T], fn func(T) error) error {
+	minRemaining := config.MinRemaining
+	switch {
+	case minRemaining == 0:
+		minRemaining = DefaultPaginationMinRemaining
+	case minRemaining < 0:
+		minRemaining = 0
+	}
+
+	page, limited := 0, 0
+	for {
+		items, res, err := list(ctx, page)
+		if err != nil {
+			var rerr *github.RateLimitError
+			if !errors.As(err, &rerr) {
+				return err
+			}
+
+			// the reset time may have passed already because of clock skew,
+			// so always wait a little before requesting the page again
+			limited++
+			if limited >= paginationRetry.MaxAttempts {
+				return err
+			}
+			delay := time.Until(rerr.Rate.Reset.Time)
+			if min := backoffDelay(limited, paginationRetry); delay < min {
+				delay = min
+			}
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		limited = 0
+
+		for _, item := range items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if res.NextPage == 0 {
+			return nil
+		}
+		page = res.NextPage
+
+		if res.Rate.Limit > 0 && res.Rate.Remaining <= minRemaining {
+			if err := waitForReset(ctx, res.Rate); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// EachPullRequest calls fn for each pull request in a repository that
+// matches opts, which may be nil. See Paginate for details about iteration
+// and how config sets the rate limit threshold.
+func EachPullRequest(ctx context.Context, client *github.Client, config PaginationConfig, owner, repo string, opts *github.PullRequestListOptions, fn func(*github.PullRequest) error) error {
+	var o github.PullRequestListOptions
+	if opts != nil {
+		o = *opts
+	}
+	setPageDefaults(&o.ListOptions)
+
+	return Paginate(ctx, config, func(ctx context.Context, page int) ([]*github.PullRequest, *github.Response, error) {
+		if page != 0 {
+			o.Page = page
+		}
+		prs, res, err := client.PullRequests.List(ctx, owner, repo, &o)
+		return prs, res, errors.Wrapf(err, "failed to list pull requests in %s/%s", owner, repo)
+	}, fn)
+}
+
+// EachIssue calls fn for each issue in a repository that matches opts, which
+// may be nil. GitHub includes pull requests in the list of issues; use
+// Issue.IsPullRequest to skip them. See Paginate for details about iteration
+// and how config sets the rate limit threshold.
+func EachIssue(ctx context.Context, client *github.Client, config PaginationConfig, owner, repo string, opts *github.IssueListByRepoOptions, fn func(*github.Issue) error) error {
+	var o github.IssueListByRepoOptions
+	if opts != nil {
+		o = *opts
+	}
+	setPageDefaults(&o.ListOptions)
+
+	return Paginate(ctx, config, func(ctx context.Context, page int) ([]*github.Issue, *github.Response, error) {
+		if page != 0 {
+			o.Page = page
+		}
+		issues, res, err := client.Issues.ListByRepo(ctx, owner, repo, &o)
+		return issues, res, errors.Wrapf(err, "failed to list issues in %s/%s", owner, repo)
+	}, fn)
+}
+
+// EachPullRequestFile calls fn for each file changed by a pull request. GitHub
+// lists at most 3000 files. See Paginate for details about iteration and how
+// config sets the rate limit threshold.
+func EachPullRequestFile(ctx context.Context, client *github.Client, config PaginationConfig, owner, repo string, number int, fn func(*github.CommitFile) error) error {
+	o := github.ListOptions{PerPage: defaultPerPage}
+
+	return Paginate(ctx, config, func(ctx context.Context, page int) ([]*github.CommitFile, *github.Response, error) {
+		o.Page = page
+		files, res, err := client.PullRequests.ListFiles(ctx, owner, repo, number, &o)
+		return files, res, errors.Wrapf(err, "failed to list files of pull request %d in %s/%s", number, owner, repo)
+	}, fn)
+}
+
+func setPageDefaults(opts *github.ListOptions) {
+	if opts.PerPage == 0 {
+		opts.PerPage = defaultPerPage
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestEachPullRequest(t *testing.T) {
+	srv, requests := newTestPaginationServer(t, 3, 500, time.Now().Add(-time.Minute), 0)
+
+	var numbers []int
+	err := EachPullRequest(context.Background(), srv, PaginationConfig{}, "owner", "repo", &github.PullRequestListOptions{State: "closed"}, func(pr *github.PullRequest) error {
+		numbers = append(numbers, pr.GetNumber())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertField(t, "pull requests", fmt.Sprint([]int{1, 2, 3}), fmt.Sprint(numbers))
+	assertField(t, "request count", int32(3), atomic.LoadInt32(requests))
+}
+
+func TestEachPullRequestConfig(t *testing.T) {
+	srv, requests := newTestPaginationServer(t, 3, 50, time.Now().Add(time.Hour), 0)
+
+	// the default threshold waits for the low limit to reset
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := EachPullRequest(ctx, srv, PaginationConfig{}, "owner", "repo", nil, func(pr *github.PullRequest) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, but got %v", err)
+	}
+	assertField(t, "request count", int32(1), atomic.LoadInt32(requests))
+
+	atomic.StoreInt32(requests, 0)
+	err = EachPullRequest(context.Background(), srv, PaginationConfig{MinRemaining: 10}, "owner", "repo", nil, func(pr *github.PullRequest) error { return nil })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertField(t, "request count", int32(3), atomic.LoadInt32(requests))
+}
+
+func TestPaginate(t *testing.T) {
+	errStop := errors.New("stop")
+
+	tests := map[string]struct {
+		Remaining   int
+		Reset       time.Time
+		RateLimited int
+		Config      PaginationConfig
+		Stop        bool
+		Timeout     time.Duration
+
+		Items        int
+		Requests     int32
+		Err          error
+		RateLimitErr bool
+	}{
+		"allPages": {
+			Remaining: 500,
+			Reset:     time.Now().Add(time.Hour),
+			Items:     3,
+			Requests:  3,
+		},
+		"waitsForLowLimit": {
+			Remaining: 50,
+			Reset:     time.Now().Add(time.Hour),
+			Timeout:   50 * time.Millisecond,
+			Items:     1,
+			Requests:  1,
+			Err:       context.DeadlineExceeded,
+		},
+		"configuredThreshold": {
+			Remaining: 50,
+			Reset:     time.Now().Add(time.Hour),
+			Config:    PaginationConfig{MinRemaining: 10},
+			Items:     3,
+			Requests:  3,
+		},
+		"waitsForExhaustedLimit": {
+			Remaining: 0,
+			Reset:     time.Now().Add(time.Hour),
+			Config:    PaginationConfig{MinRemaining: -1},
+			Timeout:   50 * time.Millisecond,
+			Items:     1,
+			Requests:  1,
+			Err:       context.DeadlineExceeded,
+		},
+		"ignoresLowLimitWhenNegative": {
+			Remaining: 1,
+			Reset:     time.Now().Add(time.Hour),
+			Config:    PaginationConfig{MinRemaining: -1},
+			Items:     3,
+			Requests:  3,
+		},
+		"retriesExhaustedLimit": {
+			Remaining:   500,
+			Reset:       time.Now().Add(-time.Minute),
+			RateLimited: 1,
+			Items:       3,
+			Requests:    4,
+		},
+		"limitsExhaustedLimitRetries": {
+			Remaining:    500,
+			Reset:        time.Now().Add(-time.Minute),
+			RateLimited:  100,
+			Items:        0,
+			Requests:     3,
+			RateLimitErr: true,
+		},
+		"stopsOnError": {
+			Remaining: 500,
+			Reset:     time.Now().Add(time.Hour),
+			Stop:      true,
+			Items:     1,
+			Requests:  1,
+			Err:       errStop,
+		},
+	}
+
+	defaultRetry := paginationRetry
+	paginationRetry.BaseDelay = time.Millisecond
+	defer func() { paginationRetry = defaultRetry }()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, requests := newTestPaginationServer(t, 3, test.Remaining, test.Reset, test.RateLimited)
+
+			ctx := context.Background()
+			if test.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.Timeout)
+				defer cancel()
+			}
+
+			var items int
+			err := Paginate(ctx, test.Config, func(ctx context.Context, page int) ([]*github.PullRequest, *github.Response, error) {
+				return client.PullRequests.List(ctx, "owner", "repo", &github.PullRequestListOptions{
+					ListOptions: github.ListOptions{Page: page},
+				})
+			}, func(pr *github.PullRequest) error {
+				items++
+				if test.Stop {
+					return errStop
+				}
+				return nil
+			})
+
+			var rerr *github.RateLimitError
+			if test.RateLimitErr {
+				if !errors.As(err, &rerr) {
+					t.Fatalf("expected rate limit error, but got %v", err)
+				}
+			} else if test.Err != nil {
+				if !errors.Is(err, test.Err) {
+					t.Fatalf("expected error %v, but got %v", test.Err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertField(t, "item count", test.Items, items)
+			assertField(t, "request count", test.Requests, atomic.LoadInt32(requests))
+		})
+	}
+}
+
+// newTestPaginationServer serves pages of pull requests with one pull request
+// per page. Each response reports the given rate limit. The first rateLimited
+// requests fail because the rate limit is exhausted.
+func newTestPaginationServer(t *testing.T, pages, remaining int, reset time.Time, rateLimited int) (*github.Client, *int32) {
+	var requests int32
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if n <= int32(rateLimited) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+		if state := r.URL.Query().Get("state"); state != "" && state != "closed" {
+			t.Errorf("incorrect state: %q", state)
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < pages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, srv.URL, r.URL.Path, page+1))
+		}
+		fmt.Fprintf(w, `[{"number":%d}]`, page)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client, &requests
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// AcceptedPermissionsHeader is the response header GitHub uses to list the
+// permissions that grant access to an endpoint.
+const AcceptedPermissionsHeader = "X-Accepted-GitHub-Permissions"
+
+// ErrMissingPermission is matched by errors for requests that failed because
+// the app does not have a required permission.
+var ErrMissingPermission = errors.New("missing permission")
+
+// Permission is an app permission and access level, like "contents" and
+// "write".
+type Permission struct {
+	Name  string
+	Level string
+}
+
+func (p Permission) String() string {
+	return p.Name + ": " + p.Level
+}
+
+// MissingPermissionError is returned for requests that failed with a 403
+// Forbidden response that lists the permissions accepted by the endpoint. It
+// matches ErrMissingPermission when using errors.Is and wraps the
+// *github.ErrorResponse for the response.
+type MissingPermissionError struct {
+	// Accepted lists the alternative sets of permissions that grant access.
+	// The app needs every permission in at least one of the sets.
+	Accepted [][]Permission
+
+	Response *github.ErrorResponse
+}
+
+func (e *MissingPermissionError) Error() string {
+	alternatives := make([]string, len(e.Accepted))
+	for i, perms := range e.Accepted {
+		names := make([]string, len(perms))
+		for j, p := range perms {
+			names[j] = p.String()
+		}
+		alternatives[i] = strings.Join(names, " and ")
+	}
+	return fmt.Sprintf("app needs %s: %v", strings.Join(alternatives, " or "), e.Response)
+}
+
+func (e *MissingPermissionError) Is(target error) bool {
+	return target == ErrMissingPermission
+}
+
+func (e *MissingPermissionError) Unwrap() error {
+	return e.Response
+}
+
+// RequestID returns the GitHub request ID of the rejected request.
+func (e *MissingPermissionError) RequestID() string {
+	if e.Response == nil {
+		return ""
+	}
+	return responseRequestID(e.Response.Response)
+}
+
+// ParseAcceptedPermissions parses the value of the
+// X-Accepted-GitHub-Permissions header. Commas separate alternative sets of
+// permissions and semicolons or ampersands separate permissions that are
+// required together, like "contents=read; pull_requests=write, issues=write".
+// Names and levels are converted to lower case and malformed entries are
+// ignored.
+func ParseAcceptedPermissions(header string) [][]Permission {
+	var accepted [][]Permission
+	for _, alternative := range strings.Split(header, ",") {
+		var perms []Permission
+		for _, entry := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ';' || r == '&' }) {
+			name, level, ok := strings.Cut(entry, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			level = strings.ToLower(strings.TrimSpace(level))
+			if !ok || name == "" || level == "" {
+				continue
+			}
+			perms = append(perms, Permission{Name: name, Level: level})
+		}
+		if len(perms) > 0 {
+			accepted = append(accepted, perms)
+		}
+	}
+	return accepted
+}
+
+// WithMissingPermissionErrors makes REST API clients return a
+// *MissingPermissionError instead of a response for 403 Forbidden responses
+// that list the permissions accepted by the endpoint. The error names the
+// missing permissions, so it is clear which permissions to add to the app.
+//
+// Because clients return an error instead of the response, the
+// *github.Response returned by go-github methods is nil for these requests.
+// Use errors.As to get the *github.ErrorResponse from the error.
+func WithMissingPermissionErrors() ClientOption {
+	return func(c *clientCreator) {
+		c.missingPermissionErrors = true
+	}
+}
+
+// checkPermissions returns the middleware that converts responses for
+// missing permissions to errors, if enabled.
+func (c *clientCreator) checkPermissions() []ClientMiddleware {
+	if !c.missingPermissionErrors {
+		return nil
+	}
+	return []ClientMiddleware{missingPermissions}
+}
+
+func missingPermissions(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(r)
+		if err != nil || res.StatusCode != http.StatusForbidden {
+			return res, err
+		}
+
+		accepted := ParseAcceptedPermissions(res.Header.Get(AcceptedPermissionsHeader))
+		if len(accepted) == 0 {
+			return res, err
+		}
+
+		// the response is not returned, so close the body after CheckResponse
+		// reads it to parse the error message
+		body := res.Body
+		defer body.Close()
+
+		var rerr *github.ErrorResponse
+		if !errors.As(github.CheckResponse(res), &rerr) {
+			rerr = &github.ErrorResponse{Response: res}
+		}
+		return nil, &MissingPermissionError{Accepted: accepted, Response: rerr}
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestParseAcceptedPermissions(t *testing.T) {
+	tests := map[string]struct {
+		Header   string
+		Accepted [][]Permission
+	}{
+		"empty": {
+			Header: "",
+		},
+		"single": {
+			Header:   "contents=write",
+			Accepted: [][]Permission{{{Name: "contents", Level: "write"}}},
+		},
+		"alternatives": {
+			Header: "issues=write, pull_requests=write",
+			Accepted: [][]Permission{
+				{{Name: "issues", Level: "write"}},
+				{{Name: "pull_requests", Level: "write"}},
+			},
+		},
+		"combined": {
+			Header: "contents=read; pull_requests=write,checks=write&statuses=read",
+			Accepted: [][]Permission{
+				{{Name: "contents", Level: "read"}, {Name: "pull_requests", Level: "write"}},
+				{{Name: "checks", Level: "write"}, {Name: "statuses", Level: "read"}},
+			},
+		},
+		"normalizes": {
+			Header:   "  Contents = WRITE ,",
+			Accepted: [][]Permission{{{Name: "contents", Level: "write"}}},
+		},
+		"ignoresMalformed": {
+			Header:   "contents, =read, issues=, metadata=read",
+			Accepted: [][]Permission{{{Name: "metadata", Level: "read"}}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			accepted := ParseAcceptedPermissions(test.Header)
+			if !reflect.DeepEqual(test.Accepted, accepted) {
+				t.Errorf("incorrect permissions:\nexpected: %v\n  actual: %v", test.Accepted, accepted)
+			}
+		})
+	}
+}
+
+func TestMissingPermissionErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/repos/owner/repo/contents/file" {
+			w.Header().Set(AcceptedPermissionsHeader, "contents=write")
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cc := NewClientCreator(server.URL, server.URL, 1, nil, WithMissingPermissionErrors())
+	client, err := cc.NewTokenClient("token")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	ctx := context.Background()
+
+	_, _, err = client.Repositories.DeleteFile(ctx, "owner", "repo", "file", &github.RepositoryContentFileOptions{})
+	if !errors.Is(err, ErrMissingPermission) {
+		t.Fatalf("expected ErrMissingPermission, but got: %v", err)
+	}
+
+	var perr *MissingPermissionError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected MissingPermissionError, but got: %T", err)
+	}
+	expected := [][]Permission{{{Name: "contents", Level: "write"}}}
+	if !reflect.DeepEqual(expected, perr.Accepted) {
+		t.Errorf("incorrect permissions: expected %v, actual %v", expected, perr.Accepted)
+	}
+
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Message != "Resource not accessible by integration" {
+		t.Errorf("expected error to wrap the GitHub response, but got: %v", err)
+	}
+
+	// responses without the header are unchanged
+	_, res, err := client.Repositories.Get(ctx, "owner", "repo")
+	if errors.Is(err, ErrMissingPermission) {
+		t.Errorf("unexpected missing permission error: %v", err)
+	}
+	if res == nil || res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 response, but got: %v", res)
+	}
+}
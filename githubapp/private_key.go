@@ -0,0 +1,109 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEncryptedPrivateKey is returned when parsing a private key that is
+// encrypted with a passphrase. GitHub generates unencrypted keys, so an
+// encrypted key was usually modified after it was downloaded.
+var ErrEncryptedPrivateKey = errors.New("private key is encrypted; GitHub app keys must be unencrypted")
+
+// PrivateKeySource loads the PEM-encoded private key of an app.
+type PrivateKeySource interface {
+	PrivateKey() ([]byte, error)
+}
+
+// PEMBytes is a PrivateKeySource for a key that is already in memory.
+type PEMBytes []byte
+
+func (b PEMBytes) PrivateKey() ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.New("private key is empty")
+	}
+	return b, nil
+}
+
+// PEMFile is a PrivateKeySource that reads a key from the file at a path.
+type PEMFile string
+
+func (f PEMFile) PrivateKey() ([]byte, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read private key file")
+	}
+	return PEMBytes(b).PrivateKey()
+}
+
+// EnvVar is a PrivateKeySource that reads a key from the environment
+// variable with a name.
+type EnvVar string
+
+func (v EnvVar) PrivateKey() ([]byte, error) {
+	s, ok := os.LookupEnv(string(v))
+	if !ok {
+		return nil, errors.Errorf("environment variable %s is not set", string(v))
+	}
+	return PEMBytes(s).PrivateKey()
+}
+
+// ParsePrivateKey parses a PEM-encoded RSA private key. It accepts PKCS#1
+// ("RSA PRIVATE KEY") and PKCS#8 ("PRIVATE KEY") keys and returns
+// ErrEncryptedPrivateKey for keys encrypted with a passphrase. Keys where the
+// line breaks were replaced by literal "\n" sequences, as often happens when
+// storing keys in environment variables, are also accepted.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil && bytes.Contains(b, []byte(`\n`)) {
+		block, _ = pem.Decode(bytes.ReplaceAll(b, []byte(`\n`), []byte("\n")))
+	}
+	if block == nil {
+		return nil, errors.New("private key is not PEM-encoded")
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, ErrEncryptedPrivateKey
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse PKCS#1 private key")
+		}
+		return key, nil
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse PKCS#8 private key")
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.Errorf("private key has type %T, but GitHub apps use RSA keys", key)
+		}
+		return rsaKey, nil
+	}
+	return nil, errors.Errorf("unsupported PEM block type %q, expected \"RSA PRIVATE KEY\" or \"PRIVATE KEY\"", block.Type)
+}
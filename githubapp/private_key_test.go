@@ -0,0 +1,204 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	tests := map[string]struct {
+		Input []byte
+		Err   string
+	}{
+		"pkcs1": {
+			Input: pkcs1PEM,
+		},
+		"pkcs8": {
+			Input: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		"escapedNewlines": {
+			Input: []byte(strings.ReplaceAll(string(pkcs1PEM), "\n", `\n`)),
+		},
+		"encryptedPKCS1": {
+			Input: pem.EncodeToMemory(&pem.Block{
+				Type:    "RSA PRIVATE KEY",
+				Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-128-CBC,00000000000000000000000000000000"},
+				Bytes:   []byte("encrypted"),
+			}),
+			Err: "encrypted",
+		},
+		"encryptedPKCS8": {
+			Input: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("encrypted")}),
+			Err:   "encrypted",
+		},
+		"notRSA": {
+			Input: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8}),
+			Err:   "RSA keys",
+		},
+		"wrongBlockType": {
+			Input: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")}),
+			Err:   "unsupported PEM block type",
+		},
+		"notPEM": {
+			Input: []byte("not a key"),
+			Err:   "not PEM-encoded",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParsePrivateKey(test.Input)
+			if test.Err != "" {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				if !strings.Contains(err.Error(), test.Err) {
+					t.Errorf("incorrect error: expected to contain %q, actual %q", test.Err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !parsed.Equal(key) {
+				t.Error("parsed key does not match the original key")
+			}
+		})
+	}
+
+	t.Run("encryptedError", func(t *testing.T) {
+		_, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("encrypted")}))
+		if !errors.Is(err, ErrEncryptedPrivateKey) {
+			t.Errorf("expected ErrEncryptedPrivateKey, but got %v", err)
+		}
+	})
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	key := newTestPrivateKey(t)
+	otherKey := newTestPrivateKey(t)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	t.Setenv("TEST_GITHUB_APP_KEY", string(otherKey))
+
+	tests := map[string]struct {
+		Config   func(*Config)
+		Expected []byte
+		Err      bool
+	}{
+		"privateKey": {
+			Config:   func(c *Config) { c.App.PrivateKey = string(key) },
+			Expected: key,
+		},
+		"privateKeyPath": {
+			Config:   func(c *Config) { c.App.PrivateKeyPath = path },
+			Expected: key,
+		},
+		"privateKeyBeforePath": {
+			Config: func(c *Config) {
+				c.App.PrivateKey = string(otherKey)
+				c.App.PrivateKeyPath = path
+			},
+			Expected: otherKey,
+		},
+		"sourceBeforeOthers": {
+			Config: func(c *Config) {
+				c.App.PrivateKey = string(key)
+				c.App.PrivateKeySource = EnvVar("TEST_GITHUB_APP_KEY")
+			},
+			Expected: otherKey,
+		},
+		"pemBytesSource": {
+			Config:   func(c *Config) { c.App.PrivateKeySource = PEMBytes(key) },
+			Expected: key,
+		},
+		"pemFileSource": {
+			Config:   func(c *Config) { c.App.PrivateKeySource = PEMFile(path) },
+			Expected: key,
+		},
+		"missingFile": {
+			Config: func(c *Config) { c.App.PrivateKeySource = PEMFile(filepath.Join(t.TempDir(), "missing.pem")) },
+			Err:    true,
+		},
+		"missingEnvVar": {
+			Config: func(c *Config) { c.App.PrivateKeySource = EnvVar("TEST_GITHUB_APP_KEY_MISSING") },
+			Err:    true,
+		},
+		"invalidKey": {
+			Config: func(c *Config) { c.App.PrivateKey = "not a key" },
+			Err:    true,
+		},
+		"noKey": {
+			Config: func(c *Config) {},
+			Err:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var c Config
+			test.Config(&c)
+
+			b, err := c.LoadPrivateKey()
+			if test.Err {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(test.Expected, b) {
+				t.Error("loaded incorrect private key")
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// ErrNoCommits is returned by CreatePullRequest if the head branch has no
+// commits that are not in the base branch.
+var ErrNoCommits = errors.New("no commits between base and head")
+
+// PRRequest describes a pull request created by CreatePullRequest.
+type PRRequest struct {
+	Owner string
+	Repo  string
+
+	Title string
+	Body  string
+	Draft bool
+
+	// Base is the branch that the changes are merged into. If empty, the
+	// repository's default branch is used.
+	Base string
+
+	// Head is the branch that contains the changes. If the branch does not
+	// exist, it is created from Base.
+	Head string
+
+	// Files and Delete are committed to Head with CommitFiles before the pull
+	// request is opened. If both are empty, no commit is created.
+	Files  map[string][]byte
+	Delete []string
+
+	// Message is the message of the commit. If empty, Title is used.
+	Message string
+
+	// Author is the author of the commit. If nil, GitHub uses the app as the
+	// author.
+	Author *github.CommitAuthor
+
+	// Labels, Reviewers, and TeamReviewers are added to the pull request
+	// after it is created. Reviewers are user logins and TeamReviewers are
+	// slugs of teams in the repository owner's organization.
+	Labels        []string
+	Reviewers     []string
+	TeamReviewers []string
+}
+
+// CreatePullRequest opens a pull request from the head branch to the base
+// branch. If the request includes files, it first commits them to the head
+// branch, creating the branch from the base branch if it does not exist.
+//
+// If the head branch has no commits that are not in the base branch, GitHub
+// rejects the pull request and CreatePullRequest returns an error that
+// matches ErrNoCommits with errors.Is. A head branch created by the call is
+// deleted in this case.
+//
+// Labels and reviewers are added after the pull request is created with
+// AddLabels and RequestReviewers. If any of them fail, CreatePullRequest
+// returns both the pull request and the error.
+func CreatePullRequest(ctx context.Context, client *github.Client, req PRRequest) (*github.PullRequest, error) {
+	if req.Head == "" {
+		return nil, errors.New("pull request must set a head branch")
+	}
+	if req.Title == "" {
+		return nil, errors.New("pull request must set a title")
+	}
+
+	base := req.Base
+	if base == "" {
+		var err error
+		if base, err = DefaultBranch(ctx, client, req.Owner, req.Repo); err != nil {
+			return nil, err
+		}
+	}
+
+	createdBranch, err := preparePullRequestHead(ctx, client, req, base)
+	if err != nil {
+		return nil, err
+	}
+
+	newPR := &github.NewPullRequest{
+		Title: github.String(req.Title),
+		Head:  github.String(req.Head),
+		Base:  github.String(base),
+		Body:  optionalString(req.Body),
+		Draft: github.Bool(req.Draft),
+	}
+
+	var pr *github.PullRequest
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped pull request creation", "owner", req.Owner, "repo", req.Repo, "head", req.Head, "base", base)
+		pr = &github.PullRequest{
+			NodeID: github.String(DryRunNodeID),
+			State:  github.String("open"),
+			Title:  newPR.Title,
+			Body:   newPR.Body,
+			Draft:  newPR.Draft,
+			Head:   &github.PullRequestBranch{Ref: newPR.Head},
+			Base:   &github.PullRequestBranch{Ref: newPR.Base},
+		}
+	} else {
+		pr, _, err = client.PullRequests.Create(ctx, req.Owner, req.Repo, newPR)
+	}
+	if err != nil {
+		if isNoCommits(err) {
+			if createdBranch {
+				// the branch is only useful for the pull request, so remove it
+				// instead of leaving an empty branch behind
+				_, _ = client.Git.DeleteRef(ctx, req.Owner, req.Repo, "heads/"+req.Head)
+			}
+			return nil, errors.Wrapf(ErrNoCommits, "failed to create pull request from %q to %q", req.Head, base)
+		}
+		return nil, errors.Wrap(err, "failed to create pull request")
+	}
+
+	if _, err := AddLabels(ctx, client, req.Owner, req.Repo, pr.GetNumber(), req.Labels...); err != nil {
+		return pr, errors.Wrapf(err, "failed to add labels to pull request %d", pr.GetNumber())
+	}
+
+	reviewers := append([]string{}, req.Reviewers...)
+	for _, team := range req.TeamReviewers {
+		reviewers = append(reviewers, req.Owner+"/"+team)
+	}
+	if _, err := RequestReviewers(ctx, client, req.Owner, req.Repo, pr.GetNumber(), reviewers...); err != nil {
+		return pr, errors.Wrapf(err, "failed to request reviewers for pull request %d", pr.GetNumber())
+	}
+
+	return pr, nil
+}
+
+// preparePullRequestHead commits the files in a request to the head branch
+// or creates the head branch if it does not exist and there are no files. It
+// returns true if it created the branch.
+func preparePullRequestHead(ctx context.Context, client *github.Client, req PRRequest, base string) (bool, error) {
+	if len(req.Files) > 0 || len(req.Delete) > 0 {
+		message := req.Message
+		if message == "" {
+			message = req.Title
+		}
+		res, err := CommitFiles(ctx, client, CommitRequest{
+			Owner:      req.Owner,
+			Repo:       req.Repo,
+			Branch:     req.Head,
+			BaseBranch: base,
+			Message:    message,
+			Author:     req.Author,
+			Files:      req.Files,
+			Delete:     req.Delete,
+		})
+		if err != nil {
+			return false, err
+		}
+		return res.CreatedBranch, nil
+	}
+
+	baseSHA, err := branchHead(ctx, client, req.Owner, req.Repo, base)
+	if err != nil {
+		return false, err
+	}
+	if baseSHA == "" {
+		return false, errors.Errorf("base branch %q does not exist", base)
+	}
+	return EnsureBranch(ctx, client, req.Owner, req.Repo, req.Head, baseSHA, false)
+}
+
+// isNoCommits returns true if err is the response GitHub sends when creating
+// a pull request for a head branch with no new commits.
+func isNoCommits(err error) bool {
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Response == nil || rerr.Response.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	for _, e := range rerr.Errors {
+		if strings.HasPrefix(e.Message, "No commits between") {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestReviewers requests reviews of a pull request. Reviewers are user
+// logins or team slugs in the form "org/team"; a leading "@" is ignored. If
+// GitHub rejects the request, for example because one user is not a
+// collaborator, each reviewer is requested separately so the others are still
+// requested. The returned error is non-nil if any review was not requested and
+// is the same as the result's Err.
+func RequestReviewers(ctx context.Context, client *github.Client, owner, repo string, number int, reviewers ...string) (PartialResult, error) {
+	if IsDryRun(ctx) {
+		return dryRunEach(ctx, "skipped review requests", owner, repo, number, reviewers), nil
+	}
+
+	res := applyEach(uniqueItems(reviewers), func(items []string) error {
+		var req github.ReviewersRequest
+		for _, item := range items {
+			name := strings.TrimPrefix(item, "@")
+			if i := strings.Index(name, "/"); i >= 0 {
+				req.TeamReviewers = append(req.TeamReviewers, name[i+1:])
+			} else {
+				req.Reviewers = append(req.Reviewers, name)
+			}
+		}
+		_, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, number, req)
+		return err
+	})
+	return res, res.Err()
+}
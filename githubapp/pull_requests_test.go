@@ -0,0 +1,185 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCreatePullRequest(t *testing.T) {
+	tests := map[string]struct {
+		Branches   map[string]string
+		Request    PRRequest
+		NoCommits  bool
+		LabelError bool
+
+		Error      error
+		RefRequest string
+		Base       string
+		Labels     int
+		Reviewers  int
+	}{
+		"existingBranch": {
+			Branches:   map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			Request:    PRRequest{Head: "feature"},
+			RefRequest: "POST /repos/owner/repo/git/refs",
+			Base:       "main",
+		},
+		"commitsFiles": {
+			Branches: map[string]string{"develop": "base-sha"},
+			Request: PRRequest{
+				Head:  "feature",
+				Base:  "develop",
+				Files: map[string][]byte{"a.txt": []byte("a")},
+			},
+			RefRequest: "POST /repos/owner/repo/git/refs",
+			Base:       "develop",
+		},
+		"labelsAndReviewers": {
+			Branches: map[string]string{"main": "base-sha", "feature": "feature-sha"},
+			Request: PRRequest{
+				Head:          "feature",
+				Labels:        []string{"bot"},
+				Reviewers:     []string{"octocat"},
+				TeamReviewers: []string{"maintainers"},
+			},
+			RefRequest: "POST /repos/owner/repo/git/refs",
+			Base:       "main",
+			Labels:     1,
+			Reviewers:  2,
+		},
+		"noCommitsDeletesCreatedBranch": {
+			Branches:   map[string]string{"main": "base-sha"},
+			Request:    PRRequest{Head: "feature"},
+			NoCommits:  true,
+			Error:      ErrNoCommits,
+			RefRequest: "DELETE /repos/owner/repo/git/refs/heads/feature",
+		},
+		"noCommitsKeepsExistingBranch": {
+			Branches:   map[string]string{"main": "base-sha", "feature": "base-sha"},
+			Request:    PRRequest{Head: "feature"},
+			NoCommits:  true,
+			Error:      ErrNoCommits,
+			RefRequest: "POST /repos/owner/repo/git/refs",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestGitServer(t, test.Branches)
+
+			var base string
+			var labels, reviewers int
+			srv.Mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				if test.NoCommits {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					fmt.Fprint(w, `{"message":"Validation Failed","errors":[{"resource":"PullRequest","code":"custom","message":"No commits between main and feature"}]}`)
+					return
+				}
+				var pr struct {
+					Base string `json:"base"`
+				}
+				srv.decode(t, r, &pr)
+				base = pr.Base
+				fmt.Fprint(w, `{"number":7}`)
+			})
+			srv.Mux.HandleFunc("/repos/owner/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+				var body []string
+				srv.decode(t, r, &body)
+				labels = len(body)
+				fmt.Fprint(w, `[]`)
+			})
+			srv.Mux.HandleFunc("/repos/owner/repo/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+				var body map[string][]string
+				srv.decode(t, r, &body)
+				reviewers = len(body["reviewers"]) + len(body["team_reviewers"])
+				fmt.Fprint(w, `{"number":7}`)
+			})
+
+			req := test.Request
+			req.Owner, req.Repo, req.Title = "owner", "repo", "Update files"
+
+			pr, err := CreatePullRequest(context.Background(), srv.Client(), req)
+			if test.Error != nil {
+				if !errors.Is(err, test.Error) {
+					t.Fatalf("expected error %v, but got %v", test.Error, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertField(t, "pull request number", 7, pr.GetNumber())
+			}
+
+			assertField(t, "ref request", test.RefRequest, srv.RefRequest)
+			assertField(t, "base", test.Base, base)
+			assertField(t, "label count", test.Labels, labels)
+			assertField(t, "reviewer count", test.Reviewers, reviewers)
+		})
+	}
+}
+
+func TestCreatePullRequestValidation(t *testing.T) {
+	srv := newTestGitServer(t, map[string]string{"main": "base-sha"})
+
+	if _, err := CreatePullRequest(context.Background(), srv.Client(), PRRequest{Owner: "owner", Repo: "repo", Title: "Title"}); err == nil {
+		t.Error("expected error for missing head, but got nil")
+	}
+	if _, err := CreatePullRequest(context.Background(), srv.Client(), PRRequest{Owner: "owner", Repo: "repo", Head: "feature"}); err == nil {
+		t.Error("expected error for missing title, but got nil")
+	}
+}
+
+func TestRequestReviewers(t *testing.T) {
+	tests := map[string]struct {
+		Reviewers []string
+
+		Succeeded []string
+		Failed    []string
+		Requests  int
+	}{
+		"usersAndTeams": {
+			Reviewers: []string{"octocat", "@owner/maintainers"},
+			Succeeded: []string{"octocat", "@owner/maintainers"},
+			Requests:  1,
+		},
+		"invalidUser": {
+			Reviewers: []string{"octocat", "ghost", "owner/maintainers"},
+			Succeeded: []string{"octocat", "owner/maintainers"},
+			Failed:    []string{"ghost"},
+			Requests:  4,
+		},
+		"missingTeam": {
+			Reviewers: []string{"owner/missing"},
+			Failed:    []string{"owner/missing"},
+			Requests:  1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestIssueServer(t)
+
+			res, err := RequestReviewers(context.Background(), srv.Client(), "owner", "repo", 7, test.Reviewers...)
+			assertPartialResult(t, res, err, test.Succeeded, test.Failed)
+			assertField(t, "request count", test.Requests, srv.Requests)
+		})
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Job is a webhook event waiting in a Queue. Jobs encode to JSON with
+// encoding/json so that a queue can store them outside of the process and a
+// different process can handle them.
+type Job struct {
+	EventType      string    `json:"event_type"`
+	DeliveryID     string    `json:"delivery_id"`
+	InstallationID int64     `json:"installation_id,omitempty"`
+	Payload        []byte    `json:"payload"`
+	EnqueuedAt     time.Time `json:"enqueued_at"`
+
+	// ctx is the context of the request that created the job. It is only
+	// available when the job does not leave the process.
+	ctx context.Context
+}
+
+// Queue stores jobs between the dispatcher and the workers that run event
+// handlers. Implementations backed by an external service, like Redis or SQS,
+// allow jobs to survive restarts and to be shared by multiple processes.
+//
+// Queues that deliver jobs at least once may deliver a job more than once, so
+// handlers should tolerate duplicate deliveries.
+type Queue interface {
+	// Enqueue adds a job to the queue. If the queue is full, it returns
+	// ErrCapacityExceeded.
+	Enqueue(ctx context.Context, job Job) error
+
+	// Dequeue removes a job from the queue, blocking until a job is available
+	// or ctx is done. When the dispatcher shuts down, it calls Dequeue with a
+	// canceled context: queues that only store jobs in memory should return
+	// their remaining jobs before returning ctx.Err(), while other queues may
+	// return ctx.Err() immediately and leave jobs for another process.
+	Dequeue(ctx context.Context) (Job, error)
+}
+
+// NewMemoryQueue returns a Queue that stores up to size jobs in memory. If the
+// queue is full, Enqueue waits up to timeout for space before returning
+// ErrCapacityExceeded. Jobs from a memory queue keep the context of the
+// request that created them.
+func NewMemoryQueue(size int, timeout time.Duration) Queue {
+	if size < 0 {
+		panic("NewMemoryQueue: queue size must be non-negative")
+	}
+	return &memoryQueue{
+		jobs:    make(chan Job, size),
+		timeout: timeout,
+	}
+}
+
+type memoryQueue struct {
+	jobs    chan Job
+	timeout time.Duration
+}
+
+func (q *memoryQueue) Enqueue(ctx context.Context, job Job) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+	}
+
+	if q.timeout > 0 {
+		t := time.NewTimer(q.timeout)
+		defer t.Stop()
+
+		select {
+		case q.jobs <- job:
+			return nil
+		case <-t.C:
+		case <-ctx.Done():
+		}
+	}
+	return ErrCapacityExceeded
+}
+
+func (q *memoryQueue) Dequeue(ctx context.Context) (Job, error) {
+	// return queued jobs even if the context is done to drain the queue
+	select {
+	case job := <-q.jobs:
+		return job, nil
+	default:
+	}
+
+	select {
+	case job := <-q.jobs:
+		return job, nil
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+}
+
+func (q *memoryQueue) Len() int {
+	return len(q.jobs)
+}
+
+// jobRetryDelay is how long a worker waits after a Dequeue error
+const jobRetryDelay = time.Second
+
+// jobScheduler is a scheduler that converts dispatches to jobs and handles
+// them in a fixed number of worker goroutines. The handler for each job is
+// found by event type, since jobs from other processes do not include one.
+type jobScheduler struct {
+	scheduler
+
+	q          Queue
+	handler    func(eventType string, payload []byte) (EventHandler, bool)
+	decorate   ContextDecorator
+	fieldNames *FieldNames
+	base       context.Context
+
+	mu       sync.RWMutex
+	closed   bool
+	stopping chan struct{}
+	stopCtx  context.Context
+	stop     context.CancelFunc
+	stopOnce sync.Once
+
+	workers        sync.WaitGroup
+	abandoned      int32
+	abandonedCount int64
+}
+
+func newJobScheduler(q Queue, base context.Context, opts ...SchedulerOption) *jobScheduler {
+	if base == nil {
+		base = context.Background()
+	}
+
+	s := &jobScheduler{
+		scheduler: scheduler{
+			deriver: DefaultContextDeriver,
+			onError: DefaultAsyncErrorCallback,
+			keys:    newKeyedRunner(),
+		},
+		q:        q,
+		base:     base,
+		stopping: make(chan struct{}),
+	}
+	s.stopCtx, s.stop = context.WithCancel(context.Background())
+	if lq, ok := q.(interface{ Len() int }); ok {
+		s.queueLen = lq.Len
+	}
+	for _, opt := range opts {
+		opt(&s.scheduler)
+	}
+
+	s.maxKeyed = maxKeyedDispatches(DefaultAsyncQueueSize)
+	if mq, ok := q.(*memoryQueue); ok {
+		s.maxKeyed = maxKeyedDispatches(cap(mq.jobs))
+	}
+	return s
+}
+
+// start starts the workers. It must be called once before events are
+// scheduled.
+func (s *jobScheduler) start(workers int, handler func(string, []byte) (EventHandler, bool), decorate ContextDecorator, fieldNames *FieldNames) {
+	s.handler = handler
+	s.decorate = decorate
+	s.fieldNames = fieldNames
+
+	s.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+}
+
+func (s *jobScheduler) work() {
+	defer s.workers.Done()
+
+	for {
+		// leave jobs in the queue while too many wait for their keys
+		s.keys.waitBelow(s.maxKeyed)
+
+		job, err := s.q.Dequeue(s.stopCtx)
+		if err != nil {
+			if s.stopCtx.Err() != nil {
+				return
+			}
+			LoggerFromContext(s.base).Error("Failed to dequeue webhook event", "error", err)
+			_ = sleepContext(s.stopCtx, jobRetryDelay)
+			continue
+		}
+		if s.abandon() {
+			continue
+		}
+		s.run(job)
+	}
+}
+
+func (s *jobScheduler) run(job Job) {
+	ctx := job.ctx
+	if ctx == nil {
+		// jobs from other processes use the field names of this dispatcher
+		ctx = s.derive(s.base)
+		if s.fieldNames != nil {
+			ctx = WithFieldNames(ctx, *s.fieldNames)
+		}
+		ctx = withDelivery(s.decorate(ctx), job.EventType, job.DeliveryID)
+	}
+
+	d := Dispatch{
+		EventType:  job.EventType,
+		DeliveryID: job.DeliveryID,
+		Payload:    job.Payload,
+	}
+
+	h, ok := s.handler(job.EventType, job.Payload)
+	if !ok {
+		if s.onError != nil {
+			s.onError(ctx, d, errors.Errorf("no handler for %s event", job.EventType))
+		}
+		return
+	}
+	d.Handler = h
+
+	// jobs waiting for a scheduling key may start after shutdown abandons
+	// the remaining jobs
+	s.runKeyed(d, func() {
+		if s.abandon() {
+			return
+		}
+		if s.eventAge != nil && !job.EnqueuedAt.IsZero() {
+			s.eventAge.Update(time.Since(job.EnqueuedAt).Milliseconds())
+		}
+		s.safeExecute(ctx, d)
+	})
+}
+
+// abandon returns true and counts the job as dropped if shutdown abandoned
+// the remaining jobs.
+func (s *jobScheduler) abandon() bool {
+	if atomic.LoadInt32(&s.abandoned) != 0 {
+		atomic.AddInt64(&s.abandonedCount, 1)
+		return true
+	}
+	return false
+}
+
+func (s *jobScheduler) Schedule(ctx context.Context, d Dispatch) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrSchedulerClosed
+	}
+
+	job := Job{
+		EventType:  d.EventType,
+		DeliveryID: d.DeliveryID,
+		Payload:    d.Payload,
+		EnqueuedAt: time.Now(),
+		ctx:        s.derive(ctx),
+	}
+
+	var event struct {
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+	}
+	if err := json.Unmarshal(d.Payload, &event); err == nil {
+		job.InstallationID = event.Installation.ID
+	}
+
+	// stop waiting for space in the queue if the scheduler shuts down
+	enqueueCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-enqueueCtx.Done():
+		}
+	}()
+
+	if err := s.q.Enqueue(enqueueCtx, job); err != nil {
+		select {
+		case <-s.stopping:
+			return ErrSchedulerClosed
+		default:
+		}
+		if errors.Is(err, ErrCapacityExceeded) {
+			if s.dropped != nil {
+				s.dropped.Inc(1)
+			}
+			return ErrCapacityExceeded
+		}
+		return errors.Wrap(err, "failed to enqueue event")
+	}
+	return nil
+}
+
+func (s *jobScheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		// release any Schedule calls waiting for space before closing
+		close(s.stopping)
+
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		// workers drain the queue with a canceled context
+		s.stop()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// stop workers from starting jobs and drop jobs that remain in memory,
+	// including jobs waiting for their keys
+	atomic.StoreInt32(&s.abandoned, 1)
+	atomic.AddInt64(&s.abandonedCount, int64(s.keys.drop()))
+	for {
+		if _, err := s.q.Dequeue(s.stopCtx); err != nil {
+			break
+		}
+		atomic.AddInt64(&s.abandonedCount, 1)
+	}
+
+	dropped := int(atomic.LoadInt64(&s.abandonedCount))
+	if s.dropped != nil {
+		s.dropped.Inc(int64(dropped))
+	}
+	return ShutdownError{Dropped: dropped, Cause: ctx.Err()}
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	t.Run("rejectsJobsWhenFull", func(t *testing.T) {
+		q := NewMemoryQueue(1, 0)
+		ctx := context.Background()
+
+		if err := q.Enqueue(ctx, Job{DeliveryID: "1"}); err != nil {
+			t.Fatalf("unexpected error enqueuing first job: %v", err)
+		}
+		if err := q.Enqueue(ctx, Job{DeliveryID: "2"}); err != ErrCapacityExceeded {
+			t.Fatalf("expected ErrCapacityExceeded, but got: %v", err)
+		}
+	})
+
+	t.Run("waitsForSpace", func(t *testing.T) {
+		q := NewMemoryQueue(1, timeout)
+		ctx := context.Background()
+
+		if err := q.Enqueue(ctx, Job{DeliveryID: "1"}); err != nil {
+			t.Fatalf("unexpected error enqueuing first job: %v", err)
+		}
+		go func() {
+			time.Sleep(timeout / 4)
+			_, _ = q.Dequeue(ctx)
+		}()
+		if err := q.Enqueue(ctx, Job{DeliveryID: "2"}); err != nil {
+			t.Fatalf("unexpected error enqueuing second job: %v", err)
+		}
+	})
+
+	t.Run("drainsWithCanceledContext", func(t *testing.T) {
+		q := NewMemoryQueue(2, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		for _, id := range []string{"1", "2"} {
+			if err := q.Enqueue(ctx, Job{DeliveryID: id}); err != nil {
+				t.Fatalf("unexpected error enqueuing job %s: %v", id, err)
+			}
+		}
+		cancel()
+
+		for _, id := range []string{"1", "2"} {
+			job, err := q.Dequeue(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error dequeuing job %s: %v", id, err)
+			}
+			if job.DeliveryID != id {
+				t.Errorf("incorrect job: expected %s, actual %s", id, job.DeliveryID)
+			}
+		}
+		if _, err := q.Dequeue(ctx); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, but got: %v", err)
+		}
+	})
+}
+
+func TestJobJSON(t *testing.T) {
+	job := Job{
+		EventType:      "pull_request",
+		DeliveryID:     "delivery",
+		InstallationID: 42,
+		Payload:        []byte(`{"action":"opened"}`),
+		EnqueuedAt:     time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+		ctx:            context.Background(),
+	}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("unexpected error encoding job: %v", err)
+	}
+
+	var decoded Job
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding job: %v", err)
+	}
+
+	job.ctx = nil
+	if !reflect.DeepEqual(job, decoded) {
+		t.Errorf("incorrect decoded job:\nexpected: %+v\n  actual: %+v", job, decoded)
+	}
+}
+
+func TestAsyncDispatcherQueue(t *testing.T) {
+	called := make(chan string, 1)
+	h := TestEventHandler{
+		Types: []string{"pull_request"},
+		Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+			called <- deliveryID
+			return nil
+		},
+	}
+
+	q := &jsonQueue{jobs: make(chan []byte, 1)}
+	d := NewAsyncDispatcher([]EventHandler{&h}, testHookSecret, AsyncConfig{Workers: 1, Queue: q})
+
+	res := httptest.NewRecorder()
+	d.ServeHTTP(res, newHookRequest("pull_request", "queued-delivery", true))
+	if res.Code != http.StatusAccepted {
+		t.Errorf("incorrect response code: expected %d, actual %d", http.StatusAccepted, res.Code)
+	}
+
+	select {
+	case id := <-called:
+		if id != "queued-delivery" {
+			t.Errorf("incorrect delivery ID: %q", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	var job Job
+	if err := json.Unmarshal(q.last, &job); err != nil {
+		t.Fatalf("unexpected error decoding job: %v", err)
+	}
+	if job.EventType != "pull_request" || job.DeliveryID != "queued-delivery" {
+		t.Errorf("incorrect job: %+v", job)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error shutting down: %v", err)
+	}
+}
+
+func TestAsyncFieldNames(t *testing.T) {
+	names := FieldNames{EventType: "github.event", DeliveryID: "github.delivery"}
+
+	tests := map[string]func(h EventHandler) (http.Handler, func()){
+		"asyncScheduler": func(h EventHandler) (http.Handler, func()) {
+			return NewEventDispatcher([]EventHandler{h}, testHookSecret, WithScheduler(AsyncScheduler()), WithLogFieldNames(names)), func() {}
+		},
+		"memoryQueue": func(h EventHandler) (http.Handler, func()) {
+			d := NewAsyncDispatcher([]EventHandler{h}, testHookSecret, AsyncConfig{Workers: 1}, WithLogFieldNames(names))
+			return d, func() { _ = d.Shutdown(context.Background()) }
+		},
+		"sharedQueue": func(h EventHandler) (http.Handler, func()) {
+			q := &jsonQueue{jobs: make(chan []byte, 1)}
+			d := NewAsyncDispatcher([]EventHandler{h}, testHookSecret, AsyncConfig{Workers: 1, Queue: q}, WithLogFieldNames(names))
+			return d, func() { _ = d.Shutdown(context.Background()) }
+		},
+	}
+
+	for name, newDispatcher := range tests {
+		t.Run(name, func(t *testing.T) {
+			called := make(chan FieldNames, 1)
+			h := TestEventHandler{
+				Types: []string{"pull_request"},
+				Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					called <- FieldNamesFromContext(ctx)
+					return nil
+				},
+			}
+
+			d, shutdown := newDispatcher(&h)
+			defer shutdown()
+
+			d.ServeHTTP(httptest.NewRecorder(), newHookRequest("pull_request", "names", true))
+
+			select {
+			case actual := <-called:
+				assertField(t, "event type field", names.EventType, actual.EventType)
+				assertField(t, "delivery ID field", names.DeliveryID, actual.DeliveryID)
+				assertField(t, "installation ID field", LogKeyInstallationID, actual.InstallationID)
+			case <-time.After(time.Second):
+				t.Fatal("handler was not called")
+			}
+		})
+	}
+}
+
+// jsonQueue stores encoded jobs to simulate a queue shared by processes
+type jsonQueue struct {
+	jobs chan []byte
+	last []byte
+}
+
+func (q *jsonQueue) Enqueue(ctx context.Context, job Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	q.last = b
+
+	select {
+	case q.jobs <- b:
+		return nil
+	default:
+		return ErrCapacityExceeded
+	}
+}
+
+func (q *jsonQueue) Dequeue(ctx context.Context) (Job, error) {
+	var job Job
+	select {
+	case b := <-q.jobs:
+		return job, errors.Wrap(json.Unmarshal(b, &job), "failed to decode job")
+	case <-ctx.Done():
+		return job, ctx.Err()
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/gregjones/httpcache"
+)
+
+// RateLimit is the most recent rate limit state observed for an installation.
+type RateLimit struct {
+	// Resource is the rate limit category that applies to the request, like
+	// "core", "search", or "graphql". Each resource has an independent limit.
+	Resource string
+
+	Limit     int
+	Remaining int
+	Used      int
+	Reset     time.Time
+}
+
+// rateLimitTracker records rate limit headers from responses, keyed by
+// installation ID.
+type rateLimitTracker struct {
+	mu     sync.RWMutex
+	limits map[int64]RateLimit
+}
+
+func newRateLimitTracker() *rateLimitTracker {
+	return &rateLimitTracker{
+		limits: make(map[int64]RateLimit),
+	}
+}
+
+func (t *rateLimitTracker) Get(installationID int64) (RateLimit, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	limit, ok := t.limits[installationID]
+	return limit, ok
+}
+
+func (t *rateLimitTracker) update(installationID int64, limit RateLimit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limits[installationID] = limit
+}
+
+// middleware returns a ClientMiddleware that updates the tracker with the
+// rate limit headers of every response for the installation.
+func (t *rateLimitTracker) middleware(installationID int64) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+
+			// cached responses contain the headers from the original request,
+			// which may no longer reflect the current limits
+			if res != nil && res.Header.Get(httpcache.XFromCache) == "" {
+				if limit, ok := parseRateLimit(res.Header); ok {
+					t.update(installationID, limit)
+				}
+			}
+
+			return res, err
+		})
+	}
+}
+
+type rateKey struct{}
+
+// rateRecorder stores the most recent rate limit for a context.
+type rateRecorder struct {
+	mu   sync.Mutex
+	rate github.Rate
+	ok   bool
+}
+
+// WithRateTracking returns a context that records the rate limit headers of
+// each response to a request made with the context by a client from a
+// ClientCreator. Use LastRate to get the rate limit from the most recent
+// response, for example to skip optional work when few requests remain.
+func WithRateTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateKey{}, &rateRecorder{})
+}
+
+// LastRate returns the rate limit from the most recent response to a request
+// made with ctx. The context must be prepared by WithRateTracking. It is safe
+// to call LastRate while requests are in progress, but if requests run
+// concurrently with the same context, the rate may belong to any of the
+// requests. It returns false if tracking is not enabled or no responses
+// included rate limit headers.
+//
+// Each resource, like "core" or "search", has an independent limit, so the
+// rate only applies to requests for the same resource as the last request.
+func LastRate(ctx context.Context) (github.Rate, bool) {
+	r, ok := ctx.Value(rateKey{}).(*rateRecorder)
+	if !ok {
+		return github.Rate{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rate, r.ok
+}
+
+// recordRate is middleware that records the rate limit of responses in the
+// request context, if tracking is enabled.
+func recordRate(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(r)
+		if rec, ok := r.Context().Value(rateKey{}).(*rateRecorder); ok {
+			if res != nil && res.Header.Get(httpcache.XFromCache) == "" {
+				if limit, ok := parseRateLimit(res.Header); ok {
+					rec.mu.Lock()
+					rec.rate = github.Rate{
+						Limit:     limit.Limit,
+						Remaining: limit.Remaining,
+						Reset:     github.Timestamp{Time: limit.Reset},
+					}
+					rec.ok = true
+					rec.mu.Unlock()
+				}
+			}
+		}
+		return res, err
+	})
+}
+
+// parseRateLimit extracts rate limit information from response headers. It
+// returns false if the headers do not contain rate limit information.
+//
+// See https://docs.github.com/en/rest/overview/resources-in-the-rest-api#rate-limit-http-headers
+func parseRateLimit(h http.Header) (RateLimit, bool) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	limit := RateLimit{
+		Resource:  h.Get("X-RateLimit-Resource"),
+		Remaining: remaining,
+	}
+	if limit.Resource == "" {
+		limit.Resource = "core"
+	}
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Limit")); err == nil {
+		limit.Limit = v
+	}
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Used")); err == nil {
+		limit.Used = v
+	}
+	if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		limit.Reset = time.Unix(v, 0)
+	}
+	return limit, true
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gregjones/httpcache"
+)
+
+func TestRateLimitTracker(t *testing.T) {
+	tracker := newRateLimitTracker()
+
+	headers := http.Header{}
+	next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: headers.Clone()}, nil
+	})
+	rt := tracker.middleware(42)(next)
+
+	send := func() {
+		req := httptest.NewRequest(http.MethodGet, "/repos/palantir/go-githubapp", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	send()
+	if _, ok := tracker.Get(42); ok {
+		t.Fatal("expected no rate limit for response without headers")
+	}
+
+	headers.Set("X-RateLimit-Limit", "5000")
+	headers.Set("X-RateLimit-Remaining", "4990")
+	headers.Set("X-RateLimit-Used", "10")
+	headers.Set("X-RateLimit-Reset", "1700000000")
+	headers.Set("X-RateLimit-Resource", "core")
+	send()
+
+	limit, ok := tracker.Get(42)
+	if !ok {
+		t.Fatal("expected rate limit for installation, but none was found")
+	}
+	assertField(t, "resource", "core", limit.Resource)
+	assertField(t, "limit", 5000, limit.Limit)
+	assertField(t, "remaining", 4990, limit.Remaining)
+	assertField(t, "used", 10, limit.Used)
+	assertField(t, "reset", time.Unix(1700000000, 0), limit.Reset)
+
+	headers.Set("X-RateLimit-Remaining", "0")
+	headers.Set(httpcache.XFromCache, "1")
+	send()
+
+	limit, _ = tracker.Get(42)
+	assertField(t, "remaining after cached response", 4990, limit.Remaining)
+
+	if _, ok := tracker.Get(7); ok {
+		t.Fatal("expected no rate limit for unknown installation")
+	}
+}
+
+func TestLastRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/palantir/go-githubapp" {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "4321")
+			w.Header().Set("X-RateLimit-Reset", "1700000000")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	cc := NewClientCreator(server.URL, server.URL, 1, nil)
+	client, err := cc.NewTokenClient("token")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	if _, ok := LastRate(context.Background()); ok {
+		t.Error("expected no rate for untracked context")
+	}
+
+	ctx := WithRateTracking(context.Background())
+	if _, ok := LastRate(ctx); ok {
+		t.Error("expected no rate before any requests")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = LastRate(ctx)
+		}
+	}()
+
+	if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	<-done
+
+	rate, ok := LastRate(ctx)
+	if !ok {
+		t.Fatal("expected rate after request")
+	}
+	assertField(t, "limit", 5000, rate.Limit)
+	assertField(t, "remaining", 4321, rate.Remaining)
+	assertField(t, "reset", time.Unix(1700000000, 0).Unix(), rate.Reset.Unix())
+
+	if _, _, err := client.Repositories.Get(ctx, "palantir", "no-rate"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	rate, _ = LastRate(ctx)
+	assertField(t, "remaining after response without rate", 4321, rate.Remaining)
+}
@@ -0,0 +1,213 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithRateLimitWaiter makes clients wait for the primary rate limit to reset
+// instead of returning an error when GitHub rejects a request because the
+// limit is exhausted. If the limit resets within maxWait, the client waits
+// until the reset time and retries the request once. Otherwise, the rate
+// limit response is returned immediately. Waiting stops if the request
+// context is canceled.
+//
+// Requests from the same client share the rate limit state: once a request
+// finds the limit exhausted, other requests for the same resource wait for
+// the reset without contacting GitHub. After the reset, one request is sent
+// first and the others wait for its response, so that they do not all fail
+// again if the limit is still exhausted.
+//
+// This is intended for batch jobs that prefer to wait rather than fail. It
+// should not be used by webhook handlers, which must respond quickly. Requests
+// with a body are only retried if the body can be recreated using the
+// request's GetBody function.
+func WithRateLimitWaiter(maxWait time.Duration) ClientOption {
+	return func(c *clientCreator) {
+		c.rateLimitMaxWait = maxWait
+	}
+}
+
+func rateLimitWaiter(maxWait time.Duration) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		var mu sync.Mutex
+		gates := make(map[string]*rateLimitGate)
+
+		gate := func(r *http.Request) *rateLimitGate {
+			mu.Lock()
+			defer mu.Unlock()
+
+			resource := rateLimitResource(r)
+			g, ok := gates[resource]
+			if !ok {
+				g = &rateLimitGate{}
+				gates[resource] = g
+			}
+			return g
+		}
+
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			g := gate(r)
+
+			for attempt := 1; ; attempt++ {
+				req := r
+				if attempt > 1 && r.GetBody != nil {
+					body, err := r.GetBody()
+					if err != nil {
+						return nil, err
+					}
+					req = r.Clone(r.Context())
+					req.Body = body
+				}
+
+				probe, err := g.wait(r.Context(), maxWait)
+				if err != nil {
+					closeRequestBody(req)
+					return nil, err
+				}
+
+				res, err := next.RoundTrip(req)
+
+				var reset time.Time
+				if err == nil {
+					reset, _ = primaryRateLimitReset(res)
+				}
+				g.update(reset, probe)
+
+				if reset.IsZero() || attempt > 1 || !canRewindBody(r) {
+					return res, err
+				}
+
+				delay := time.Until(reset)
+				if delay > maxWait {
+					return res, err
+				}
+
+				LoggerFromContext(r.Context()).Info("Waiting for GitHub rate limit to reset",
+					"method", r.Method,
+					"path", r.URL.String(),
+					"status", res.StatusCode,
+					"delay", delay,
+				)
+
+				// discard the body so the connection can be reused
+				_, _ = io.Copy(io.Discard, res.Body)
+				closeBody(res.Body)
+			}
+		})
+	}
+}
+
+// primaryRateLimitReset returns the reset time of the rate limit if res
+// rejected a request because the primary rate limit is exhausted.
+func primaryRateLimitReset(res *http.Response) (time.Time, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+
+	// secondary rate limits set Retry-After instead of relying on the reset
+	if res.Header.Get("Retry-After") != "" {
+		return time.Time{}, false
+	}
+
+	limit, ok := parseRateLimit(res.Header)
+	if !ok || limit.Remaining > 0 || limit.Reset.IsZero() {
+		return time.Time{}, false
+	}
+	return limit.Reset, true
+}
+
+// rateLimitResource returns the rate limit resource that likely applies to a
+// request. Each resource has an independent limit.
+func rateLimitResource(r *http.Request) string {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.Contains(r.URL.Path, "/search/"):
+		return "search"
+	}
+	return "core"
+}
+
+// rateLimitGate delays requests while a rate limit is exhausted.
+type rateLimitGate struct {
+	mu    sync.Mutex
+	reset time.Time
+
+	// probe is closed when the first request sent after the reset completes
+	probe chan struct{}
+}
+
+// wait blocks until a request may be sent. If the limit reset more than
+// maxWait in the future, it returns immediately. If it returns true, the
+// caller is sending the first request after a reset and must call update
+// when the request completes.
+func (g *rateLimitGate) wait(ctx context.Context, maxWait time.Duration) (bool, error) {
+	for {
+		g.mu.Lock()
+		if g.reset.IsZero() {
+			g.mu.Unlock()
+			return false, nil
+		}
+
+		if d := time.Until(g.reset); d > 0 {
+			g.mu.Unlock()
+			if d > maxWait {
+				return false, nil
+			}
+			if err := sleepContext(ctx, d); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		if g.probe == nil {
+			g.probe = make(chan struct{})
+			g.mu.Unlock()
+			return true, nil
+		}
+
+		probe := g.probe
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-probe:
+		}
+	}
+}
+
+// update records the result of a request. A non-zero reset means the request
+// found the limit exhausted. Results of requests sent before the limit was
+// exhausted do not clear the reset time, but the result of a probe does.
+func (g *rateLimitGate) update(reset time.Time, probe bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !reset.IsZero() || probe {
+		g.reset = reset
+	}
+	if probe {
+		close(g.probe)
+		g.probe = nil
+	}
+}
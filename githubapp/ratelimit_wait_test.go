@@ -0,0 +1,176 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRateLimitWaiter(t *testing.T) {
+	tests := map[string]struct {
+		Limited    int
+		Reset      time.Duration
+		RetryAfter bool
+
+		Status   int
+		Requests int32
+	}{
+		"notLimited": {
+			Status:   http.StatusOK,
+			Requests: 1,
+		},
+		"waitsForReset": {
+			Limited:  1,
+			Reset:    -time.Second,
+			Status:   http.StatusOK,
+			Requests: 2,
+		},
+		"retriesOnce": {
+			Limited:  2,
+			Reset:    -time.Second,
+			Status:   http.StatusForbidden,
+			Requests: 2,
+		},
+		"exceedsMaxWait": {
+			Limited:  1,
+			Reset:    time.Hour,
+			Status:   http.StatusForbidden,
+			Requests: 1,
+		},
+		"secondaryRateLimit": {
+			Limited:    1,
+			Reset:      -time.Second,
+			RetryAfter: true,
+			Status:     http.StatusForbidden,
+			Requests:   1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				if int(n) <= test.Limited {
+					w.Header().Set("X-RateLimit-Remaining", "0")
+					w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(test.Reset).Unix(), 10))
+					if test.RetryAfter {
+						w.Header().Set("Retry-After", "1")
+					}
+					writeTestGitHubError(w, http.StatusForbidden, "API rate limit exceeded")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			cc := NewClientCreator(server.URL, server.URL, 1, nil, WithRateLimitWaiter(time.Minute))
+			client, err := cc.NewTokenClient("token")
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			_, res, _ := client.Repositories.Get(context.Background(), "palantir", "go-githubapp")
+			if res == nil {
+				t.Fatal("expected response, but got nil")
+			}
+			if res.StatusCode != test.Status {
+				t.Errorf("incorrect status: expected %d, actual %d", test.Status, res.StatusCode)
+			}
+			if n := atomic.LoadInt32(&requests); n != test.Requests {
+				t.Errorf("incorrect request count: expected %d, actual %d", test.Requests, n)
+			}
+		})
+	}
+}
+
+func TestRateLimitWaiterContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		writeTestGitHubError(w, http.StatusForbidden, "API rate limit exceeded")
+	}))
+	defer server.Close()
+
+	cc := NewClientCreator(server.URL, server.URL, 1, nil, WithRateLimitWaiter(2*time.Hour))
+	client, err := cc.NewTokenClient("token")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err = client.Repositories.Get(ctx, "palantir", "go-githubapp")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, but got %v", err)
+	}
+}
+
+func TestRateLimitGate(t *testing.T) {
+	var g rateLimitGate
+	g.update(time.Now().Add(-time.Second), false)
+
+	const waiters = 5
+
+	var wg sync.WaitGroup
+	var probes int32
+	released := make(chan bool, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probe, err := g.wait(context.Background(), time.Minute)
+			if err != nil {
+				t.Errorf("unexpected error waiting: %v", err)
+				return
+			}
+			if probe {
+				atomic.AddInt32(&probes, 1)
+			}
+			released <- probe
+		}()
+	}
+
+	// exactly one waiter is released to probe the limit
+	if probe := <-released; !probe {
+		t.Fatal("first released waiter was not the probe")
+	}
+	select {
+	case <-released:
+		t.Fatal("waiter was released before the probe completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	g.update(time.Time{}, true)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Errorf("incorrect probe count: expected 1, actual %d", n)
+	}
+	if probe, _ := g.wait(context.Background(), time.Minute); probe {
+		t.Error("request after a successful probe was also a probe")
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// ReleaseAsset is a file to upload to a release with UploadReleaseAsset.
+type ReleaseAsset struct {
+	// Name is the file name of the asset.
+	Name string
+
+	// Label is an optional short description of the asset that GitHub shows
+	// instead of the name.
+	Label string
+
+	// ContentType is the media type of the asset. If empty,
+	// "application/octet-stream" is used.
+	ContentType string
+
+	// Content is the content of the asset. Each attempt reads the content
+	// from the start, so it is not consumed by failed attempts.
+	Content io.ReaderAt
+
+	// Size is the size of the content in bytes.
+	Size int64
+}
+
+// UploadReleaseAsset uploads an asset to the release with the given ID and
+// retries uploads that fail with network errors or 5xx responses, using the
+// attempts and delays of config. The Retryable function of config is not
+// used.
+//
+// A failed upload can leave behind an incomplete asset with the same name,
+// which makes later attempts fail. UploadReleaseAsset deletes incomplete
+// assets before trying again. If a retry finds a complete asset with the same
+// name and size, like when a response is lost after a successful upload, it
+// is returned instead of an error. A complete asset that exists before the
+// first attempt may have different content, so it is never returned: the
+// upload fails with GitHub's validation error instead.
+//
+// Releases that are immutable once published do not accept new assets, so
+// upload assets while the release is still a draft.
+//
+// In dry-run mode, UploadReleaseAsset makes no requests and returns an asset
+// with DryRunNodeID as its node ID.
+func UploadReleaseAsset(ctx context.Context, client *github.Client, owner, repo string, releaseID int64, asset ReleaseAsset, config RetryConfig) (*github.ReleaseAsset, error) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = DefaultRetryBaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultRetryMaxDelay
+	}
+
+	contentType := asset.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped uploading release asset", "owner", owner, "repo", repo, "release", releaseID, "asset", asset.Name)
+		return &github.ReleaseAsset{
+			NodeID:      github.String(DryRunNodeID),
+			Name:        github.String(asset.Name),
+			Label:       github.String(asset.Label),
+			ContentType: github.String(contentType),
+			Size:        github.Int(int(asset.Size)),
+			State:       github.String("uploaded"),
+		}, nil
+	}
+
+	params := url.Values{"name": {asset.Name}}
+	if asset.Label != "" {
+		params.Set("label", asset.Label)
+	}
+	u := fmt.Sprintf("repos/%s/%s/releases/%d/assets?%s", owner, repo, releaseID, params.Encode())
+
+	// retried is true if a previous attempt failed in a way that may hide a
+	// successful upload
+	retried := false
+	for attempt := 1; ; attempt++ {
+		req, err := client.NewUploadRequest(u, io.NewSectionReader(asset.Content, 0, asset.Size), asset.Size, contentType)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create upload request")
+		}
+
+		uploaded := new(github.ReleaseAsset)
+		res, err := client.Do(ctx, req, uploaded)
+		if err == nil {
+			return uploaded, nil
+		}
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(err, "failed to upload asset %s", asset.Name)
+		}
+
+		if isAlreadyExists(err) {
+			existing, findErr := findReleaseAsset(ctx, client, owner, repo, releaseID, asset.Name)
+			if findErr != nil {
+				return nil, findErr
+			}
+			if existing != nil && existing.GetState() == "uploaded" {
+				if !retried {
+					return nil, errors.Wrapf(err, "failed to upload asset %s", asset.Name)
+				}
+				if int64(existing.GetSize()) == asset.Size {
+					return existing, nil
+				}
+				return nil, errors.Errorf("release already has a different asset named %s", asset.Name)
+			}
+			if existing != nil {
+				if _, err := client.Repositories.DeleteReleaseAsset(ctx, owner, repo, existing.GetID()); err != nil {
+					return nil, errors.Wrapf(err, "failed to delete incomplete asset %s", asset.Name)
+				}
+			}
+		} else if res != nil && res.StatusCode < http.StatusInternalServerError {
+			return nil, errors.Wrapf(err, "failed to upload asset %s", asset.Name)
+		} else {
+			retried = true
+		}
+
+		if attempt >= config.MaxAttempts {
+			return nil, errors.Wrapf(err, "failed to upload asset %s after %d attempts", asset.Name, attempt)
+		}
+
+		delay := config.BaseDelay << (attempt - 1)
+		if delay <= 0 || delay > config.MaxDelay {
+			delay = config.MaxDelay
+		}
+
+		LoggerFromContext(ctx).Info("Retrying release asset upload after failure",
+			"asset", asset.Name,
+			"attempt", attempt,
+			"delay", delay,
+			"error", err,
+		)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, errors.Wrapf(err, "failed to upload asset %s", asset.Name)
+		}
+	}
+}
+
+// isAlreadyExists returns true if err is a validation error for a release
+// asset with a name that is already used.
+func isAlreadyExists(err error) bool {
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Response == nil || rerr.Response.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	for _, e := range rerr.Errors {
+		if e.Code == "already_exists" {
+			return true
+		}
+	}
+	return false
+}
+
+// findReleaseAsset returns the asset of a release with the given name or nil
+// if the release has no asset with the name.
+func findReleaseAsset(ctx context.Context, client *github.Client, owner, repo string, releaseID int64, name string) (*github.ReleaseAsset, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		assets, res, err := client.Repositories.ListReleaseAssets(ctx, owner, repo, releaseID, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list assets of release %d", releaseID)
+		}
+		for _, a := range assets {
+			if a.GetName() == name {
+				return a, nil
+			}
+		}
+		if res.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestUploadReleaseAsset(t *testing.T) {
+	content := []byte("release binary")
+
+	tests := map[string]struct {
+		Responses []int
+		Existing  *github.ReleaseAsset
+
+		Uploads int
+		Deleted bool
+		Err     bool
+	}{
+		"success": {
+			Responses: []int{http.StatusCreated},
+			Uploads:   1,
+		},
+		"retryServerError": {
+			Responses: []int{http.StatusBadGateway, http.StatusCreated},
+			Uploads:   2,
+		},
+		"deleteIncompleteAsset": {
+			Responses: []int{http.StatusUnprocessableEntity, http.StatusCreated},
+			Existing:  &github.ReleaseAsset{ID: github.Int64(7), Name: github.String("app.tar.gz"), State: github.String("starter")},
+			Uploads:   2,
+			Deleted:   true,
+		},
+		"existingCompleteAsset": {
+			Responses: []int{http.StatusUnprocessableEntity},
+			Existing:  &github.ReleaseAsset{ID: github.Int64(7), Name: github.String("app.tar.gz"), State: github.String("uploaded"), Size: github.Int(len(content))},
+			Uploads:   1,
+			Err:       true,
+		},
+		"completeAssetAfterRetry": {
+			Responses: []int{http.StatusBadGateway, http.StatusUnprocessableEntity},
+			Existing:  &github.ReleaseAsset{ID: github.Int64(7), Name: github.String("app.tar.gz"), State: github.String("uploaded"), Size: github.Int(len(content))},
+			Uploads:   2,
+		},
+		"existingDifferentAsset": {
+			Responses: []int{http.StatusBadGateway, http.StatusUnprocessableEntity},
+			Existing:  &github.ReleaseAsset{ID: github.Int64(7), Name: github.String("app.tar.gz"), State: github.String("uploaded"), Size: github.Int(1)},
+			Uploads:   2,
+			Err:       true,
+		},
+		"clientError": {
+			Responses: []int{http.StatusNotFound},
+			Uploads:   1,
+			Err:       true,
+		},
+		"tooManyFailures": {
+			Responses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			Uploads:   3,
+			Err:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var uploads int
+			var deleted bool
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/api/uploads/repos/owner/repo/releases/1/assets":
+					body, _ := io.ReadAll(r.Body)
+					if !bytes.Equal(body, content) {
+						writeTestGitHubError(w, http.StatusBadRequest, "incorrect body")
+						return
+					}
+					if r.URL.Query().Get("name") != "app.tar.gz" || r.Header.Get("Content-Type") != "application/gzip" {
+						writeTestGitHubError(w, http.StatusBadRequest, "incorrect name or content type")
+						return
+					}
+
+					status := test.Responses[uploads]
+					uploads++
+
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(status)
+					switch status {
+					case http.StatusCreated:
+						_ = json.NewEncoder(w).Encode(github.ReleaseAsset{ID: github.Int64(8), Name: github.String("app.tar.gz"), State: github.String("uploaded")})
+					case http.StatusUnprocessableEntity:
+						_, _ = w.Write([]byte(`{"message":"Validation Failed","errors":[{"resource":"ReleaseAsset","code":"already_exists","field":"name"}]}`))
+					default:
+						_, _ = w.Write([]byte(`{"message":"upload failed"}`))
+					}
+
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/owner/repo/releases/1/assets":
+					assets := []*github.ReleaseAsset{}
+					if test.Existing != nil && !deleted {
+						assets = append(assets, test.Existing)
+					}
+					_ = json.NewEncoder(w).Encode(assets)
+
+				case r.Method == http.MethodDelete && r.URL.Path == "/api/v3/repos/owner/repo/releases/assets/7":
+					deleted = true
+					w.WriteHeader(http.StatusNoContent)
+
+				default:
+					writeTestGitHubError(w, http.StatusNotFound, "Not Found")
+				}
+			}))
+			defer srv.Close()
+
+			cc := NewClientCreator(srv.URL+"/api/v3", srv.URL+"/api/graphql", 1, nil)
+			client, err := cc.NewTokenClient("secret-token")
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			asset, err := UploadReleaseAsset(context.Background(), client, "owner", "repo", 1, ReleaseAsset{
+				Name:        "app.tar.gz",
+				ContentType: "application/gzip",
+				Content:     bytes.NewReader(content),
+				Size:        int64(len(content)),
+			}, RetryConfig{BaseDelay: time.Millisecond})
+
+			if test.Err {
+				if err == nil {
+					t.Fatalf("expected error uploading asset, but got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error uploading asset: %v", err)
+				}
+				if asset.GetName() != "app.tar.gz" || asset.GetState() != "uploaded" {
+					t.Errorf("incorrect asset: %+v", asset)
+				}
+			}
+
+			if uploads != test.Uploads {
+				t.Errorf("incorrect number of uploads: expected %d, actual %d", test.Uploads, uploads)
+			}
+			if deleted != test.Deleted {
+				t.Errorf("incorrect deletion: expected %t, actual %t", test.Deleted, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	ttlcache "github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBranchCacheExpiry is how long DefaultBranch caches the default
+	// branch of a repository.
+	DefaultBranchCacheExpiry = 5 * time.Minute
+
+	// rawContentMediaType requests the raw content of a file from the
+	// contents API instead of base64-encoded content in a JSON object.
+	rawContentMediaType = "application/vnd.github.raw"
+)
+
+var defaultBranches = ttlcache.New(DefaultBranchCacheExpiry, 2*DefaultBranchCacheExpiry)
+
+// DefaultBranch returns the name of the default branch of a repository, like
+// "main" or "develop". Results are cached for DefaultBranchCacheExpiry, so a
+// changed default branch is used after the cached value expires.
+func DefaultBranch(ctx context.Context, client *github.Client, owner, repo string) (string, error) {
+	key := strings.ToLower(fmt.Sprintf("%s%s/%s", client.BaseURL, owner, repo))
+	if branch, ok := defaultBranches.Get(key); ok {
+		return branch.(string), nil
+	}
+
+	r, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get repository %s/%s", owner, repo)
+	}
+
+	branch := r.GetDefaultBranch()
+	if branch == "" {
+		return "", errors.Errorf("repository %s/%s has no default branch", owner, repo)
+	}
+
+	defaultBranches.Set(key, branch, ttlcache.DefaultExpiration)
+	return branch, nil
+}
+
+// DownloadContents returns a reader for the content of the file at path in
+// owner/repo on ref, or on the default branch if ref is empty. Unlike
+// Repositories.GetContents, the content is streamed from GitHub instead of
+// decoded in memory, and files up to 100MB are supported instead of 1MB. The
+// request uses the client's authentication, so it works for private
+// repositories. The caller must close the reader.
+//
+// If path is a directory, the reader contains a JSON listing of the
+// directory. Responses cached by WithClientCaching are stored in memory, so
+// use a client without caching for large files.
+func DownloadContents(ctx context.Context, client *github.Client, owner, repo, path, ref string) (io.ReadCloser, error) {
+	if strings.Contains(path, "..") {
+		return nil, errors.Errorf("invalid path %q: path must not contain '..'", path)
+	}
+
+	u := fmt.Sprintf("repos/%s/%s/contents/%s", owner, repo, (&url.URL{Path: strings.TrimPrefix(path, "/")}).String())
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+
+	req, err := client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Accept", rawContentMediaType)
+
+	res, err := client.BareDo(ctx, req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s from %s/%s", path, owner, repo)
+	}
+	return res.Body, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestDefaultBranch(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/repos/owner/trunk-repo" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"name":"trunk-repo","default_branch":"trunk"}`)
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	for i := 0; i < 2; i++ {
+		branch, err := DefaultBranch(context.Background(), client, "owner", "trunk-repo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if branch != "trunk" {
+			t.Errorf("incorrect branch: expected %q, actual %q", "trunk", branch)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("incorrect request count: expected 1, actual %d", requests)
+	}
+
+	if _, err := DefaultBranch(context.Background(), client, "owner", "missing"); err == nil {
+		t.Error("expected error for missing repository, but got nil")
+	}
+}
+
+func TestDownloadContents(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 128*1024)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			writeTestGitHubError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		if r.Header.Get("Accept") != rawContentMediaType {
+			writeTestGitHubError(w, http.StatusUnsupportedMediaType, "Unsupported media type")
+			return
+		}
+
+		switch r.URL.Path {
+		case "/repos/owner/repo/contents/assets/large file.bin":
+			if r.URL.Query().Get("ref") != "feature/x" {
+				writeTestGitHubError(w, http.StatusNotFound, "No commit found for the ref")
+				return
+			}
+			w.Header().Set("ETag", `"large"`)
+			_, _ = w.Write(content)
+		default:
+			writeTestGitHubError(w, http.StatusNotFound, "Not Found")
+		}
+	}))
+	defer srv.Close()
+
+	cc := NewClientCreator(srv.URL, srv.URL, 1, nil)
+	client, err := cc.NewTokenClient("secret-token")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	tests := map[string]struct {
+		Path string
+		Ref  string
+		Err  bool
+	}{
+		"largeFile": {
+			Path: "assets/large file.bin",
+			Ref:  "feature/x",
+		},
+		"missingRef": {
+			Path: "assets/large file.bin",
+			Err:  true,
+		},
+		"missingFile": {
+			Path: "assets/missing.bin",
+			Ref:  "feature/x",
+			Err:  true,
+		},
+		"parentPath": {
+			Path: "../secrets",
+			Err:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := DownloadContents(context.Background(), client, "owner", "repo", test.Path, test.Ref)
+			if test.Err {
+				if err == nil {
+					_ = r.Close()
+					t.Fatal("expected error downloading contents, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error downloading contents: %v", err)
+			}
+			defer func() { _ = r.Close() }()
+
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("unexpected error reading contents: %v", err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Errorf("incorrect content: expected %d bytes, actual %d bytes", len(content), len(b))
+			}
+		})
+	}
+}
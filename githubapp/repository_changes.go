@@ -0,0 +1,178 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// DefaultRepositoryConcurrency is the number of repositories processed at
+// the same time by RepositoryChanges.Each if the concurrency is not positive.
+const DefaultRepositoryConcurrency = 4
+
+// RepositoryChange is the type of change to a repository in an installation.
+type RepositoryChange string
+
+const (
+	RepositoryAdded   RepositoryChange = "added"
+	RepositoryRemoved RepositoryChange = "removed"
+)
+
+// RepositoryFunc is called for each changed repository. The client is an
+// installation client for the installation that changed. Clients cannot
+// access removed repositories, so use removals to update state stored by the
+// app instead of making requests for the repository.
+type RepositoryFunc func(ctx context.Context, client *github.Client, change RepositoryChange, repo *github.Repository) error
+
+// RepositoryChanges lists the repositories added to or removed from an
+// installation by an installation or installation_repositories event.
+type RepositoryChanges struct {
+	InstallationID int64
+	Added          []*github.Repository
+	Removed        []*github.Repository
+}
+
+// InstallationRepositoriesChanges returns the repositories added to or
+// removed from an installation by an installation_repositories event.
+func InstallationRepositoriesChanges(event *github.InstallationRepositoriesEvent) RepositoryChanges {
+	return RepositoryChanges{
+		InstallationID: event.GetInstallation().GetID(),
+		Added:          event.RepositoriesAdded,
+		Removed:        event.RepositoriesRemoved,
+	}
+}
+
+// InstallationChanges returns the repositories added to or removed from an
+// installation by an installation event. When the app is installed, with the
+// "created" action, every repository in the installation is added. When the
+// app is uninstalled, with the "deleted" action, every repository is removed.
+// Other actions do not change repositories.
+func InstallationChanges(event *github.InstallationEvent) RepositoryChanges {
+	c := RepositoryChanges{
+		InstallationID: event.GetInstallation().GetID(),
+	}
+	switch event.GetAction() {
+	case "created":
+		c.Added = event.Repositories
+	case "deleted":
+		c.Removed = event.Repositories
+	}
+	return c
+}
+
+// Len returns the total number of changed repositories.
+func (c RepositoryChanges) Len() int {
+	return len(c.Added) + len(c.Removed)
+}
+
+// Each calls fn for each added repository and then for each removed
+// repository, with at most concurrency calls running at the same time. If
+// concurrency is not positive, Each uses DefaultRepositoryConcurrency. All
+// calls share one installation client created by cc, so limiting concurrency
+// also limits how quickly the calls use the installation's rate limit.
+//
+// If there are added repositories, Each requests an installation token with
+// ctx before making any calls and returns an error if that fails. If all
+// changes are removals, like when the app is uninstalled, Each does not
+// request a token, so removals are processed even though the installation no
+// longer exists; requests made with the client fail in this case.
+//
+// If a call returns an error, Each cancels the context passed to calls in
+// progress, does not start new calls, and returns the first error, annotated
+// with the name of the repository. Each also stops if ctx is canceled.
+func (c RepositoryChanges) Each(ctx context.Context, cc ClientCreator, concurrency int, fn RepositoryFunc) error {
+	if c.Len() == 0 {
+		return nil
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultRepositoryConcurrency
+	}
+
+	// Removals happen when the app is uninstalled, after which GitHub cannot
+	// create tokens for the installation. Only request a token up front when
+	// there are added repositories, so cleanup for removals always runs.
+	var client *github.Client
+	var err error
+	if len(c.Added) > 0 {
+		client, err = cc.NewInstallationClientContext(ctx, c.InstallationID)
+	} else {
+		client, err = cc.NewInstallationClient(c.InstallationID)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type work struct {
+		change RepositoryChange
+		repo   *github.Repository
+	}
+	queue := make(chan work)
+
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for w := range queue {
+				// the producer may send work after cancellation
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, client, w.change, w.repo); err != nil {
+					fail(errors.Wrapf(err, "failed to process %s repository %s", w.change, w.repo.GetFullName()))
+				}
+			}
+		}()
+	}
+
+	send := func(change RepositoryChange, repos []*github.Repository) bool {
+		for _, repo := range repos {
+			select {
+			case queue <- work{change: change, repo: repo}:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+	if send(RepositoryAdded, c.Added) {
+		send(RepositoryRemoved, c.Removed)
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,219 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestRepositoryChanges(t *testing.T) {
+	repos := func(names ...string) []*github.Repository {
+		var rs []*github.Repository
+		for _, name := range names {
+			rs = append(rs, &github.Repository{FullName: github.String(name)})
+		}
+		return rs
+	}
+
+	tests := map[string]struct {
+		Changes     RepositoryChanges
+		Concurrency int
+		Fail        string
+
+		Processed []string
+		Error     bool
+	}{
+		"addedAndRemoved": {
+			Changes: RepositoryChanges{
+				InstallationID: 1234,
+				Added:          repos("o/a", "o/b"),
+				Removed:        repos("o/c"),
+			},
+			Processed: []string{"added o/a", "added o/b", "removed o/c"},
+		},
+		"boundedConcurrency": {
+			Changes: RepositoryChanges{
+				InstallationID: 1234,
+				Added:          repos("o/a", "o/b", "o/c", "o/d", "o/e", "o/f", "o/g", "o/h"),
+			},
+			Concurrency: 3,
+			Processed:   []string{"added o/a", "added o/b", "added o/c", "added o/d", "added o/e", "added o/f", "added o/g", "added o/h"},
+		},
+		"empty": {
+			Changes: RepositoryChanges{InstallationID: 1234},
+		},
+		"error": {
+			Changes: RepositoryChanges{
+				InstallationID: 1234,
+				Added:          repos("o/a"),
+			},
+			Fail:  "o/a",
+			Error: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cc := &MockClientCreator{}
+
+			var (
+				mu        sync.Mutex
+				processed []string
+				active    int32
+				maxActive int32
+			)
+			err := test.Changes.Each(context.Background(), cc, test.Concurrency, func(ctx context.Context, client *github.Client, change RepositoryChange, repo *github.Repository) error {
+				if client == nil {
+					t.Error("expected non-nil client")
+				}
+
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+				for {
+					m := atomic.LoadInt32(&maxActive)
+					if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+
+				if repo.GetFullName() == test.Fail {
+					return errors.New("processing failed")
+				}
+
+				mu.Lock()
+				processed = append(processed, fmt.Sprintf("%s %s", change, repo.GetFullName()))
+				mu.Unlock()
+				return nil
+			})
+
+			if test.Error {
+				if err == nil {
+					t.Fatal("expected error processing repositories, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error processing repositories: %v", err)
+			}
+
+			sort.Strings(processed)
+			if fmt.Sprint(processed) != fmt.Sprint(test.Processed) {
+				t.Errorf("incorrect processed repositories\nexpected: %v\n  actual: %v", test.Processed, processed)
+			}
+
+			concurrency := test.Concurrency
+			if concurrency <= 0 {
+				concurrency = DefaultRepositoryConcurrency
+			}
+			if int(maxActive) > concurrency {
+				t.Errorf("too many concurrent calls: limit %d, actual %d", concurrency, maxActive)
+			}
+
+			if test.Changes.Len() > 0 {
+				if ids := cc.InstallationIDs(); len(ids) != 1 || ids[0] != test.Changes.InstallationID {
+					t.Errorf("incorrect installation clients: %v", ids)
+				}
+			}
+		})
+	}
+}
+
+func TestRepositoryChangesStopsOnError(t *testing.T) {
+	var calls int32
+	changes := RepositoryChanges{InstallationID: 1}
+	for i := 0; i < 100; i++ {
+		changes.Added = append(changes.Added, &github.Repository{FullName: github.String(fmt.Sprintf("o/r%d", i))})
+	}
+
+	err := changes.Each(context.Background(), &MockClientCreator{}, 2, func(ctx context.Context, client *github.Client, change RepositoryChange, repo *github.Repository) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("processing failed")
+	})
+	if err == nil {
+		t.Fatal("expected error processing repositories, but got nil")
+	}
+	if n := atomic.LoadInt32(&calls); n > 2 {
+		t.Errorf("expected processing to stop after error, but made %d calls", n)
+	}
+}
+
+func TestRepositoryChangesUninstalled(t *testing.T) {
+	server := newTestGitHubServer(t, "")
+	server.TokenErrors = map[int64]int{1: http.StatusNotFound}
+	cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t))
+
+	repos := []*github.Repository{{FullName: github.String("o/a")}, {FullName: github.String("o/b")}}
+	deleted := InstallationChanges(&github.InstallationEvent{
+		Action:       github.String("deleted"),
+		Installation: &github.Installation{ID: github.Int64(1)},
+		Repositories: repos,
+	})
+
+	var calls int32
+	err := deleted.Each(context.Background(), cc, 2, func(ctx context.Context, client *github.Client, change RepositoryChange, repo *github.Repository) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error processing removed repositories: %v", err)
+	}
+	assertField(t, "calls", int32(2), atomic.LoadInt32(&calls))
+	assertField(t, "token count", 0, server.TokenCount(1))
+
+	added := RepositoryChanges{InstallationID: 1, Added: repos}
+	err = added.Each(context.Background(), cc, 2, func(ctx context.Context, client *github.Client, change RepositoryChange, repo *github.Repository) error {
+		t.Errorf("unexpected call for %s", repo.GetFullName())
+		return nil
+	})
+	if !errors.Is(err, ErrInstallationNotFound) {
+		t.Errorf("expected ErrInstallationNotFound for added repositories, but got: %v", err)
+	}
+}
+
+func TestInstallationChanges(t *testing.T) {
+	repos := []*github.Repository{{FullName: github.String("o/a")}}
+	installation := &github.Installation{ID: github.Int64(1234)}
+
+	created := InstallationChanges(&github.InstallationEvent{Action: github.String("created"), Installation: installation, Repositories: repos})
+	assertField(t, "installation ID", int64(1234), created.InstallationID)
+	assertField(t, "created added", 1, len(created.Added))
+	assertField(t, "created removed", 0, len(created.Removed))
+
+	deleted := InstallationChanges(&github.InstallationEvent{Action: github.String("deleted"), Installation: installation, Repositories: repos})
+	assertField(t, "deleted added", 0, len(deleted.Added))
+	assertField(t, "deleted removed", 1, len(deleted.Removed))
+
+	suspended := InstallationChanges(&github.InstallationEvent{Action: github.String("suspend"), Installation: installation, Repositories: repos})
+	assertField(t, "suspend changes", 0, suspended.Len())
+
+	changed := InstallationRepositoriesChanges(&github.InstallationRepositoriesEvent{
+		Action:              github.String("removed"),
+		Installation:        installation,
+		RepositoriesRemoved: repos,
+	})
+	assertField(t, "installation_repositories ID", int64(1234), changed.InstallationID)
+	assertField(t, "installation_repositories removed", 1, len(changed.Removed))
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// RequestIDHeader is the response header that contains the ID GitHub assigns
+// to each API request. GitHub support uses the ID to investigate failed or
+// unexpected requests.
+const RequestIDHeader = "X-GitHub-Request-Id"
+
+// RequestIDError is implemented by errors that identify the GitHub request
+// that failed, like errors for failed installation token requests.
+type RequestIDError interface {
+	error
+	RequestID() string
+}
+
+// RequestID returns the GitHub request ID of the failed request that caused
+// err. It returns the empty string if err is not the result of a response
+// from GitHub or the response did not include an ID.
+//
+// RequestID supports errors that implement RequestIDError and the error
+// types returned by go-github clients, including errors wrapped by
+// github.com/pkg/errors or fmt.Errorf.
+func RequestID(err error) string {
+	var iderr RequestIDError
+	if errors.As(err, &iderr) {
+		return iderr.RequestID()
+	}
+
+	var rerr *github.ErrorResponse
+	if errors.As(err, &rerr) {
+		return responseRequestID(rerr.Response)
+	}
+	var rlerr *github.RateLimitError
+	if errors.As(err, &rlerr) {
+		return responseRequestID(rlerr.Response)
+	}
+	var aerr *github.AbuseRateLimitError
+	if errors.As(err, &aerr) {
+		return responseRequestID(aerr.Response)
+	}
+	return ""
+}
+
+func responseRequestID(res *http.Response) string {
+	if res == nil {
+		return ""
+	}
+	return res.Header.Get(RequestIDHeader)
+}
+
+type requestIDKey struct{}
+
+// requestIDRecorder stores the most recent request ID for a context.
+type requestIDRecorder struct {
+	mu sync.Mutex
+	id string
+}
+
+// WithRequestIDTracking returns a context that records the GitHub request ID
+// of each response to a request made with the context by a client from a
+// ClientCreator. Use LastRequestID to get the ID of the most recent response,
+// including successful responses.
+func WithRequestIDTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, &requestIDRecorder{})
+}
+
+// LastRequestID returns the GitHub request ID of the most recent response to
+// a request made with ctx. The context must be prepared by
+// WithRequestIDTracking. If requests run concurrently with the same context,
+// the ID may belong to any of the requests. It returns the empty string if
+// tracking is not enabled or no responses included an ID.
+func LastRequestID(ctx context.Context) string {
+	r, ok := ctx.Value(requestIDKey{}).(*requestIDRecorder)
+	if !ok {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.id
+}
+
+// recordRequestID is middleware that records the request ID of responses in
+// the request context, if tracking is enabled.
+func recordRequestID(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(r)
+		if rec, ok := r.Context().Value(requestIDKey{}).(*requestIDRecorder); ok {
+			if id := responseRequestID(res); id != "" {
+				rec.mu.Lock()
+				rec.id = id
+				rec.mu.Unlock()
+			}
+		}
+		return res, err
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+func TestRequestID(t *testing.T) {
+	res := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     make(http.Header),
+	}
+	res.Header.Set(RequestIDHeader, "ABCD:1234")
+
+	tests := map[string]struct {
+		Err error
+		ID  string
+	}{
+		"errorResponse": {
+			Err: &github.ErrorResponse{Response: res},
+			ID:  "ABCD:1234",
+		},
+		"wrappedErrorResponse": {
+			Err: errors.Wrap(&github.ErrorResponse{Response: res}, "failed to get repository"),
+			ID:  "ABCD:1234",
+		},
+		"rateLimitError": {
+			Err: &github.RateLimitError{Response: res},
+			ID:  "ABCD:1234",
+		},
+		"abuseRateLimitError": {
+			Err: &github.AbuseRateLimitError{Response: res},
+			ID:  "ABCD:1234",
+		},
+		"installationError": {
+			Err: errors.Wrap(classifyTokenError(&github.ErrorResponse{Response: res}), "failed to create token"),
+			ID:  "ABCD:1234",
+		},
+		"missingPermissionError": {
+			Err: &MissingPermissionError{Response: &github.ErrorResponse{Response: res}},
+			ID:  "ABCD:1234",
+		},
+		"noResponse": {
+			Err: &github.ErrorResponse{},
+		},
+		"otherError": {
+			Err: errors.New("connection refused"),
+		},
+		"nilError": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertField(t, "request ID", test.ID, RequestID(test.Err))
+		})
+	}
+}
+
+func TestLastRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/palantir/go-githubapp":
+			w.Header().Set(RequestIDHeader, "found-id")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{}"))
+		case "/repos/palantir/no-id":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{}"))
+		default:
+			w.Header().Set(RequestIDHeader, "missing-id")
+			writeTestGitHubError(w, http.StatusNotFound, "Not Found")
+		}
+	}))
+	defer server.Close()
+
+	cc := NewClientCreator(server.URL, server.URL, 1, nil)
+	client, err := cc.NewTokenClient("token")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	if _, _, err := client.Repositories.Get(context.Background(), "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	assertField(t, "untracked request ID", "", LastRequestID(context.Background()))
+
+	ctx := WithRequestIDTracking(context.Background())
+	if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	assertField(t, "request ID", "found-id", LastRequestID(ctx))
+
+	if _, _, err := client.Repositories.Get(ctx, "palantir", "no-id"); err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	assertField(t, "request ID after response without ID", "found-id", LastRequestID(ctx))
+
+	_, _, err = client.Repositories.Get(ctx, "palantir", "missing")
+	if err == nil {
+		t.Fatal("expected error, but got nil")
+	}
+	assertField(t, "error request ID", "missing-id", RequestID(err))
+	assertField(t, "request ID after error", "missing-id", LastRequestID(ctx))
+}
@@ -0,0 +1,280 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 500 * time.Millisecond
+	DefaultRetryMaxDelay    = 30 * time.Second
+)
+
+// RetryConfig controls how clients retry requests that fail with transient
+// errors. Zero values use the corresponding defaults.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of times to send a request, including
+	// the first attempt.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. The delay doubles for
+	// each subsequent retry.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between attempts. If GitHub asks for a
+	// longer delay with the Retry-After header, the response is returned
+	// without retrying.
+	MaxDelay time.Duration
+
+	// Retryable returns true if a request may be sent more than once. If nil,
+	// only GET and HEAD requests are retried.
+	Retryable func(*http.Request) bool
+}
+
+// WithRetry enables retries for requests made by all created clients. Requests
+// are retried when GitHub responds with a 500, 502, 503, or 504 status, or
+// with a 403 or 429 status that includes a Retry-After header, as it does for
+// secondary rate limits. Retries stop if the request context is canceled.
+//
+// Requests with a body are only retried if the body can be recreated using the
+// request's GetBody function.
+func WithRetry(config RetryConfig) ClientOption {
+	return func(c *clientCreator) {
+		c.retry = &config
+	}
+}
+
+func retry(config RetryConfig) ClientMiddleware {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = DefaultRetryBaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultRetryMaxDelay
+	}
+	if config.Retryable == nil {
+		config.Retryable = isIdempotent
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if !config.Retryable(r) || !canRewindBody(r) {
+				return next.RoundTrip(r)
+			}
+
+			for attempt := 1; ; attempt++ {
+				req := r
+				if attempt > 1 {
+					var err error
+					if req, err = rewindRequest(r); err != nil {
+						return nil, err
+					}
+				}
+
+				res, err := next.RoundTrip(req)
+				if err != nil || attempt >= config.MaxAttempts {
+					return res, err
+				}
+
+				delay, ok := retryDelay(res, attempt, config)
+				if !ok {
+					return res, err
+				}
+
+				LoggerFromContext(r.Context()).Info("Retrying GitHub request after transient failure",
+					"method", r.Method,
+					"path", r.URL.String(),
+					"status", res.StatusCode,
+					"attempt", attempt,
+					"delay", delay,
+				)
+
+				// discard the body so the connection can be reused
+				_, _ = io.Copy(io.Discard, res.Body)
+				closeBody(res.Body)
+
+				if err := sleepContext(r.Context(), delay); err != nil {
+					return nil, err
+				}
+			}
+		})
+	}
+}
+
+// WithSecondaryRateLimitBackoff retries a request once if GitHub rejects it
+// because of a secondary rate limit and asks the client to wait for no longer
+// than max with the Retry-After header. Other errors, including primary rate
+// limits, are returned without retrying. Waiting stops if the request context
+// is canceled.
+//
+// Unlike WithRetry, this applies to all request methods, as GitHub does not
+// process requests rejected by secondary rate limits. Requests with a body are
+// only retried if the body can be recreated using the request's GetBody
+// function.
+func WithSecondaryRateLimitBackoff(max time.Duration) ClientOption {
+	return func(c *clientCreator) {
+		c.secondaryRateLimitMax = max
+	}
+}
+
+func secondaryRateLimitBackoff(max time.Duration) ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := next.RoundTrip(r)
+			if err != nil || !canRewindBody(r) {
+				return res, err
+			}
+
+			delay, ok := secondaryRateLimitDelay(res, max)
+			if !ok {
+				return res, err
+			}
+
+			LoggerFromContext(r.Context()).Info("Retrying GitHub request after secondary rate limit",
+				"method", r.Method,
+				"path", r.URL.String(),
+				"status", res.StatusCode,
+				"delay", delay,
+			)
+			closeBody(res.Body)
+
+			if err := sleepContext(r.Context(), delay); err != nil {
+				return nil, err
+			}
+
+			req := r
+			if r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req = r.Clone(r.Context())
+				req.Body = body
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// secondaryRateLimitDelay returns the delay requested by a secondary rate
+// limit response and false if res is not a secondary rate limit response or
+// the delay is longer than max. It replaces the body of res so that it can be
+// read again by the caller.
+func secondaryRateLimitDelay(res *http.Response, max time.Duration) (time.Duration, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	delay := time.Duration(seconds) * time.Second
+	if delay > max {
+		return 0, false
+	}
+
+	body, err := io.ReadAll(res.Body)
+	closeBody(res.Body)
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+
+	if !strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return 0, false
+	}
+	return delay, true
+}
+
+// sleepContext waits for delay or until ctx is canceled, returning the
+// context's error in the second case.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryDelay returns the delay before retrying a request that produced res and
+// false if the request should not be retried.
+func retryDelay(res *http.Response, attempt int, config RetryConfig) (time.Duration, bool) {
+	switch res.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return backoffDelay(attempt, config), true
+
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+		delay := time.Duration(seconds) * time.Second
+		if delay > config.MaxDelay {
+			return 0, false
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// backoffDelay returns the delay after the given failed attempt. The delay
+// starts at config.BaseDelay and doubles for each attempt, up to
+// config.MaxDelay.
+func backoffDelay(attempt int, config RetryConfig) time.Duration {
+	delay := config.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > config.MaxDelay {
+		delay = config.MaxDelay
+	}
+	return delay
+}
+
+func isIdempotent(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// canRewindBody returns true if the request has no body or if the body can be
+// recreated for additional attempts.
+func canRewindBody(r *http.Request) bool {
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// rewindRequest returns a copy of the request with a new body, so it can be
+// sent again. The request must satisfy canRewindBody.
+func rewindRequest(r *http.Request) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
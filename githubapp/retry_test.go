@@ -0,0 +1,301 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	config := RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}
+
+	tests := map[string]struct {
+		Method    string
+		Body      []byte
+		Statuses  []int
+		Header    http.Header
+		Config    func(*RetryConfig)
+		Status    int
+		CallCount int
+	}{
+		"noRetryOnSuccess": {
+			Method:    http.MethodGet,
+			Statuses:  []int{200},
+			Status:    200,
+			CallCount: 1,
+		},
+		"retryServerError": {
+			Method:    http.MethodGet,
+			Statuses:  []int{502, 503, 200},
+			Status:    200,
+			CallCount: 3,
+		},
+		"stopAfterMaxAttempts": {
+			Method:    http.MethodGet,
+			Statuses:  []int{500, 500, 500, 200},
+			Status:    500,
+			CallCount: 3,
+		},
+		"noRetryClientError": {
+			Method:    http.MethodGet,
+			Statuses:  []int{404, 200},
+			Status:    404,
+			CallCount: 1,
+		},
+		"retrySecondaryRateLimit": {
+			Method:    http.MethodGet,
+			Statuses:  []int{403, 200},
+			Header:    http.Header{"Retry-After": []string{"0"}},
+			Status:    200,
+			CallCount: 2,
+		},
+		"noRetryForbiddenWithoutRetryAfter": {
+			Method:    http.MethodGet,
+			Statuses:  []int{403, 200},
+			Status:    403,
+			CallCount: 1,
+		},
+		"noRetryLongRetryAfter": {
+			Method:    http.MethodGet,
+			Statuses:  []int{429, 200},
+			Header:    http.Header{"Retry-After": []string{"60"}},
+			Status:    429,
+			CallCount: 1,
+		},
+		"noRetryPost": {
+			Method:    http.MethodPost,
+			Body:      []byte(`{"body":"comment"}`),
+			Statuses:  []int{502, 200},
+			Status:    502,
+			CallCount: 1,
+		},
+		"retryPostWhenRetryable": {
+			Method:   http.MethodPost,
+			Body:     []byte(`{"body":"comment"}`),
+			Statuses: []int{502, 200},
+			Config: func(c *RetryConfig) {
+				c.Retryable = func(*http.Request) bool { return true }
+			},
+			Status:    200,
+			CallCount: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var bodies [][]byte
+			next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				var body []byte
+				if r.Body != nil {
+					body, _ = io.ReadAll(r.Body)
+				}
+				bodies = append(bodies, body)
+
+				status := test.Statuses[len(bodies)-1]
+				header := http.Header{}
+				if status != 200 {
+					header = test.Header.Clone()
+				}
+				return &http.Response{
+					StatusCode: status,
+					Header:     header,
+					Body:       io.NopCloser(bytes.NewReader(nil)),
+				}, nil
+			})
+
+			c := config
+			if test.Config != nil {
+				test.Config(&c)
+			}
+			rt := retry(c)(next)
+
+			var body io.Reader
+			if test.Body != nil {
+				body = bytes.NewReader(test.Body)
+			}
+			req := httptest.NewRequest(test.Method, "https://api.github.com/repos/palantir/go-githubapp", body)
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(test.Body)), nil
+			}
+
+			res, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertField(t, "status", test.Status, res.StatusCode)
+			assertField(t, "call count", test.CallCount, len(bodies))
+			for i, b := range bodies {
+				if !bytes.Equal(test.Body, b) && !(test.Body == nil && len(b) == 0) {
+					t.Errorf("incorrect body for attempt %d: %q", i+1, b)
+				}
+			}
+		})
+	}
+
+	t.Run("stopOnContextCancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		calls := 0
+		next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			cancel()
+			return &http.Response{StatusCode: 503, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+		})
+
+		rt := retry(RetryConfig{MaxAttempts: 3, BaseDelay: time.Second})(next)
+
+		req := httptest.NewRequest(http.MethodGet, "https://api.github.com/", nil).WithContext(ctx)
+		if _, err := rt.RoundTrip(req); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, but got: %v", err)
+		}
+		assertField(t, "call count", 1, calls)
+	})
+}
+
+func TestSecondaryRateLimitBackoff(t *testing.T) {
+	const secondaryLimit = `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`
+
+	tests := map[string]struct {
+		Method     string
+		Statuses   []int
+		RetryAfter string
+		Body       string
+
+		Status    int
+		CallCount int
+	}{
+		"retrySecondaryRateLimit": {
+			Method:     http.MethodGet,
+			Statuses:   []int{403, 200},
+			RetryAfter: "0",
+			Body:       secondaryLimit,
+			Status:     200,
+			CallCount:  2,
+		},
+		"retryPost": {
+			Method:     http.MethodPost,
+			Statuses:   []int{429, 200},
+			RetryAfter: "0",
+			Body:       secondaryLimit,
+			Status:     200,
+			CallCount:  2,
+		},
+		"retryOnlyOnce": {
+			Method:     http.MethodGet,
+			Statuses:   []int{403, 403, 200},
+			RetryAfter: "0",
+			Body:       secondaryLimit,
+			Status:     403,
+			CallCount:  2,
+		},
+		"noRetryPrimaryRateLimit": {
+			Method:     http.MethodGet,
+			Statuses:   []int{403, 200},
+			RetryAfter: "0",
+			Body:       `{"message":"API rate limit exceeded for installation ID 1."}`,
+			Status:     403,
+			CallCount:  1,
+		},
+		"noRetryWithoutRetryAfter": {
+			Method:    http.MethodGet,
+			Statuses:  []int{403, 200},
+			Body:      secondaryLimit,
+			Status:    403,
+			CallCount: 1,
+		},
+		"noRetryLongRetryAfter": {
+			Method:     http.MethodGet,
+			Statuses:   []int{403, 200},
+			RetryAfter: "60",
+			Body:       secondaryLimit,
+			Status:     403,
+			CallCount:  1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				status := test.Statuses[calls]
+				calls++
+
+				header := http.Header{}
+				body := ""
+				if status != 200 {
+					if test.RetryAfter != "" {
+						header.Set("Retry-After", test.RetryAfter)
+					}
+					body = test.Body
+				}
+				return &http.Response{
+					StatusCode: status,
+					Header:     header,
+					Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+				}, nil
+			})
+
+			rt := secondaryRateLimitBackoff(time.Second)(next)
+
+			req := httptest.NewRequest(test.Method, "https://api.github.com/repos/palantir/go-githubapp", nil)
+			res, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertField(t, "status", test.Status, res.StatusCode)
+			assertField(t, "call count", test.CallCount, calls)
+
+			if res.StatusCode != 200 {
+				body, _ := io.ReadAll(res.Body)
+				assertField(t, "body", test.Body, string(body))
+			}
+		})
+	}
+
+	t.Run("stopOnContextCancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		calls := 0
+		next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			cancel()
+			return &http.Response{
+				StatusCode: 403,
+				Header:     http.Header{"Retry-After": []string{"1"}},
+				Body:       io.NopCloser(bytes.NewReader([]byte(secondaryLimit))),
+			}, nil
+		})
+
+		rt := secondaryRateLimitBackoff(time.Minute)(next)
+
+		req := httptest.NewRequest(http.MethodGet, "https://api.github.com/", nil).WithContext(ctx)
+		if _, err := rt.RoundTrip(req); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, but got: %v", err)
+		}
+		assertField(t, "call count", 1, calls)
+	})
+}
@@ -16,12 +16,13 @@ package githubapp
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rcrowley/go-metrics"
-	"github.com/rs/zerolog"
 )
 
 const (
@@ -39,8 +40,37 @@ const (
 
 var (
 	ErrCapacityExceeded = errors.New("scheduler: capacity exceeded")
+	ErrSchedulerClosed  = errors.New("scheduler: shut down")
 )
 
+// ShutdownError is returned when a scheduler cannot process all queued events
+// before the shutdown context ends.
+type ShutdownError struct {
+	// Dropped is the number of queued events that did not start.
+	Dropped int
+	Cause   error
+}
+
+func (e ShutdownError) Error() string {
+	return fmt.Sprintf("scheduler: shutdown incomplete, dropped %d queued events: %v", e.Dropped, e.Cause)
+}
+
+func (e ShutdownError) Unwrap() error {
+	return e.Cause
+}
+
+// ShutdownScheduler is a Scheduler that can be stopped. After Shutdown is
+// called, Schedule returns ErrSchedulerClosed.
+type ShutdownScheduler interface {
+	Scheduler
+
+	// Shutdown stops accepting new events and waits for queued and running
+	// events to finish or for ctx to end. If ctx ends first, events that did
+	// not start are dropped and Shutdown returns a ShutdownError. Running
+	// events are not canceled.
+	Shutdown(ctx context.Context) error
+}
+
 // Dispatch is a webhook payload and the handler that handles it.
 type Dispatch struct {
 	Handler EventHandler
@@ -72,7 +102,7 @@ var defaultAsyncErrorCallback = MetricsAsyncErrorCallback(nil)
 // MetricsAsyncErrorCallback logs errors and increments an error counter.
 func MetricsAsyncErrorCallback(reg metrics.Registry) AsyncErrorCallback {
 	return func(ctx context.Context, d Dispatch, err error) {
-		zerolog.Ctx(ctx).Error().Err(err).Msg("Unexpected error handling webhook")
+		LoggerFromContext(ctx).Error("Unexpected error handling webhook", "error", err)
 		errorCounter(reg, d.EventType).Inc(1)
 	}
 }
@@ -81,16 +111,25 @@ func MetricsAsyncErrorCallback(reg metrics.Registry) AsyncErrorCallback {
 // The new context must be based on context.Background(), not the input.
 type ContextDeriver func(context.Context) context.Context
 
-// DefaultContextDeriver copies the logger from the request's context to a new
-// context.
+// DefaultContextDeriver copies the loggers, the delivery ID, and the log field
+// names from the request's context to a new context. If the request was
+// dispatched with context decorators, it applies them to the new context
+// before copying the loggers.
 func DefaultContextDeriver(ctx context.Context) context.Context {
 	newCtx := context.Background()
 
 	// this value is always unused by async schedulers, but is set for
 	// compatibility with existing handlers that call SetResponder
 	newCtx = InitializeResponder(newCtx)
+	newCtx = copyDecorators(ctx, newCtx)
 
-	return zerolog.Ctx(ctx).WithContext(newCtx)
+	if id, ok := DeliveryIDFromContext(ctx); ok {
+		newCtx = context.WithValue(newCtx, deliveryIDKey{}, id)
+	}
+	if names, ok := ctx.Value(fieldNamesKey{}).(FieldNames); ok {
+		newCtx = context.WithValue(newCtx, fieldNamesKey{}, names)
+	}
+	return copyLoggers(ctx, newCtx)
 }
 
 // Scheduler is a strategy for executing event handlers.
@@ -130,11 +169,28 @@ func WithContextDeriver(deriver ContextDeriver) SchedulerOption {
 	}
 }
 
+// WithQueueTimeout sets how long a queueing scheduler waits for space in a
+// full queue before rejecting an event with ErrCapacityExceeded. By default,
+// events are rejected immediately when the queue is full. Schedulers that do
+// not use a queue ignore this option.
+func WithQueueTimeout(timeout time.Duration) SchedulerOption {
+	return func(s *scheduler) {
+		s.queueTimeout = timeout
+	}
+}
+
 // WithSchedulingMetrics enables metrics reporting for schedulers.
 func WithSchedulingMetrics(r metrics.Registry) SchedulerOption {
 	return func(s *scheduler) {
 		metrics.NewRegisteredFunctionalGauge(MetricsKeyQueueLength, r, func() int64 {
-			return int64(len(s.queue))
+			n := len(s.queue)
+			if s.queueLen != nil {
+				n = s.queueLen()
+			}
+			if s.keys != nil {
+				n += s.keys.len()
+			}
+			return int64(n)
 		})
 		metrics.NewRegisteredFunctionalGauge(MetricsKeyActiveWorkers, r, func() int64 {
 			return atomic.LoadInt64(&s.activeWorkers)
@@ -159,9 +215,17 @@ type scheduler struct {
 
 	activeWorkers int64
 	queue         chan queueDispatch
+	queueLen      func() int
+	queueTimeout  time.Duration
 
 	eventAge metrics.Histogram
 	dropped  metrics.Counter
+
+	// keys runs dispatches for handlers with scheduling policies. Workers
+	// stop taking events from the queue while maxKeyed dispatches wait for
+	// their keys.
+	keys     *keyedRunner
+	maxKeyed int
 }
 
 func (s *scheduler) safeExecute(ctx context.Context, d Dispatch) {
@@ -183,6 +247,28 @@ func (s *scheduler) safeExecute(ctx context.Context, d Dispatch) {
 	err = d.Execute(ctx)
 }
 
+// maxKeyedDispatches returns how many dispatches may wait for their keys in
+// a scheduler with a queue of the given size. At least one dispatch may wait,
+// so that a scheduler without a queue can still run other keys.
+func maxKeyedDispatches(queueSize int) int {
+	if queueSize < 1 {
+		return 1
+	}
+	return queueSize
+}
+
+// runKeyed calls run for the dispatch. If the dispatch's handler has a
+// scheduling policy, dispatches with the same key run one at a time: a
+// dispatch that must wait is queued and runKeyed returns without calling run,
+// so the caller is free to start other dispatches.
+func (s *scheduler) runKeyed(d Dispatch, run func()) {
+	if key, ok := d.schedulingKey(); ok {
+		s.keys.run(key, run)
+		return
+	}
+	run()
+}
+
 func (s *scheduler) derive(ctx context.Context) context.Context {
 	if s.deriver == nil {
 		return ctx
@@ -209,6 +295,7 @@ func AsyncScheduler(opts ...SchedulerOption) Scheduler {
 		scheduler: scheduler{
 			deriver: DefaultContextDeriver,
 			onError: DefaultAsyncErrorCallback,
+			keys:    newKeyedRunner(),
 		},
 	}
 	for _, opt := range opts {
@@ -222,13 +309,20 @@ type asyncScheduler struct {
 }
 
 func (s *asyncScheduler) Schedule(ctx context.Context, d Dispatch) error {
-	go s.safeExecute(s.derive(ctx), d)
+	ctx = s.derive(ctx)
+	go s.runKeyed(d, func() { s.safeExecute(ctx, d) })
 	return nil
 }
 
 // QueueAsyncScheduler returns a scheduler that executes handlers in a fixed
 // number of worker goroutines. If no workers are available, events queue until
-// the queue is full.
+// the queue is full. The scheduler implements ShutdownScheduler.
+//
+// Events waiting for another event with the same scheduling key, as set by
+// HandlerWithPolicy, do not occupy a worker. Up to queueSize of these events
+// wait outside the queue; after that, workers stop taking events from the
+// queue until a key is free, so a busy key eventually fills the queue and new
+// events are rejected with ErrCapacityExceeded.
 func QueueAsyncScheduler(queueSize int, workers int, opts ...SchedulerOption) Scheduler {
 	if queueSize < 0 {
 		panic("QueueAsyncScheduler: queue size must be non-negative")
@@ -242,19 +336,26 @@ func QueueAsyncScheduler(queueSize int, workers int, opts ...SchedulerOption) Sc
 			deriver: DefaultContextDeriver,
 			onError: DefaultAsyncErrorCallback,
 			queue:   make(chan queueDispatch, queueSize),
+			keys:    newKeyedRunner(),
 		},
+		stopping: make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(&s.scheduler)
 	}
+	s.maxKeyed = maxKeyedDispatches(queueSize)
 
+	s.workers.Add(workers)
 	for i := 0; i < workers; i++ {
 		go func() {
-			for d := range s.queue {
-				if s.eventAge != nil {
-					s.eventAge.Update(time.Since(d.t).Milliseconds())
+			defer s.workers.Done()
+			for {
+				s.keys.waitBelow(s.maxKeyed)
+				d, ok := <-s.queue
+				if !ok {
+					return
 				}
-				s.safeExecute(d.ctx, d.d)
+				s.runKeyed(d.d, func() { s.execute(d) })
 			}
 		}()
 	}
@@ -264,16 +365,101 @@ func QueueAsyncScheduler(queueSize int, workers int, opts ...SchedulerOption) Sc
 
 type queueScheduler struct {
 	scheduler
+
+	// mu guards sending to and closing the queue
+	mu       sync.RWMutex
+	closed   bool
+	stopping chan struct{}
+	stopOnce sync.Once
+
+	workers        sync.WaitGroup
+	abandoned      int32
+	abandonedCount int64
+}
+
+// execute runs a queued dispatch unless the scheduler abandoned queued events
+// during shutdown.
+func (s *queueScheduler) execute(d queueDispatch) {
+	if atomic.LoadInt32(&s.abandoned) != 0 {
+		atomic.AddInt64(&s.abandonedCount, 1)
+		return
+	}
+	if s.eventAge != nil {
+		s.eventAge.Update(time.Since(d.t).Milliseconds())
+	}
+	s.safeExecute(d.ctx, d.d)
 }
 
 func (s *queueScheduler) Schedule(ctx context.Context, d Dispatch) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrSchedulerClosed
+	}
+
+	qd := queueDispatch{ctx: s.derive(ctx), t: time.Now(), d: d}
+
 	select {
-	case s.queue <- queueDispatch{ctx: s.derive(ctx), t: time.Now(), d: d}:
+	case s.queue <- qd:
+		return nil
 	default:
-		if s.dropped != nil {
-			s.dropped.Inc(1)
+	}
+
+	if s.queueTimeout > 0 {
+		t := time.NewTimer(s.queueTimeout)
+		defer t.Stop()
+
+		select {
+		case s.queue <- qd:
+			return nil
+		case <-s.stopping:
+			return ErrSchedulerClosed
+		case <-t.C:
+		case <-ctx.Done():
 		}
-		return ErrCapacityExceeded
 	}
-	return nil
+
+	if s.dropped != nil {
+		s.dropped.Inc(1)
+	}
+	return ErrCapacityExceeded
+}
+
+func (s *queueScheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		// release any Schedule calls waiting for capacity before closing
+		close(s.stopping)
+
+		s.mu.Lock()
+		s.closed = true
+		close(s.queue)
+		s.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// stop workers from starting queued events and drop the rest, including
+	// events waiting for their keys
+	atomic.StoreInt32(&s.abandoned, 1)
+	atomic.AddInt64(&s.abandonedCount, int64(s.keys.drop()))
+	for range s.queue {
+		atomic.AddInt64(&s.abandonedCount, 1)
+	}
+
+	dropped := int(atomic.LoadInt64(&s.abandonedCount))
+	if s.dropped != nil {
+		s.dropped.Inc(int64(dropped))
+	}
+	return ShutdownError{Dropped: dropped, Cause: ctx.Err()}
 }
@@ -0,0 +1,342 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// SchedulingPolicy decides which events a handler may handle at the same
+// time. Events with the same non-empty key are handled one at a time, in the
+// order they reach the handler. Events with an empty key are handled without
+// waiting for other events.
+type SchedulingPolicy interface {
+	SchedulingKey(eventType string, payload []byte) string
+}
+
+// SchedulingPolicyFunc adapts a function to a SchedulingPolicy.
+type SchedulingPolicyFunc func(eventType string, payload []byte) string
+
+func (f SchedulingPolicyFunc) SchedulingKey(eventType string, payload []byte) string {
+	return f(eventType, payload)
+}
+
+var (
+	// Parallel handles all events at the same time. This is the behavior of
+	// handlers without a policy.
+	Parallel SchedulingPolicy = SchedulingPolicyFunc(func(eventType string, payload []byte) string {
+		return ""
+	})
+
+	// SerialPerRepo handles events for the same repository one at a time.
+	// Events without a repository, like installation events, are handled in
+	// parallel.
+	SerialPerRepo SchedulingPolicy = SchedulingPolicyFunc(func(eventType string, payload []byte) string {
+		var event policyEvent
+		if err := json.Unmarshal(payload, &event); err != nil || event.Repository == nil {
+			return ""
+		}
+		if event.Repository.ID > 0 {
+			return fmt.Sprintf("repo:%d", event.Repository.ID)
+		}
+		if event.Repository.FullName != "" {
+			return "repo:" + event.Repository.FullName
+		}
+		return ""
+	})
+
+	// SerialPerInstallation handles events for the same installation one at
+	// a time. Events without an installation are handled in parallel.
+	SerialPerInstallation SchedulingPolicy = SchedulingPolicyFunc(func(eventType string, payload []byte) string {
+		var event policyEvent
+		if err := json.Unmarshal(payload, &event); err != nil || event.Installation == nil || event.Installation.ID <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("installation:%d", event.Installation.ID)
+	})
+)
+
+// policyEvent contains the fields of a payload used by the built-in policies.
+type policyEvent struct {
+	Repository *struct {
+		ID       int64  `json:"id"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation *struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// HandlerWithPolicy returns an EventHandler that calls h according to the
+// scheduling policy. For example, with SerialPerRepo, the handler is never
+// called for two events from the same repository at the same time, so a
+// comment handler cannot post the same comment twice for concurrent events
+// on one pull request. Other handlers are not affected by the policy.
+//
+// Policies are most useful with asynchronous schedulers, which otherwise
+// handle events in any order. AsyncScheduler, QueueAsyncScheduler, and
+// NewAsyncDispatcher keep an event that must wait for an earlier event with
+// the same key in a queue for the key, so waiting events do not occupy
+// workers and events with other keys are not delayed. The queued event runs
+// after the earlier event finishes. If other handlers are registered for the
+// same event, they wait with the handler that has the policy.
+//
+// With DefaultScheduler and other schedulers, or if the event has handlers
+// with different scheduling keys, the handler itself waits for the earlier
+// event before it runs. Waiting stops if the handler's context is canceled.
+func HandlerWithPolicy(h EventHandler, policy SchedulingPolicy) EventHandler {
+	return &policyHandler{
+		EventHandler: h,
+		policy:       policy,
+		locks:        newKeyedLocker(),
+	}
+}
+
+type policyHandler struct {
+	EventHandler
+	policy SchedulingPolicy
+	locks  *keyedLocker
+}
+
+// withHandler returns a copy of the policy handler that calls inner and
+// shares the locks of the original handler. The dispatcher applies policies
+// outside of the wrappers it adds to every handler so that the wrappers see
+// the ResponseHandler and TimeoutHandler implementations of the handler with
+// the policy.
+func (h *policyHandler) withHandler(inner EventHandler) *policyHandler {
+	return &policyHandler{
+		EventHandler: inner,
+		policy:       h.policy,
+		locks:        h.locks,
+	}
+}
+
+func (h *policyHandler) Name() string {
+	return HandlerName(h.EventHandler)
+}
+
+func (h *policyHandler) RequiresSerialExecution() bool {
+	return isSerial(h.EventHandler)
+}
+
+func (h *policyHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	key := h.policy.SchedulingKey(eventType, payload)
+	if key == "" {
+		return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	}
+
+	// schedulers that support policies only start one event for each key at
+	// a time, so the lock is only contended with other schedulers
+	unlock, err := h.locks.lock(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
+
+// schedulingKey returns the key of the event, which identifies the handler
+// and the key returned by the policy.
+func (h *policyHandler) schedulingKey(eventType string, payload []byte) (policyKey, bool) {
+	key := h.policy.SchedulingKey(eventType, payload)
+	if key == "" {
+		return policyKey{}, false
+	}
+	return policyKey{locks: h.locks, key: key}, true
+}
+
+// policyKey identifies events that a handler with a policy handles one at a
+// time. Handlers with policies may return the same keys, so the key includes
+// the handler's locks to identify the handler.
+type policyKey struct {
+	locks *keyedLocker
+	key   string
+}
+
+// keyedScheduling is implemented by handlers that provide scheduling keys.
+type keyedScheduling interface {
+	schedulingKey(eventType string, payload []byte) (policyKey, bool)
+}
+
+// schedulingKey returns the scheduling key of the dispatch, if its handler
+// has a scheduling policy.
+func (d Dispatch) schedulingKey() (policyKey, bool) {
+	if h, ok := d.Handler.(keyedScheduling); ok {
+		return h.schedulingKey(d.EventType, d.Payload)
+	}
+	return policyKey{}, false
+}
+
+// keyedRunner runs functions so that functions with the same key never run
+// at the same time. Instead of waiting for the key, a function is added to a
+// queue for the key and runs in the goroutine that finishes the previous
+// function with the key.
+type keyedRunner struct {
+	mu      sync.Mutex
+	pending map[policyKey][]func()
+	queued  int
+	changed chan struct{}
+}
+
+func newKeyedRunner() *keyedRunner {
+	return &keyedRunner{
+		pending: make(map[policyKey][]func()),
+		changed: make(chan struct{}),
+	}
+}
+
+// run calls fn if no function with the same key is running. Otherwise, it
+// queues fn and returns immediately. After fn returns, run calls the
+// functions queued for the key in order until the queue is empty.
+func (r *keyedRunner) run(key policyKey, fn func()) {
+	r.mu.Lock()
+	if queue, ok := r.pending[key]; ok {
+		r.pending[key] = append(queue, fn)
+		r.queued++
+		r.mu.Unlock()
+		return
+	}
+	r.pending[key] = nil
+	r.mu.Unlock()
+
+	for fn != nil {
+		fn()
+		fn = r.next(key)
+	}
+}
+
+// next removes and returns the next function queued for key. If the queue
+// is empty, it releases the key and returns nil.
+func (r *keyedRunner) next(key policyKey) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queue := r.pending[key]
+	if len(queue) == 0 {
+		delete(r.pending, key)
+		return nil
+	}
+	r.pending[key] = queue[1:]
+	r.queued--
+	r.notify()
+	return queue[0]
+}
+
+// len returns the number of functions waiting for their key.
+func (r *keyedRunner) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queued
+}
+
+// waitBelow blocks until fewer than limit functions wait for their key.
+// Schedulers call it before taking another event from their queue, so that
+// events for busy keys stay in the bounded queue instead of accumulating in
+// the runner.
+func (r *keyedRunner) waitBelow(limit int) {
+	r.mu.Lock()
+	for r.queued >= limit {
+		changed := r.changed
+		r.mu.Unlock()
+		<-changed
+		r.mu.Lock()
+	}
+	r.mu.Unlock()
+}
+
+// drop removes all functions waiting for their key and returns how many
+// were removed. Running functions are not affected.
+func (r *keyedRunner) drop() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.queued
+	for key := range r.pending {
+		r.pending[key] = nil
+	}
+	r.queued = 0
+	r.notify()
+	return n
+}
+
+// notify wakes callers of waitBelow. The caller must hold r.mu.
+func (r *keyedRunner) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// keyedLocker is a set of locks identified by keys. Callers waiting for the
+// same key acquire the lock in the order they called lock.
+type keyedLocker struct {
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+func newKeyedLocker() *keyedLocker {
+	return &keyedLocker{waiters: make(map[string][]chan struct{})}
+}
+
+// lock waits until the caller holds the lock for key or ctx is canceled. It
+// returns a function that releases the lock.
+func (l *keyedLocker) lock(ctx context.Context, key string) (func(), error) {
+	ready := make(chan struct{})
+
+	l.mu.Lock()
+	l.waiters[key] = append(l.waiters[key], ready)
+	if len(l.waiters[key]) == 1 {
+		close(ready)
+	}
+	l.mu.Unlock()
+
+	unlock := func() { l.release(key, ready) }
+
+	select {
+	case <-ready:
+		return unlock, nil
+	case <-ctx.Done():
+		// the lock may be acquired at the same time as cancellation
+		unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// release removes a waiter for key and wakes the next waiter if the removed
+// waiter held the lock.
+func (l *keyedLocker) release(key string, ready chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waiters := l.waiters[key]
+	for i, w := range waiters {
+		if w != ready {
+			continue
+		}
+
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		if len(waiters) == 0 {
+			delete(l.waiters, key)
+			return
+		}
+		l.waiters[key] = waiters
+		if i == 0 {
+			close(waiters[0])
+		}
+		return
+	}
+}
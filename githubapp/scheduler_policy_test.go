@@ -0,0 +1,385 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulingPolicies(t *testing.T) {
+	payload := []byte(`{"repository":{"id":7,"full_name":"octo-org/octo-repo"},"installation":{"id":42}}`)
+
+	tests := map[string]struct {
+		Policy  SchedulingPolicy
+		Payload []byte
+		Key     string
+	}{
+		"parallel": {
+			Policy:  Parallel,
+			Payload: payload,
+			Key:     "",
+		},
+		"serialPerRepo": {
+			Policy:  SerialPerRepo,
+			Payload: payload,
+			Key:     "repo:7",
+		},
+		"serialPerRepoFullName": {
+			Policy:  SerialPerRepo,
+			Payload: []byte(`{"repository":{"full_name":"octo-org/octo-repo"}}`),
+			Key:     "repo:octo-org/octo-repo",
+		},
+		"serialPerRepoNoRepository": {
+			Policy:  SerialPerRepo,
+			Payload: []byte(`{"installation":{"id":42}}`),
+			Key:     "",
+		},
+		"serialPerInstallation": {
+			Policy:  SerialPerInstallation,
+			Payload: payload,
+			Key:     "installation:42",
+		},
+		"invalidPayload": {
+			Policy:  SerialPerInstallation,
+			Payload: []byte(`not json`),
+			Key:     "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assertField(t, "key", test.Key, test.Policy.SchedulingKey("pull_request", test.Payload))
+		})
+	}
+}
+
+func TestHandlerWithPolicy(t *testing.T) {
+	var active, maxActive int64
+	inner := testPolicyHandler(func() {
+		n := atomic.AddInt64(&active, 1)
+		defer atomic.AddInt64(&active, -1)
+		for {
+			m := atomic.LoadInt64(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt64(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	tests := map[string]struct {
+		Payloads  []string
+		MaxActive int64
+	}{
+		"sameRepository": {
+			Payloads:  []string{`{"repository":{"id":1}}`, `{"repository":{"id":1}}`, `{"repository":{"id":1}}`},
+			MaxActive: 1,
+		},
+		"differentRepositories": {
+			Payloads:  []string{`{"repository":{"id":1}}`, `{"repository":{"id":2}}`, `{"repository":{"id":3}}`},
+			MaxActive: 3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt64(&maxActive, 0)
+			h := HandlerWithPolicy(inner, SerialPerRepo)
+
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for _, p := range test.Payloads {
+				wg.Add(1)
+				go func(payload []byte) {
+					defer wg.Done()
+					<-start
+					if err := h.Handle(context.Background(), "issue_comment", "delivery", payload); err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}([]byte(p))
+			}
+			close(start)
+			wg.Wait()
+
+			if m := atomic.LoadInt64(&maxActive); test.MaxActive == 1 && m != 1 || test.MaxActive > 1 && m < 2 {
+				t.Errorf("incorrect concurrency: expected %d, actual %d", test.MaxActive, m)
+			}
+		})
+	}
+
+	assertField(t, "handler name", "testPolicyHandler", HandlerName(HandlerWithPolicy(inner, Parallel)))
+}
+
+// testPolicyHandler is a handler that is safe to call concurrently.
+type testPolicyHandler func()
+
+func (h testPolicyHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h testPolicyHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h()
+	return nil
+}
+
+func TestKeyedLocker(t *testing.T) {
+	l := newKeyedLocker()
+	waiters := func() int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiters["key"])
+	}
+	waitFor := func(n int) {
+		for i := 0; waiters() != n; i++ {
+			if i > 1000 {
+				t.Fatalf("timed out waiting for %d waiters", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	unlock, err := l.lock(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			unlock, err := l.lock(context.Background(), "key")
+			if err != nil {
+				t.Errorf("unexpected error locking: %v", err)
+				return
+			}
+			order <- i
+			unlock()
+		}(i)
+		waitFor(i + 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.lock(ctx, "key")
+		errc <- err
+	}()
+	waitFor(4)
+	cancel()
+	if err := <-errc; err == nil {
+		t.Error("expected error after cancellation, but got nil")
+	}
+	waitFor(3)
+
+	unlock()
+	for _, expected := range []int{1, 2} {
+		assertField(t, "lock order", expected, <-order)
+	}
+	waitFor(0)
+}
+
+func TestKeyedRunner(t *testing.T) {
+	r := newKeyedRunner()
+	key := policyKey{key: "repo:1"}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var order []int
+	go r.run(key, func() {
+		close(started)
+		<-release
+		order = append(order, 1)
+	})
+	<-started
+
+	// queued functions do not block the caller
+	for i := 2; i <= 3; i++ {
+		i := i
+		r.run(key, func() { order = append(order, i) })
+	}
+
+	other := make(chan struct{})
+	go r.run(policyKey{key: "repo:2"}, func() { close(other) })
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("function with a different key did not run")
+	}
+
+	close(release)
+	for i := 0; i < 1000; i++ {
+		r.mu.Lock()
+		n := len(r.pending)
+		r.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assertField(t, "order", "[1 2 3]", fmt.Sprint(order))
+	assertField(t, "pending keys", 0, len(r.pending))
+}
+
+func TestPolicySchedulingWorkers(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+
+	var active, maxActive int64
+	h := testKeyedHandler(func(deliveryID string, payload []byte) {
+		if SerialPerRepo.SchedulingKey("issue_comment", payload) == "repo:1" {
+			n := atomic.AddInt64(&active, 1)
+			defer atomic.AddInt64(&active, -1)
+			if n > atomic.LoadInt64(&maxActive) {
+				atomic.StoreInt64(&maxActive, n)
+			}
+			<-release
+		}
+		handled <- deliveryID
+	})
+
+	d := NewAsyncDispatcher([]EventHandler{HandlerWithPolicy(h, SerialPerRepo)}, testHookSecret, AsyncConfig{Workers: 2})
+	defer func() { _ = d.Shutdown(context.Background()) }()
+
+	// release blocked handlers before shutting down, even if the test fails
+	var releaseOnce sync.Once
+	releaseAll := func() { releaseOnce.Do(func() { close(release) }) }
+	defer releaseAll()
+
+	send := func(id, payload string) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, newPayloadRequest("issue_comment", id, []byte(payload), true))
+		assertField(t, "status for "+id, http.StatusAccepted, rec.Code)
+	}
+	for i := 1; i <= 4; i++ {
+		send(fmt.Sprintf("repo-1-%d", i), `{"repository":{"id":1}}`)
+	}
+	send("repo-2", `{"repository":{"id":2}}`)
+
+	// events waiting for the same repository must not occupy the second worker
+	select {
+	case id := <-handled:
+		assertField(t, "first handled event", "repo-2", id)
+	case <-time.After(time.Second):
+		t.Fatal("event for a different repository did not run while events for a busy repository waited")
+	}
+
+	releaseAll()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 4 events for the busy repository ran", i)
+		}
+	}
+	assertField(t, "max concurrent events for repository", int64(1), atomic.LoadInt64(&maxActive))
+}
+
+func TestPolicySchedulingCapacity(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	h := HandlerWithPolicy(testKeyedHandler(func(deliveryID string, payload []byte) {
+		<-release
+	}), SerialPerRepo)
+
+	s := QueueAsyncScheduler(2, 1).(ShutdownScheduler)
+	d := Dispatch{
+		Handler:    h,
+		EventType:  "issue_comment",
+		DeliveryID: "delivery",
+		Payload:    []byte(`{"repository":{"id":1}}`),
+	}
+
+	// one event runs, up to two wait for the key, and up to two fill the queue
+	accepted := 0
+	var err error
+	for i := 0; i < 1000; i++ {
+		if err = s.Schedule(context.Background(), d); err != nil {
+			break
+		}
+		accepted++
+	}
+	if err != ErrCapacityExceeded {
+		t.Fatalf("expected ErrCapacityExceeded, but got: %v", err)
+	}
+	if accepted > 5 {
+		t.Fatalf("scheduler accepted %d events for a busy key, expected at most 5", accepted)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	serr, ok := s.Shutdown(ctx).(ShutdownError)
+	if !ok {
+		t.Fatal("expected ShutdownError while an event is running")
+	}
+	assertField(t, "dropped events", accepted-1, serr.Dropped)
+}
+
+func TestHandlerWithPolicyInterfaces(t *testing.T) {
+	h := &testPolicyResponseHandler{}
+	d := NewEventDispatcher([]EventHandler{HandlerWithPolicy(h, SerialPerRepo)}, testHookSecret)
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, newPayloadRequest("issue_comment", "delivery", []byte(`{"repository":{"id":1}}`), true))
+
+	assertField(t, "status", http.StatusCreated, rec.Code)
+	assertField(t, "handler deadline", true, h.deadline)
+}
+
+// testKeyedHandler is a handler that is called with the delivery ID and
+// payload of each event.
+type testKeyedHandler func(deliveryID string, payload []byte)
+
+func (h testKeyedHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h testKeyedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h(deliveryID, payload)
+	return nil
+}
+
+// testPolicyResponseHandler is a ResponseHandler with a custom timeout.
+type testPolicyResponseHandler struct {
+	deadline bool
+}
+
+func (h *testPolicyResponseHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h *testPolicyResponseHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	_, err := h.HandleResponse(ctx, eventType, deliveryID, payload)
+	return err
+}
+
+func (h *testPolicyResponseHandler) HandleResponse(ctx context.Context, eventType, deliveryID string, payload []byte) (int, error) {
+	_, h.deadline = ctx.Deadline()
+	return http.StatusCreated, nil
+}
+
+func (h *testPolicyResponseHandler) HandlerTimeout() time.Duration {
+	return time.Minute
+}
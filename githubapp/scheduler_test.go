@@ -23,14 +23,18 @@ import (
 )
 
 type AsyncHandler struct {
-	Block  chan struct{}
-	Called chan bool
-	Error  error
+	Started chan bool
+	Block   chan struct{}
+	Called  chan bool
+	Error   error
 }
 
 func (h *AsyncHandler) Handles() []string { return []string{"ping"} }
 
 func (h *AsyncHandler) Handle(ctx context.Context, eventType, id string, payload []byte) error {
+	if h.Started != nil {
+		h.Started <- true
+	}
 	if h.Block != nil {
 		<-h.Block
 	}
@@ -154,4 +158,138 @@ func TestQueueAsyncScheduler(t *testing.T) {
 			t.Fatalf("expected ErrCapacityExceeded, but got: %v", err)
 		}
 	})
+
+	t.Run("waitForCapacity", func(t *testing.T) {
+		s := QueueAsyncScheduler(0, 1, WithQueueTimeout(timeout))
+		h := AsyncHandler{Block: make(chan struct{}), Called: make(chan bool, 2)}
+		ctx := context.Background()
+		d := Dispatch{
+			Handler: &h,
+		}
+
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling first dispatch: %v", err)
+		}
+		go func() {
+			time.Sleep(timeout / 4)
+			h.Block <- struct{}{}
+		}()
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling second dispatch: %v", err)
+		}
+
+		close(h.Block)
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling third dispatch: %v", err)
+		}
+	})
+
+	t.Run("rejectEventsAfterTimeout", func(t *testing.T) {
+		s := QueueAsyncScheduler(0, 1, WithQueueTimeout(timeout/4))
+		h := AsyncHandler{Block: make(chan struct{}), Called: make(chan bool, 1)}
+		ctx := context.Background()
+		d := Dispatch{
+			Handler: &h,
+		}
+
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling first dispatch: %v", err)
+		}
+		if err := s.Schedule(ctx, d); err != ErrCapacityExceeded {
+			t.Fatalf("expected ErrCapacityExceeded, but got: %v", err)
+		}
+	})
+}
+
+func TestQueueAsyncSchedulerShutdown(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	t.Run("drainsQueue", func(t *testing.T) {
+		s := QueueAsyncScheduler(2, 1).(ShutdownScheduler)
+		h := AsyncHandler{Started: make(chan bool, 3), Block: make(chan struct{}), Called: make(chan bool, 3)}
+		ctx := context.Background()
+		d := Dispatch{
+			Handler: &h,
+		}
+
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling first dispatch: %v", err)
+		}
+		<-h.Started
+		for i := 0; i < 2; i++ {
+			if err := s.Schedule(ctx, d); err != nil {
+				t.Fatalf("unexpected error scheduling queued dispatch %d: %v", i, err)
+			}
+		}
+		close(h.Block)
+
+		sctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		if err := s.Shutdown(sctx); err != nil {
+			t.Fatalf("unexpected error shutting down: %v", err)
+		}
+		if len(h.Called) != 3 {
+			t.Errorf("incorrect number of handled events: expected 3, actual %d", len(h.Called))
+		}
+	})
+
+	t.Run("rejectsEventsAfterShutdown", func(t *testing.T) {
+		s := QueueAsyncScheduler(1, 1).(ShutdownScheduler)
+		ctx := context.Background()
+
+		if err := s.Shutdown(ctx); err != nil {
+			t.Fatalf("unexpected error shutting down: %v", err)
+		}
+		if err := s.Schedule(ctx, Dispatch{Handler: &AsyncHandler{}}); err != ErrSchedulerClosed {
+			t.Fatalf("expected ErrSchedulerClosed, but got: %v", err)
+		}
+	})
+
+	t.Run("dropsEventsAfterDeadline", func(t *testing.T) {
+		s := QueueAsyncScheduler(2, 1).(ShutdownScheduler)
+		h := AsyncHandler{Started: make(chan bool, 3), Block: make(chan struct{}), Called: make(chan bool, 3)}
+		ctx := context.Background()
+		d := Dispatch{
+			Handler: &h,
+		}
+
+		if err := s.Schedule(ctx, d); err != nil {
+			t.Fatalf("unexpected error scheduling first dispatch: %v", err)
+		}
+		<-h.Started
+		for i := 0; i < 2; i++ {
+			if err := s.Schedule(ctx, d); err != nil {
+				t.Fatalf("unexpected error scheduling queued dispatch %d: %v", i, err)
+			}
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, timeout/4)
+		defer cancel()
+
+		err := s.Shutdown(sctx)
+
+		var serr ShutdownError
+		if !errors.As(err, &serr) {
+			t.Fatalf("expected ShutdownError, but got: %v", err)
+		}
+		if serr.Dropped != 2 {
+			t.Errorf("incorrect dropped count: expected 2, actual %d", serr.Dropped)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected error to wrap context.DeadlineExceeded, but got: %v", err)
+		}
+
+		// the running handler finishes, but no queued events start
+		close(h.Block)
+		select {
+		case <-h.Called:
+		case <-time.After(timeout):
+			t.Fatal("running handler did not finish")
+		}
+		time.Sleep(timeout / 4)
+		if len(h.Called) != 0 {
+			t.Errorf("dropped events were handled: %d", len(h.Called))
+		}
+	})
 }
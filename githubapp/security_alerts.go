@@ -0,0 +1,179 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// DependabotAlertEvent is triggered when a Dependabot alert is created,
+// dismissed, fixed, reintroduced, or reopened. The webhook event name is
+// "dependabot_alert". go-github does not define this event, so it is defined
+// here for use with typed handlers.
+//
+// See https://docs.github.com/en/webhooks/webhook-events-and-payloads#dependabot_alert
+type DependabotAlertEvent struct {
+	Action       *string                 `json:"action,omitempty"`
+	Alert        *github.DependabotAlert `json:"alert,omitempty"`
+	Repo         *github.Repository      `json:"repository,omitempty"`
+	Organization *github.Organization    `json:"organization,omitempty"`
+	Enterprise   *github.Enterprise      `json:"enterprise,omitempty"`
+	Installation *github.Installation    `json:"installation,omitempty"`
+	Sender       *github.User            `json:"sender,omitempty"`
+}
+
+// GetAction returns the Action field if it's non-nil, zero value otherwise.
+func (e *DependabotAlertEvent) GetAction() string {
+	if e == nil || e.Action == nil {
+		return ""
+	}
+	return *e.Action
+}
+
+// GetAlert returns the Alert field.
+func (e *DependabotAlertEvent) GetAlert() *github.DependabotAlert {
+	if e == nil {
+		return nil
+	}
+	return e.Alert
+}
+
+// GetRepo returns the Repo field.
+func (e *DependabotAlertEvent) GetRepo() *github.Repository {
+	if e == nil {
+		return nil
+	}
+	return e.Repo
+}
+
+// GetInstallation returns the Installation field.
+func (e *DependabotAlertEvent) GetInstallation() *github.Installation {
+	if e == nil {
+		return nil
+	}
+	return e.Installation
+}
+
+// ResolveSecretScanningAlert resolves a secret scanning alert. The resolution
+// is one of "false_positive", "wont_fix", "revoked", or "used_in_tests". The
+// comment is optional.
+func ResolveSecretScanningAlert(ctx context.Context, client *github.Client, owner, repo string, number int64, resolution, comment string) (*github.SecretScanningAlert, error) {
+	if resolution == "" {
+		return nil, errors.New("secret scanning alert resolution must not be empty")
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped resolving secret scanning alert", "owner", owner, "repo", repo, "alert", number, "resolution", resolution)
+		return &github.SecretScanningAlert{
+			Number:     github.Int(int(number)),
+			State:      github.String("resolved"),
+			Resolution: github.String(resolution),
+		}, nil
+	}
+
+	// the go-github options do not encode the request body correctly
+	body := struct {
+		State             string  `json:"state"`
+		Resolution        string  `json:"resolution"`
+		ResolutionComment *string `json:"resolution_comment,omitempty"`
+	}{
+		State:             "resolved",
+		Resolution:        resolution,
+		ResolutionComment: optionalString(comment),
+	}
+
+	alert := new(github.SecretScanningAlert)
+	if err := patchAlert(ctx, client, fmt.Sprintf("repos/%s/%s/secret-scanning/alerts/%d", owner, repo, number), body, alert); err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve secret scanning alert %d", number)
+	}
+	return alert, nil
+}
+
+// DismissCodeScanningAlert dismisses a code scanning alert. The reason is one
+// of "false positive", "won't fix", or "used in tests". The comment is
+// optional.
+func DismissCodeScanningAlert(ctx context.Context, client *github.Client, owner, repo string, number int64, reason, comment string) (*github.Alert, error) {
+	if reason == "" {
+		return nil, errors.New("code scanning alert dismissal reason must not be empty")
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped dismissing code scanning alert", "owner", owner, "repo", repo, "alert", number, "reason", reason)
+		return &github.Alert{
+			Number:          github.Int(int(number)),
+			State:           github.String("dismissed"),
+			DismissedReason: github.String(reason),
+		}, nil
+	}
+
+	alert, _, err := client.CodeScanning.UpdateAlert(ctx, owner, repo, number, &github.CodeScanningAlertState{
+		State:            "dismissed",
+		DismissedReason:  github.String(reason),
+		DismissedComment: optionalString(comment),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dismiss code scanning alert %d", number)
+	}
+	return alert, nil
+}
+
+// DismissDependabotAlert dismisses a Dependabot alert. The reason is one of
+// "fix_started", "inaccurate", "no_bandwidth", "not_used", or
+// "tolerable_risk". The comment is optional.
+func DismissDependabotAlert(ctx context.Context, client *github.Client, owner, repo string, number int, reason, comment string) (*github.DependabotAlert, error) {
+	if reason == "" {
+		return nil, errors.New("dismissal reason of Dependabot alert must not be empty")
+	}
+
+	if IsDryRun(ctx) {
+		logDryRun(ctx, "skipped dismissing Dependabot alert", "owner", owner, "repo", repo, "alert", number, "reason", reason)
+		return &github.DependabotAlert{
+			Number:          github.Int(number),
+			State:           github.String("dismissed"),
+			DismissedReason: github.String(reason),
+		}, nil
+	}
+
+	body := struct {
+		State            string  `json:"state"`
+		DismissedReason  string  `json:"dismissed_reason"`
+		DismissedComment *string `json:"dismissed_comment,omitempty"`
+	}{
+		State:            "dismissed",
+		DismissedReason:  reason,
+		DismissedComment: optionalString(comment),
+	}
+
+	alert := new(github.DependabotAlert)
+	if err := patchAlert(ctx, client, fmt.Sprintf("repos/%s/%s/dependabot/alerts/%d", owner, repo, number), body, alert); err != nil {
+		return nil, errors.Wrapf(err, "failed to dismiss Dependabot alert %d", number)
+	}
+	return alert, nil
+}
+
+// patchAlert sends a PATCH request to update an alert and decodes the
+// updated alert into v.
+func patchAlert(ctx context.Context, client *github.Client, u string, body, v interface{}) error {
+	req, err := client.NewRequest("PATCH", u, body)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(ctx, req, v)
+	return err
+}
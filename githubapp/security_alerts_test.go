@@ -0,0 +1,170 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestSecurityAlertHelpers(t *testing.T) {
+	tests := map[string]struct {
+		Call func(ctx context.Context, client *github.Client) (state string, err error)
+
+		Path string
+		Body map[string]string
+	}{
+		"resolveSecretScanningAlert": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				alert, err := ResolveSecretScanningAlert(ctx, client, "owner", "repo", 7, "revoked", "rotated")
+				return alert.GetState(), err
+			},
+			Path: "/repos/owner/repo/secret-scanning/alerts/7",
+			Body: map[string]string{"state": "resolved", "resolution": "revoked", "resolution_comment": "rotated"},
+		},
+		"dismissCodeScanningAlert": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				alert, err := DismissCodeScanningAlert(ctx, client, "owner", "repo", 7, "false positive", "")
+				return alert.GetState(), err
+			},
+			Path: "/repos/owner/repo/code-scanning/alerts/7",
+			Body: map[string]string{"state": "dismissed", "dismissed_reason": "false positive"},
+		},
+		"dismissDependabotAlert": {
+			Call: func(ctx context.Context, client *github.Client) (string, error) {
+				alert, err := DismissDependabotAlert(ctx, client, "owner", "repo", 7, "not_used", "dev dependency")
+				return alert.GetState(), err
+			},
+			Path: "/repos/owner/repo/dependabot/alerts/7",
+			Body: map[string]string{"state": "dismissed", "dismissed_reason": "not_used", "dismissed_comment": "dev dependency"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method != http.MethodPatch || r.URL.Path != test.Path {
+					t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+				}
+
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request body: %v", err)
+				}
+				if !reflect.DeepEqual(test.Body, body) {
+					t.Errorf("incorrect request body:\nexpected: %v\n  actual: %v", test.Body, body)
+				}
+				fmt.Fprintf(w, `{"number":7,"state":%q}`, body["state"])
+			}))
+			defer server.Close()
+
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+
+			state, err := test.Call(context.Background(), client)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if state != test.Body["state"] {
+				t.Errorf("incorrect alert state: expected %q, actual %q", test.Body["state"], state)
+			}
+
+			state, err = test.Call(WithDryRun(context.Background(), true), client)
+			if err != nil {
+				t.Fatalf("unexpected error in dry-run mode: %v", err)
+			}
+			if state != test.Body["state"] {
+				t.Errorf("incorrect alert state in dry-run mode: expected %q, actual %q", test.Body["state"], state)
+			}
+			if requests != 1 {
+				t.Errorf("incorrect number of requests: expected 1, actual %d", requests)
+			}
+		})
+	}
+}
+
+func TestSecurityAlertEvents(t *testing.T) {
+	h := &testAlertHandler{}
+	var dismissed []int
+
+	d := NewTypedDispatcher([]interface{}{h}, testHookSecret,
+		WithActionHandler("dependabot_alert", "dismissed", TypedEventHandler("dependabot_alert", func(ctx context.Context, event *DependabotAlertEvent) error {
+			dismissed = append(dismissed, event.GetAlert().GetNumber())
+			return nil
+		})),
+	)
+
+	events := map[string]string{
+		"code_scanning_alert":   `{"action":"created","alert":{"number":1}}`,
+		"secret_scanning_alert": `{"action":"resolved","alert":{"number":2}}`,
+		"dependabot_alert":      `{"action":"dismissed","alert":{"number":3},"installation":{"id":42}}`,
+	}
+	for eventType, body := range events {
+		res := httptest.NewRecorder()
+		d.ServeHTTP(res, newPayloadRequest(eventType, eventType, []byte(body), true))
+		if res.Code != http.StatusOK {
+			t.Errorf("incorrect response code for %s: expected %d, actual %d", eventType, http.StatusOK, res.Code)
+		}
+	}
+
+	expected := map[string]int{"code_scanning_alert": 1, "secret_scanning_alert": 2, "dependabot_alert": 3}
+	if !reflect.DeepEqual(expected, h.Alerts) {
+		t.Errorf("incorrect handled alerts:\nexpected: %v\n  actual: %v", expected, h.Alerts)
+	}
+	if !reflect.DeepEqual([]int{3}, dismissed) {
+		t.Errorf("incorrect dismissed alerts: %v", dismissed)
+	}
+	if h.InstallationID != 42 {
+		t.Errorf("incorrect installation ID: %d", h.InstallationID)
+	}
+}
+
+type testAlertHandler struct {
+	Alerts         map[string]int
+	InstallationID int64
+}
+
+func (h *testAlertHandler) record(eventType string, number int) {
+	if h.Alerts == nil {
+		h.Alerts = make(map[string]int)
+	}
+	h.Alerts[eventType] = number
+}
+
+func (h *testAlertHandler) HandleCodeScanningAlert(ctx context.Context, event *github.CodeScanningAlertEvent) error {
+	h.record("code_scanning_alert", event.GetAlert().GetNumber())
+	return nil
+}
+
+func (h *testAlertHandler) HandleSecretScanningAlert(ctx context.Context, event *github.SecretScanningAlertEvent) error {
+	h.record("secret_scanning_alert", event.GetAlert().GetNumber())
+	return nil
+}
+
+func (h *testAlertHandler) HandleDependabotAlert(ctx context.Context, event *DependabotAlertEvent) error {
+	h.record("dependabot_alert", event.GetAlert().GetNumber())
+	h.InstallationID = GetInstallationIDFromEvent(event)
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SharedCalls deduplicates concurrent calls with the same key, so that
+// expensive work triggered by several events at once, like analyzing the
+// same commit for near-simultaneous deliveries, runs only once. It is safe
+// for concurrent use.
+type SharedCalls struct {
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+type sharedCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewSharedCalls returns an empty SharedCalls.
+func NewSharedCalls() *SharedCalls {
+	return &SharedCalls{calls: make(map[string]*sharedCall)}
+}
+
+// Do calls fn and returns its results, unless a call with the same key is
+// already running. In that case, Do waits for the running call to finish and
+// returns its results, with shared set to true. Results are not cached after
+// the call finishes.
+//
+// Only the first caller's fn runs, so any context it uses belongs to that
+// caller: if the first caller's context is canceled, all callers may receive
+// the resulting error. If ctx is canceled while waiting for another call, Do
+// returns the context's error without waiting for the call to finish.
+func (g *SharedCalls) Do(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+
+		select {
+		case <-c.done:
+			return c.value, true, c.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+
+	c := &sharedCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = errors.Errorf("shared call %q panicked: %v", key, r)
+			g.finish(key, c)
+			panic(r)
+		}
+		g.finish(key, c)
+	}()
+
+	c.value, c.err = fn()
+	return c.value, false, c.err
+}
+
+func (g *SharedCalls) finish(key string, c *sharedCall) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+type sharedCallsKey struct{}
+
+// WithSharedCalls sets the SharedCalls used by DoShared in handlers called by
+// the dispatcher. Use the same SharedCalls with several dispatchers to
+// deduplicate work between them. By default, each dispatcher has its own
+// SharedCalls.
+func WithSharedCalls(calls *SharedCalls) DispatcherOption {
+	return func(d *eventDispatcher) {
+		if calls != nil {
+			d.sharedCalls = calls
+		}
+	}
+}
+
+// DoShared calls fn using the SharedCalls of the dispatcher that called the
+// handler with ctx, so that concurrent handler calls that compute the same
+// key share one execution and its result. See SharedCalls.Do for details. If
+// ctx was not created by a dispatcher, DoShared calls fn directly.
+//
+//	result, _, err := githubapp.DoShared(ctx, "analyze:"+sha, func() (interface{}, error) {
+//		return analyze(ctx, client, sha)
+//	})
+func DoShared(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, shared bool, err error) {
+	if calls, ok := ctx.Value(sharedCallsKey{}).(*SharedCalls); ok {
+		return calls.Do(ctx, key, fn)
+	}
+	value, err = fn()
+	return value, false, err
+}
+
+// sharedCallsHandler adds a SharedCalls to the context of an event handler.
+type sharedCallsHandler struct {
+	EventHandler
+	calls *SharedCalls
+}
+
+func (h *sharedCallsHandler) Name() string {
+	return HandlerName(h.EventHandler)
+}
+
+func (h *sharedCallsHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	ctx = context.WithValue(ctx, sharedCallsKey{}, h.calls)
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSharedCalls(t *testing.T) {
+	t.Run("sharesResult", func(t *testing.T) {
+		g := NewSharedCalls()
+		release := make(chan struct{})
+
+		var calls, shared int64
+		fn := func() (interface{}, error) {
+			atomic.AddInt64(&calls, 1)
+			<-release
+			return "result", nil
+		}
+
+		var started, done sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			started.Add(1)
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				started.Done()
+
+				v, s, err := g.Do(context.Background(), "key", fn)
+				if err != nil || v != "result" {
+					t.Errorf("incorrect result: %v, %v", v, err)
+				}
+				if s {
+					atomic.AddInt64(&shared, 1)
+				}
+			}()
+		}
+		started.Wait()
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		done.Wait()
+
+		if calls != 1 || shared != 4 {
+			t.Errorf("incorrect calls: expected 1 call and 4 shared results, actual %d and %d", calls, shared)
+		}
+
+		// results are not cached after the call finishes
+		if _, s, _ := g.Do(context.Background(), "key", func() (interface{}, error) { return nil, nil }); s {
+			t.Error("expected new call after the first finished, but the result was shared")
+		}
+	})
+
+	t.Run("canceledWaiter", func(t *testing.T) {
+		g := NewSharedCalls()
+		release := make(chan struct{})
+		defer close(release)
+
+		go func() {
+			_, _, _ = g.Do(context.Background(), "key", func() (interface{}, error) {
+				<-release
+				return nil, nil
+			})
+		}()
+		waitForSharedCall(t, g, "key")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := g.Do(ctx, "key", nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, but got %v", err)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		g := NewSharedCalls()
+		release := make(chan struct{})
+
+		go func() {
+			defer func() { _ = recover() }()
+			_, _, _ = g.Do(context.Background(), "key", func() (interface{}, error) {
+				<-release
+				panic("analysis failed")
+			})
+		}()
+		waitForSharedCall(t, g, "key")
+
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := g.Do(context.Background(), "key", nil)
+			errc <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		if err := <-errc; err == nil {
+			t.Error("expected error after panic, but got nil")
+		}
+	})
+}
+
+func TestDoShared(t *testing.T) {
+	t.Run("withoutDispatcher", func(t *testing.T) {
+		v, shared, err := DoShared(context.Background(), "key", func() (interface{}, error) {
+			return 42, nil
+		})
+		if err != nil || v != 42 || shared {
+			t.Errorf("incorrect result: %v, %t, %v", v, shared, err)
+		}
+	})
+
+	t.Run("dispatcher", func(t *testing.T) {
+		release := make(chan struct{})
+		var calls, handled int64
+
+		h := testSharedCallHandler(func(ctx context.Context) {
+			_, _, err := DoShared(ctx, "analyze:abc123", func() (interface{}, error) {
+				atomic.AddInt64(&calls, 1)
+				<-release
+				return nil, nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			atomic.AddInt64(&handled, 1)
+		})
+		d := NewEventDispatcher([]EventHandler{h}, testHookSecret)
+
+		var wg sync.WaitGroup
+		for _, id := range []string{"first", "second"} {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				d.ServeHTTP(httptest.NewRecorder(), newHookRequest("issue_comment", id, true))
+			}(id)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if calls != 1 || handled != 2 {
+			t.Errorf("incorrect calls: expected 1 shared call for 2 events, actual %d for %d", calls, handled)
+		}
+	})
+}
+
+// testSharedCallHandler is a handler that calls a function with the context
+// of each event.
+type testSharedCallHandler func(ctx context.Context)
+
+func (h testSharedCallHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h testSharedCallHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h(ctx)
+	return nil
+}
+
+func waitForSharedCall(t *testing.T, g *SharedCalls, key string) {
+	for i := 0; i < 1000; i++ {
+		g.mu.Lock()
+		_, ok := g.calls[key]
+		g.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for call %q", key)
+}
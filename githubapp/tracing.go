@@ -0,0 +1,113 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	TraceKeyEventType  = "github.event_type"
+	TraceKeyDeliveryID = "github.delivery_id"
+	TraceKeyRequestID  = "github.request_id"
+	TraceKeyMethod     = "http.method"
+	TraceKeyURL        = "http.url"
+	TraceKeyStatusCode = "http.status_code"
+)
+
+// Tracer starts spans for webhook deliveries and GitHub API requests. It
+// allows reporting traces to systems like OpenTelemetry without the library
+// depending on their clients. Implementations must store the span in the
+// returned context so that spans started with that context are its
+// children.
+//
+// Attributes are alternating keys and values, like "github.event_type",
+// "push".
+type Tracer interface {
+	Start(ctx context.Context, name string, attributes ...string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attributes ...string)
+	RecordError(err error)
+	End()
+}
+
+// WithTracer starts a span for each webhook delivery. The span is named
+// "webhook <event type>", has the event type and delivery ID as attributes,
+// and is stored in the context passed to handlers, so that clients created
+// with the WithClientTracer option create child spans for their requests.
+// When handlers run synchronously, their errors are recorded on the span.
+//
+// If the span has a TraceID() string method, the trace ID is added to the
+// context logger with the LogKeyTraceID key or the configured field name.
+func WithTracer(t Tracer) DispatcherOption {
+	return func(d *eventDispatcher) {
+		d.tracer = t
+	}
+}
+
+// WithClientTracer starts a span for each request made by created clients,
+// using the request context as the parent. Spans are named "GitHub API
+// <method>" and have the method, URL, response status, and GitHub request ID
+// as attributes. Retries of a request are part of the same span.
+func WithClientTracer(t Tracer) ClientOption {
+	return func(c *clientCreator) {
+		c.tracer = t
+	}
+}
+
+// startDeliverySpan starts the span for a webhook delivery and adds the
+// trace ID to the logger, if available.
+func (d *eventDispatcher) startDeliverySpan(ctx context.Context, eventType, deliveryID string) (context.Context, Span) {
+	ctx, span := d.tracer.Start(ctx, "webhook "+eventType, TraceKeyEventType, eventType, TraceKeyDeliveryID, deliveryID)
+	if s, ok := span.(interface{ TraceID() string }); ok {
+		if id := s.TraceID(); id != "" {
+			ctx = withLogFields(ctx, FieldNamesFromContext(ctx).TraceID, id)
+		}
+	}
+	return ctx, span
+}
+
+// traceRequests returns the middleware that starts a span for each request,
+// if tracing is enabled.
+func (c *clientCreator) traceRequests() []ClientMiddleware {
+	if c.tracer == nil {
+		return nil
+	}
+
+	t := c.tracer
+	return []ClientMiddleware{func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			ctx, span := t.Start(r.Context(), "GitHub API "+r.Method, TraceKeyMethod, r.Method, TraceKeyURL, r.URL.String())
+			defer span.End()
+
+			res, err := next.RoundTrip(r.WithContext(ctx))
+			if err != nil {
+				span.RecordError(err)
+				return res, err
+			}
+
+			span.SetAttributes(TraceKeyStatusCode, strconv.Itoa(res.StatusCode))
+			if id := res.Header.Get(RequestIDHeader); id != "" {
+				span.SetAttributes(TraceKeyRequestID, id)
+			}
+			return res, err
+		})
+	}}
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapp
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	tests := map[string]struct {
+		HandlerErr error
+
+		Spans []testSpan
+	}{
+		"tracesDeliveryAndRequests": {
+			Spans: []testSpan{
+				{
+					Name:       "webhook pull_request",
+					Attributes: []string{TraceKeyEventType, "pull_request", TraceKeyDeliveryID, "trace"},
+				},
+				{
+					Name:   "GitHub API GET",
+					Parent: "webhook pull_request",
+					Attributes: []string{
+						TraceKeyMethod, "GET",
+						TraceKeyURL, "/repos/palantir/go-githubapp",
+						TraceKeyStatusCode, "200",
+					},
+				},
+			},
+		},
+		"recordsHandlerError": {
+			HandlerErr: errors.New("handler failed"),
+			Spans: []testSpan{
+				{
+					Name:       "webhook pull_request",
+					Attributes: []string{TraceKeyEventType, "pull_request", TraceKeyDeliveryID, "trace"},
+					Errors:     []string{"handler failed"},
+				},
+				{
+					Name:   "GitHub API GET",
+					Parent: "webhook pull_request",
+					Attributes: []string{
+						TraceKeyMethod, "GET",
+						TraceKeyURL, "/repos/palantir/go-githubapp",
+						TraceKeyStatusCode, "200",
+					},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestGitHubServer(t, "")
+			tracer := &testTracer{}
+
+			cc := NewClientCreator(server.URL, server.URL, 1, newTestPrivateKey(t), WithClientTracer(tracer))
+			h := TestEventHandler{
+				Types: []string{"pull_request"},
+				Fn: func(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+					client, err := cc.NewInstallationClient(42)
+					if err != nil {
+						return err
+					}
+					if _, _, err := client.Repositories.Get(ctx, "palantir", "go-githubapp"); err != nil {
+						return err
+					}
+					return test.HandlerErr
+				},
+			}
+			d := NewEventDispatcher([]EventHandler{&h}, testHookSecret, WithTracer(tracer))
+			d.ServeHTTP(httptest.NewRecorder(), newHookRequest("pull_request", "trace", true))
+
+			spans := tracer.Spans(server.URL)
+			if !reflect.DeepEqual(test.Spans, spans) {
+				t.Errorf("incorrect spans:\nexpected: %+v\n  actual: %+v", test.Spans, spans)
+			}
+		})
+	}
+}
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	Name       string
+	Parent     string
+	Attributes []string
+	Errors     []string
+
+	ended bool
+}
+
+func (s *testSpan) SetAttributes(attributes ...string) {
+	s.Attributes = append(s.Attributes, attributes...)
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.Errors = append(s.Errors, err.Error())
+}
+
+func (s *testSpan) End() {
+	s.ended = true
+}
+
+// testTracer records spans in the order they start.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attributes ...string) (context.Context, Span) {
+	s := &testSpan{Name: name, Attributes: attributes}
+	if parent, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		s.Parent = parent.Name
+	}
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+// Spans returns the ended spans, removing the server URL from URL attributes.
+func (t *testTracer) Spans(serverURL string) []testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var spans []testSpan
+	for _, s := range t.spans {
+		if !s.ended {
+			continue
+		}
+		span := *s
+		span.Attributes = append([]string(nil), s.Attributes...)
+		for i := 0; i+1 < len(span.Attributes); i += 2 {
+			if span.Attributes[i] == TraceKeyURL {
+				span.Attributes[i+1] = span.Attributes[i+1][len(serverURL):]
+			}
+		}
+		span.ended = false
+		spans = append(spans, span)
+	}
+	return spans
+}
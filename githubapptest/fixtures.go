@@ -0,0 +1,63 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapptest
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Fixture returns an example payload for an event type. The payloads are
+// based on payloads sent by GitHub, with IDs and names replaced by
+// placeholder values. All payloads use the repository "octo-org/octo-repo"
+// and the installation ID 1234. Fixture panics if there is no payload for
+// the event type; see Fixtures for the available types.
+func Fixture(eventType string) []byte {
+	b, err := fixtures.ReadFile("fixtures/" + eventType + ".json")
+	if err != nil {
+		panic(fmt.Sprintf("githubapptest: no fixture for %s events", eventType))
+	}
+	return b
+}
+
+// FixtureEvent returns the example payload for an event type parsed into the
+// go-github type for the event, like *github.PullRequestEvent. Tests can
+// modify the event before passing it to Deliver.
+func FixtureEvent(eventType string) interface{} {
+	event, err := github.ParseWebHook(eventType, Fixture(eventType))
+	if err != nil {
+		panic(fmt.Sprintf("githubapptest: failed to parse fixture for %s events: %v", eventType, err))
+	}
+	return event
+}
+
+// Fixtures returns the event types that have example payloads.
+func Fixtures() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+
+	var types []string
+	for _, e := range entries {
+		types = append(types, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(types)
+	return types
+}
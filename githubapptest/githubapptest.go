@@ -0,0 +1,102 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package githubapptest provides utilities for testing GitHub webhook
+// handlers. It simulates webhook deliveries to an http.Handler, like the
+// dispatcher created by githubapp.NewEventDispatcher, and provides example
+// payloads for common event types.
+package githubapptest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+)
+
+// Secret is the webhook secret used by Deliver. Create dispatchers under
+// test with this secret or use DeliverWithSecret.
+const Secret = "githubapptest-webhook-secret"
+
+// Deliver sends a webhook delivery for an event to a handler, signed with
+// Secret, and returns the recorded response. See NewRequest for details
+// about the payload.
+func Deliver(h http.Handler, eventType string, payload interface{}) *httptest.ResponseRecorder {
+	return DeliverWithSecret(h, Secret, eventType, payload)
+}
+
+// DeliverWithSecret is like Deliver, but signs the payload with the given
+// secret.
+func DeliverWithSecret(h http.Handler, secret, eventType string, payload interface{}) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, NewRequest(secret, eventType, payload))
+	return res
+}
+
+// NewRequest returns a webhook request for an event, with the same headers
+// GitHub sends, including a random delivery ID and SHA-256 and SHA-1
+// signatures computed with secret. If secret is empty, the request is not
+// signed.
+//
+// If payload is a []byte or string, it is sent as is. Otherwise, it is
+// encoded as JSON. Like httptest.NewRequest, NewRequest panics if the
+// payload cannot be encoded.
+func NewRequest(secret, eventType string, payload interface{}) *http.Request {
+	var body []byte
+	switch p := payload.(type) {
+	case []byte:
+		body = p
+	case string:
+		body = []byte(p)
+	default:
+		b, err := json.Marshal(payload)
+		if err != nil {
+			panic(fmt.Sprintf("githubapptest: failed to encode %s payload: %v", eventType, err))
+		}
+		body = b
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/github/hook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/githubapptest")
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", newDeliveryID())
+	if secret != "" {
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, secret, body))
+		req.Header.Set("X-Hub-Signature", "sha1="+sign(sha1.New, secret, body))
+	}
+	return req
+}
+
+func sign(h func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDeliveryID returns a random ID in the UUID format GitHub uses.
+func newDeliveryID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("githubapptest: failed to generate delivery ID: %v", err))
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubapptest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+func TestDeliver(t *testing.T) {
+	tests := map[string]struct {
+		Secret  string
+		Payload interface{}
+
+		Code    int
+		Handled bool
+	}{
+		"bytes": {
+			Secret:  Secret,
+			Payload: Fixture("pull_request"),
+			Code:    http.StatusOK,
+			Handled: true,
+		},
+		"struct": {
+			Secret: Secret,
+			Payload: &github.PullRequestEvent{
+				Action:       github.String("closed"),
+				Number:       github.Int(7),
+				Repo:         &github.Repository{Name: github.String("repo")},
+				Installation: &github.Installation{ID: github.Int64(1)},
+			},
+			Code:    http.StatusOK,
+			Handled: true,
+		},
+		"wrongSecret": {
+			Secret:  "wrong-secret",
+			Payload: Fixture("pull_request"),
+			Code:    http.StatusBadRequest,
+		},
+		"unsigned": {
+			Payload: Fixture("pull_request"),
+			Code:    http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := &testHandler{types: []string{"pull_request"}}
+			handler := githubapp.NewEventDispatcher([]githubapp.EventHandler{h}, Secret)
+
+			res := DeliverWithSecret(handler, test.Secret, "pull_request", test.Payload)
+			if res.Code != test.Code {
+				t.Errorf("incorrect response code: expected %d, actual %d", test.Code, res.Code)
+			}
+			if handled := h.payload != nil; handled != test.Handled {
+				t.Fatalf("incorrect handled state: expected %t, actual %t", test.Handled, handled)
+			}
+			if test.Handled && len(h.deliveryID) != 36 {
+				t.Errorf("incorrect delivery ID: %q", h.deliveryID)
+			}
+		})
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	types := Fixtures()
+	if len(types) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, eventType := range types {
+		t.Run(eventType, func(t *testing.T) {
+			h := &testHandler{types: []string{eventType}}
+			handler := githubapp.NewEventDispatcher([]githubapp.EventHandler{h}, Secret, githubapp.WithPayloadValidation())
+
+			if res := Deliver(handler, eventType, FixtureEvent(eventType)); res.Code != http.StatusOK {
+				t.Fatalf("incorrect response code: expected %d, actual %d", http.StatusOK, res.Code)
+			}
+			if len(h.payload) == 0 {
+				t.Error("handler did not receive the event")
+			}
+		})
+	}
+
+	t.Run("parsesEvent", func(t *testing.T) {
+		event, ok := FixtureEvent("issue_comment").(*github.IssueCommentEvent)
+		if !ok {
+			t.Fatalf("incorrect event type: %T", FixtureEvent("issue_comment"))
+		}
+		if id := event.GetInstallation().GetID(); id != 1234 {
+			t.Errorf("incorrect installation ID: %d", id)
+		}
+		if name := event.GetRepo().GetFullName(); name != "octo-org/octo-repo" {
+			t.Errorf("incorrect repository: %s", name)
+		}
+	})
+
+	t.Run("unknownFixture", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected panic for unknown fixture")
+			}
+		}()
+		Fixture("unknown")
+	})
+}
+
+type testHandler struct {
+	types []string
+
+	deliveryID string
+	payload    []byte
+}
+
+func (h *testHandler) Handles() []string {
+	return h.types
+}
+
+func (h *testHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.deliveryID, h.payload = deliveryID, payload
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package markdown builds GitHub Flavored Markdown for issue and pull request
+// comments. The functions make it safe to include arbitrary text, like the
+// body of a comment or the output of a command, in the Markdown posted by an
+// app without changing how the rest of the comment renders.
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// punctuation contains the ASCII punctuation characters, all of which can be
+// escaped with a backslash.
+const punctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// Escape returns the text escaped so that it renders as plain inline text.
+// Every ASCII punctuation character is escaped with a backslash and line
+// breaks are replaced by spaces, so the text cannot start new blocks, like
+// lists or headings, or close blocks that contain it.
+func Escape(text string) string {
+	var b strings.Builder
+	for _, r := range normalizeNewlines(text) {
+		switch {
+		case r == '\n':
+			b.WriteByte(' ')
+		case r < 128 && strings.ContainsRune(punctuation, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Code returns the text as an inline code span. The span is delimited by more
+// backticks than the longest run of backticks in the text, so the text cannot
+// end the span early. Code returns an empty string if the text is empty.
+func Code(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	text = strings.ReplaceAll(normalizeNewlines(text), "\n", " ")
+	delim := strings.Repeat("`", longestRun(text, '`')+1)
+
+	// Renderers remove one space from each end of the span, which makes it
+	// possible to include text that starts or ends with a backtick
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") ||
+		(strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ") && strings.Trim(text, " ") != "") {
+		text = " " + text + " "
+	}
+	return delim + text + delim
+}
+
+// CodeBlock returns the content as a fenced code block. The fence is longer
+// than the longest run of backticks in the content, so the content cannot
+// close the block early. The returned block ends with a line break.
+func CodeBlock(content string) string {
+	return CodeBlockWithLanguage("", content)
+}
+
+// CodeBlockWithLanguage is like CodeBlock, but sets the language used to
+// highlight the content. The language is omitted if it contains whitespace or
+// backticks.
+func CodeBlockWithLanguage(language, content string) string {
+	if strings.ContainsAny(language, "` \t\r\n") {
+		language = ""
+	}
+
+	content = normalizeNewlines(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	n := longestRun(content, '`') + 1
+	if n < 3 {
+		n = 3
+	}
+	fence := strings.Repeat("`", n)
+
+	return fence + language + "\n" + content + fence + "\n"
+}
+
+// Details returns a collapsible section with the summary, which is always
+// visible, and the body, which is hidden until the section is expanded. The
+// summary is plain text and is escaped, while the body is Markdown and should
+// escape any untrusted text it contains. The returned section ends with a line
+// break.
+func Details(summary, body string) string {
+	body = strings.TrimRight(normalizeNewlines(body), "\n")
+
+	var b strings.Builder
+	b.WriteString("<details>\n<summary>")
+	b.WriteString(html.EscapeString(strings.ReplaceAll(normalizeNewlines(summary), "\n", " ")))
+	b.WriteString("</summary>\n\n")
+	if body != "" {
+		b.WriteString(body)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("</details>\n")
+	return b.String()
+}
+
+// Table returns a table with the header and rows. Cells are Markdown and
+// should escape any untrusted text they contain. Pipe characters in cells are
+// escaped and line breaks are replaced with HTML line breaks, which tables
+// require. Rows with fewer cells than the header are padded with empty cells.
+// Table returns an empty string if the header is empty. The returned table
+// ends with a line break.
+func Table(header []string, rows [][]string) string {
+	if len(header) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	writeTableRow(&b, header, len(header))
+
+	b.WriteString("|")
+	for range header {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+
+	for _, row := range rows {
+		writeTableRow(&b, row, len(header))
+	}
+	return b.String()
+}
+
+func writeTableRow(b *strings.Builder, cells []string, n int) {
+	b.WriteString("|")
+	for i := 0; i < n || i < len(cells); i++ {
+		var cell string
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		cell = strings.TrimSpace(normalizeNewlines(cell))
+		cell = strings.ReplaceAll(cell, "|", "\\|")
+		cell = strings.ReplaceAll(cell, "\n", "<br>")
+
+		b.WriteString(" ")
+		b.WriteString(cell)
+		b.WriteString(" |")
+	}
+	b.WriteString("\n")
+}
+
+// Task is an item in a task list.
+type Task struct {
+	// Text is the Markdown content of the item. It should escape any
+	// untrusted text it contains.
+	Text string
+
+	// Done is true if the item is checked.
+	Done bool
+}
+
+// TaskList returns a list of tasks with checkboxes. Each line of text after
+// the first in a task is indented so that it stays part of the task. The
+// returned list ends with a line break.
+func TaskList(tasks []Task) string {
+	var b strings.Builder
+	for _, t := range tasks {
+		if t.Done {
+			b.WriteString("- [x] ")
+		} else {
+			b.WriteString("- [ ] ")
+		}
+		text := strings.TrimRight(normalizeNewlines(t.Text), "\n")
+		b.WriteString(strings.ReplaceAll(text, "\n", "\n  "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// longestRun returns the length of the longest run of c in s.
+func longestRun(s string, c byte) int {
+	longest, current := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
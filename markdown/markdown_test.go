@@ -0,0 +1,276 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package markdown
+
+import (
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	tests := map[string]struct {
+		Input  string
+		Output string
+	}{
+		"plain": {
+			Input:  "hello world",
+			Output: "hello world",
+		},
+		"emphasis": {
+			Input:  "*bold* _italic_",
+			Output: `\*bold\* \_italic\_`,
+		},
+		"link": {
+			Input:  "[click](https://example.com)",
+			Output: `\[click\]\(https\:\/\/example\.com\)`,
+		},
+		"html": {
+			Input:  "<script>",
+			Output: `\<script\>`,
+		},
+		"backslash": {
+			Input:  `a\b`,
+			Output: `a\\b`,
+		},
+		"newlines": {
+			Input:  "line\n# heading\r\n- item",
+			Output: `line \# heading \- item`,
+		},
+		"unicode": {
+			Input:  "héllo 👋",
+			Output: "héllo 👋",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := Escape(test.Input); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := map[string]struct {
+		Input  string
+		Output string
+	}{
+		"empty": {
+			Input:  "",
+			Output: "",
+		},
+		"plain": {
+			Input:  "/deploy",
+			Output: "`/deploy`",
+		},
+		"backtick": {
+			Input:  "a`b",
+			Output: "``a`b``",
+		},
+		"leadingBacktick": {
+			Input:  "`a",
+			Output: "`` `a ``",
+		},
+		"surroundingSpaces": {
+			Input:  " a ",
+			Output: "`  a  `",
+		},
+		"onlySpaces": {
+			Input:  "  ",
+			Output: "`  `",
+		},
+		"newline": {
+			Input:  "a\nb",
+			Output: "`a b`",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := Code(test.Input); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	tests := map[string]struct {
+		Language string
+		Input    string
+		Output   string
+	}{
+		"empty": {
+			Input:  "",
+			Output: "```\n```\n",
+		},
+		"plain": {
+			Input:  "hello\nworld",
+			Output: "```\nhello\nworld\n```\n",
+		},
+		"trailingNewline": {
+			Input:  "hello\n",
+			Output: "```\nhello\n```\n",
+		},
+		"fence": {
+			Input:  "```\ninjected\n```",
+			Output: "````\n```\ninjected\n```\n````\n",
+		},
+		"inlineFence": {
+			Input:  "text ```` text",
+			Output: "`````\ntext ```` text\n`````\n",
+		},
+		"trailingFence": {
+			Input:  "text\n```",
+			Output: "````\ntext\n```\n````\n",
+		},
+		"longFence": {
+			Input:  "`````go\n``",
+			Output: "``````\n`````go\n``\n``````\n",
+		},
+		"carriageReturns": {
+			Input:  "a\r\nb",
+			Output: "```\na\nb\n```\n",
+		},
+		"language": {
+			Language: "go",
+			Input:    "package main",
+			Output:   "```go\npackage main\n```\n",
+		},
+		"invalidLanguage": {
+			Language: "go`\n# heading",
+			Input:    "package main",
+			Output:   "```\npackage main\n```\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := CodeBlockWithLanguage(test.Language, test.Input); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
+
+func TestDetails(t *testing.T) {
+	tests := map[string]struct {
+		Summary string
+		Body    string
+		Output  string
+	}{
+		"basic": {
+			Summary: "Logs",
+			Body:    "some output\n",
+			Output:  "<details>\n<summary>Logs</summary>\n\nsome output\n\n</details>\n",
+		},
+		"escapedSummary": {
+			Summary: "<b>Logs</b> & more\nlines",
+			Body:    "output",
+			Output:  "<details>\n<summary>&lt;b&gt;Logs&lt;/b&gt; &amp; more lines</summary>\n\noutput\n\n</details>\n",
+		},
+		"emptyBody": {
+			Summary: "Nothing",
+			Output:  "<details>\n<summary>Nothing</summary>\n\n</details>\n",
+		},
+		"codeBlock": {
+			Summary: "Logs",
+			Body:    CodeBlock("line 1\nline 2"),
+			Output:  "<details>\n<summary>Logs</summary>\n\n```\nline 1\nline 2\n```\n\n</details>\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := Details(test.Summary, test.Body); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	tests := map[string]struct {
+		Header []string
+		Rows   [][]string
+		Output string
+	}{
+		"empty": {
+			Output: "",
+		},
+		"headerOnly": {
+			Header: []string{"Name", "Status"},
+			Output: "| Name | Status |\n| --- | --- |\n",
+		},
+		"rows": {
+			Header: []string{"Name", "Status"},
+			Rows: [][]string{
+				{"build", "passed"},
+				{"test", "failed"},
+			},
+			Output: "| Name | Status |\n| --- | --- |\n| build | passed |\n| test | failed |\n",
+		},
+		"shortRow": {
+			Header: []string{"Name", "Status"},
+			Rows:   [][]string{{"build"}},
+			Output: "| Name | Status |\n| --- | --- |\n| build |  |\n",
+		},
+		"specialCharacters": {
+			Header: []string{"Name"},
+			Rows:   [][]string{{"a | b\nc"}},
+			Output: "| Name |\n| --- |\n| a \\| b<br>c |\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := Table(test.Header, test.Rows); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
+
+func TestTaskList(t *testing.T) {
+	tests := map[string]struct {
+		Tasks  []Task
+		Output string
+	}{
+		"empty": {
+			Output: "",
+		},
+		"tasks": {
+			Tasks: []Task{
+				{Text: "build", Done: true},
+				{Text: "deploy"},
+			},
+			Output: "- [x] build\n- [ ] deploy\n",
+		},
+		"multiline": {
+			Tasks: []Task{
+				{Text: "deploy\nto production\n"},
+			},
+			Output: "- [ ] deploy\n  to production\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if out := TaskList(test.Tasks); out != test.Output {
+				t.Errorf("incorrect output\nexpected: %q\n  actual: %q", test.Output, out)
+			}
+		})
+	}
+}
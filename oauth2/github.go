@@ -15,9 +15,13 @@
 package oauth2
 
 import (
+	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/google/go-github/v53/github"
 	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 )
 
@@ -40,3 +44,64 @@ func GetConfig(c githubapp.Config, scopes []string) *oauth2.Config {
 func joinURL(base, path string) string {
 	return strings.TrimSuffix(base, "/") + path
 }
+
+// GitHubLogin contains information about the GitHub user who completed the
+// auth flow.
+type GitHubLogin struct {
+	*Login
+
+	// GitHubClient is a GitHub client that authenticates as the user.
+	GitHubClient *github.Client
+
+	// UserLogin and UserID identify the user.
+	UserLogin string
+	UserID    int64
+}
+
+// GitHubLoginCallback is called after a successful auth flow with GitHub.
+type GitHubLoginCallback func(w http.ResponseWriter, r *http.Request, login *GitHubLogin)
+
+// OnGitHubLogin sets a login callback that receives a GitHub client for the
+// user and the user's login and ID. The client uses the API URL for the
+// configuration. If the user cannot be loaded, the error callback is called
+// instead.
+func OnGitHubLogin(c githubapp.Config, callback GitHubLoginCallback) Param {
+	return func(h *handler) {
+		h.onLogin = func(w http.ResponseWriter, r *http.Request, login *Login) {
+			client, err := newGitHubClient(c, login.Client)
+			if err != nil {
+				h.onError(w, r, err)
+				return
+			}
+
+			user, _, err := client.Users.Get(r.Context(), "")
+			if err != nil {
+				h.onError(w, r, errors.Wrap(err, "failed to get authenticated user"))
+				return
+			}
+
+			callback(w, r, &GitHubLogin{
+				Login:        login,
+				GitHubClient: client,
+				UserLogin:    user.GetLogin(),
+				UserID:       user.GetID(),
+			})
+		}
+	}
+}
+
+func newGitHubClient(c githubapp.Config, httpClient *http.Client) (*github.Client, error) {
+	v3, _, err := c.APIURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(v3, "/") + "/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse base URL: %q", v3)
+	}
+
+	client := github.NewClient(httpClient)
+	client.BaseURL = baseURL
+	return client, nil
+}
@@ -56,8 +56,9 @@ type handler struct {
 	onError ErrorCallback
 	onLogin LoginCallback
 
-	forceTLS bool
-	store    StateStore
+	forceTLS    bool
+	forceVerify bool
+	store       StateStore
 }
 
 // NewHandler returns an http.Hander that implements the 3-leg OAuth2 flow on a
@@ -102,6 +103,16 @@ func ForceTLS(forceTLS bool) Param {
 	}
 }
 
+// ForceVerify determines if users must confirm the account they use to log in,
+// even if they previously authorized the application. When enabled, GitHub
+// shows an account picker instead of immediately redirecting back to the
+// application.
+func ForceVerify(forceVerify bool) Param {
+	return func(h *handler) {
+		h.forceVerify = forceVerify
+	}
+}
+
 // WithStore sets the StateStore used to create and verify OAuth2 states. The
 // default state store uses a static value, is insecure, and is not suitable
 // for production use.
@@ -154,7 +165,12 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		url := conf.AuthCodeURL(state, oauth2.AccessTypeOnline)
+		opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOnline}
+		if h.forceVerify {
+			opts = append(opts, oauth2.SetAuthURLParam("prompt", "select_account"))
+		}
+
+		url := conf.AuthCodeURL(state, opts...)
 		http.Redirect(w, r, url, http.StatusFound)
 		return
 	}
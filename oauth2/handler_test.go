@@ -0,0 +1,110 @@
+// Copyright 2023 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+func TestGitHubLoginFlow(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if code := r.FormValue("code"); code != "test-code" {
+			t.Errorf("incorrect code: %q", code)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"user-token","token_type":"bearer"}`)
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer user-token" {
+			t.Errorf("incorrect authorization: %q", auth)
+		}
+		fmt.Fprint(w, `{"login":"octocat","id":1}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var c githubapp.Config
+	c.WebURL = srv.URL
+	c.OAuth.ClientID = "client-id"
+
+	var login *GitHubLogin
+	h := NewHandler(
+		GetConfig(c, []string{"read:user"}),
+		ForceVerify(true),
+		WithStore(&CookieStateStore{Insecure: true}),
+		OnGitHubLogin(c, func(w http.ResponseWriter, r *http.Request, l *GitHubLogin) {
+			login = l
+		}),
+		OnError(func(w http.ResponseWriter, r *http.Request, err error) {
+			t.Errorf("unexpected error: %v", err)
+		}),
+	)
+
+	// initial request redirects to GitHub
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/github/auth", nil))
+
+	if res.Code != http.StatusFound {
+		t.Fatalf("incorrect response code: expected %d, actual %d", http.StatusFound, res.Code)
+	}
+	location, err := url.Parse(res.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect location: %v", err)
+	}
+	q := location.Query()
+	if q.Get("prompt") != "select_account" {
+		t.Errorf("incorrect prompt parameter: %q", q.Get("prompt"))
+	}
+	if q.Get("scope") != "read:user" {
+		t.Errorf("incorrect scope parameter: %q", q.Get("scope"))
+	}
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != q.Get("state") {
+		t.Fatalf("state cookie does not match state parameter: %v", cookies)
+	}
+
+	// callback with an invalid state is rejected
+	req := httptest.NewRequest(http.MethodGet, "/api/github/auth?code=test-code&state=wrong", nil)
+	req.AddCookie(cookies[0])
+	res = httptest.NewRecorder()
+	NewHandler(GetConfig(c, nil), WithStore(&CookieStateStore{Insecure: true})).ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("incorrect response code for invalid state: expected %d, actual %d", http.StatusBadRequest, res.Code)
+	}
+
+	// callback with the state completes the flow
+	req = httptest.NewRequest(http.MethodGet, "/api/github/auth?code=test-code&state="+q.Get("state"), nil)
+	req.AddCookie(cookies[0])
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if login == nil {
+		t.Fatal("login callback was not called")
+	}
+	if login.UserLogin != "octocat" || login.UserID != 1 {
+		t.Errorf("incorrect user: %s (%d)", login.UserLogin, login.UserID)
+	}
+	if login.Token.AccessToken != "user-token" {
+		t.Errorf("incorrect token: %q", login.Token.AccessToken)
+	}
+}
@@ -15,7 +15,13 @@
 package oauth2
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // StateStore generates and verifies the state parameter for OAuth2 flows.
@@ -30,6 +36,73 @@ type StateStore interface {
 	VerifyState(r *http.Request, state string) (bool, error)
 }
 
+const (
+	DefaultStateCookieName   = "oauth2_state"
+	DefaultStateCookieMaxAge = 10 * time.Minute
+)
+
+// CookieStateStore is a StateStore that stores the state in a cookie. The
+// cookie is only sent over HTTPS unless Insecure is set.
+type CookieStateStore struct {
+	// Name is the name of the cookie. If empty, DefaultStateCookieName is
+	// used.
+	Name string
+
+	// MaxAge is how long the user has to complete the auth flow. If zero,
+	// DefaultStateCookieMaxAge is used.
+	MaxAge time.Duration
+
+	// Insecure allows the cookie to be sent over HTTP. Use this only for
+	// local development.
+	Insecure bool
+}
+
+func (s *CookieStateStore) GenerateState(w http.ResponseWriter, r *http.Request) (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate state value")
+	}
+	state := hex.EncodeToString(b)
+
+	maxAge := s.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultStateCookieMaxAge
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.name(),
+		Value:    state,
+		Path:     r.URL.Path,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   !s.Insecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return state, nil
+}
+
+func (s *CookieStateStore) VerifyState(r *http.Request, expected string) (bool, error) {
+	if expected == "" {
+		return false, nil
+	}
+
+	c, err := r.Cookie(s.name())
+	if err != nil {
+		if err == http.ErrNoCookie {
+			return false, nil
+		}
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(c.Value)) == 1, nil
+}
+
+func (s *CookieStateStore) name() string {
+	if s.Name == "" {
+		return DefaultStateCookieName
+	}
+	return s.Name
+}
+
 const (
 	insecureState = "insecure-for-testing-only"
 )